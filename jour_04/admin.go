@@ -0,0 +1,52 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// adminKey marque dans le contexte Gin une requête authentifiée admin
+const adminKey = "admin"
+
+// AdminAuthMiddleware protège les routes /admin avec un token Bearer
+// lu dans ADMIN_TOKEN. Sans ADMIN_TOKEN, l'administration est désactivée.
+func AdminAuthMiddleware() gin.HandlerFunc {
+	expected := os.Getenv("ADMIN_TOKEN")
+
+	return func(c *gin.Context) {
+		if expected == "" {
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"error": "Administration désactivée (ADMIN_TOKEN non défini)",
+			})
+			c.Abort()
+			return
+		}
+
+		token := c.GetHeader("Authorization")
+		if token == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token d'authentification requis"})
+			c.Abort()
+			return
+		}
+
+		parts := strings.SplitN(token, " ", 2)
+		if len(parts) != 2 || parts[0] != "Bearer" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Format de token invalide. Utilisez: Bearer <token>"})
+			c.Abort()
+			return
+		}
+
+		if subtle.ConstantTimeCompare([]byte(parts[1]), []byte(expected)) != 1 {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token invalide"})
+			c.Abort()
+			return
+		}
+
+		c.Set(adminKey, true)
+		c.Next()
+	}
+}
@@ -0,0 +1,517 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mattn/go-sqlite3"
+	"gorm.io/gorm"
+)
+
+// === SAUVEGARDES ===
+//
+// Deux formats, écrits dans BACKUP_DIR avec une somme SHA-256 à côté
+// (<fichier>.sha256, vérifiable avec `sha256sum -c`) :
+//   - sqlite : copie du fichier par l'API de sauvegarde en ligne de SQLite,
+//     cohérente pendant que l'API sert des requêtes
+//   - ndjson : export logique de tous les modèles (export.go), pour tous
+//     les drivers, rechargeable dans un autre moteur
+//
+// Une sauvegarde se lance par POST /admin/backups, par `jour04 backup` ou
+// toutes les BACKUP_INTERVAL ; les BACKUP_KEEP plus récentes de chaque
+// format sont gardées.
+//
+// `jour04 restore <fichier>` vérifie la somme puis :
+//   - .db : contrôle l'intégrité d'une copie, puis la met à la place du
+//     fichier de la base (serveur arrêté) ; l'ancien fichier est gardé
+//   - .ndjson.gz : valide tout l'export, puis remplace les lignes de la
+//     base en une transaction (tous drivers)
+
+const (
+	BackupSQLite = "sqlite"
+	BackupNDJSON = "ndjson"
+)
+
+var (
+	ErrBackupRunning     = errors.New("sauvegarde déjà en cours")
+	ErrBackupUnsupported = errors.New("sauvegarde sqlite réservée au driver SQLite (utiliser ndjson)")
+	ErrChecksum          = errors.New("somme de contrôle invalide")
+)
+
+// backupExtensions : extension des fichiers de chaque format
+var backupExtensions = map[string]string{
+	BackupSQLite: ".db",
+	BackupNDJSON: ".ndjson.gz",
+}
+
+type BackupConfig struct {
+	Dir  string // BACKUP_DIR, "backups" par défaut
+	Keep int    // BACKUP_KEEP, 7 par défaut (par format)
+}
+
+func loadBackupConfig() BackupConfig {
+	cfg := BackupConfig{Dir: os.Getenv("BACKUP_DIR"), Keep: 7}
+	if cfg.Dir == "" {
+		cfg.Dir = "backups"
+	}
+	if n, err := strconv.Atoi(os.Getenv("BACKUP_KEEP")); err == nil && n > 0 {
+		cfg.Keep = n
+	}
+	return cfg
+}
+
+// backupInterval retourne 0 si les sauvegardes périodiques sont désactivées
+// (par défaut)
+func backupInterval() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("BACKUP_INTERVAL")); err == nil && d > 0 {
+		return d
+	}
+	return 0
+}
+
+// BackupInfo décrit un fichier de sauvegarde
+type BackupInfo struct {
+	Name      string    `json:"name"`
+	Kind      string    `json:"kind"`
+	Size      int64     `json:"size"`
+	SHA256    string    `json:"sha256"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type BackupManager struct {
+	db    *gorm.DB
+	dbCfg DBConfig
+	cfg   BackupConfig
+	mu    sync.Mutex // une sauvegarde à la fois
+}
+
+func NewBackupManager(conn *gorm.DB, dbCfg DBConfig, cfg BackupConfig) *BackupManager {
+	return &BackupManager{db: conn, dbCfg: dbCfg, cfg: cfg}
+}
+
+// DefaultKind : sqlite sur SQLite, ndjson sinon
+func (m *BackupManager) DefaultKind() string {
+	if m.dbCfg.Driver == "sqlite" {
+		return BackupSQLite
+	}
+	return BackupNDJSON
+}
+
+// Run écrit une sauvegarde du format kind, sa somme de contrôle, puis
+// applique la rétention ; ErrBackupRunning si une autre est en cours
+func (m *BackupManager) Run(ctx context.Context, kind string) (*BackupInfo, error) {
+	ext, ok := backupExtensions[kind]
+	if !ok {
+		return nil, fmt.Errorf("format de sauvegarde inconnu: %q (sqlite, ndjson)", kind)
+	}
+	if kind == BackupSQLite && m.dbCfg.Driver != "sqlite" {
+		return nil, ErrBackupUnsupported
+	}
+	if !m.mu.TryLock() {
+		return nil, ErrBackupRunning
+	}
+	defer m.mu.Unlock()
+
+	if err := os.MkdirAll(m.cfg.Dir, 0o755); err != nil {
+		return nil, err
+	}
+	created := time.Now().UTC()
+	name := "afaapay-" + created.Format("20060102T150405.000Z") + ext
+	path := filepath.Join(m.cfg.Dir, name)
+
+	// Écrit sous un nom temporaire : une sauvegarde interrompue n'est
+	// jamais listée ni restaurée
+	tmp := path + ".tmp"
+	defer os.Remove(tmp)
+	switch kind {
+	case BackupSQLite:
+		if err := backupSQLite(ctx, m.dbCfg, tmp); err != nil {
+			return nil, fmt.Errorf("sauvegarde sqlite: %w", err)
+		}
+	case BackupNDJSON:
+		if err := exportToFile(ctx, m.db, m.dbCfg, tmp); err != nil {
+			return nil, fmt.Errorf("export ndjson: %w", err)
+		}
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return nil, err
+	}
+	sum, err := writeChecksum(path)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &BackupInfo{Name: name, Kind: kind, SHA256: sum, CreatedAt: created}
+	if st, err := os.Stat(path); err == nil {
+		info.Size = st.Size()
+	}
+	if err := m.prune(kind); err != nil {
+		fmt.Printf("[BACKUP] Rétention : %v\n", err)
+	}
+	return info, nil
+}
+
+// List retourne les sauvegardes de BACKUP_DIR, les plus récentes d'abord
+func (m *BackupManager) List() ([]BackupInfo, error) {
+	entries, err := os.ReadDir(m.cfg.Dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return []BackupInfo{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	backups := []BackupInfo{}
+	for _, e := range entries {
+		kind := backupKind(e.Name())
+		if kind == "" || !strings.HasPrefix(e.Name(), "afaapay-") {
+			continue
+		}
+		info := BackupInfo{Name: e.Name(), Kind: kind}
+		if st, err := e.Info(); err == nil {
+			info.Size, info.CreatedAt = st.Size(), st.ModTime().UTC()
+		}
+		if sum, _, err := readChecksum(filepath.Join(m.cfg.Dir, e.Name())); err == nil {
+			info.SHA256 = sum
+		}
+		backups = append(backups, info)
+	}
+	// Les noms portent la date (UTC) : l'ordre alphabétique est chronologique
+	sort.Slice(backups, func(i, j int) bool { return backups[i].Name > backups[j].Name })
+	return backups, nil
+}
+
+// prune supprime les sauvegardes de kind au-delà des BACKUP_KEEP plus récentes
+func (m *BackupManager) prune(kind string) error {
+	backups, err := m.List()
+	if err != nil {
+		return err
+	}
+	kept := 0
+	var errs []error
+	for _, b := range backups {
+		if b.Kind != kind {
+			continue
+		}
+		if kept++; kept <= m.cfg.Keep {
+			continue
+		}
+		path := filepath.Join(m.cfg.Dir, b.Name)
+		errs = append(errs, os.Remove(path))
+		if err := os.Remove(path + ".sha256"); err != nil && !errors.Is(err, os.ErrNotExist) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Watch sauvegarde à intervalle régulier dans le format par défaut
+func (m *BackupManager) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			info, err := m.Run(ctx, m.DefaultKind())
+			if err != nil {
+				fmt.Printf("[BACKUP] Erreur: %v\n", err)
+				continue
+			}
+			fmt.Printf("[BACKUP] %s (%d octets)\n", info.Name, info.Size)
+		}
+	}
+}
+
+// backupKind : format d'un fichier d'après son extension, vide sinon
+func backupKind(name string) string {
+	for kind, ext := range backupExtensions {
+		if strings.HasSuffix(name, ext) {
+			return kind
+		}
+	}
+	return ""
+}
+
+// --- SQLite ---
+
+// backupSQLite copie la base SQLite de cfg dans dest par l'API de
+// sauvegarde en ligne, sur des connexions à part (le pool de l'API, d'une
+// seule connexion sous SQLite, reste libre). La copie se fait en une étape,
+// sous un seul instantané de lecture : elle est cohérente et, avec le
+// journal WAL, ne bloque pas les écritures.
+func backupSQLite(ctx context.Context, cfg DBConfig, dest string) error {
+	src, err := sql.Open("sqlite3", withSQLitePragmas(cfg.DSN, cfg.BusyTimeout))
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := sql.Open("sqlite3", dest)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	srcConn, err := src.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer srcConn.Close()
+	dstConn, err := dst.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer dstConn.Close()
+
+	return dstConn.Raw(func(d interface{}) error {
+		return srcConn.Raw(func(s interface{}) error {
+			bk, err := d.(*sqlite3.SQLiteConn).Backup("main", s.(*sqlite3.SQLiteConn), "main")
+			if err != nil {
+				return err
+			}
+			if _, err := bk.Step(-1); err != nil {
+				bk.Finish()
+				return err
+			}
+			return bk.Finish()
+		})
+	})
+}
+
+// sqliteFilePath : chemin du fichier d'un DSN SQLite, vide pour une base
+// en mémoire
+func sqliteFilePath(dsn string) string {
+	path, _, _ := strings.Cut(strings.TrimPrefix(dsn, "file:"), "?")
+	if path == ":memory:" {
+		return ""
+	}
+	return path
+}
+
+// restoreSQLiteFile remplace le fichier de la base par la sauvegarde
+// backup, après contrôle d'une copie ; retourne le chemin où l'ancien
+// fichier est gardé (vide s'il n'existait pas). Le serveur doit être arrêté.
+func restoreSQLiteFile(ctx context.Context, backup string, cfg DBConfig) (string, error) {
+	target := sqliteFilePath(cfg.DSN)
+	if target == "" {
+		return "", errors.New("base SQLite en mémoire : rien à restaurer")
+	}
+
+	// 1. Copie à côté de la base (même système de fichiers : rename atomique)
+	candidate := target + ".restore"
+	defer removeSQLiteFiles(candidate)
+	if err := copyFile(backup, candidate); err != nil {
+		return "", err
+	}
+
+	// 2. Contrôles sur la copie
+	if err := checkSQLiteFile(ctx, candidate); err != nil {
+		return "", fmt.Errorf("sauvegarde %s refusée: %w", filepath.Base(backup), err)
+	}
+
+	// 3. Échange : l'ancienne base (et son journal WAL) est gardée
+	previous := ""
+	if _, err := os.Stat(target); err == nil {
+		previous = target + ".pre-restore-" + time.Now().UTC().Format("20060102T150405Z")
+		for _, suffix := range []string{"", "-wal", "-shm"} {
+			if err := os.Rename(target+suffix, previous+suffix); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return "", err
+			}
+		}
+	}
+	return previous, os.Rename(candidate, target)
+}
+
+// checkSQLiteFile vérifie l'intégrité du fichier et que son schéma est connu
+// de ce binaire
+func checkSQLiteFile(ctx context.Context, path string) error {
+	conn, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var result string
+	if err := conn.QueryRowContext(ctx, "PRAGMA integrity_check").Scan(&result); err != nil {
+		return err
+	}
+	if result != "ok" {
+		return fmt.Errorf("intégrité : %s", result)
+	}
+
+	var version sql.NullString
+	if err := conn.QueryRowContext(ctx, "SELECT MAX(version) FROM schema_migrations").Scan(&version); err != nil {
+		return fmt.Errorf("table schema_migrations illisible : %w", err)
+	}
+	migrations, err := loadMigrations(migrationFiles, "sqlite")
+	if err != nil {
+		return err
+	}
+	if latest := migrations[len(migrations)-1].Version; version.String > latest {
+		return fmt.Errorf("schéma %s plus récent que ce binaire (%s)", version.String, latest)
+	}
+	return nil
+}
+
+func removeSQLiteFiles(path string) {
+	for _, suffix := range []string{"", "-wal", "-shm"} {
+		os.Remove(path + suffix)
+	}
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// exportToFile écrit un export NDJSON compressé dans path
+func exportToFile(ctx context.Context, conn *gorm.DB, cfg DBConfig, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := exportNDJSON(ctx, conn, cfg, f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// --- Sommes de contrôle ---
+
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// writeChecksum écrit <path>.sha256 au format de sha256sum
+func writeChecksum(path string) (string, error) {
+	sum, err := fileSHA256(path)
+	if err != nil {
+		return "", err
+	}
+	line := sum + "  " + filepath.Base(path) + "\n"
+	return sum, os.WriteFile(path+".sha256", []byte(line), 0o644)
+}
+
+// readChecksum lit <path>.sha256 ; ok est faux si le fichier n'existe pas
+func readChecksum(path string) (sum string, ok bool, err error) {
+	raw, err := os.ReadFile(path + ".sha256")
+	if errors.Is(err, os.ErrNotExist) {
+		return "", false, err
+	}
+	if err != nil {
+		return "", false, err
+	}
+	fields := strings.Fields(string(raw))
+	if len(fields) == 0 {
+		return "", false, fmt.Errorf("%w: %s.sha256 vide", ErrChecksum, filepath.Base(path))
+	}
+	return fields[0], true, nil
+}
+
+// verifyChecksum compare path à <path>.sha256 ; ok est faux sans fichier
+// de somme (rien à vérifier)
+func verifyChecksum(path string) (ok bool, err error) {
+	want, ok, err := readChecksum(path)
+	if !ok {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	got, err := fileSHA256(path)
+	if err != nil {
+		return false, err
+	}
+	if got != want {
+		return false, fmt.Errorf("%w: %s (attendu %s, calculé %s)", ErrChecksum, filepath.Base(path), want, got)
+	}
+	return true, nil
+}
+
+// === ADMIN HANDLER ===
+
+type BackupHandler struct {
+	backups *BackupManager
+}
+
+func NewBackupHandler(backups *BackupManager) *BackupHandler {
+	return &BackupHandler{backups: backups}
+}
+
+// GET /admin/backups - sauvegardes de BACKUP_DIR
+func (h *BackupHandler) List(c *gin.Context) {
+	backups, err := h.backups.List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Lecture des sauvegardes impossible"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"dir": h.backups.cfg.Dir, "keep": h.backups.cfg.Keep, "backups": backups})
+}
+
+// POST /admin/backups?kind=sqlite|ndjson (sqlite par défaut sur SQLite)
+func (h *BackupHandler) Create(c *gin.Context) {
+	kind := c.DefaultQuery("kind", h.backups.DefaultKind())
+	if _, ok := backupExtensions[kind]; !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "kind doit valoir sqlite ou ndjson"})
+		return
+	}
+
+	info, err := h.backups.Run(c.Request.Context(), kind)
+	switch {
+	case errors.Is(err, ErrBackupUnsupported):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrBackupRunning):
+		c.JSON(http.StatusConflict, gin.H{"error": "Une sauvegarde est déjà en cours"})
+	case err != nil:
+		fmt.Printf("[BACKUP] Erreur: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur de sauvegarde"})
+	default:
+		c.JSON(http.StatusCreated, info)
+	}
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/sync/singleflight"
+)
+
+// === CACHE EN LECTURE ===
+//
+// Les lectures d'un utilisateur ou d'un post par ID passent par un cache
+// (read-through) : en cas d'absence, l'enregistrement est lu sur le primaire
+// puis gardé CACHE_TTL. Deux implémentations de Cache :
+//   - memory : LRU en mémoire du processus (CACHE_SIZE entrées)
+//   - redis  : serveur Redis (REDIS_URL), partagé entre les instances
+//
+// Une écriture (mise à jour, corbeille, restauration, commentaire) invalide
+// les clés concernées après la validation de son unité de travail. Avec
+// plusieurs instances, seul Redis voit les invalidations de toutes : un LRU
+// par instance peut servir une valeur périmée jusqu'à CACHE_TTL.
+//
+// Les lectures faites dans une unité de travail ne passent pas par le cache
+// (elles doivent voir la transaction). Les lectures simultanées d'une même
+// clé absente sont regroupées (singleflight) : une seule requête en base.
+
+// Cache stocke des valeurs sérialisées ; une erreur de Get est traitée comme
+// une absence, le cache ne devant jamais faire échouer une lecture
+type Cache interface {
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Delete(ctx context.Context, keys ...string) error
+	// Name : "memory" ou "redis"
+	Name() string
+}
+
+// newCache construit le cache choisi par CACHE (memory par défaut, redis,
+// off) ; nil avec CACHE=off
+func newCache() (Cache, error) {
+	switch driver := strings.ToLower(os.Getenv("CACHE")); driver {
+	case "", "memory":
+		size := 10000
+		if n, err := strconv.Atoi(os.Getenv("CACHE_SIZE")); err == nil && n > 0 {
+			size = n
+		}
+		return NewLRUCache(size), nil
+	case "redis":
+		return newRedisCacheFromEnv()
+	case "off", "none":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("CACHE inconnu: %q (memory, redis, off)", driver)
+	}
+}
+
+// cacheTTL : CACHE_TTL, 1 minute par défaut
+func cacheTTL() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("CACHE_TTL")); err == nil && d > 0 {
+		return d
+	}
+	return time.Minute
+}
+
+// --- LRU ---
+
+type lruCache struct {
+	mu        sync.Mutex
+	max       int
+	ll        *list.List // tête = utilisée le plus récemment
+	items     map[string]*list.Element
+	evictions atomic.Int64
+}
+
+type lruEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+func NewLRUCache(max int) *lruCache {
+	return &lruCache{max: max, ll: list.New(), items: map[string]*list.Element{}}
+}
+
+func (c *lruCache) Name() string { return "memory" }
+
+func (c *lruCache) Get(_ context.Context, key string) ([]byte, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false, nil
+	}
+	entry := el.Value.(*lruEntry)
+	if time.Now().After(entry.expires) {
+		c.ll.Remove(el)
+		delete(c.items, key)
+		return nil, false, nil
+	}
+	c.ll.MoveToFront(el)
+	return entry.value, true, nil
+}
+
+func (c *lruCache) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expires := time.Now().Add(ttl)
+	if el, ok := c.items[key]; ok {
+		entry := el.Value.(*lruEntry)
+		entry.value, entry.expires = value, expires
+		c.ll.MoveToFront(el)
+		return nil
+	}
+	c.items[key] = c.ll.PushFront(&lruEntry{key: key, value: value, expires: expires})
+	for c.ll.Len() > c.max {
+		oldest := c.ll.Back()
+		c.ll.Remove(oldest)
+		delete(c.items, oldest.Value.(*lruEntry).key)
+		c.evictions.Add(1)
+	}
+	return nil
+}
+
+func (c *lruCache) Delete(_ context.Context, keys ...string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, key := range keys {
+		if el, ok := c.items[key]; ok {
+			c.ll.Remove(el)
+			delete(c.items, key)
+		}
+	}
+	return nil
+}
+
+// Stats : taille et évictions pour GET /admin/cache
+func (c *lruCache) Stats() gin.H {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return gin.H{"entries": c.ll.Len(), "max_entries": c.max, "evictions": c.evictions.Load()}
+}
+
+// --- Read-through ---
+
+type ReadThrough struct {
+	cache Cache
+	ttl   time.Duration
+	group singleflight.Group
+
+	// epoch change à chaque invalidation : une lecture commencée avant
+	// n'écrit pas sa valeur (peut-être périmée) dans le cache
+	epoch atomic.Uint64
+
+	hits, misses, coalesced, sets, invalidations, errors atomic.Int64
+}
+
+func NewReadThrough(cache Cache, ttl time.Duration) *ReadThrough {
+	return &ReadThrough{cache: cache, ttl: ttl}
+}
+
+// cacheKey : "<type>:<tenant>:<id>" ; false sans tenant (pas de cache)
+func cacheKey(ctx context.Context, kind string, id uint) (string, bool) {
+	tenant, ok := tenantOf(ctx)
+	if !ok {
+		return "", false
+	}
+	return kind + ":" + tenant + ":" + strconv.FormatUint(uint64(id), 10), true
+}
+
+// Fetch remplit dest (pointeur) depuis le cache, sinon avec load puis met la
+// valeur en cache. Les erreurs de load (ErrNotFound...) ne sont pas mises en
+// cache. load lit sur le primaire : un réplica en retard ne remplit pas le
+// cache avec une valeur que l'invalidation vient de retirer.
+func (rt *ReadThrough) Fetch(ctx context.Context, key string, dest interface{},
+	load func(ctx context.Context, dest interface{}) error) error {
+	if inUnitOfWork(ctx) {
+		return load(ctx, dest)
+	}
+
+	// X-Read-Your-Writes : lecture fraîche, qui remplit tout de même le cache
+	group := key
+	if forced, _ := ctx.Value(primaryKey{}).(bool); forced {
+		group = "primary:" + key
+	} else if data, ok := rt.get(ctx, key); ok && json.Unmarshal(data, dest) == nil {
+		rt.hits.Add(1)
+		return nil
+	}
+	rt.misses.Add(1)
+
+	leader := false
+	data, err, _ := rt.group.Do(group, func() (interface{}, error) {
+		leader = true
+		epoch := rt.epoch.Load()
+		// Sans annulation : les lectures regroupées ne dépendent pas de la
+		// requête qui a lancé le chargement
+		if err := load(usePrimary(context.WithoutCancel(ctx)), dest); err != nil {
+			return nil, err
+		}
+		data, err := json.Marshal(dest)
+		if err != nil {
+			return nil, err
+		}
+		if rt.epoch.Load() == epoch {
+			rt.set(ctx, key, data)
+		}
+		return data, nil
+	})
+	if err != nil || leader {
+		return err
+	}
+	rt.coalesced.Add(1)
+	return json.Unmarshal(data.([]byte), dest)
+}
+
+// Invalidate retire les clés après la validation de l'unité de travail en
+// cours (tout de suite hors unité de travail)
+func (rt *ReadThrough) Invalidate(ctx context.Context, keys ...string) {
+	if len(keys) == 0 {
+		return
+	}
+	afterCommit(ctx, func() {
+		rt.epoch.Add(1)
+		rt.invalidations.Add(int64(len(keys)))
+		if err := rt.cache.Delete(context.WithoutCancel(ctx), keys...); err != nil {
+			rt.errors.Add(1)
+			fmt.Printf("[CACHE] Invalidation impossible (%s) : %v\n", strings.Join(keys, ", "), err)
+		}
+	})
+}
+
+func (rt *ReadThrough) get(ctx context.Context, key string) ([]byte, bool) {
+	data, ok, err := rt.cache.Get(ctx, key)
+	if err != nil {
+		rt.errors.Add(1)
+		fmt.Printf("[CACHE] Lecture impossible (%s) : %v\n", key, err)
+		return nil, false
+	}
+	return data, ok
+}
+
+func (rt *ReadThrough) set(ctx context.Context, key string, data []byte) {
+	if err := rt.cache.Set(context.WithoutCancel(ctx), key, data, rt.ttl); err != nil {
+		rt.errors.Add(1)
+		fmt.Printf("[CACHE] Écriture impossible (%s) : %v\n", key, err)
+		return
+	}
+	rt.sets.Add(1)
+}
+
+// Stats : compteurs depuis le démarrage
+func (rt *ReadThrough) Stats() gin.H {
+	hits, misses := rt.hits.Load(), rt.misses.Load()
+	ratio := 0.0
+	if hits+misses > 0 {
+		ratio = float64(hits) / float64(hits+misses)
+	}
+	stats := gin.H{
+		"driver":        rt.cache.Name(),
+		"ttl":           rt.ttl.String(),
+		"hits":          hits,
+		"misses":        misses,
+		"hit_ratio":     ratio,
+		"coalesced":     rt.coalesced.Load(),
+		"sets":          rt.sets.Load(),
+		"invalidations": rt.invalidations.Load(),
+		"errors":        rt.errors.Load(),
+	}
+	if s, ok := rt.cache.(interface{ Stats() gin.H }); ok {
+		for k, v := range s.Stats() {
+			stats[k] = v
+		}
+	}
+	return stats
+}
+
+// === ADMIN HANDLER ===
+
+type CacheHandler struct {
+	rt *ReadThrough
+}
+
+// rt peut être nil (CACHE=off)
+func NewCacheHandler(rt *ReadThrough) *CacheHandler {
+	return &CacheHandler{rt: rt}
+}
+
+// GET /admin/cache - succès, absences et invalidations du cache
+func (h *CacheHandler) Stats(c *gin.Context) {
+	if h.rt == nil {
+		c.JSON(http.StatusOK, gin.H{"driver": "off"})
+		return
+	}
+	c.JSON(http.StatusOK, h.rt.Stats())
+}
@@ -0,0 +1,370 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// === CACHE REDIS ===
+//
+// Client minimal du protocole Redis (RESP2) : GET, SET PX, DEL, avec AUTH et
+// SELECT à la connexion et un petit pool de connexions. REDIS_URL :
+//   redis://[:motdepasse@]hôte:6379/0
+//   fake    serveur simulé dans le processus (FakeRedis), pour les tests
+//
+// REDIS_TIMEOUT (250ms par défaut) borne chaque commande : un Redis lent ou
+// absent dégrade en lectures directes sur la base, sans faire échouer l'API.
+
+const redisKeyPrefix = "jour04:"
+
+type redisCache struct {
+	addr     string
+	password string
+	db       int
+	timeout  time.Duration
+	idle     chan *redisConn
+}
+
+type redisConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+var errRedisNil = errors.New("redis: nil")
+
+func newRedisCacheFromEnv() (Cache, error) {
+	raw := os.Getenv("REDIS_URL")
+	if raw == "" {
+		return nil, errors.New("REDIS_URL requis avec CACHE=redis")
+	}
+	if raw == "fake" {
+		fake, err := NewFakeRedis("127.0.0.1:0")
+		if err != nil {
+			return nil, err
+		}
+		fmt.Printf("🧪 Redis simulé sur %s (REDIS_URL=fake)\n", fake.Addr())
+		raw = "redis://" + fake.Addr()
+	}
+
+	timeout := 250 * time.Millisecond
+	if d, err := time.ParseDuration(os.Getenv("REDIS_TIMEOUT")); err == nil && d > 0 {
+		timeout = d
+	}
+	return NewRedisCache(raw, timeout)
+}
+
+func NewRedisCache(rawURL string, timeout time.Duration) (*redisCache, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme != "redis" || u.Host == "" {
+		return nil, fmt.Errorf("REDIS_URL invalide: %q (redis://[:motdepasse@]hôte:port/base)", rawURL)
+	}
+	c := &redisCache{addr: u.Host, timeout: timeout, idle: make(chan *redisConn, 10)}
+	if u.Port() == "" {
+		c.addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if password, ok := u.User.Password(); ok {
+		c.password = password
+	}
+	if path := strings.TrimPrefix(u.Path, "/"); path != "" {
+		if c.db, err = strconv.Atoi(path); err != nil {
+			return nil, fmt.Errorf("REDIS_URL : base invalide %q", path)
+		}
+	}
+	return c, nil
+}
+
+func (c *redisCache) Name() string { return "redis" }
+
+func (c *redisCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	reply, err := c.do(ctx, "GET", redisKeyPrefix+key)
+	if errors.Is(err, errRedisNil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return reply.([]byte), true, nil
+}
+
+func (c *redisCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	px := max(ttl.Milliseconds(), 1)
+	_, err := c.do(ctx, "SET", redisKeyPrefix+key, string(value), "PX", strconv.FormatInt(px, 10))
+	return err
+}
+
+func (c *redisCache) Delete(ctx context.Context, keys ...string) error {
+	args := []string{"DEL"}
+	for _, key := range keys {
+		args = append(args, redisKeyPrefix+key)
+	}
+	_, err := c.do(ctx, args...)
+	return err
+}
+
+// do envoie une commande et lit sa réponse. Une connexion en erreur est
+// fermée, pas remise dans le pool (elle peut contenir une réponse partielle).
+func (c *redisCache) do(ctx context.Context, args ...string) (interface{}, error) {
+	conn, err := c.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(c.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+
+	reply, err := conn.command(args...)
+	if err != nil && !errors.Is(err, errRedisNil) && !isRedisError(err) {
+		conn.Close()
+		return nil, err
+	}
+	select {
+	case c.idle <- conn:
+	default:
+		conn.Close()
+	}
+	return reply, err
+}
+
+// conn retourne une connexion du pool ou en ouvre une (AUTH, SELECT)
+func (c *redisCache) conn(ctx context.Context) (*redisConn, error) {
+	select {
+	case conn := <-c.idle:
+		return conn, nil
+	default:
+	}
+
+	dialer := net.Dialer{Timeout: c.timeout}
+	netConn, err := dialer.DialContext(ctx, "tcp", c.addr)
+	if err != nil {
+		return nil, err
+	}
+	conn := &redisConn{Conn: netConn, r: bufio.NewReader(netConn)}
+	conn.SetDeadline(time.Now().Add(c.timeout))
+
+	var setup [][]string
+	if c.password != "" {
+		setup = append(setup, []string{"AUTH", c.password})
+	}
+	if c.db != 0 {
+		setup = append(setup, []string{"SELECT", strconv.Itoa(c.db)})
+	}
+	for _, args := range setup {
+		if _, err := conn.command(args...); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("redis %s: %w", args[0], err)
+		}
+	}
+	return conn, nil
+}
+
+// command écrit une commande RESP (tableau de chaînes) et lit la réponse
+func (conn *redisConn) command(args ...string) (interface{}, error) {
+	if _, err := conn.Write(encodeRESPCommand(args)); err != nil {
+		return nil, err
+	}
+	return readRESP(conn.r)
+}
+
+func encodeRESPCommand(args []string) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	return []byte(b.String())
+}
+
+// redisError : réponse d'erreur du serveur (-ERR ...) ; la connexion reste
+// utilisable
+type redisError string
+
+func (e redisError) Error() string { return string(e) }
+
+func isRedisError(err error) bool {
+	var re redisError
+	return errors.As(err, &re)
+}
+
+// readRESP lit une réponse : string (+), erreur (-), entier (:), chaîne
+// binaire ($, errRedisNil si absente) ou tableau (*)
+func readRESP(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || !strings.HasSuffix(line, "\r\n") {
+		return nil, fmt.Errorf("redis: réponse invalide %q", line)
+	}
+	kind, payload := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+':
+		return payload, nil
+	case '-':
+		return nil, redisError(payload)
+	case ':':
+		return strconv.ParseInt(payload, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(payload)
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, errRedisNil
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		return data[:n], nil
+	case '*':
+		n, err := strconv.Atoi(payload)
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, errRedisNil
+		}
+		items := make([]interface{}, n)
+		for i := range items {
+			if items[i], err = readRESP(r); err != nil && !errors.Is(err, errRedisNil) {
+				return nil, err
+			}
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("redis: type de réponse inconnu %q", kind)
+}
+
+// === REDIS SIMULÉ ===
+
+// FakeRedis est un serveur RESP en mémoire (GET, SET [EX|PX], DEL, PING,
+// AUTH, SELECT, DBSIZE, FLUSHDB) : le client Redis se teste sans serveur
+// Redis. Une seule base ; AUTH et SELECT sont acceptés sans effet.
+type FakeRedis struct {
+	listener net.Listener
+
+	mu   sync.Mutex
+	data map[string]fakeRedisEntry
+}
+
+type fakeRedisEntry struct {
+	value   []byte
+	expires time.Time // zéro = sans expiration
+}
+
+// NewFakeRedis écoute sur addr ("127.0.0.1:0" pour un port libre)
+func NewFakeRedis(addr string) (*FakeRedis, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	f := &FakeRedis{listener: listener, data: map[string]fakeRedisEntry{}}
+	go f.serve()
+	return f, nil
+}
+
+func (f *FakeRedis) Addr() string { return f.listener.Addr().String() }
+
+func (f *FakeRedis) Close() error { return f.listener.Close() }
+
+func (f *FakeRedis) serve() {
+	for {
+		conn, err := f.listener.Accept()
+		if err != nil {
+			return
+		}
+		go f.handle(conn)
+	}
+}
+
+func (f *FakeRedis) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		request, err := readRESP(r)
+		if err != nil {
+			return
+		}
+		items, ok := request.([]interface{})
+		if !ok || len(items) == 0 {
+			conn.Write([]byte("-ERR commande invalide\r\n"))
+			continue
+		}
+		args := make([]string, len(items))
+		for i, item := range items {
+			b, _ := item.([]byte)
+			args[i] = string(b)
+		}
+		if _, err := conn.Write(f.exec(args)); err != nil {
+			return
+		}
+	}
+}
+
+// exec exécute une commande et retourne la réponse encodée
+func (f *FakeRedis) exec(args []string) []byte {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch cmd := strings.ToUpper(args[0]); {
+	case cmd == "PING":
+		return []byte("+PONG\r\n")
+	case cmd == "AUTH" || cmd == "SELECT":
+		return []byte("+OK\r\n")
+	case cmd == "FLUSHDB":
+		f.data = map[string]fakeRedisEntry{}
+		return []byte("+OK\r\n")
+	case cmd == "DBSIZE":
+		return []byte(":" + strconv.Itoa(len(f.data)) + "\r\n")
+	case cmd == "GET" && len(args) == 2:
+		entry, ok := f.data[args[1]]
+		if !ok || (!entry.expires.IsZero() && time.Now().After(entry.expires)) {
+			delete(f.data, args[1])
+			return []byte("$-1\r\n")
+		}
+		return []byte("$" + strconv.Itoa(len(entry.value)) + "\r\n" + string(entry.value) + "\r\n")
+	case cmd == "SET" && (len(args) == 3 || len(args) == 5):
+		entry := fakeRedisEntry{value: []byte(args[2])}
+		if len(args) == 5 {
+			n, err := strconv.ParseInt(args[4], 10, 64)
+			if err != nil || n <= 0 {
+				return []byte("-ERR invalid expire time in 'set' command\r\n")
+			}
+			switch strings.ToUpper(args[3]) {
+			case "EX":
+				entry.expires = time.Now().Add(time.Duration(n) * time.Second)
+			case "PX":
+				entry.expires = time.Now().Add(time.Duration(n) * time.Millisecond)
+			default:
+				return []byte("-ERR syntax error\r\n")
+			}
+		}
+		f.data[args[1]] = entry
+		return []byte("+OK\r\n")
+	case cmd == "DEL" && len(args) > 1:
+		deleted := 0
+		for _, key := range args[1:] {
+			if _, ok := f.data[key]; ok {
+				delete(f.data, key)
+				deleted++
+			}
+		}
+		return []byte(":" + strconv.Itoa(deleted) + "\r\n")
+	default:
+		return []byte("-ERR unknown command '" + args[0] + "'\r\n")
+	}
+}
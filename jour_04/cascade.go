@@ -0,0 +1,347 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// === POLITIQUES DE SUPPRESSION ===
+//
+// La politique est déclarée sur le champ de la relation, dans le modèle parent :
+//
+//	Posts []Post `gorm:"foreignKey:UserID" ondelete:"cascade"`
+//
+//   - cascade  : les enfants sont supprimés (avec leurs propres politiques)
+//   - restrict : la suppression est refusée tant qu'il reste des enfants (409)
+//   - reassign : les enfants sont rattachés à l'enregistrement de remplacement
+//     fourni par le parent (interface Tombstoner)
+//
+// Sans tag ondelete, rien n'est fait côté application. Les lignes des tables
+// de jointure many2many sont toujours supprimées.
+//
+// Un modèle avec un champ gorm.DeletedAt est mis à la corbeille (softDelete) :
+// restrict est vérifié, les enfants cascade qui ont aussi une corbeille y
+// vont avec la même date (et en ressortent ensemble, restoreFromTrash). Tout
+// ce qui est irréversible (reassign, enfants sans corbeille, jointures)
+// attend la purge : deleteWithPolicies sur tx.Unscoped().
+
+const (
+	OnDeleteCascade  = "cascade"
+	OnDeleteRestrict = "restrict"
+	OnDeleteReassign = "reassign"
+)
+
+// Tombstoner est implémenté par les modèles qui acceptent ondelete:"reassign"
+type Tombstoner interface {
+	// Tombstone retourne un pointeur vers l'enregistrement de remplacement,
+	// retrouvé par ses champs non vides ou créé s'il n'existe pas
+	Tombstone() interface{}
+}
+
+// RestrictError signale une suppression bloquée par ondelete:"restrict"
+type RestrictError struct {
+	Relation string
+	Count    int64
+}
+
+func (e *RestrictError) Error() string {
+	return fmt.Sprintf("suppression impossible : %d enregistrement(s) lié(s) via %s", e.Count, e.Relation)
+}
+
+var ErrTombstoneDelete = errors.New("l'enregistrement de remplacement ne peut pas être supprimé")
+
+// onDeletePolicy lit la politique déclarée sur le champ field du modèle
+func onDeletePolicy(model interface{}, field string) string {
+	t := reflect.Indirect(reflect.ValueOf(model)).Type()
+	if f, ok := t.FieldByName(field); ok {
+		return f.Tag.Get("ondelete")
+	}
+	return ""
+}
+
+// parseModel retourne le schéma de model et le nom de sa clé primaire
+func parseModel(tx *gorm.DB, model interface{}) (*schema.Schema, string, error) {
+	stmt := &gorm.Statement{DB: tx}
+	if err := stmt.Parse(model); err != nil {
+		return nil, "", err
+	}
+	sch := stmt.Schema
+	if sch.PrioritizedPrimaryField == nil {
+		return nil, "", fmt.Errorf("%s : clé primaire simple requise", sch.Name)
+	}
+	return sch, sch.PrioritizedPrimaryField.DBName, nil
+}
+
+// deletedAtColumn retourne la colonne gorm.DeletedAt du modèle ("" sans corbeille)
+func deletedAtColumn(sch *schema.Schema) string {
+	for _, f := range sch.Fields {
+		if f.FieldType == reflect.TypeOf(gorm.DeletedAt{}) {
+			return f.DBName
+		}
+	}
+	return ""
+}
+
+// policyRelation : relation portant un tag ondelete, et sa clé étrangère
+type policyRelation struct {
+	*schema.Relationship
+	Policy string
+	FK     string
+}
+
+// policyRelations liste les relations has many / has one du schéma qui
+// déclarent une politique ondelete
+func policyRelations(sch *schema.Schema) ([]policyRelation, error) {
+	var relations []policyRelation
+	for _, rel := range append(append([]*schema.Relationship{}, sch.Relationships.HasMany...), sch.Relationships.HasOne...) {
+		policy := rel.Field.Tag.Get("ondelete")
+		if policy == "" {
+			continue
+		}
+		if len(rel.References) != 1 || rel.References[0].PrimaryKey == nil {
+			return nil, fmt.Errorf("%s.%s : ondelete ne gère que les clés étrangères simples", sch.Name, rel.Name)
+		}
+		switch policy {
+		case OnDeleteCascade, OnDeleteRestrict, OnDeleteReassign:
+		default:
+			return nil, fmt.Errorf("%s.%s : politique ondelete inconnue %q", sch.Name, rel.Name, policy)
+		}
+		relations = append(relations, policyRelation{rel, policy, rel.References[0].ForeignKey.DBName})
+	}
+	return relations, nil
+}
+
+// deleteWithPolicies supprime les enregistrements ids de model après avoir
+// appliqué les politiques de ses relations. À appeler dans une transaction.
+// Un modèle avec corbeille y est mis, sauf sur tx.Unscoped() (purge).
+func deleteWithPolicies(tx *gorm.DB, model interface{}, ids []interface{}) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	sch, pk, err := parseModel(tx, model)
+	if err != nil {
+		return err
+	}
+	if deletedAtColumn(sch) != "" && !tx.Statement.Unscoped {
+		return softDelete(tx, model, ids, tx.NowFunc())
+	}
+	relations, err := policyRelations(sch)
+	if err != nil {
+		return err
+	}
+
+	for _, rel := range relations {
+		child := reflect.New(rel.FieldSchema.ModelType).Interface()
+		fk := rel.FK
+		children := tx.Model(child).Where(fk+" IN ?", ids).Session(&gorm.Session{}) // réutilisable
+
+		switch rel.Policy {
+		case OnDeleteRestrict:
+			var count int64
+			if err := children.Count(&count).Error; err != nil {
+				return err
+			}
+			if count > 0 {
+				return &RestrictError{Relation: sch.Name + "." + rel.Name, Count: count}
+			}
+
+		case OnDeleteCascade:
+			// Pluck sur une purge (Unscoped) : enfants à la corbeille compris
+			var childIDs []interface{}
+			if err := children.Pluck(rel.FieldSchema.PrioritizedPrimaryField.DBName, &childIDs).Error; err != nil {
+				return err
+			}
+			if err := deleteWithPolicies(tx, child, childIDs); err != nil {
+				return err
+			}
+
+		case OnDeleteReassign:
+			var count int64
+			if err := children.Count(&count).Error; err != nil {
+				return err
+			}
+			if count == 0 {
+				continue
+			}
+			tombID, err := tombstoneID(tx, model, true)
+			if err != nil {
+				return err
+			}
+			if containsID(ids, tombID) {
+				return ErrTombstoneDelete
+			}
+			if err := children.Update(fk, tombID).Error; err != nil {
+				return err
+			}
+		}
+	}
+
+	// Les lignes de jointure many2many n'existent que par leurs deux côtés :
+	// elles disparaissent avec l'enregistrement, sans politique à déclarer
+	for _, rel := range sch.Relationships.Many2Many {
+		for _, ref := range rel.References {
+			if !ref.OwnPrimaryKey {
+				continue
+			}
+			err := tx.Exec("DELETE FROM ? WHERE ? IN ?",
+				clause.Table{Name: rel.JoinTable.Table}, clause.Column{Name: ref.ForeignKey.DBName}, ids).Error
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return tx.Where(pk+" IN ?", ids).Delete(model).Error
+}
+
+// softDelete met ids à la corbeille à la date at (voir l'en-tête du fichier)
+func softDelete(tx *gorm.DB, model interface{}, ids []interface{}, at time.Time) error {
+	sch, pk, err := parseModel(tx, model)
+	if err != nil {
+		return err
+	}
+	relations, err := policyRelations(sch)
+	if err != nil {
+		return err
+	}
+
+	for _, rel := range relations {
+		child := reflect.New(rel.FieldSchema.ModelType).Interface()
+		children := tx.Model(child).Where(rel.FK+" IN ?", ids).Session(&gorm.Session{})
+
+		switch rel.Policy {
+		case OnDeleteRestrict:
+			var count int64
+			if err := children.Count(&count).Error; err != nil {
+				return err
+			}
+			if count > 0 {
+				return &RestrictError{Relation: sch.Name + "." + rel.Name, Count: count}
+			}
+
+		case OnDeleteCascade:
+			if deletedAtColumn(rel.FieldSchema) == "" {
+				continue // supprimés à la purge
+			}
+			var childIDs []interface{}
+			if err := children.Pluck(rel.FieldSchema.PrioritizedPrimaryField.DBName, &childIDs).Error; err != nil {
+				return err
+			}
+			if len(childIDs) > 0 {
+				if err := softDelete(tx, child, childIDs, at); err != nil {
+					return err
+				}
+			}
+
+		case OnDeleteReassign:
+			// Réattribution à la purge ; le remplaçant ne peut pas partir à
+			// la corbeille puisqu'il ne pourrait plus en être purgé
+			tombID, err := tombstoneID(tx, model, false)
+			if err != nil {
+				return err
+			}
+			if tombID != nil && containsID(ids, tombID) {
+				return ErrTombstoneDelete
+			}
+		}
+	}
+
+	// UpdateColumn : ni hooks ni updated_at, comme le Delete de GORM
+	return tx.Model(model).Where(pk+" IN ?", ids).UpdateColumn(deletedAtColumn(sch), at).Error
+}
+
+// restoreFromTrash sort id de la corbeille. Avec cascade, les enfants
+// cascade mis à la corbeille en même temps que lui (même deleted_at) en
+// sortent aussi. gorm.ErrRecordNotFound si id n'est pas à la corbeille.
+func restoreFromTrash(tx *gorm.DB, model interface{}, id interface{}, cascade bool) error {
+	sch, pk, err := parseModel(tx, model)
+	if err != nil {
+		return err
+	}
+	deletedAt := deletedAtColumn(sch)
+	if deletedAt == "" {
+		return fmt.Errorf("%s : pas de corbeille (champ gorm.DeletedAt)", sch.Name)
+	}
+
+	var count int64
+	err = tx.Unscoped().Model(model).Where(pk+" = ? AND "+deletedAt+" IS NOT NULL", id).Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	if cascade {
+		relations, err := policyRelations(sch)
+		if err != nil {
+			return err
+		}
+		for _, rel := range relations {
+			childDeletedAt := deletedAtColumn(rel.FieldSchema)
+			if rel.Policy != OnDeleteCascade || childDeletedAt == "" {
+				continue
+			}
+
+			// Comparaison en SQL avec la valeur stockée : pas d'aller-retour
+			// de la date par Go (fuseau, précision selon le driver)
+			parentDeletedAt := tx.Unscoped().Model(model).Select(deletedAt).Where(pk+" = ?", id)
+			child := reflect.New(rel.FieldSchema.ModelType).Interface()
+			var childIDs []interface{}
+			err := tx.Unscoped().Model(child).
+				Where(rel.FK+" = ?", id).
+				Where(childDeletedAt+" = (?)", parentDeletedAt).
+				Pluck(rel.FieldSchema.PrioritizedPrimaryField.DBName, &childIDs).Error
+			if err != nil {
+				return err
+			}
+			for _, childID := range childIDs {
+				if err := restoreFromTrash(tx, child, childID, true); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return tx.Unscoped().Model(model).Where(pk+" = ?", id).UpdateColumn(deletedAt, nil).Error
+}
+
+func containsID(ids []interface{}, id interface{}) bool {
+	return slices.ContainsFunc(ids, func(v interface{}) bool { return fmt.Sprint(v) == fmt.Sprint(id) })
+}
+
+// tombstoneID retrouve l'enregistrement de remplacement du modèle ; s'il
+// n'existe pas, il est créé si create, sinon nil est retourné
+func tombstoneID(tx *gorm.DB, model interface{}, create bool) (interface{}, error) {
+	t, ok := model.(Tombstoner)
+	if !ok {
+		return nil, fmt.Errorf("%T : ondelete:\"reassign\" nécessite l'interface Tombstoner", model)
+	}
+
+	tomb := t.Tombstone()
+	if create {
+		if err := tx.Where(tomb).FirstOrCreate(tomb).Error; err != nil {
+			return nil, err
+		}
+	} else {
+		found := tx.Where(tomb).Limit(1).Find(tomb)
+		if found.Error != nil || found.RowsAffected == 0 {
+			return nil, found.Error
+		}
+	}
+
+	stmt := &gorm.Statement{DB: tx}
+	if err := stmt.Parse(tomb); err != nil {
+		return nil, err
+	}
+	id, _ := stmt.Schema.PrioritizedPrimaryField.ValueOf(tx.Statement.Context, reflect.ValueOf(tomb).Elem())
+	return id, nil
+}
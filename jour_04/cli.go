@@ -0,0 +1,460 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// === SOUS-COMMANDES ===
+//
+//	go run . migrate up [-to V]      applique les migrations en attente (jusqu'à V)
+//	go run . migrate down [-steps N] annule les N dernières (1 par défaut)
+//	go run . migrate status          état de chaque migration
+//	go run . migrate create <nom>    crée les fichiers up/down vides
+//	go run . migrate diff <nom>      (dev) brouillon depuis l'écart modèles/base
+//	go run . reindex                 reconstruit l'index de recherche plein texte
+//	go run . purge [-older-than D]   vide la corbeille (SOFT_DELETE_RETENTION par défaut)
+//	go run . seed [options]          génère des users, posts et commentaires (graine fixe)
+//	go run . seed fichier.yaml ...   charge des fixtures YAML ou JSON
+//	go run . backup [-kind K]        sauvegarde dans BACKUP_DIR (sqlite ou ndjson)
+//	go run . export <fichier>        export logique NDJSON compressé, tous drivers
+//	go run . restore <fichier>       restaure une sauvegarde .db ou un export .ndjson.gz
+//	go run . simulate [options]      simulateur local des API MTN MoMo et Orange Money
+
+// runCommand exécute une sous-commande et retourne le code de sortie
+func runCommand(args []string) int {
+	switch args[0] {
+	case "migrate":
+		return runMigrateCommand(args[1:])
+	case "reindex":
+		return runReindexCommand()
+	case "purge":
+		return runPurgeCommand(args[1:])
+	case "seed":
+		return runSeedCommand(args[1:])
+	case "backup":
+		return runBackupCommand(args[1:])
+	case "export":
+		return runExportCommand(args[1:])
+	case "restore":
+		return runRestoreCommand(args[1:])
+	case "simulate":
+		return runSimulateCommand(args[1:])
+	case "help", "-h", "--help":
+		printUsage()
+		return 0
+	}
+
+	fmt.Fprintf(os.Stderr, "Commande inconnue: %s\n", args[0])
+	printUsage()
+	return 2
+}
+
+func printUsage() {
+	fmt.Fprintln(os.Stderr, `Usage:
+  jour04                          démarre le serveur
+  jour04 migrate up [-to V]       applique les migrations en attente (jusqu'à la version V)
+  jour04 migrate down [-steps N]  annule les N dernières migrations
+  jour04 migrate status           affiche l'état des migrations
+  jour04 migrate create <nom>     crée une migration vide
+  jour04 migrate diff <nom>       (dev) génère un brouillon depuis les modèles
+  jour04 reindex                  reconstruit l'index de recherche plein texte
+  jour04 purge [-older-than D]    supprime définitivement la corbeille plus ancienne que D
+  jour04 seed [-seed N] [-users N] [-posts N] [-comments N] [-tenant T] [-dump fichier]
+                                  génère des données de test reproductibles
+  jour04 seed fichier.yaml ...    charge des fixtures YAML ou JSON
+  jour04 backup [-kind K]         sauvegarde dans BACKUP_DIR (sqlite sur SQLite, ndjson sinon)
+  jour04 export <fichier>         écrit un export NDJSON compressé (.ndjson.gz) et sa somme
+  jour04 restore <fichier>        vérifie puis restaure une sauvegarde .db (SQLite, serveur
+                                  arrêté) ou un export .ndjson.gz (tous drivers)
+  jour04 simulate [-port P] [-latency D] [-callback-delay D] [-failure-rate F] [-callbacks=false]
+                                  simulateur local des API MTN MoMo et Orange Money`)
+}
+
+func runMigrateCommand(args []string) int {
+	if len(args) == 0 {
+		printUsage()
+		return 2
+	}
+
+	ctx := context.Background()
+	sub, rest := args[0], args[1:]
+
+	// create n'a pas besoin de la base
+	if sub == "create" {
+		if len(rest) != 1 {
+			fmt.Fprintln(os.Stderr, "Usage: migrate create <nom>")
+			return 2
+		}
+		files, err := createMigrationFiles(migrationsDir, rest[0], "", "-- SQL de la migration\n", "-- SQL de retour arrière\n")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "❌", err)
+			return 1
+		}
+		for _, f := range files {
+			fmt.Println("📝 Créé :", f)
+		}
+		return 0
+	}
+
+	if err := connectDatabase(); err != nil {
+		fmt.Fprintln(os.Stderr, "❌ Erreur de connexion à la BD:", err)
+		return 1
+	}
+
+	migrations, err := loadMigrations(migrationFiles, dialect.Name())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "❌", err)
+		return 1
+	}
+	runner := newMigrationRunner(db, migrations)
+
+	switch sub {
+	case "up":
+		fs := flag.NewFlagSet("migrate up", flag.ContinueOnError)
+		to := fs.String("to", "", "dernière version à appliquer (toutes par défaut)")
+		if err := fs.Parse(rest); err != nil {
+			return 2
+		}
+		applied, err := runner.UpTo(ctx, *to)
+		for _, m := range applied {
+			fmt.Printf("⬆️  %s_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "❌", err)
+			return 1
+		}
+		if len(applied) == 0 {
+			fmt.Println("✅ Base à jour")
+		}
+		return 0
+
+	case "down":
+		fs := flag.NewFlagSet("migrate down", flag.ContinueOnError)
+		steps := fs.Int("steps", 1, "nombre de migrations à annuler")
+		if err := fs.Parse(rest); err != nil || *steps < 1 {
+			return 2
+		}
+		reverted, err := runner.Down(ctx, *steps)
+		for _, m := range reverted {
+			fmt.Printf("⬇️  %s_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "❌", err)
+			return 1
+		}
+		return 0
+
+	case "status":
+		statuses, err := runner.Status(ctx)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "❌", err)
+			return 1
+		}
+		fmt.Printf("Base %s\n\n", dialect.Label())
+		for _, s := range statuses {
+			state := "en attente"
+			switch {
+			case s.Missing:
+				state = "appliquée, FICHIER ABSENT"
+			case s.Modified:
+				state = "appliquée, MODIFIÉE depuis"
+			case s.Applied:
+				state = "appliquée le " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			case s.Unmet != nil:
+				state = "en attente, sautée : " + s.Unmet.Error()
+			}
+			fmt.Printf("  %s  %-35s %s\n", s.Version, s.Name, state)
+		}
+		return 0
+
+	case "diff":
+		if len(rest) != 1 {
+			fmt.Fprintln(os.Stderr, "Usage: migrate diff <nom>")
+			return 2
+		}
+		if strings.EqualFold(os.Getenv("APP_ENV"), "production") {
+			fmt.Fprintln(os.Stderr, "❌ migrate diff est réservé au développement")
+			return 1
+		}
+		up, down, err := diffSchema(db, appModels())
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "❌", err)
+			return 1
+		}
+		if up == "" {
+			fmt.Println("✅ Aucun écart entre les modèles et la base")
+			return 0
+		}
+		files, err := createMigrationFiles(migrationsDir, rest[0], dialect.Name(), up, down)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "❌", err)
+			return 1
+		}
+		for _, f := range files {
+			fmt.Println("📝 Brouillon :", f)
+		}
+		fmt.Println("⚠️  Relire et adapter le SQL avant de l'appliquer (et l'écrire pour les autres drivers)")
+		return 0
+	}
+
+	fmt.Fprintf(os.Stderr, "Sous-commande inconnue: migrate %s\n", sub)
+	printUsage()
+	return 2
+}
+
+var migrationNameRegex = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+// createMigrationFiles écrit <version>_<nom>.up[.driver].sql et .down[.driver].sql
+func createMigrationFiles(dir, name, driver, up, down string) ([]string, error) {
+	if !migrationNameRegex.MatchString(name) {
+		return nil, fmt.Errorf("nom de migration invalide %q (minuscules, chiffres, _)", name)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	suffix := ".sql"
+	if driver != "" {
+		suffix = "." + driver + ".sql"
+	}
+
+	version := time.Now().UTC().Format("20060102150405")
+	files := []string{
+		filepath.Join(dir, version+"_"+name+".up"+suffix),
+		filepath.Join(dir, version+"_"+name+".down"+suffix),
+	}
+	for i, content := range []string{up, down} {
+		if err := os.WriteFile(files[i], []byte(content), 0o644); err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+func runReindexCommand() int {
+	if err := connectDatabase(); err != nil {
+		fmt.Fprintln(os.Stderr, "❌ Erreur de connexion à la BD:", err)
+		return 1
+	}
+
+	count, err := reindexPosts(context.Background(), db, dialect)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "❌", err)
+		return 1
+	}
+	fmt.Printf("✅ Index de recherche reconstruit (%d posts, %s)\n", count, dialect.Label())
+	return 0
+}
+
+func runPurgeCommand(args []string) int {
+	fs := flag.NewFlagSet("purge", flag.ContinueOnError)
+	olderThan := fs.Duration("older-than", trashRetention(), "ancienneté minimale dans la corbeille")
+	if err := fs.Parse(args); err != nil || *olderThan < 0 {
+		return 2
+	}
+
+	if err := connectDatabase(); err != nil {
+		fmt.Fprintln(os.Stderr, "❌ Erreur de connexion à la BD:", err)
+		return 1
+	}
+
+	purger := NewTrashPurger(newGormRepositories(), *olderThan)
+	report, err := purger.Purge(context.Background(), *olderThan)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "❌", err)
+		return 1
+	}
+	fmt.Printf("✅ Corbeille purgée avant le %s : %d utilisateur(s), %d post(s)\n",
+		report.Before.Format(time.RFC3339), report.Users, report.Posts)
+	return 0
+}
+
+func runSeedCommand(args []string) int {
+	fs := flag.NewFlagSet("seed", flag.ContinueOnError)
+	seed := fs.Uint64("seed", 42, "graine du générateur")
+	users := fs.Int("users", 20, "nombre d'utilisateurs générés")
+	posts := fs.Int("posts", 60, "nombre de posts générés")
+	comments := fs.Int("comments", 120, "nombre de commentaires générés")
+	dump := fs.String("dump", "", "écrit la fixture générée (.yaml ou .json) sans toucher à la base")
+	tenant := fs.String("tenant", defaultTenant, "tenant qui reçoit les données")
+	if err := fs.Parse(args); err != nil || *users < 0 || *posts < 0 || *comments < 0 ||
+		!slugRegex.MatchString(*tenant) {
+		return 2
+	}
+	if !seedAllowed() {
+		fmt.Fprintln(os.Stderr, "❌ seed est réservé au développement")
+		return 1
+	}
+
+	// Fichiers de fixtures, ou données générées
+	var fx *Fixtures
+	if fs.NArg() > 0 {
+		fx = &Fixtures{}
+		for _, path := range fs.Args() {
+			file, err := readFixtures(path)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "❌", err)
+				return 1
+			}
+			fx.Merge(file)
+		}
+	} else {
+		fx = generateFixtures(*seed, SeedVolumes{Users: *users, Posts: *posts, Comments: *comments})
+	}
+
+	if *dump != "" {
+		if err := writeFixtures(*dump, fx); err != nil {
+			fmt.Fprintln(os.Stderr, "❌", err)
+			return 1
+		}
+		fmt.Println("📝 Fixture écrite :", *dump)
+		return 0
+	}
+
+	if err := registerValidators(); err != nil {
+		fmt.Fprintln(os.Stderr, "❌", err)
+		return 1
+	}
+	if err := connectDatabase(); err != nil {
+		fmt.Fprintln(os.Stderr, "❌ Erreur de connexion à la BD:", err)
+		return 1
+	}
+	if err := migrateOnStart(context.Background()); err != nil {
+		fmt.Fprintln(os.Stderr, "❌", err)
+		return 1
+	}
+
+	ctx := withTenant(context.Background(), *tenant)
+	result, err := NewFixtureLoader(newGormRepositories()).Load(ctx, fx)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "❌", err)
+		return 1
+	}
+	fmt.Printf("✅ %d utilisateur(s), %d post(s), %d commentaire(s), %d tag(s) créés pour %s (%s)\n",
+		len(fx.Users), len(fx.Posts), len(fx.Comments), result.Tags, *tenant, dialect.Label())
+	return 0
+}
+
+func runBackupCommand(args []string) int {
+	dbCfg := loadDBConfig()
+	manager := NewBackupManager(nil, dbCfg, loadBackupConfig())
+	fs := flag.NewFlagSet("backup", flag.ContinueOnError)
+	kind := fs.String("kind", manager.DefaultKind(), "format : sqlite ou ndjson")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	if err := connectDatabase(); err != nil {
+		fmt.Fprintln(os.Stderr, "❌ Erreur de connexion à la BD:", err)
+		return 1
+	}
+	manager.db = db
+
+	info, err := manager.Run(context.Background(), *kind)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "❌", err)
+		return 1
+	}
+	fmt.Printf("✅ Sauvegarde %s (%d octets, sha256 %s)\n",
+		filepath.Join(manager.cfg.Dir, info.Name), info.Size, info.SHA256)
+	return 0
+}
+
+func runExportCommand(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: export <fichier.ndjson.gz>")
+		return 2
+	}
+	path := args[0]
+
+	if err := connectDatabase(); err != nil {
+		fmt.Fprintln(os.Stderr, "❌ Erreur de connexion à la BD:", err)
+		return 1
+	}
+
+	tmp := path + ".tmp"
+	defer os.Remove(tmp)
+	if err := exportToFile(context.Background(), db, loadDBConfig(), tmp); err != nil {
+		fmt.Fprintln(os.Stderr, "❌", err)
+		return 1
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		fmt.Fprintln(os.Stderr, "❌", err)
+		return 1
+	}
+	sum, err := writeChecksum(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "❌", err)
+		return 1
+	}
+	fmt.Printf("✅ Export %s (%s, sha256 %s)\n", path, dialect.Label(), sum)
+	return 0
+}
+
+func runRestoreCommand(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: restore <fichier.db|fichier.ndjson.gz>")
+		return 2
+	}
+	path := args[0]
+	ctx := context.Background()
+
+	kind := backupKind(path)
+	if kind == "" {
+		fmt.Fprintln(os.Stderr, "❌ format inconnu : .db ou .ndjson.gz attendu")
+		return 2
+	}
+	checked, err := verifyChecksum(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "❌", err)
+		return 1
+	}
+	if !checked {
+		fmt.Fprintf(os.Stderr, "⚠️  Pas de %s.sha256 : somme de contrôle non vérifiée\n", filepath.Base(path))
+	}
+
+	dbCfg := loadDBConfig()
+	if kind == BackupSQLite {
+		if dbCfg.Driver != "sqlite" {
+			fmt.Fprintln(os.Stderr, "❌ une sauvegarde .db ne se restaure que sur SQLite (utiliser un export .ndjson.gz)")
+			return 1
+		}
+		previous, err := restoreSQLiteFile(ctx, path, dbCfg)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "❌", err)
+			return 1
+		}
+		fmt.Printf("✅ Base %s restaurée depuis %s\n", sqliteFilePath(dbCfg.DSN), path)
+		if previous != "" {
+			fmt.Println("   Ancienne base gardée :", previous)
+		}
+		return 0
+	}
+
+	if err := connectDatabase(); err != nil {
+		fmt.Fprintln(os.Stderr, "❌ Erreur de connexion à la BD:", err)
+		return 1
+	}
+	if err := migrateOnStart(ctx); err != nil {
+		fmt.Fprintln(os.Stderr, "❌", err)
+		return 1
+	}
+	counts, err := importNDJSON(ctx, db, dialect, path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "❌", err)
+		return 1
+	}
+	fmt.Printf("✅ Export %s restauré (%s) :\n", path, dialect.Label())
+	tables, _ := exportTables(db)
+	for _, t := range tables {
+		fmt.Printf("   %-16s %d\n", t.Name, counts[t.Name])
+	}
+	return 0
+}
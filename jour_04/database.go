@@ -0,0 +1,363 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/mattn/go-sqlite3"
+	gormmysql "gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// === CONFIGURATION BASE DE DONNÉES ===
+
+// DBConfig décrit la connexion à ouvrir.
+// Variables d'environnement :
+//   - DB_DRIVER   : sqlite (défaut), postgres ou mysql
+//   - DB_DSN      : chaîne de connexion (défaut selon le driver)
+//   - DB_TIMEZONE : fuseau horaire de la session (défaut Africa/Douala)
+//   - DB_CONNECT_TIMEOUT : délai pour obtenir une première connexion (défaut 60s)
+//   - DB_BUSY_TIMEOUT : attente d'un verrou SQLite avant SQLITE_BUSY (défaut 5s)
+//
+// Le pool se règle avec DB_MAX_OPEN_CONNS, DB_MAX_IDLE_CONNS,
+// DB_CONN_MAX_LIFETIME et DB_CONN_MAX_IDLE_TIME (voir pool.go).
+type DBConfig struct {
+	Driver         string
+	DSN            string
+	TimeZone       string
+	ConnectTimeout time.Duration
+	BusyTimeout    time.Duration
+}
+
+// Chaînes de connexion par défaut (environnement de développement)
+var defaultDSNs = map[string]string{
+	"sqlite":   "afaapay.db",
+	"postgres": "host=localhost user=postgres password=postgres dbname=afaapay port=5432 sslmode=disable",
+	"mysql":    "root:password@tcp(localhost:3306)/afaapay?charset=utf8mb4",
+}
+
+func loadDBConfig() DBConfig {
+	cfg := DBConfig{
+		Driver:   strings.ToLower(os.Getenv("DB_DRIVER")),
+		DSN:      os.Getenv("DB_DSN"),
+		TimeZone: os.Getenv("DB_TIMEZONE"),
+	}
+	if cfg.Driver == "" {
+		cfg.Driver = "sqlite"
+	}
+	if cfg.DSN == "" {
+		cfg.DSN = defaultDSNs[cfg.Driver]
+	}
+	if cfg.TimeZone == "" {
+		cfg.TimeZone = "Africa/Douala"
+	}
+	cfg.ConnectTimeout = 60 * time.Second
+	if d, err := time.ParseDuration(os.Getenv("DB_CONNECT_TIMEOUT")); err == nil && d >= 0 {
+		cfg.ConnectTimeout = d
+	}
+	cfg.BusyTimeout = 5 * time.Second
+	if d, err := time.ParseDuration(os.Getenv("DB_BUSY_TIMEOUT")); err == nil && d >= 0 {
+		cfg.BusyTimeout = d
+	}
+	return cfg
+}
+
+// === DIALECTES ===
+
+// Dialect regroupe ce qui diffère d'un moteur de base de données à l'autre.
+type Dialect interface {
+	// Name est le nom du driver (sqlite, postgres, mysql)
+	Name() string
+	// Label est le nom affiché (SQLite, PostgreSQL, MySQL)
+	Label() string
+	// Dialector construit le dialector GORM, avec le fuseau horaire (et pour
+	// SQLite les pragmas) appliqués
+	Dialector(cfg DBConfig) gorm.Dialector
+	// DefaultPool est le réglage du pool avant DB_MAX_OPEN_CONNS & co
+	DefaultPool() PoolConfig
+	// UniqueViolation indique si err est une violation de contrainte
+	// d'unicité et, si possible, la colonne concernée
+	UniqueViolation(err error) (column string, ok bool)
+	// ResetSequence recale le compteur d'auto-incrément de table.column sur
+	// le plus grand ID, après des INSERT avec ID explicite (import)
+	ResetSequence(tx *gorm.DB, table, column string) error
+	// SerializationFailure indique si err est l'annulation d'une transaction
+	// par la base (conflit de sérialisation, deadlock) : elle peut être rejouée
+	SerializationFailure(err error) bool
+}
+
+var dialects = map[string]Dialect{
+	"sqlite":   sqliteDialect{},
+	"postgres": postgresDialect{},
+	"mysql":    mysqlDialect{},
+}
+
+// dialect est le dialecte de la connexion courante
+var dialect Dialect
+
+// openDatabase ouvre la connexion décrite par cfg ; tant que la base ne
+// répond pas (conteneur pas encore prêt), réessaie jusqu'à cfg.ConnectTimeout
+func openDatabase(ctx context.Context, cfg DBConfig) (*gorm.DB, Dialect, error) {
+	d, ok := dialects[cfg.Driver]
+	if !ok {
+		return nil, nil, fmt.Errorf("driver de base de données inconnu: %q (sqlite, postgres, mysql)", cfg.Driver)
+	}
+
+	var conn *gorm.DB
+	err := retryWithBackoff(ctx, cfg.ConnectTimeout, d.Label(), func() error {
+		var err error
+		conn, err = gorm.Open(d.Dialector(cfg), &gorm.Config{})
+		if err != nil && conn != nil {
+			if sqlDB, dbErr := conn.DB(); dbErr == nil {
+				sqlDB.Close()
+			}
+		}
+		return err
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("connexion %s: %w", d.Label(), err)
+	}
+
+	if err := configurePool(conn, loadPoolConfig(d.DefaultPool())); err != nil {
+		return nil, nil, err
+	}
+	if err := checkSearchSupport(conn, d); err != nil {
+		return nil, nil, err
+	}
+	return conn, d, nil
+}
+
+// connectDatabase ouvre la connexion configurée et initialise db et dialect
+func connectDatabase() error {
+	var err error
+	db, dialect, err = openDatabase(context.Background(), loadDBConfig())
+	if err != nil {
+		return err
+	}
+	// Isolation des tenants sur tous les modèles ayant un TenantID
+	return registerTenantScoping(db)
+}
+
+// isSerializationFailure est un raccourci pour le dialecte courant
+func isSerializationFailure(err error) bool {
+	return err != nil && dialect != nil && dialect.SerializationFailure(err)
+}
+
+// isUniqueViolation est un raccourci pour le dialecte courant
+func isUniqueViolation(err error) bool {
+	if err == nil || dialect == nil {
+		return false
+	}
+	_, ok := dialect.UniqueViolation(err)
+	return ok
+}
+
+// --- SQLite ---
+
+type sqliteDialect struct{}
+
+func (sqliteDialect) Name() string  { return "sqlite" }
+func (sqliteDialect) Label() string { return "SQLite" }
+
+// SQLite n'a pas de fuseau de session : les dates sont stockées telles quelles
+func (sqliteDialect) Dialector(cfg DBConfig) gorm.Dialector {
+	return sqlite.Open(withSQLitePragmas(cfg.DSN, cfg.BusyTimeout))
+}
+
+// Un seul écrivain à la fois dans un fichier SQLite : une connexion unique
+// sérialise les écritures du processus au lieu de les faire échouer en
+// SQLITE_BUSY (DB_MAX_OPEN_CONNS pour changer)
+func (sqliteDialect) DefaultPool() PoolConfig {
+	return PoolConfig{MaxOpenConns: 1, MaxIdleConns: 1}
+}
+
+// withSQLitePragmas active le journal WAL (lectures non bloquées par une
+// écriture), le délai d'attente des verrous et les transactions IMMEDIATE
+// (verrou d'écriture pris au BEGIN, sans promotion qui échouerait en
+// SQLITE_BUSY), sauf si le DSN les précise déjà.
+func withSQLitePragmas(dsn string, busyTimeout time.Duration) string {
+	base, query, _ := strings.Cut(dsn, "?")
+	params, err := url.ParseQuery(query)
+	if err != nil {
+		return dsn
+	}
+	if params.Get("_journal_mode") == "" && params.Get("_journal") == "" {
+		params.Set("_journal_mode", "WAL")
+	}
+	if params.Get("_busy_timeout") == "" && params.Get("_timeout") == "" {
+		params.Set("_busy_timeout", strconv.FormatInt(busyTimeout.Milliseconds(), 10))
+	}
+	if params.Get("_txlock") == "" {
+		params.Set("_txlock", "immediate")
+	}
+	return base + "?" + params.Encode()
+}
+
+// Message : "UNIQUE constraint failed: users.tenant_id, users.email" ; la
+// colonne significative est la dernière (tenant_id vient en tête des index
+// par tenant). SQLite distingue les doublons de clé primaire des autres
+// index uniques.
+func (sqliteDialect) UniqueViolation(err error) (string, bool) {
+	var sqlErr sqlite3.Error
+	if !errors.As(err, &sqlErr) ||
+		(sqlErr.ExtendedCode != sqlite3.ErrConstraintUnique && sqlErr.ExtendedCode != sqlite3.ErrConstraintPrimaryKey) {
+		return "", false
+	}
+
+	column := ""
+	if _, cols, found := strings.Cut(sqlErr.Error(), "failed: "); found {
+		last := cols[strings.LastIndex(cols, ",")+1:]
+		if _, col, found := strings.Cut(last, "."); found {
+			column = strings.TrimSpace(col)
+		}
+	}
+	return column, true
+}
+
+// AUTOINCREMENT suit le plus grand ID inséré
+func (sqliteDialect) ResetSequence(*gorm.DB, string, string) error { return nil }
+
+// Transactions IMMEDIATE : un seul écrivain, les conflits attendent
+// _busy_timeout au lieu d'annuler la transaction
+func (sqliteDialect) SerializationFailure(error) bool { return false }
+
+// --- PostgreSQL ---
+
+type postgresDialect struct{}
+
+func (postgresDialect) Name() string  { return "postgres" }
+func (postgresDialect) Label() string { return "PostgreSQL" }
+
+func (postgresDialect) Dialector(cfg DBConfig) gorm.Dialector {
+	return postgres.Open(withPostgresTimeZone(cfg.DSN, cfg.TimeZone))
+}
+
+func (postgresDialect) DefaultPool() PoolConfig { return defaultServerPool }
+
+// Code SQLSTATE 23505 : unique_violation
+func (postgresDialect) UniqueViolation(err error) (string, bool) {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) || pgErr.Code != "23505" {
+		return "", false
+	}
+	if pgErr.ColumnName != "" {
+		return pgErr.ColumnName, true
+	}
+	return columnFromIndex(pgErr.TableName, pgErr.ConstraintName), true
+}
+
+// Les séquences SERIAL ignorent les ID insérés explicitement ; table et
+// column viennent des modèles, jamais d'une requête
+func (postgresDialect) ResetSequence(tx *gorm.DB, table, column string) error {
+	return tx.Exec(fmt.Sprintf(
+		"SELECT setval(pg_get_serial_sequence('%s', '%s'), COALESCE((SELECT MAX(%s) FROM %s), 0) + 1, false)",
+		table, column, column, table)).Error
+}
+
+// SQLSTATE 40001 : serialization_failure, 40P01 : deadlock_detected
+func (postgresDialect) SerializationFailure(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && (pgErr.Code == "40001" || pgErr.Code == "40P01")
+}
+
+// withPostgresTimeZone ajoute TimeZone au DSN s'il n'est pas déjà présent,
+// au format clé=valeur comme au format URL (postgres://...).
+func withPostgresTimeZone(dsn, timeZone string) string {
+	if timeZone == "" || strings.Contains(strings.ToLower(dsn), "timezone") {
+		return dsn
+	}
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		if u, err := url.Parse(dsn); err == nil {
+			q := u.Query()
+			q.Set("TimeZone", timeZone)
+			u.RawQuery = q.Encode()
+			return u.String()
+		}
+	}
+	return dsn + " TimeZone=" + timeZone
+}
+
+// --- MySQL ---
+
+type mysqlDialect struct{}
+
+func (mysqlDialect) Name() string  { return "mysql" }
+func (mysqlDialect) Label() string { return "MySQL" }
+
+func (mysqlDialect) Dialector(cfg DBConfig) gorm.Dialector {
+	return gormmysql.Open(withMySQLTimeZone(cfg.DSN, cfg.TimeZone))
+}
+
+func (mysqlDialect) DefaultPool() PoolConfig { return defaultServerPool }
+
+// Erreur 1062 : "Duplicate entry 'x' for key 'users.idx_users_email'"
+func (mysqlDialect) UniqueViolation(err error) (string, bool) {
+	var myErr *mysql.MySQLError
+	if !errors.As(err, &myErr) || myErr.Number != 1062 {
+		return "", false
+	}
+
+	m := mysqlDuplicateKeyRegex.FindStringSubmatch(myErr.Message)
+	if m == nil {
+		return "", true
+	}
+	table, index, found := strings.Cut(m[1], ".")
+	if !found {
+		table, index = "", m[1]
+	}
+	return columnFromIndex(table, index), true
+}
+
+// AUTO_INCREMENT suit le plus grand ID inséré
+func (mysqlDialect) ResetSequence(*gorm.DB, string, string) error { return nil }
+
+// Erreur 1213 : deadlock (InnoDB annule l'une des deux transactions)
+func (mysqlDialect) SerializationFailure(err error) bool {
+	var myErr *mysql.MySQLError
+	return errors.As(err, &myErr) && myErr.Number == 1213
+}
+
+var mysqlDuplicateKeyRegex = regexp.MustCompile(`for key '([^']+)'`)
+
+// withMySQLTimeZone force parseTime (dates en time.Time) et loc (fuseau
+// utilisé pour interpréter les DATETIME) si le DSN ne les précise pas.
+func withMySQLTimeZone(dsn, timeZone string) string {
+	base, query, _ := strings.Cut(dsn, "?")
+	params, err := url.ParseQuery(query)
+	if err != nil {
+		return dsn
+	}
+	if params.Get("parseTime") == "" {
+		params.Set("parseTime", "True")
+	}
+	if params.Get("loc") == "" && timeZone != "" {
+		params.Set("loc", timeZone)
+	}
+	return base + "?" + params.Encode()
+}
+
+// columnFromIndex retrouve la colonne à partir du nom d'index généré
+// par GORM (idx_<table>_<colonne>, idx_<table>_tenant_<colonne> pour un
+// index par tenant) ; sinon renvoie le nom de l'index.
+func columnFromIndex(table, index string) string {
+	if table != "" {
+		if col, found := strings.CutPrefix(index, "idx_"+table+"_"); found {
+			if c, perTenant := strings.CutPrefix(col, "tenant_"); perTenant && c != "id" {
+				return c
+			}
+			return col
+		}
+	}
+	return index
+}
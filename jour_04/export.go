@@ -0,0 +1,462 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// === EXPORT LOGIQUE (NDJSON compressé) ===
+//
+// Toutes les tables des modèles (appModels) et leurs tables de jointure,
+// ligne par ligne, dans un fichier gzip d'objets JSON (un par ligne) :
+//
+//	{"format":"jour04-export","version":1,"driver":"sqlite","schema":"20260117090000",...}
+//	{"table":"users","row":{"id":1,"tenant_id":"default","email":"noah@example.com",...}}
+//	...
+//	{"counts":{"users":3,"posts":5,...}}
+//
+// Les valeurs sont celles des colonnes (tenant, corbeille comprises), sans
+// dépendre du driver : l'export d'une base SQLite se recharge dans
+// PostgreSQL ou MySQL au même schéma (version de migration).
+//
+// L'export lit un instantané : une copie en ligne pour SQLite (backup.go),
+// une transaction REPEATABLE READ en lecture seule sinon.
+//
+// L'import lit le fichier deux fois : une validation complète (format,
+// schéma, tables et colonnes connues, types, comptages), puis le
+// remplacement de toutes les lignes en une transaction.
+
+const (
+	exportFormat  = "jour04-export"
+	exportVersion = 1
+)
+
+var ErrInvalidExport = errors.New("export invalide")
+
+type exportHeader struct {
+	Format    string    `json:"format"`
+	Version   int       `json:"version"`
+	Driver    string    `json:"driver"`
+	Schema    string    `json:"schema"` // dernière migration appliquée
+	CreatedAt time.Time `json:"created_at"`
+	Tables    []string  `json:"tables"`
+}
+
+// exportLine : ligne de données (Table, Row) ou ligne finale (Counts)
+type exportLine struct {
+	Table  string                 `json:"table,omitempty"`
+	Row    map[string]interface{} `json:"row,omitempty"`
+	Counts map[string]int64       `json:"counts,omitempty"`
+}
+
+// exportTable : table exportée, dans l'ordre d'insertion (parents d'abord)
+type exportTable struct {
+	Name    string
+	Columns []string
+	Order   []string // clé primaire
+	Serial  string   // colonne auto-incrémentée, vide sinon
+	fields  map[string]*schema.Field
+}
+
+// exportTables décrit les tables des modèles puis leurs tables de jointure
+func exportTables(conn *gorm.DB) ([]exportTable, error) {
+	var tables, joins []exportTable
+	seen := map[string]bool{}
+	add := func(list *[]exportTable, sch *schema.Schema) {
+		if seen[sch.Table] {
+			return
+		}
+		seen[sch.Table] = true
+		t := exportTable{Name: sch.Table, Order: sch.PrimaryFieldDBNames, fields: map[string]*schema.Field{}}
+		for _, f := range sch.Fields {
+			if f.DBName == "" || !f.Creatable {
+				continue
+			}
+			t.Columns = append(t.Columns, f.DBName)
+			t.fields[f.DBName] = f
+			if f.AutoIncrement || (f == sch.PrioritizedPrimaryField && f.DataType == schema.Uint) {
+				t.Serial = f.DBName
+			}
+		}
+		*list = append(*list, t)
+	}
+
+	for _, model := range appModels() {
+		stmt := &gorm.Statement{DB: conn}
+		if err := stmt.Parse(model); err != nil {
+			return nil, err
+		}
+		add(&tables, stmt.Schema)
+		for _, rel := range stmt.Schema.Relationships.Relations {
+			if rel.JoinTable != nil {
+				add(&joins, rel.JoinTable)
+			}
+		}
+	}
+	return append(tables, joins...), nil
+}
+
+// schemaVersion : dernière migration appliquée à la base
+func schemaVersion(ctx context.Context, conn *gorm.DB) (string, error) {
+	var version sql.NullString
+	err := conn.WithContext(ctx).Model(&SchemaMigration{}).Select("MAX(version)").Scan(&version).Error
+	return version.String, err
+}
+
+// --- Export ---
+
+// exportNDJSON écrit un export compressé de la base dans w et retourne le
+// nombre de lignes par table
+func exportNDJSON(ctx context.Context, conn *gorm.DB, cfg DBConfig, w io.Writer) (map[string]int64, error) {
+	if cfg.Driver == "sqlite" {
+		// Instantané par copie en ligne : l'export ne bloque pas les écritures
+		dir, err := os.MkdirTemp("", "jour04-export-")
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(dir)
+		snapshot := filepath.Join(dir, "snapshot.db")
+		if err := backupSQLite(ctx, cfg, snapshot); err != nil {
+			return nil, err
+		}
+		snap, err := gorm.Open(sqlite.Open(snapshot), &gorm.Config{Logger: conn.Logger})
+		if err != nil {
+			return nil, err
+		}
+		if sqlDB, err := snap.DB(); err == nil {
+			defer sqlDB.Close()
+		}
+		return writeExport(ctx, snap, cfg.Driver, w)
+	}
+
+	var counts map[string]int64
+	err := conn.WithContext(usePrimary(ctx)).Transaction(func(tx *gorm.DB) error {
+		var err error
+		counts, err = writeExport(ctx, tx, cfg.Driver, w)
+		return err
+	}, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	return counts, err
+}
+
+func writeExport(ctx context.Context, conn *gorm.DB, driver string, w io.Writer) (map[string]int64, error) {
+	tables, err := exportTables(conn)
+	if err != nil {
+		return nil, err
+	}
+	version, err := schemaVersion(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	gz := gzip.NewWriter(w)
+	buf := bufio.NewWriter(gz)
+	enc := json.NewEncoder(buf)
+
+	header := exportHeader{Format: exportFormat, Version: exportVersion, Driver: driver, Schema: version, CreatedAt: time.Now().UTC()}
+	for _, t := range tables {
+		header.Tables = append(header.Tables, t.Name)
+	}
+	if err := enc.Encode(header); err != nil {
+		return nil, err
+	}
+
+	counts := map[string]int64{}
+	for _, t := range tables {
+		n, err := exportRows(ctx, conn, t, enc)
+		if err != nil {
+			return nil, fmt.Errorf("export %s: %w", t.Name, err)
+		}
+		counts[t.Name] = n
+	}
+	if err := enc.Encode(exportLine{Counts: counts}); err != nil {
+		return nil, err
+	}
+	if err := buf.Flush(); err != nil {
+		return nil, err
+	}
+	return counts, gz.Close()
+}
+
+func exportRows(ctx context.Context, conn *gorm.DB, t exportTable, enc *json.Encoder) (int64, error) {
+	rows, err := conn.WithContext(ctx).Table(t.Name).Select(t.Columns).Order(strings.Join(t.Order, ", ")).Rows()
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	values := make([]interface{}, len(t.Columns))
+	ptrs := make([]interface{}, len(t.Columns))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+
+	var n int64
+	for rows.Next() {
+		if err := rows.Scan(ptrs...); err != nil {
+			return n, err
+		}
+		row := make(map[string]interface{}, len(t.Columns))
+		for i, col := range t.Columns {
+			if b, ok := values[i].([]byte); ok {
+				row[col] = string(b) // texte (MySQL), JSON sérialisé
+			} else {
+				row[col] = values[i]
+			}
+		}
+		if err := enc.Encode(exportLine{Table: t.Name, Row: row}); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, rows.Err()
+}
+
+// --- Import ---
+
+// importNDJSON valide l'export path puis remplace toutes les lignes de la
+// base par les siennes, en une transaction
+func importNDJSON(ctx context.Context, conn *gorm.DB, d Dialect, path string) (map[string]int64, error) {
+	tables, err := exportTables(conn)
+	if err != nil {
+		return nil, err
+	}
+	version, err := schemaVersion(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	// 1. Validation : rien n'est écrit si le fichier est incomplet ou
+	// incompatible
+	counts, err := readExport(path, tables, version, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// 2. Remplacement
+	err = conn.WithContext(allTenants(ctx)).Transaction(func(tx *gorm.DB) error {
+		// Le grand livre refuse tout DELETE (triggers *_no_delete) sauf
+		// pendant une maintenance déclarée dans ledger_maintenance. L'import
+		// est la seule exception : la ligne n'existe que dans cette
+		// transaction, retirée avant le commit ou annulée avec elle.
+		if err := tx.Exec("INSERT INTO ledger_maintenance (reason) VALUES (?)", "import").Error; err != nil {
+			return fmt.Errorf("déverrouillage du grand livre: %w", err)
+		}
+		for i := len(tables) - 1; i >= 0; i-- {
+			if err := tx.Exec("DELETE FROM " + tables[i].Name).Error; err != nil {
+				return fmt.Errorf("vidage de %s: %w", tables[i].Name, err)
+			}
+		}
+
+		var batch []map[string]interface{}
+		var batchTable *exportTable
+		flush := func() error {
+			if len(batch) == 0 {
+				return nil
+			}
+			err := tx.Table(batchTable.Name).CreateInBatches(batch, 200).Error
+			batch = batch[:0]
+			return err
+		}
+		if _, err := readExport(path, tables, version, func(t *exportTable, row map[string]interface{}) error {
+			if batchTable != t {
+				if err := flush(); err != nil {
+					return err
+				}
+				batchTable = t
+			}
+			batch = append(batch, row)
+			return nil
+		}); err != nil {
+			return err
+		}
+		if err := flush(); err != nil {
+			return err
+		}
+
+		for _, t := range tables {
+			if t.Serial != "" {
+				if err := d.ResetSequence(tx, t.Name, t.Serial); err != nil {
+					return fmt.Errorf("séquence de %s: %w", t.Name, err)
+				}
+			}
+		}
+		return tx.Exec("DELETE FROM ledger_maintenance").Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Index de recherche : reconstruit pour les posts importés
+	if _, err := reindexPosts(ctx, conn, d); err != nil {
+		return counts, err
+	}
+	return counts, nil
+}
+
+// readExport lit et vérifie l'export path ; fn (si non nil) reçoit chaque
+// ligne convertie pour la base courante
+func readExport(path string, tables []exportTable, version string,
+	fn func(t *exportTable, row map[string]interface{}) error) (map[string]int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("%w: pas un fichier gzip (%v)", ErrInvalidExport, err)
+	}
+	dec := json.NewDecoder(gz)
+	dec.UseNumber()
+	invalid := func(line int, format string, args ...interface{}) error {
+		return fmt.Errorf("%w: ligne %d : %s", ErrInvalidExport, line, fmt.Sprintf(format, args...))
+	}
+
+	var header exportHeader
+	if err := dec.Decode(&header); err != nil {
+		return nil, invalid(1, "en-tête illisible (%v)", err)
+	}
+	switch {
+	case header.Format != exportFormat:
+		return nil, invalid(1, "format %q inconnu", header.Format)
+	case header.Version != exportVersion:
+		return nil, invalid(1, "version %d non gérée (%d attendue)", header.Version, exportVersion)
+	case header.Schema != version:
+		return nil, invalid(1, "export au schéma %s, base au schéma %s (migrer l'une ou l'autre)", header.Schema, version)
+	}
+
+	byName := map[string]*exportTable{}
+	for i := range tables {
+		byName[tables[i].Name] = &tables[i]
+	}
+
+	counts := map[string]int64{}
+	for line := 2; ; line++ {
+		var l exportLine
+		if err := dec.Decode(&l); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil, invalid(line, "fichier tronqué (ligne finale absente)")
+			}
+			return nil, invalid(line, "%v", err)
+		}
+
+		if l.Table == "" {
+			if l.Counts == nil {
+				return nil, invalid(line, "ni table ni comptages")
+			}
+			for name := range byName {
+				if l.Counts[name] != counts[name] {
+					return nil, invalid(line, "%s : %d lignes annoncées, %d lues", name, l.Counts[name], counts[name])
+				}
+			}
+			if dec.More() {
+				return nil, invalid(line+1, "données après la ligne finale")
+			}
+			return counts, nil
+		}
+
+		t, ok := byName[l.Table]
+		if !ok {
+			return nil, invalid(line, "table inconnue %q", l.Table)
+		}
+		row, err := importRow(t, l.Row)
+		if err != nil {
+			return nil, invalid(line, "%s : %v", l.Table, err)
+		}
+		counts[l.Table]++
+		if fn != nil {
+			if err := fn(t, row); err != nil {
+				return nil, fmt.Errorf("import %s (ligne %d): %w", l.Table, line, err)
+			}
+		}
+	}
+}
+
+// importRow convertit les valeurs JSON d'une ligne selon le type des colonnes
+func importRow(t *exportTable, raw map[string]interface{}) (map[string]interface{}, error) {
+	row := make(map[string]interface{}, len(raw))
+	for col, v := range raw {
+		field, ok := t.fields[col]
+		if !ok {
+			return nil, fmt.Errorf("colonne inconnue %q", col)
+		}
+		value, err := importValue(field, v)
+		if err != nil {
+			return nil, fmt.Errorf("%s : %v", col, err)
+		}
+		row[col] = value
+	}
+	for _, col := range t.Order {
+		if row[col] == nil {
+			return nil, fmt.Errorf("clé %s absente", col)
+		}
+	}
+	return row, nil
+}
+
+// Formats de date rencontrés selon le driver d'origine
+var exportTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02",
+}
+
+func importValue(field *schema.Field, v interface{}) (interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+	n, isNumber := v.(json.Number)
+	s, isString := v.(string)
+	b, isBool := v.(bool)
+
+	switch field.DataType {
+	case schema.Bool:
+		switch {
+		case isBool:
+			return b, nil
+		case isNumber:
+			return n.String() != "0", nil
+		}
+	case schema.Int, schema.Uint:
+		if isNumber {
+			return n.Int64()
+		}
+	case schema.Float:
+		if isNumber {
+			return n.Float64()
+		}
+	case schema.Time:
+		if isString {
+			for _, layout := range exportTimeLayouts {
+				if t, err := time.Parse(layout, s); err == nil {
+					return t.In(time.Local), nil
+				}
+			}
+			return nil, fmt.Errorf("date illisible %q", s)
+		}
+	default:
+		// Texte, et colonnes sérialisées (JSON) gardées telles quelles
+		if isString {
+			return s, nil
+		}
+		if isNumber {
+			return n.String(), nil
+		}
+	}
+	return nil, fmt.Errorf("valeur %v incompatible avec le type %s", v, field.DataType)
+}
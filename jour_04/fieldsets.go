@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// === SPARSE FIELDSETS ET INCLUDES ===
+//
+// ?fields=id,name limite les colonnes lues (SELECT) et les clés renvoyées ;
+// l'ID est toujours renvoyé. ?include=posts,posts.tags précharge des
+// relations, absentes par défaut. Chaque ressource déclare ce qui peut être
+// demandé (Readable) ; le reste est refusé (400).
+//
+// Une relation incluse coûte une requête (Preload) quel que soit le nombre
+// de lignes : avec maxIncludeDepth niveaux et des listes de relations
+// fermées, le nombre de requêtes d'une lecture est borné et connu d'avance.
+//
+// ?trashed=with|only lit aussi ou seulement la corbeille, sur les routes
+// /admin uniquement (403 ailleurs).
+
+const maxIncludeDepth = 2
+
+// Readable : champs (noms JSON) et relations qu'un client peut demander
+type Readable struct {
+	Fields   []string
+	Includes []string
+}
+
+var (
+	userReadable = Readable{
+		Fields:   []string{"id", "name", "email", "phone", "age", "created_at", "updated_at", "deleted_at"},
+		Includes: []string{"posts", "posts.tags"},
+	}
+	postReadable = Readable{
+		Fields:   []string{"id", "title", "content", "user_id", "comments_count", "created_at", "updated_at", "deleted_at"},
+		Includes: []string{"user", "tags", "comments", "comments.user"},
+	}
+)
+
+// queryList lit un paramètre liste, répété (?include=a&include=b) ou séparé
+// par des virgules (?include=a,b), sans doublons
+func queryList(c *gin.Context, name string) []string {
+	var list []string
+	for _, value := range c.QueryArray(name) {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" && !slices.Contains(list, item) {
+				list = append(list, item)
+			}
+		}
+	}
+	return list
+}
+
+// parseReadOptions lit ?fields=, ?include= et ?trashed= ; répond 400 et
+// retourne false si un champ ou une relation n'est pas autorisé pour la
+// ressource, 403 pour ?trashed= hors administration
+func parseReadOptions(c *gin.Context, r Readable) (ReadOptions, bool) {
+	opts := ReadOptions{Fields: queryList(c, "fields"), Include: queryList(c, "include")}
+
+	switch trashed := c.Query("trashed"); trashed {
+	case "":
+	case TrashedWith, TrashedOnly:
+		if !c.GetBool(adminKey) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "?trashed= est réservé aux routes /admin"})
+			return ReadOptions{}, false
+		}
+		opts.Trashed = trashed
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "trashed doit valoir with ou only"})
+		return ReadOptions{}, false
+	}
+
+	for _, f := range opts.Fields {
+		if !slices.Contains(r.Fields, f) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Champ inconnu : " + f, "allowed": r.Fields})
+			return ReadOptions{}, false
+		}
+	}
+	for _, inc := range opts.Include {
+		if strings.Count(inc, ".")+1 > maxIncludeDepth {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("Include trop profond : %s (%d niveaux maximum)", inc, maxIncludeDepth),
+			})
+			return ReadOptions{}, false
+		}
+		if !slices.Contains(r.Includes, inc) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Relation inconnue : " + inc, "allowed": r.Includes})
+			return ReadOptions{}, false
+		}
+	}
+	return opts, true
+}
+
+// sparse réduit v (entité ou slice d'entités) aux clés demandées par opts :
+// champs de ?fields=, ID et relations incluses. Sans ?fields=, v est
+// renvoyé tel quel.
+func sparse(v interface{}, opts ReadOptions) interface{} {
+	if len(opts.Fields) == 0 {
+		return v
+	}
+
+	keep := map[string]bool{"id": true}
+	for _, f := range opts.Fields {
+		keep[f] = true
+	}
+	for _, inc := range opts.Include {
+		keep[strings.SplitN(inc, ".", 2)[0]] = true
+	}
+	filter := func(row map[string]json.RawMessage) map[string]json.RawMessage {
+		for key := range row {
+			if !keep[key] {
+				delete(row, key)
+			}
+		}
+		return row
+	}
+
+	// Aller-retour JSON : les clés sont celles des tags json des modèles,
+	// qui ne peuvent pas faire échouer l'encodage
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+	if reflect.Indirect(reflect.ValueOf(v)).Kind() == reflect.Slice {
+		var rows []map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &rows); err != nil {
+			return v
+		}
+		for i := range rows {
+			rows[i] = filter(rows[i])
+		}
+		return rows
+	}
+	var row map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &row); err != nil {
+		return v
+	}
+	return filter(row)
+}
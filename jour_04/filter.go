@@ -0,0 +1,478 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+)
+
+// === FILTRES (?filter=) ===
+//
+// Petit langage d'expressions pour les listes :
+//
+//	GET /v1/users?filter=age >= 30 and name ~ "Mvondo"
+//	GET /v1/posts?filter=created_at > 2026-01-01 and not (user_id = 3)
+//
+// Grammaire (mots-clés insensibles à la casse) :
+//
+//	expr       = terme { "or" terme }
+//	terme      = facteur { "and" facteur }
+//	facteur    = "not" facteur | "(" expr ")" | comparaison
+//	comparaison = champ opérateur valeur
+//
+// Opérateurs : = != < <= > >= et ~ (contient, sans casse). Une valeur est une
+// chaîne entre guillemets ("...", \" pour un guillemet), un nombre ou une
+// date (AAAA-MM-JJ, heure locale, ou RFC 3339).
+//
+// Chaque ressource déclare ses champs filtrables et les opérateurs permis
+// sur chacun (userFilterable, postFilterable) ; l'expression devient une
+// clause WHERE paramétrée : seuls les noms de colonnes de cette liste
+// entrent dans le SQL, jamais le texte du client. Les erreurs indiquent la
+// position (en caractères, à partir de 1) de l'élément fautif.
+
+const (
+	maxFilterLength = 500 // caractères
+	maxFilterTerms  = 10  // comparaisons
+	maxFilterDepth  = 4   // parenthèses et not imbriqués
+)
+
+type filterKind int
+
+const (
+	filterText filterKind = iota
+	filterNumber
+	filterTime
+)
+
+var (
+	textFilterOps    = []string{"=", "!=", "~"}
+	orderedFilterOps = []string{"=", "!=", "<", "<=", ">", ">="}
+)
+
+// FilterField : champ filtrable (nom JSON) et sa colonne
+type FilterField struct {
+	Name   string
+	Column string
+	Field  string // champ Go du modèle, pour le filtrage en mémoire
+	Kind   filterKind
+	Ops    []string
+}
+
+var (
+	userFilterable = []FilterField{
+		{Name: "id", Column: "id", Field: "ID", Kind: filterNumber, Ops: orderedFilterOps},
+		{Name: "name", Column: "name", Field: "Name", Kind: filterText, Ops: textFilterOps},
+		{Name: "email", Column: "email", Field: "Email", Kind: filterText, Ops: textFilterOps},
+		{Name: "phone", Column: "phone", Field: "Phone", Kind: filterText, Ops: textFilterOps},
+		{Name: "age", Column: "age", Field: "Age", Kind: filterNumber, Ops: orderedFilterOps},
+		{Name: "created_at", Column: "created_at", Field: "CreatedAt", Kind: filterTime, Ops: orderedFilterOps},
+		{Name: "updated_at", Column: "updated_at", Field: "UpdatedAt", Kind: filterTime, Ops: orderedFilterOps},
+	}
+	postFilterable = []FilterField{
+		{Name: "id", Column: "id", Field: "ID", Kind: filterNumber, Ops: orderedFilterOps},
+		{Name: "title", Column: "title", Field: "Title", Kind: filterText, Ops: textFilterOps},
+		{Name: "content", Column: "content", Field: "Content", Kind: filterText, Ops: []string{"~"}},
+		{Name: "user_id", Column: "user_id", Field: "UserID", Kind: filterNumber, Ops: []string{"=", "!="}},
+		{Name: "created_at", Column: "created_at", Field: "CreatedAt", Kind: filterTime, Ops: orderedFilterOps},
+		{Name: "updated_at", Column: "updated_at", Field: "UpdatedAt", Kind: filterTime, Ops: orderedFilterOps},
+	}
+)
+
+// FilterError : expression refusée, Pos est la position de l'élément fautif
+type FilterError struct {
+	Pos int
+	Msg string
+}
+
+func (e *FilterError) Error() string {
+	return fmt.Sprintf("position %d : %s", e.Pos, e.Msg)
+}
+
+// Filter : expression analysée, dont tous les champs sont filtrables
+type Filter struct {
+	root filterNode
+}
+
+type filterNode interface {
+	sql(table string) (string, []interface{})
+	match(row reflect.Value) bool
+}
+
+// SQL retourne la condition et ses paramètres pour la table table
+func (f *Filter) SQL(table string) (string, []interface{}) {
+	return f.root.sql(table)
+}
+
+// Match applique le filtre à une entité (filtrage en mémoire) ; un filtre
+// nil accepte tout
+func (f *Filter) Match(entity interface{}) bool {
+	if f == nil {
+		return true
+	}
+	return f.root.match(reflect.Indirect(reflect.ValueOf(entity)))
+}
+
+// --- AST ---
+
+type logicalNode struct {
+	op          string // AND, OR
+	left, right filterNode
+}
+
+func (n *logicalNode) sql(table string) (string, []interface{}) {
+	l, largs := n.left.sql(table)
+	r, rargs := n.right.sql(table)
+	return "(" + l + " " + n.op + " " + r + ")", append(largs, rargs...)
+}
+
+func (n *logicalNode) match(row reflect.Value) bool {
+	if n.op == "AND" {
+		return n.left.match(row) && n.right.match(row)
+	}
+	return n.left.match(row) || n.right.match(row)
+}
+
+type notNode struct {
+	x filterNode
+}
+
+func (n *notNode) sql(table string) (string, []interface{}) {
+	s, args := n.x.sql(table)
+	return "NOT " + s, args
+}
+
+func (n *notNode) match(row reflect.Value) bool { return !n.x.match(row) }
+
+type compareNode struct {
+	field FilterField
+	op    string
+	value interface{} // string, float64 ou time.Time selon field.Kind
+}
+
+// likeEscaper : ! sert de caractère d'échappement, le même sur les trois
+// moteurs (\ est lui-même un échappement dans les chaînes MySQL)
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+func (n *compareNode) sql(table string) (string, []interface{}) {
+	column := table + "." + n.field.Column
+	if n.op == "~" {
+		pattern := "%" + likeEscaper.Replace(strings.ToLower(n.value.(string))) + "%"
+		return "LOWER(" + column + ") LIKE ? ESCAPE '!'", []interface{}{pattern}
+	}
+	op := n.op
+	if op == "!=" {
+		op = "<>"
+	}
+	return column + " " + op + " ?", []interface{}{n.value}
+}
+
+func (n *compareNode) match(row reflect.Value) bool {
+	v := row.FieldByName(n.field.Field)
+
+	var c int
+	switch n.field.Kind {
+	case filterText:
+		if n.op == "~" {
+			return strings.Contains(strings.ToLower(v.String()), strings.ToLower(n.value.(string)))
+		}
+		c = strings.Compare(v.String(), n.value.(string))
+	case filterNumber:
+		var x float64
+		if v.CanInt() {
+			x = float64(v.Int())
+		} else {
+			x = float64(v.Uint())
+		}
+		c = cmp.Compare(x, n.value.(float64))
+	case filterTime:
+		c = v.Interface().(time.Time).Compare(n.value.(time.Time))
+	}
+
+	switch n.op {
+	case "=":
+		return c == 0
+	case "!=":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	}
+	return false
+}
+
+// --- Analyse lexicale ---
+
+type filterTokenKind int
+
+const (
+	tokEOF filterTokenKind = iota
+	tokWord
+	tokString
+	tokOp
+	tokLParen
+	tokRParen
+)
+
+type filterToken struct {
+	kind filterTokenKind
+	text string
+	pos  int // à partir de 1
+}
+
+// keyword indique si le token est le mot-clé kw (and, or, not)
+func (t filterToken) keyword(kw string) bool {
+	return t.kind == tokWord && strings.EqualFold(t.text, kw)
+}
+
+func isFilterWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("_-:.+", r)
+}
+
+func lexFilter(input string) ([]filterToken, error) {
+	runes := []rune(input)
+	var tokens []filterToken
+
+	for i := 0; i < len(runes); {
+		r, pos := runes[i], i+1
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, filterToken{tokLParen, "(", pos})
+			i++
+		case r == ')':
+			tokens = append(tokens, filterToken{tokRParen, ")", pos})
+			i++
+		case r == '"':
+			var b strings.Builder
+			i++
+			for ; i < len(runes) && runes[i] != '"'; i++ {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					i++
+				}
+				b.WriteRune(runes[i])
+			}
+			if i == len(runes) {
+				return nil, &FilterError{pos, "chaîne non terminée"}
+			}
+			tokens = append(tokens, filterToken{tokString, b.String(), pos})
+			i++
+		case strings.ContainsRune("=!<>~", r):
+			op := string(r)
+			if i+1 < len(runes) && runes[i+1] == '=' && r != '=' && r != '~' {
+				op += "="
+			}
+			if op == "!" {
+				return nil, &FilterError{pos, "opérateur inconnu « ! » (!= attendu)"}
+			}
+			tokens = append(tokens, filterToken{tokOp, op, pos})
+			i += len(op)
+		case isFilterWordRune(r):
+			start := i
+			for i < len(runes) && isFilterWordRune(runes[i]) {
+				i++
+			}
+			tokens = append(tokens, filterToken{tokWord, string(runes[start:i]), pos})
+		default:
+			return nil, &FilterError{pos, fmt.Sprintf("caractère inattendu « %c »", r)}
+		}
+	}
+	return append(tokens, filterToken{tokEOF, "", len(runes) + 1}), nil
+}
+
+// --- Analyse syntaxique ---
+
+type filterParser struct {
+	tokens []filterToken
+	i      int
+	fields []FilterField
+	terms  int
+	depth  int
+}
+
+// ParseFilter analyse input et vérifie ses champs et opérateurs contre
+// fields ; retourne une *FilterError en cas de refus
+func ParseFilter(input string, fields []FilterField) (*Filter, error) {
+	if n := len([]rune(input)); n > maxFilterLength {
+		return nil, &FilterError{maxFilterLength + 1, fmt.Sprintf("filtre trop long (%d caractères au plus)", maxFilterLength)}
+	}
+	tokens, err := lexFilter(input)
+	if err != nil {
+		return nil, err
+	}
+	p := &filterParser{tokens: tokens, fields: fields}
+	if p.peek().kind == tokEOF {
+		return nil, &FilterError{1, "filtre vide"}
+	}
+	root, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, &FilterError{t.pos, fmt.Sprintf("and ou or attendu, « %s » trouvé", t.text)}
+	}
+	return &Filter{root: root}, nil
+}
+
+func (p *filterParser) peek() filterToken { return p.tokens[p.i] }
+
+func (p *filterParser) next() filterToken {
+	t := p.tokens[p.i]
+	if t.kind != tokEOF {
+		p.i++
+	}
+	return t
+}
+
+func (p *filterParser) expr() (filterNode, error) {
+	return p.binary("or", "OR", p.term)
+}
+
+func (p *filterParser) term() (filterNode, error) {
+	return p.binary("and", "AND", p.factor)
+}
+
+func (p *filterParser) binary(keyword, op string, operand func() (filterNode, error)) (filterNode, error) {
+	left, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().keyword(keyword) {
+		p.next()
+		right, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalNode{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) factor() (filterNode, error) {
+	t := p.peek()
+	switch {
+	case t.keyword("not"), t.kind == tokLParen:
+		p.next()
+		if p.depth++; p.depth > maxFilterDepth {
+			return nil, &FilterError{t.pos, fmt.Sprintf("filtre trop imbriqué (%d niveaux au plus)", maxFilterDepth)}
+		}
+		defer func() { p.depth-- }()
+
+		if t.kind == tokLParen {
+			x, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			if closing := p.next(); closing.kind != tokRParen {
+				return nil, &FilterError{closing.pos, "« ) » attendu"}
+			}
+			return x, nil
+		}
+		x, err := p.factor()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{x: x}, nil
+	}
+	return p.comparison()
+}
+
+func (p *filterParser) comparison() (filterNode, error) {
+	name := p.next()
+	if name.kind != tokWord || name.keyword("and") || name.keyword("or") {
+		return nil, &FilterError{name.pos, "champ attendu"}
+	}
+	field, ok := p.field(name.text)
+	if !ok {
+		return nil, &FilterError{name.pos, "champ non filtrable : " + name.text}
+	}
+	if p.terms++; p.terms > maxFilterTerms {
+		return nil, &FilterError{name.pos, fmt.Sprintf("filtre trop complexe (%d comparaisons au plus)", maxFilterTerms)}
+	}
+
+	op := p.next()
+	if op.kind != tokOp {
+		return nil, &FilterError{op.pos, "opérateur attendu (= != < <= > >= ~)"}
+	}
+	if !slices.Contains(field.Ops, op.text) {
+		return nil, &FilterError{op.pos, fmt.Sprintf("opérateur %s non permis sur %s (%s)",
+			op.text, field.Name, strings.Join(field.Ops, " "))}
+	}
+
+	raw := p.next()
+	if raw.kind != tokString && (raw.kind != tokWord || raw.keyword("and") || raw.keyword("or") || raw.keyword("not")) {
+		return nil, &FilterError{raw.pos, "valeur attendue"}
+	}
+	value, err := filterValue(field, raw)
+	if err != nil {
+		return nil, err
+	}
+	return &compareNode{field: field, op: op.text, value: value}, nil
+}
+
+func (p *filterParser) field(name string) (FilterField, bool) {
+	for _, f := range p.fields {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return FilterField{}, false
+}
+
+// filterValue convertit la valeur selon le type du champ
+func filterValue(field FilterField, t filterToken) (interface{}, error) {
+	switch field.Kind {
+	case filterNumber:
+		if n, err := strconv.ParseFloat(t.text, 64); err == nil && t.kind == tokWord {
+			return n, nil
+		}
+		return nil, &FilterError{t.pos, "nombre attendu pour " + field.Name}
+	case filterTime:
+		if d, err := time.ParseInLocation("2006-01-02", t.text, time.Local); err == nil {
+			return d, nil
+		}
+		if d, err := time.Parse(time.RFC3339, t.text); err == nil {
+			return d.In(time.Local), nil
+		}
+		return nil, &FilterError{t.pos, "date attendue pour " + field.Name + " (AAAA-MM-JJ ou RFC 3339)"}
+	}
+	return t.text, nil
+}
+
+// parseFilter lit ?filter= pour une liste ; répond 400 (avec la position)
+// et retourne false si l'expression est refusée
+func parseFilter(c *gin.Context, fields []FilterField) (*Filter, bool) {
+	input := c.Query("filter")
+	if input == "" {
+		return nil, true
+	}
+	filter, err := ParseFilter(input, fields)
+	if err != nil {
+		allowed := make([]string, len(fields))
+		for i, f := range fields {
+			allowed[i] = f.Name
+		}
+		body := gin.H{"error": "Filtre invalide : " + err.Error(), "allowed": allowed}
+		var ferr *FilterError
+		if errors.As(err, &ferr) {
+			body["position"] = ferr.Pos
+		}
+		c.JSON(http.StatusBadRequest, body)
+		return nil, false
+	}
+	return filter, true
+}
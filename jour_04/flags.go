@@ -0,0 +1,312 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Types de feature flags
+const (
+	FlagBoolean    = "boolean"
+	FlagPercentage = "percentage"
+)
+
+// Modèle FeatureFlag stocké en base et rechargé à chaud
+type FeatureFlag struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	Key         string    `gorm:"column:flag_key;uniqueIndex;not null" json:"key" binding:"required,min=2,max=64,flag_key"`
+	Description string    `json:"description" binding:"max=255"`
+	Type        string    `gorm:"not null;default:boolean" json:"type" binding:"omitempty,oneof=boolean percentage"`
+	Enabled     bool      `json:"enabled"`
+	Rollout     int       `json:"rollout" binding:"min=0,max=100"`
+	TargetUsers []uint    `gorm:"serializer:json" json:"target_users"`
+	TargetRoles []string  `gorm:"serializer:json" json:"target_roles"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// FlagSubject identifie l'appelant pour le ciblage des flags
+type FlagSubject struct {
+	UserID uint
+	Role   string
+}
+
+// Evaluate indique si le flag est actif pour le sujet :
+//   - flag désactivé : inactif pour tous
+//   - utilisateur ou rôle ciblé : actif
+//   - boolean : actif pour tous s'il n'y a aucune cible
+//   - percentage : actif pour Rollout% des utilisateurs, de façon stable
+func (f FeatureFlag) Evaluate(s FlagSubject) bool {
+	if !f.Enabled {
+		return false
+	}
+
+	if s.UserID != 0 && slices.Contains(f.TargetUsers, s.UserID) {
+		return true
+	}
+	if s.Role != "" && slices.Contains(f.TargetRoles, s.Role) {
+		return true
+	}
+
+	switch f.Type {
+	case FlagPercentage:
+		if f.Rollout >= 100 {
+			return true
+		}
+		if f.Rollout <= 0 || s.UserID == 0 {
+			return false
+		}
+		return rolloutBucket(f.Key, s.UserID) < f.Rollout
+	default:
+		return len(f.TargetUsers) == 0 && len(f.TargetRoles) == 0
+	}
+}
+
+// rolloutBucket place un utilisateur dans [0, 100) de façon déterministe,
+// pour qu'il garde la même réponse d'une requête à l'autre.
+func rolloutBucket(key string, userID uint) int {
+	h := fnv.New32a()
+	fmt.Fprintf(h, "%s:%d", key, userID)
+	return int(h.Sum32() % 100)
+}
+
+// === STORE ===
+
+// FlagStore garde une copie en mémoire des flags, rechargée
+// périodiquement depuis la base et après chaque modification.
+type FlagStore struct {
+	db    *gorm.DB
+	mu    sync.RWMutex
+	flags map[string]FeatureFlag
+}
+
+func NewFlagStore(db *gorm.DB) *FlagStore {
+	return &FlagStore{db: db, flags: map[string]FeatureFlag{}}
+}
+
+// Reload recharge tous les flags depuis la base
+func (s *FlagStore) Reload(ctx context.Context) error {
+	var list []FeatureFlag
+	// Primaire : un flag modifié doit être visible au rechargement suivant
+	if err := s.db.WithContext(usePrimary(ctx)).Find(&list).Error; err != nil {
+		return err
+	}
+
+	flags := make(map[string]FeatureFlag, len(list))
+	for _, f := range list {
+		flags[f.Key] = f
+	}
+
+	s.mu.Lock()
+	s.flags = flags
+	s.mu.Unlock()
+	return nil
+}
+
+// Watch recharge les flags à intervalle régulier jusqu'à l'annulation du contexte
+func (s *FlagStore) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Reload(ctx); err != nil {
+				fmt.Printf("[FLAGS] Erreur de rechargement: %v\n", err)
+			}
+		}
+	}
+}
+
+// IsEnabled retourne false pour un flag inconnu
+func (s *FlagStore) IsEnabled(key string, subject FlagSubject) bool {
+	s.mu.RLock()
+	f, ok := s.flags[key]
+	s.mu.RUnlock()
+	return ok && f.Evaluate(subject)
+}
+
+func (s *FlagStore) List() []FeatureFlag {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := make([]FeatureFlag, 0, len(s.flags))
+	for _, f := range s.flags {
+		list = append(list, f)
+	}
+	slices.SortFunc(list, func(a, b FeatureFlag) int { return int(a.ID) - int(b.ID) })
+	return list
+}
+
+var flags *FlagStore
+
+// flagRefreshInterval lit FLAGS_REFRESH_INTERVAL (ex: "30s"), 10s par défaut
+func flagRefreshInterval() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("FLAGS_REFRESH_INTERVAL")); err == nil && d > 0 {
+		return d
+	}
+	return 10 * time.Second
+}
+
+// flagSubject : l'appelant authentifié, claims "sub" et "role" du token
+// (headers X-User-ID et X-User-Role seulement avec AUTH_TRUST_USER_HEADER).
+// Le ciblage sert au déploiement progressif, pas au contrôle d'accès.
+func flagSubject(c *gin.Context) FlagSubject {
+	return FlagSubject{UserID: callerID(c), Role: callerRoleOf(c.Request.Context())}
+}
+
+// flagEnabled permet aux handlers de tester un flag pour la requête courante
+func flagEnabled(c *gin.Context, key string) bool {
+	return flags.IsEnabled(key, flagSubject(c))
+}
+
+// RequireFlag masque une route (404) tant que le flag est inactif pour l'appelant
+func RequireFlag(key string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !flagEnabled(c, key) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Ressource non trouvée"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// === ADMIN HANDLERS ===
+
+type FlagHandler struct {
+	store *FlagStore
+}
+
+func NewFlagHandler(store *FlagStore) *FlagHandler {
+	return &FlagHandler{store: store}
+}
+
+func (h *FlagHandler) db(c *gin.Context) *gorm.DB {
+	return h.store.db.WithContext(c.Request.Context())
+}
+
+// GET /admin/flags
+func (h *FlagHandler) List(c *gin.Context) {
+	list := h.store.List()
+	c.JSON(http.StatusOK, gin.H{"flags": list, "total": len(list)})
+}
+
+// GET /admin/flags/:key
+func (h *FlagHandler) Get(c *gin.Context) {
+	var flag FeatureFlag
+	if err := h.db(c).Where("flag_key = ?", c.Param("key")).First(&flag).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Flag non trouvé"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur BD"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"flag":        flag,
+		"enabled_for": flag.Evaluate(flagSubject(c)),
+	})
+}
+
+// POST /admin/flags
+func (h *FlagHandler) Create(c *gin.Context) {
+	var flag FeatureFlag
+
+	if err := c.ShouldBindJSON(&flag); err != nil {
+		respondValidationError(c, err)
+		return
+	}
+	if flag.Type == "" {
+		flag.Type = FlagBoolean
+	}
+
+	var count int64
+	h.db(c).Model(&FeatureFlag{}).Where("flag_key = ?", flag.Key).Count(&count)
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Flag déjà existant"})
+		return
+	}
+
+	if err := h.db(c).Create(&flag).Error; err != nil {
+		if isUniqueViolation(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Flag déjà existant"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur création"})
+		return
+	}
+	h.reload(c)
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Flag créé", "flag": flag})
+}
+
+// PUT /admin/flags/:key
+func (h *FlagHandler) Update(c *gin.Context) {
+	var existing FeatureFlag
+	if err := h.db(c).Where("flag_key = ?", c.Param("key")).First(&existing).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Flag non trouvé"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur BD"})
+		}
+		return
+	}
+
+	// La clé est immuable : on part de l'existant
+	flag := existing
+	if err := c.ShouldBindJSON(&flag); err != nil {
+		respondValidationError(c, err)
+		return
+	}
+	flag.ID = existing.ID
+	flag.Key = existing.Key
+	if flag.Type == "" {
+		flag.Type = FlagBoolean
+	}
+
+	// Save écrit aussi les valeurs zéro (enabled=false, rollout=0)
+	if err := h.db(c).Save(&flag).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur mise à jour"})
+		return
+	}
+	h.reload(c)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Flag mis à jour", "flag": flag})
+}
+
+// DELETE /admin/flags/:key
+func (h *FlagHandler) Delete(c *gin.Context) {
+	result := h.db(c).Where("flag_key = ?", c.Param("key")).Delete(&FeatureFlag{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur suppression"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Flag non trouvé"})
+		return
+	}
+	h.reload(c)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Flag supprimé"})
+}
+
+// reload applique immédiatement une modification sur cette instance ;
+// les autres instances la verront au prochain rechargement périodique.
+func (h *FlagHandler) reload(c *gin.Context) {
+	if err := h.store.Reload(c.Request.Context()); err != nil {
+		fmt.Printf("[FLAGS] Erreur de rechargement: %v\n", err)
+	}
+}
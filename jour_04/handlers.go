@@ -0,0 +1,677 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// parseID lit le paramètre :id ; répond 400 et retourne false s'il est invalide
+func parseID(c *gin.Context) (uint, bool) {
+	return parseParamID(c, "id")
+}
+
+// parseParamID lit un paramètre d'URL numérique (:comment_id...)
+func parseParamID(c *gin.Context, name string) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param(name), 10, 32)
+	if err != nil || id == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID invalide"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// callerID retourne l'utilisateur authentifié par TenantMiddleware : claim
+// "sub" du token, ou X-User-ID avec AUTH_TRUST_USER_HEADER=true (0 si aucun)
+func callerID(c *gin.Context) uint {
+	return callerOf(c.Request.Context())
+}
+
+// requireCaller répond 401 et retourne false sans utilisateur authentifié
+func requireCaller(c *gin.Context) (uint, bool) {
+	id := callerID(c)
+	if id == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Utilisateur authentifié requis (claim sub du token)"})
+		return 0, false
+	}
+	return id, true
+}
+
+// bindUpdate décode le corps JSON dans dst et retourne les champs envoyés
+// (noms Go, hors ID et relations) pour que la mise à jour n'écrive qu'eux,
+// valeurs zéro comprises. Seuls ces champs sont validés : un corps partiel
+// n'échoue pas sur les champs required absents. Répond 400 et retourne
+// false si le corps est invalide.
+func bindUpdate(c *gin.Context, dst interface{}) ([]string, bool) {
+	body, err := c.GetRawData()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Corps de requête illisible"})
+		return nil, false
+	}
+	if err := json.Unmarshal(body, dst); err != nil {
+		respondValidationError(c, err)
+		return nil, false
+	}
+
+	var sent map[string]json.RawMessage
+	if err := json.Unmarshal(body, &sent); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Objet JSON attendu"})
+		return nil, false
+	}
+
+	var fields []string
+	t := reflect.TypeOf(dst).Elem()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := strings.SplitN(f.Tag.Get("json"), ",", 2)[0]
+		if _, ok := sent[name]; !ok || f.Name == "ID" {
+			continue
+		}
+		switch f.Type.Kind() {
+		case reflect.Slice, reflect.Ptr, reflect.Struct:
+			continue
+		}
+		fields = append(fields, f.Name)
+	}
+	if len(fields) == 0 {
+		return nil, true
+	}
+
+	// validator.Validate : moteur de Gin, vérifié par registerValidators
+	v := binding.Validator.Engine().(*validator.Validate)
+	if err := v.StructPartial(dst, fields...); err != nil {
+		respondValidationError(c, err)
+		return nil, false
+	}
+	return fields, true
+}
+
+// === USERS HANDLERS ===
+
+type UserHandler struct {
+	users *UserService
+}
+
+func NewUserHandler(users *UserService) *UserHandler {
+	return &UserHandler{users: users}
+}
+
+// respondUserError traduit les erreurs du service en réponse HTTP
+func respondUserError(c *gin.Context, err error, fallback string) {
+	var restrict *RestrictError
+	var conflict *ConflictError
+	switch {
+	case errors.As(err, &restrict):
+		c.JSON(http.StatusConflict, gin.H{
+			"error":    "Suppression impossible : des enregistrements liés existent",
+			"relation": restrict.Relation,
+			"count":    restrict.Count,
+		})
+	case errors.Is(err, ErrTombstoneDelete):
+		c.JSON(http.StatusConflict, gin.H{"error": "L'utilisateur de remplacement ne peut pas être supprimé"})
+	case errors.Is(err, ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Utilisateur non trouvé"})
+	case errors.Is(err, ErrNotTrashed):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Utilisateur absent de la corbeille"})
+	case errors.As(err, &conflict):
+		message := "Valeur déjà utilisée"
+		if conflict.Field == "email" {
+			message = "Email déjà utilisé"
+		}
+		c.JSON(http.StatusConflict, gin.H{"error": message, "field": conflict.Field})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
+
+// GET /v1/users?fields=id,name&include=posts,posts.tags&filter=age >= 30
+func (h *UserHandler) List(c *gin.Context) {
+	opts, ok := parseReadOptions(c, userReadable)
+	if !ok {
+		return
+	}
+	if opts.Filter, ok = parseFilter(c, userFilterable); !ok {
+		return
+	}
+
+	users, err := h.users.List(c.Request.Context(), opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur BD"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"users": sparse(users, opts), "total": len(users)})
+}
+
+// GET /v1/users/:id?fields=...&include=...
+func (h *UserHandler) Get(c *gin.Context) {
+	id, ok := parseID(c)
+	if !ok {
+		return
+	}
+	opts, ok := parseReadOptions(c, userReadable)
+	if !ok {
+		return
+	}
+
+	user, err := h.users.Get(c.Request.Context(), id, opts)
+	if err != nil {
+		respondUserError(c, err, "Erreur BD")
+		return
+	}
+	c.JSON(http.StatusOK, sparse(user, opts))
+}
+
+// POST /v1/users
+func (h *UserHandler) Create(c *gin.Context) {
+	var user User
+
+	if err := c.ShouldBindJSON(&user); err != nil {
+		respondValidationError(c, err)
+		return
+	}
+
+	if err := h.users.Create(c.Request.Context(), &user); err != nil {
+		respondUserError(c, err, "Erreur création")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Utilisateur créé", "user": user})
+}
+
+// PUT /v1/users/:id
+func (h *UserHandler) Update(c *gin.Context) {
+	id, ok := parseID(c)
+	if !ok {
+		return
+	}
+
+	var user User
+	fields, ok := bindUpdate(c, &user)
+	if !ok {
+		return
+	}
+
+	if err := h.users.Update(c.Request.Context(), id, &user, fields); err != nil {
+		respondUserError(c, err, "Erreur mise à jour")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Utilisateur mis à jour", "user": user})
+}
+
+// DELETE /v1/users/:id
+func (h *UserHandler) Delete(c *gin.Context) {
+	id, ok := parseID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.users.Delete(c.Request.Context(), id); err != nil {
+		respondUserError(c, err, "Erreur suppression")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Utilisateur supprimé"})
+}
+
+// POST /v1/users/:id/restore?with_posts=true
+func (h *UserHandler) Restore(c *gin.Context) {
+	id, ok := parseID(c)
+	if !ok {
+		return
+	}
+	withPosts, err := strconv.ParseBool(c.DefaultQuery("with_posts", "false"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "with_posts doit valoir true ou false"})
+		return
+	}
+
+	user, err := h.users.Restore(c.Request.Context(), id, withPosts)
+	if err != nil {
+		respondUserError(c, err, "Erreur restauration")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Utilisateur restauré", "user": user})
+}
+
+// GET /v1/users/:id/posts
+func (h *UserHandler) Posts(c *gin.Context) {
+	id, ok := parseID(c)
+	if !ok {
+		return
+	}
+
+	user, err := h.users.Get(c.Request.Context(), id, ReadOptions{Include: []string{"posts"}})
+	if err != nil {
+		respondUserError(c, err, "Erreur BD")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user":        user.Name,
+		"posts_count": len(user.Posts),
+		"posts":       user.Posts,
+	})
+}
+
+// === POSTS HANDLERS ===
+
+type PostHandler struct {
+	posts *PostService
+}
+
+func NewPostHandler(posts *PostService) *PostHandler {
+	return &PostHandler{posts: posts}
+}
+
+func respondPostError(c *gin.Context, err error, fallback string) {
+	var unknown *UnknownTagsError
+	switch {
+	case errors.As(err, &unknown):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Tags inconnus", "tags": unknown.Names})
+	case errors.Is(err, ErrPostNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Post non trouvé"})
+	case errors.Is(err, ErrNotTrashed):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Post absent de la corbeille"})
+	case errors.Is(err, ErrAuthorTrashed):
+		c.JSON(http.StatusConflict, gin.H{"error": "Auteur à la corbeille : restaurer l'utilisateur d'abord"})
+	case errors.Is(err, ErrAuthorNotFound):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Utilisateur non trouvé"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
+
+// GET /v1/posts?tag=go&tag=gin&match=any|all&fields=...&include=user,tags&filter=...
+func (h *PostHandler) List(c *gin.Context) {
+	opts, ok := parseReadOptions(c, postReadable)
+	if !ok {
+		return
+	}
+	if opts.Filter, ok = parseFilter(c, postFilterable); !ok {
+		return
+	}
+
+	filter := PostFilter{Tags: c.QueryArray("tag")}
+	switch c.DefaultQuery("match", "any") {
+	case "any":
+	case "all":
+		filter.MatchAll = true
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "match doit valoir any ou all"})
+		return
+	}
+
+	posts, err := h.posts.List(c.Request.Context(), filter, opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur BD"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"posts": sparse(posts, opts), "total": len(posts)})
+}
+
+// GET /v1/posts/:id?fields=...&include=...
+func (h *PostHandler) Get(c *gin.Context) {
+	id, ok := parseID(c)
+	if !ok {
+		return
+	}
+	opts, ok := parseReadOptions(c, postReadable)
+	if !ok {
+		return
+	}
+
+	post, err := h.posts.Get(c.Request.Context(), id, opts)
+	if err != nil {
+		respondPostError(c, err, "Erreur BD")
+		return
+	}
+	c.JSON(http.StatusOK, sparse(post, opts))
+}
+
+// POST /v1/posts
+func (h *PostHandler) Create(c *gin.Context) {
+	var post Post
+
+	if err := c.ShouldBindJSON(&post); err != nil {
+		respondValidationError(c, err)
+		return
+	}
+
+	if err := h.posts.Create(c.Request.Context(), &post); err != nil {
+		respondPostError(c, err, "Erreur création")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Post créé", "post": post})
+}
+
+// PUT /v1/posts/:id
+func (h *PostHandler) Update(c *gin.Context) {
+	id, ok := parseID(c)
+	if !ok {
+		return
+	}
+
+	var post Post
+	fields, ok := bindUpdate(c, &post)
+	if !ok {
+		return
+	}
+
+	if err := h.posts.Update(c.Request.Context(), id, &post, fields); err != nil {
+		respondPostError(c, err, "Erreur mise à jour")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Post mis à jour", "post": post})
+}
+
+// DELETE /v1/posts/:id
+func (h *PostHandler) Delete(c *gin.Context) {
+	id, ok := parseID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.posts.Delete(c.Request.Context(), id); err != nil {
+		respondPostError(c, err, "Erreur suppression")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Post supprimé"})
+}
+
+// POST /v1/posts/:id/restore
+func (h *PostHandler) Restore(c *gin.Context) {
+	id, ok := parseID(c)
+	if !ok {
+		return
+	}
+
+	post, err := h.posts.Restore(c.Request.Context(), id)
+	if err != nil {
+		respondPostError(c, err, "Erreur restauration")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Post restauré", "post": post})
+}
+
+// tagsRequest : corps de POST et DELETE /v1/posts/:id/tags
+type tagsRequest struct {
+	Tags []string `json:"tags" binding:"required,min=1,dive,slug"`
+}
+
+// POST /v1/posts/:id/tags
+func (h *PostHandler) AttachTags(c *gin.Context) {
+	h.changeTags(c, h.posts.AttachTags)
+}
+
+// DELETE /v1/posts/:id/tags
+func (h *PostHandler) DetachTags(c *gin.Context) {
+	h.changeTags(c, h.posts.DetachTags)
+}
+
+func (h *PostHandler) changeTags(c *gin.Context,
+	apply func(ctx context.Context, postID uint, names []string) (*Post, error)) {
+	id, ok := parseID(c)
+	if !ok {
+		return
+	}
+
+	var req tagsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondValidationError(c, err)
+		return
+	}
+
+	post, err := apply(c.Request.Context(), id, req.Tags)
+	if err != nil {
+		respondPostError(c, err, "Erreur de mise à jour des tags")
+		return
+	}
+	c.JSON(http.StatusOK, post)
+}
+
+// === TAGS HANDLERS ===
+
+type TagHandler struct {
+	tags *TagService
+}
+
+func NewTagHandler(tags *TagService) *TagHandler {
+	return &TagHandler{tags: tags}
+}
+
+// GET /v1/tags - tags avec leur nombre de posts
+func (h *TagHandler) List(c *gin.Context) {
+	tags, err := h.tags.List(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur BD"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"tags": tags, "total": len(tags)})
+}
+
+// POST /v1/tags
+func (h *TagHandler) Create(c *gin.Context) {
+	var tag Tag
+
+	if err := c.ShouldBindJSON(&tag); err != nil {
+		respondValidationError(c, err)
+		return
+	}
+
+	if err := h.tags.Create(c.Request.Context(), &tag); err != nil {
+		if errors.Is(err, ErrTagTaken) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Tag déjà existant"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur création"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Tag créé", "tag": tag})
+}
+
+// === COMMENTS HANDLERS ===
+
+type CommentHandler struct {
+	comments *CommentService
+}
+
+func NewCommentHandler(comments *CommentService) *CommentHandler {
+	return &CommentHandler{comments: comments}
+}
+
+func respondCommentError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, ErrPostNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Post non trouvé"})
+	case errors.Is(err, ErrCommentNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Commentaire non trouvé"})
+	case errors.Is(err, ErrAuthorNotFound):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Utilisateur non trouvé"})
+	case errors.Is(err, ErrParentNotFound):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Commentaire parent non trouvé sur ce post"})
+	case errors.Is(err, ErrMaxDepth):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Profondeur maximale de réponse atteinte"})
+	case errors.Is(err, ErrNotAuthor):
+		c.JSON(http.StatusForbidden, gin.H{"error": "Seul l'auteur peut modifier ce commentaire"})
+	case errors.Is(err, ErrEditWindowClosed):
+		c.JSON(http.StatusForbidden, gin.H{"error": "Délai de modification dépassé"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
+
+// commentRequest : corps de POST /v1/posts/:id/comments
+type commentRequest struct {
+	Content  string `json:"content" binding:"required,max=2000"`
+	ParentID *uint  `json:"parent_id"`
+}
+
+// commentUpdateRequest : corps de PUT /v1/posts/:id/comments/:comment_id
+type commentUpdateRequest struct {
+	Content string `json:"content" binding:"required,max=2000"`
+}
+
+// GET /v1/posts/:id/comments?format=flat|tree
+func (h *CommentHandler) List(c *gin.Context) {
+	postID, ok := parseID(c)
+	if !ok {
+		return
+	}
+
+	var (
+		comments []Comment
+		err      error
+	)
+	switch c.DefaultQuery("format", "flat") {
+	case "flat":
+		comments, err = h.comments.List(c.Request.Context(), postID)
+	case "tree":
+		comments, err = h.comments.Tree(c.Request.Context(), postID)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format doit valoir flat ou tree"})
+		return
+	}
+	if err != nil {
+		respondCommentError(c, err, "Erreur BD")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"comments": comments, "total": len(comments)})
+}
+
+// GET /v1/posts/:id/comments/:comment_id
+func (h *CommentHandler) Get(c *gin.Context) {
+	postID, ok := parseID(c)
+	if !ok {
+		return
+	}
+	id, ok := parseParamID(c, "comment_id")
+	if !ok {
+		return
+	}
+
+	comment, err := h.comments.Get(c.Request.Context(), postID, id)
+	if err != nil {
+		respondCommentError(c, err, "Erreur BD")
+		return
+	}
+	c.JSON(http.StatusOK, comment)
+}
+
+// POST /v1/posts/:id/comments (auteur : l'appelant)
+func (h *CommentHandler) Create(c *gin.Context) {
+	postID, ok := parseID(c)
+	if !ok {
+		return
+	}
+	authorID, ok := requireCaller(c)
+	if !ok {
+		return
+	}
+
+	var req commentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondValidationError(c, err)
+		return
+	}
+
+	comment := Comment{Content: req.Content, ParentID: req.ParentID}
+	if err := h.comments.Create(c.Request.Context(), postID, authorID, &comment); err != nil {
+		respondCommentError(c, err, "Erreur création")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Commentaire créé", "comment": comment})
+}
+
+// PUT /v1/posts/:id/comments/:comment_id (auteur uniquement)
+func (h *CommentHandler) Update(c *gin.Context) {
+	postID, ok := parseID(c)
+	if !ok {
+		return
+	}
+	id, ok := parseParamID(c, "comment_id")
+	if !ok {
+		return
+	}
+	caller, ok := requireCaller(c)
+	if !ok {
+		return
+	}
+
+	var req commentUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondValidationError(c, err)
+		return
+	}
+
+	comment, err := h.comments.Update(c.Request.Context(), postID, id, caller, req.Content)
+	if err != nil {
+		respondCommentError(c, err, "Erreur mise à jour")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Commentaire mis à jour", "comment": comment})
+}
+
+// DELETE /v1/posts/:id/comments/:comment_id (auteur uniquement, réponses comprises)
+func (h *CommentHandler) Delete(c *gin.Context) {
+	postID, ok := parseID(c)
+	if !ok {
+		return
+	}
+	id, ok := parseParamID(c, "comment_id")
+	if !ok {
+		return
+	}
+	caller, ok := requireCaller(c)
+	if !ok {
+		return
+	}
+
+	if err := h.comments.Delete(c.Request.Context(), postID, id, caller); err != nil {
+		respondCommentError(c, err, "Erreur suppression")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Commentaire supprimé"})
+}
+
+// === SEARCH HANDLERS ===
+
+type SearchHandler struct {
+	search *SearchService
+}
+
+func NewSearchHandler(search *SearchService) *SearchHandler {
+	return &SearchHandler{search: search}
+}
+
+// GET /v1/search?q=gorm+sqlite&limit=20
+func (h *SearchHandler) Search(c *gin.Context) {
+	query := c.Query("q")
+	limit, _ := strconv.Atoi(c.Query("limit"))
+
+	hits, err := h.search.Search(c.Request.Context(), query, limit)
+	if err != nil {
+		if errors.Is(err, ErrEmptyQuery) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Paramètre q requis"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur de recherche"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"query": query, "results": hits, "total": len(hits)})
+}
@@ -0,0 +1,504 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// === GRAND LIVRE (partie double) ===
+//
+// Les soldes ne s'écrivent jamais directement : tout mouvement d'argent est
+// une écriture (JournalEntry) faite de lignes qui débitent un compte et en
+// créditent un autre du même montant, en unités mineures entières (XAF n'a
+// pas de centimes). Une écriture est donc équilibrée par construction ; la
+// base le garantit (CHECK sur les lignes) et refuse toute modification des
+// écritures (triggers, voir la migration create_ledger). Une correction est
+// une nouvelle écriture, en sens inverse.
+//
+// Le solde d'un compte est crédits - débits. accounts.balance en est le
+// cache, mis à jour dans la transaction de l'écriture ; `GET
+// /admin/ledger/check` le compare à la somme des lignes. Un portefeuille ne
+// peut pas passer sous zéro (CHECK en base) ; les comptes système (frais,
+// attente) le peuvent : le compte d'attente est la contrepartie de l'argent
+// entré ou sorti de la plateforme.
+
+// Types de compte
+const (
+	AccountWallet   = "wallet"   // portefeuille d'un utilisateur
+	AccountFees     = "fees"     // frais perçus par la plateforme
+	AccountSuspense = "suspense" // compte d'attente (dépôts, retraits en cours)
+)
+
+// ledgerCurrency : devise des comptes (une seule pour l'instant)
+const ledgerCurrency = "XAF"
+
+// Account : compte du grand livre. Code est unique par tenant :
+// "wallet:<user_id>" pour un portefeuille, "fees" ou "suspense" sinon.
+type Account struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	TenantID  string    `gorm:"size:64;not null;uniqueIndex:idx_accounts_tenant_code,priority:1" json:"-"`
+	Code      string    `gorm:"size:64;not null;uniqueIndex:idx_accounts_tenant_code,priority:2" json:"code"`
+	Kind      string    `gorm:"size:16;not null" json:"kind"`
+	UserID    *uint     `gorm:"index" json:"user_id,omitempty"`
+	Currency  string    `gorm:"size:3;not null;default:XAF" json:"currency"`
+	Balance   int64     `gorm:"not null;default:0" json:"balance"`    // cache : crédits - débits
+	Frozen    bool      `gorm:"not null;default:false" json:"frozen"` // gelé : plus de virements
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// JournalEntry : écriture comptable, immuable une fois enregistrée
+type JournalEntry struct {
+	ID          uint          `gorm:"primaryKey" json:"id"`
+	TenantID    string        `gorm:"size:64;not null;index" json:"-"`
+	Description string        `gorm:"not null" json:"description"`
+	CreatedAt   time.Time     `json:"created_at"`
+	Lines       []JournalLine `gorm:"foreignKey:EntryID" json:"lines"`
+}
+
+// JournalLine : Amount passe du compte débité au compte crédité
+type JournalLine struct {
+	ID              uint   `gorm:"primaryKey" json:"id"`
+	TenantID        string `gorm:"size:64;not null;index" json:"-"`
+	EntryID         uint   `gorm:"not null;index" json:"entry_id"`
+	DebitAccountID  uint   `gorm:"not null;index" json:"debit_account_id"`
+	CreditAccountID uint   `gorm:"not null;index" json:"credit_account_id"`
+	Amount          int64  `gorm:"not null" json:"amount"`
+}
+
+// Deltas : variation du solde de chaque compte touché par l'écriture
+func (e *JournalEntry) Deltas() map[uint]int64 {
+	deltas := map[uint]int64{}
+	for _, l := range e.Lines {
+		deltas[l.DebitAccountID] -= l.Amount
+		deltas[l.CreditAccountID] += l.Amount
+	}
+	return deltas
+}
+
+// walletCode : code du portefeuille d'un utilisateur
+func walletCode(userID uint) string {
+	return "wallet:" + strconv.FormatUint(uint64(userID), 10)
+}
+
+// BalanceMismatch : compte dont le solde en cache diffère de ses lignes
+type BalanceMismatch struct {
+	Tenant    string `json:"tenant"`
+	AccountID uint   `json:"account_id"`
+	Code      string `json:"code"`
+	Balance   int64  `json:"balance"`
+	Computed  int64  `json:"computed"`
+}
+
+type LedgerRepository interface {
+	// GetAccount retourne un compte, ou ErrNotFound
+	GetAccount(ctx context.Context, id uint) (*Account, error)
+	// GetAccountByCode retourne le compte de ce code, ou ErrNotFound
+	GetAccountByCode(ctx context.Context, code string) (*Account, error)
+	// CreateAccount insère le compte ; *ConflictError si le code existe
+	CreateAccount(ctx context.Context, account *Account) error
+	// LockAccounts relit les comptes ids, triés par ID, verrouillés jusqu'à
+	// la fin de la transaction (SELECT ... FOR UPDATE) ; ErrNotFound s'il en
+	// manque un
+	LockAccounts(ctx context.Context, ids []uint) ([]Account, error)
+	// Post insère l'écriture et ses lignes puis met à jour le solde des
+	// comptes touchés ; à appeler dans une unité de travail
+	Post(ctx context.Context, entry *JournalEntry) error
+	// ListEntries retourne les écritures (avec toutes leurs lignes) qui
+	// touchent le compte, les plus récentes d'abord : au plus limit, d'ID
+	// inférieur à before (0 = depuis la dernière)
+	ListEntries(ctx context.Context, accountID, before uint, limit int) ([]JournalEntry, error)
+	// SetFrozen gèle ou dégèle le compte ; ErrNotFound s'il n'existe pas
+	SetFrozen(ctx context.Context, id uint, frozen bool) error
+	// Check retourne, pour tous les tenants, les comptes dont le solde
+	// diffère de la somme de leurs lignes
+	Check(ctx context.Context) ([]BalanceMismatch, error)
+}
+
+// === SERVICE ===
+
+var (
+	ErrAccountNotFound   = errors.New("compte non trouvé")
+	ErrInsufficientFunds = errors.New("solde insuffisant")
+	ErrSameAccount       = errors.New("débit et crédit sur le même compte")
+	ErrCurrencyMismatch  = errors.New("comptes de devises différentes")
+	ErrEmptyEntry        = errors.New("écriture sans ligne")
+)
+
+const (
+	defaultEntriesLimit = 20
+	maxEntriesLimit     = 100
+)
+
+// AccountEntry : écriture vue depuis un compte ; Amount est la variation du
+// solde de ce compte (négative pour un débit)
+type AccountEntry struct {
+	JournalEntry
+	Amount int64 `json:"amount"`
+}
+
+type LedgerService struct {
+	ledger LedgerRepository
+	users  UserRepository
+	uow    UnitOfWork
+}
+
+func NewLedgerService(ledger LedgerRepository, users UserRepository, uow UnitOfWork) *LedgerService {
+	return &LedgerService{ledger: ledger, users: users, uow: uow}
+}
+
+// Account retourne un compte avec son solde
+func (s *LedgerService) Account(ctx context.Context, id uint) (*Account, error) {
+	account, err := s.ledger.GetAccount(ctx, id)
+	if errors.Is(err, ErrNotFound) {
+		return nil, ErrAccountNotFound
+	}
+	return account, err
+}
+
+// Wallet retourne le portefeuille de l'utilisateur, créé au premier appel
+func (s *LedgerService) Wallet(ctx context.Context, userID uint) (*Account, error) {
+	if _, err := s.users.Get(ctx, userID, ReadOptions{}); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	return s.ensureAccount(ctx, Account{Code: walletCode(userID), Kind: AccountWallet, UserID: &userID})
+}
+
+// SystemAccount retourne le compte système kind (fees, suspense), créé au
+// premier appel
+func (s *LedgerService) SystemAccount(ctx context.Context, kind string) (*Account, error) {
+	if kind != AccountFees && kind != AccountSuspense {
+		return nil, ErrAccountNotFound
+	}
+	return s.ensureAccount(ctx, Account{Code: kind, Kind: kind})
+}
+
+// Resolve retourne le compte désigné par son code ("wallet:12", "fees",
+// "suspense"), créé au premier appel
+func (s *LedgerService) Resolve(ctx context.Context, code string) (*Account, error) {
+	if rest, ok := strings.CutPrefix(code, "wallet:"); ok {
+		userID, err := strconv.ParseUint(rest, 10, 32)
+		if err != nil || userID == 0 {
+			return nil, ErrAccountNotFound
+		}
+		return s.Wallet(ctx, uint(userID))
+	}
+	return s.SystemAccount(ctx, code)
+}
+
+// ensureAccount lit le compte de ce code ou le crée. Deux créations
+// concurrentes : l'index unique en garde une, l'autre relit (savepoint pour
+// que l'échec n'annule pas la transaction englobante).
+func (s *LedgerService) ensureAccount(ctx context.Context, account Account) (*Account, error) {
+	existing, err := s.ledger.GetAccountByCode(ctx, account.Code)
+	if !errors.Is(err, ErrNotFound) {
+		return existing, err
+	}
+
+	account.Currency = ledgerCurrency
+	err = s.uow.Do(ctx, func(ctx context.Context) error {
+		return s.ledger.CreateAccount(ctx, &account)
+	})
+	if errors.Is(err, ErrConflict) {
+		return s.ledger.GetAccountByCode(usePrimary(ctx), account.Code)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+// SetFrozen gèle ou dégèle un compte et le retourne à jour
+func (s *LedgerService) SetFrozen(ctx context.Context, id uint, frozen bool) (*Account, error) {
+	err := s.uow.Do(ctx, func(ctx context.Context) error {
+		return s.ledger.SetFrozen(ctx, id, frozen)
+	})
+	if errors.Is(err, ErrNotFound) {
+		return nil, ErrAccountNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.ledger.GetAccount(usePrimary(ctx), id)
+}
+
+// Lock relit les comptes, triés par ID, verrouillés jusqu'à la fin de
+// l'unité de travail en cours
+func (s *LedgerService) Lock(ctx context.Context, ids ...uint) ([]Account, error) {
+	accounts, err := s.ledger.LockAccounts(ctx, ids)
+	if errors.Is(err, ErrNotFound) {
+		return nil, ErrAccountNotFound
+	}
+	return accounts, err
+}
+
+// Post enregistre l'écriture : les comptes touchés sont verrouillés, les
+// portefeuilles doivent rester positifs. entry est rechargée (IDs, date).
+// Le gel d'un compte ne bloque pas les écritures (corrections) : seuls les
+// virements et les retraits le vérifient.
+func (s *LedgerService) Post(ctx context.Context, entry *JournalEntry) error {
+	if len(entry.Lines) == 0 {
+		return ErrEmptyEntry
+	}
+	for _, l := range entry.Lines {
+		if l.DebitAccountID == l.CreditAccountID {
+			return ErrSameAccount
+		}
+	}
+
+	return s.uow.Do(ctx, func(ctx context.Context) error {
+		deltas := entry.Deltas()
+		accounts, err := s.Lock(ctx, slices.Collect(maps.Keys(deltas))...)
+		if err != nil {
+			return err
+		}
+		for _, a := range accounts {
+			if a.Currency != accounts[0].Currency {
+				return ErrCurrencyMismatch
+			}
+			if a.Kind == AccountWallet && a.Balance+deltas[a.ID] < 0 {
+				return fmt.Errorf("%w sur %s", ErrInsufficientFunds, a.Code)
+			}
+		}
+		return s.ledger.Post(ctx, entry)
+	})
+}
+
+// Entries retourne une page des écritures du compte, les plus récentes
+// d'abord, et le curseur de la page suivante (0 s'il n'y en a pas) ; limit
+// est ramené entre 1 et maxEntriesLimit (defaultEntriesLimit si 0)
+func (s *LedgerService) Entries(ctx context.Context, accountID, before uint, limit int) ([]AccountEntry, uint, error) {
+	if _, err := s.Account(ctx, accountID); err != nil {
+		return nil, 0, err
+	}
+	if limit <= 0 {
+		limit = defaultEntriesLimit
+	}
+	limit = min(limit, maxEntriesLimit)
+
+	// Une écriture de plus pour savoir s'il reste une page
+	entries, err := s.ledger.ListEntries(ctx, accountID, before, limit+1)
+	if err != nil {
+		return nil, 0, err
+	}
+	var next uint
+	if len(entries) > limit {
+		entries = entries[:limit]
+		next = entries[limit-1].ID
+	}
+
+	result := make([]AccountEntry, len(entries))
+	for i, e := range entries {
+		result[i] = AccountEntry{JournalEntry: e, Amount: e.Deltas()[accountID]}
+	}
+	return result, next, nil
+}
+
+// Check compare le solde de chaque compte à la somme de ses lignes
+func (s *LedgerService) Check(ctx context.Context) ([]BalanceMismatch, error) {
+	mismatches, err := s.ledger.Check(ctx)
+	if mismatches == nil {
+		mismatches = []BalanceMismatch{}
+	}
+	return mismatches, err
+}
+
+// === HANDLERS ===
+
+type LedgerHandler struct {
+	ledger *LedgerService
+}
+
+func NewLedgerHandler(ledger *LedgerService) *LedgerHandler {
+	return &LedgerHandler{ledger: ledger}
+}
+
+func respondLedgerError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, ErrAccountNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Compte non trouvé"})
+	case errors.Is(err, ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Utilisateur non trouvé"})
+	case errors.Is(err, ErrInsufficientFunds):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Solde insuffisant", "code": "insufficient_funds"})
+	case errors.Is(err, ErrSameAccount):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Une ligne doit débiter et créditer deux comptes différents"})
+	case errors.Is(err, ErrCurrencyMismatch):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Les comptes d'une écriture doivent avoir la même devise"})
+	case errors.Is(err, ErrEmptyEntry):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Une écriture doit avoir au moins une ligne"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
+
+// GET /v1/accounts/:id
+func (h *LedgerHandler) Get(c *gin.Context) {
+	id, ok := parseID(c)
+	if !ok {
+		return
+	}
+
+	account, err := h.ledger.Account(c.Request.Context(), id)
+	if err != nil {
+		respondLedgerError(c, err, "Erreur BD")
+		return
+	}
+	c.JSON(http.StatusOK, account)
+}
+
+// GET /v1/accounts/:id/balance
+func (h *LedgerHandler) Balance(c *gin.Context) {
+	id, ok := parseID(c)
+	if !ok {
+		return
+	}
+
+	account, err := h.ledger.Account(c.Request.Context(), id)
+	if err != nil {
+		respondLedgerError(c, err, "Erreur BD")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"account_id": account.ID,
+		"code":       account.Code,
+		"currency":   account.Currency,
+		"balance":    account.Balance,
+	})
+}
+
+// GET /v1/accounts/:id/entries?limit=20&before=<entry_id>
+func (h *LedgerHandler) Entries(c *gin.Context) {
+	id, ok := parseID(c)
+	if !ok {
+		return
+	}
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	var before uint
+	if raw := c.Query("before"); raw != "" {
+		n, err := strconv.ParseUint(raw, 10, 32)
+		if err != nil || n == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "before doit être un ID d'écriture"})
+			return
+		}
+		before = uint(n)
+	}
+
+	entries, next, err := h.ledger.Entries(c.Request.Context(), id, before, limit)
+	if err != nil {
+		respondLedgerError(c, err, "Erreur BD")
+		return
+	}
+	resp := gin.H{"entries": entries, "total": len(entries)}
+	if next != 0 {
+		resp["next_before"] = next
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// GET /v1/users/:id/wallet - portefeuille de l'utilisateur (créé au besoin)
+func (h *LedgerHandler) Wallet(c *gin.Context) {
+	id, ok := parseID(c)
+	if !ok {
+		return
+	}
+
+	account, err := h.ledger.Wallet(c.Request.Context(), id)
+	if err != nil {
+		respondLedgerError(c, err, "Erreur BD")
+		return
+	}
+	c.JSON(http.StatusOK, account)
+}
+
+// entryRequest : corps de POST /admin/ledger/entries ; les comptes sont
+// désignés par leur code
+type entryRequest struct {
+	Description string             `json:"description" binding:"required,max=255"`
+	Lines       []entryLineRequest `json:"lines" binding:"required,min=1,max=20,dive"`
+}
+
+type entryLineRequest struct {
+	Debit  string `json:"debit" binding:"required"`
+	Credit string `json:"credit" binding:"required"`
+	Amount int64  `json:"amount" binding:"required,xaf"`
+}
+
+// POST /admin/ledger/entries - écriture manuelle (dépôt, correction...)
+func (h *LedgerHandler) Post(c *gin.Context) {
+	var req entryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondValidationError(c, err)
+		return
+	}
+
+	ctx := c.Request.Context()
+	entry := JournalEntry{Description: req.Description}
+	for _, l := range req.Lines {
+		debit, err := h.ledger.Resolve(ctx, l.Debit)
+		if err != nil {
+			respondLedgerError(c, err, "Erreur BD")
+			return
+		}
+		credit, err := h.ledger.Resolve(ctx, l.Credit)
+		if err != nil {
+			respondLedgerError(c, err, "Erreur BD")
+			return
+		}
+		entry.Lines = append(entry.Lines, JournalLine{
+			DebitAccountID: debit.ID, CreditAccountID: credit.ID, Amount: l.Amount,
+		})
+	}
+
+	if err := h.ledger.Post(ctx, &entry); err != nil {
+		respondLedgerError(c, err, "Erreur d'écriture")
+		return
+	}
+	c.JSON(http.StatusCreated, entry)
+}
+
+// POST /admin/accounts/:id/freeze
+func (h *LedgerHandler) Freeze(c *gin.Context) {
+	h.setFrozen(c, true)
+}
+
+// POST /admin/accounts/:id/unfreeze
+func (h *LedgerHandler) Unfreeze(c *gin.Context) {
+	h.setFrozen(c, false)
+}
+
+func (h *LedgerHandler) setFrozen(c *gin.Context, frozen bool) {
+	id, ok := parseID(c)
+	if !ok {
+		return
+	}
+
+	account, err := h.ledger.SetFrozen(c.Request.Context(), id, frozen)
+	if err != nil {
+		respondLedgerError(c, err, "Erreur de mise à jour")
+		return
+	}
+	c.JSON(http.StatusOK, account)
+}
+
+// GET /admin/ledger/check - soldes en cache comparés aux lignes
+func (h *LedgerHandler) Check(c *gin.Context) {
+	mismatches, err := h.ledger.Check(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur BD"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": len(mismatches) == 0, "mismatches": mismatches})
+}
@@ -0,0 +1,390 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// === GRAND LIVRE : REPOSITORIES ===
+
+type gormLedgerRepository struct {
+	db *gorm.DB
+}
+
+func NewGormLedgerRepository(db *gorm.DB) LedgerRepository {
+	return &gormLedgerRepository{db: db}
+}
+
+func (r *gormLedgerRepository) GetAccount(ctx context.Context, id uint) (*Account, error) {
+	var account Account
+	if err := dbFromContext(ctx, r.db).First(&account, id).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &account, nil
+}
+
+func (r *gormLedgerRepository) GetAccountByCode(ctx context.Context, code string) (*Account, error) {
+	var account Account
+	if err := dbFromContext(ctx, r.db).Where("code = ?", code).First(&account).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &account, nil
+}
+
+func (r *gormLedgerRepository) CreateAccount(ctx context.Context, account *Account) error {
+	return translateError(dbFromContext(ctx, r.db).Create(account).Error)
+}
+
+func (r *gormLedgerRepository) LockAccounts(ctx context.Context, ids []uint) ([]Account, error) {
+	var accounts []Account
+	err := dbFromContext(ctx, r.db).Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id IN ?", ids).Order("id").Find(&accounts).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(accounts) != len(ids) {
+		return nil, ErrNotFound
+	}
+	return accounts, nil
+}
+
+func (r *gormLedgerRepository) Post(ctx context.Context, entry *JournalEntry) error {
+	tx := dbFromContext(ctx, r.db)
+	if err := tx.Omit(clause.Associations).Create(entry).Error; err != nil {
+		return err
+	}
+	for i := range entry.Lines {
+		entry.Lines[i].EntryID = entry.ID
+	}
+	if err := tx.Create(&entry.Lines).Error; err != nil {
+		return err
+	}
+
+	// Soldes mis à jour dans l'ordre des IDs (même ordre que les verrous)
+	deltas := entry.Deltas()
+	ids := slices.Sorted(maps.Keys(deltas))
+	for _, id := range ids {
+		err := tx.Model(&Account{}).Where("id = ?", id).Updates(map[string]interface{}{
+			"balance":    gorm.Expr("balance + ?", deltas[id]),
+			"updated_at": entry.CreatedAt,
+		}).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *gormLedgerRepository) ListEntries(ctx context.Context, accountID, before uint, limit int) ([]JournalEntry, error) {
+	conn := dbFromContext(ctx, r.db)
+	touching := conn.Model(&JournalLine{}).Select("entry_id").
+		Where("debit_account_id = ? OR credit_account_id = ?", accountID, accountID)
+
+	query := conn.Where("id IN (?)", touching).
+		Preload("Lines", func(db *gorm.DB) *gorm.DB { return db.Order("journal_lines.id") }).
+		Order("id DESC").Limit(limit)
+	if before > 0 {
+		query = query.Where("id < ?", before)
+	}
+
+	var entries []JournalEntry
+	if err := query.Find(&entries).Error; err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func (r *gormLedgerRepository) SetFrozen(ctx context.Context, id uint, frozen bool) error {
+	// Lecture d'abord : MySQL ne compte pas une ligne déjà à la bonne valeur
+	account, err := r.GetAccount(ctx, id)
+	if err != nil {
+		return err
+	}
+	return dbFromContext(ctx, r.db).Model(account).Update("frozen", frozen).Error
+}
+
+// Check : SQL brut, sur tous les tenants (hors callbacks de tenant)
+func (r *gormLedgerRepository) Check(ctx context.Context) ([]BalanceMismatch, error) {
+	var mismatches []BalanceMismatch
+	err := dbFromContext(ctx, r.db).Raw(`
+		SELECT tenant, account_id, code, balance, computed FROM (
+			SELECT a.tenant_id AS tenant, a.id AS account_id, a.code AS code, a.balance AS balance,
+				COALESCE((SELECT SUM(l.amount) FROM journal_lines l WHERE l.credit_account_id = a.id), 0) -
+				COALESCE((SELECT SUM(l.amount) FROM journal_lines l WHERE l.debit_account_id = a.id), 0) AS computed
+			FROM accounts a
+		) t
+		WHERE balance <> computed
+		ORDER BY account_id`).Scan(&mismatches).Error
+	return mismatches, err
+}
+
+// --- En mémoire ---
+
+type memoryLedgerRepository struct {
+	s *MemoryStore
+}
+
+func (s *MemoryStore) Ledger() LedgerRepository { return &memoryLedgerRepository{s} }
+
+func (r *memoryLedgerRepository) GetAccount(_ context.Context, id uint) (*Account, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	a, ok := r.s.accounts[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &a, nil
+}
+
+func (r *memoryLedgerRepository) GetAccountByCode(_ context.Context, code string) (*Account, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	for _, a := range r.s.accounts {
+		if a.Code == code {
+			return &a, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *memoryLedgerRepository) CreateAccount(_ context.Context, account *Account) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, a := range r.s.accounts {
+		if a.Code == account.Code {
+			return &ConflictError{Field: "code"}
+		}
+	}
+	account.ID = r.s.nextAccountID
+	r.s.nextAccountID++
+	account.CreatedAt = time.Now()
+	account.UpdatedAt = account.CreatedAt
+	r.s.accounts[account.ID] = *account
+	return nil
+}
+
+// LockAccounts : les unités de travail en mémoire sont déjà sérialisées
+func (r *memoryLedgerRepository) LockAccounts(_ context.Context, ids []uint) ([]Account, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	accounts := make([]Account, 0, len(ids))
+	for _, id := range ids {
+		a, ok := r.s.accounts[id]
+		if !ok {
+			return nil, ErrNotFound
+		}
+		accounts = append(accounts, a)
+	}
+	sort.Slice(accounts, func(i, j int) bool { return accounts[i].ID < accounts[j].ID })
+	return accounts, nil
+}
+
+// Post applique les contraintes de la base (lignes positives, portefeuilles
+// jamais négatifs) avant d'écrire
+func (r *memoryLedgerRepository) Post(_ context.Context, entry *JournalEntry) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	deltas := entry.Deltas()
+	for id, delta := range deltas {
+		a, ok := r.s.accounts[id]
+		if !ok {
+			return fmt.Errorf("compte %d inexistant", id)
+		}
+		if a.Kind == AccountWallet && a.Balance+delta < 0 {
+			return fmt.Errorf("solde négatif refusé sur %s", a.Code)
+		}
+	}
+	for _, l := range entry.Lines {
+		if l.Amount <= 0 || l.DebitAccountID == l.CreditAccountID {
+			return fmt.Errorf("ligne invalide (montant %d, comptes %d/%d)", l.Amount, l.DebitAccountID, l.CreditAccountID)
+		}
+	}
+
+	entry.ID = r.s.nextEntryID
+	r.s.nextEntryID++
+	entry.CreatedAt = time.Now()
+	for i := range entry.Lines {
+		entry.Lines[i].ID = r.s.nextLineID
+		r.s.nextLineID++
+		entry.Lines[i].EntryID = entry.ID
+		entry.Lines[i].TenantID = entry.TenantID
+		r.s.lines[entry.Lines[i].ID] = entry.Lines[i]
+	}
+	stored := *entry
+	stored.Lines = nil
+	r.s.entries[entry.ID] = stored
+
+	for id, delta := range deltas {
+		a := r.s.accounts[id]
+		a.Balance += delta
+		a.UpdatedAt = entry.CreatedAt
+		r.s.accounts[id] = a
+	}
+	return nil
+}
+
+func (r *memoryLedgerRepository) ListEntries(_ context.Context, accountID, before uint, limit int) ([]JournalEntry, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	linesOf := map[uint][]JournalLine{}
+	touched := map[uint]bool{}
+	for _, l := range r.s.lines {
+		linesOf[l.EntryID] = append(linesOf[l.EntryID], l)
+		if l.DebitAccountID == accountID || l.CreditAccountID == accountID {
+			touched[l.EntryID] = true
+		}
+	}
+
+	var entries []JournalEntry
+	for id := range touched {
+		if before > 0 && id >= before {
+			continue
+		}
+		e := r.s.entries[id]
+		e.Lines = linesOf[id]
+		sort.Slice(e.Lines, func(i, j int) bool { return e.Lines[i].ID < e.Lines[j].ID })
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].ID > entries[j].ID })
+	if len(entries) > limit {
+		entries = entries[:limit]
+	}
+	return entries, nil
+}
+
+func (r *memoryLedgerRepository) SetFrozen(_ context.Context, id uint, frozen bool) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	a, ok := r.s.accounts[id]
+	if !ok {
+		return ErrNotFound
+	}
+	a.Frozen = frozen
+	a.UpdatedAt = time.Now()
+	r.s.accounts[id] = a
+	return nil
+}
+
+func (r *memoryLedgerRepository) Check(context.Context) ([]BalanceMismatch, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	computed := map[uint]int64{}
+	for _, l := range r.s.lines {
+		computed[l.DebitAccountID] -= l.Amount
+		computed[l.CreditAccountID] += l.Amount
+	}
+	var mismatches []BalanceMismatch
+	for _, a := range r.s.accounts {
+		if a.Balance != computed[a.ID] {
+			mismatches = append(mismatches, BalanceMismatch{
+				Tenant: a.TenantID, AccountID: a.ID, Code: a.Code, Balance: a.Balance, Computed: computed[a.ID],
+			})
+		}
+	}
+	sort.Slice(mismatches, func(i, j int) bool { return mismatches[i].AccountID < mismatches[j].AccountID })
+	return mismatches, nil
+}
+
+// --- En mémoire, par tenant ---
+
+type tenantLedgerRepository struct {
+	t *MemoryTenants
+}
+
+func (t *MemoryTenants) Ledger() LedgerRepository { return &tenantLedgerRepository{t} }
+
+func (r *tenantLedgerRepository) GetAccount(ctx context.Context, id uint) (*Account, error) {
+	s, _, err := r.t.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.Ledger().GetAccount(ctx, id)
+}
+
+func (r *tenantLedgerRepository) GetAccountByCode(ctx context.Context, code string) (*Account, error) {
+	s, _, err := r.t.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.Ledger().GetAccountByCode(ctx, code)
+}
+
+func (r *tenantLedgerRepository) CreateAccount(ctx context.Context, account *Account) error {
+	s, tenant, err := r.t.store(ctx)
+	if err != nil {
+		return err
+	}
+	account.TenantID = tenant
+	return s.Ledger().CreateAccount(ctx, account)
+}
+
+func (r *tenantLedgerRepository) LockAccounts(ctx context.Context, ids []uint) ([]Account, error) {
+	s, _, err := r.t.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.Ledger().LockAccounts(ctx, ids)
+}
+
+func (r *tenantLedgerRepository) Post(ctx context.Context, entry *JournalEntry) error {
+	s, tenant, err := r.t.store(ctx)
+	if err != nil {
+		return err
+	}
+	entry.TenantID = tenant
+	return s.Ledger().Post(ctx, entry)
+}
+
+func (r *tenantLedgerRepository) ListEntries(ctx context.Context, accountID, before uint, limit int) ([]JournalEntry, error) {
+	s, _, err := r.t.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.Ledger().ListEntries(ctx, accountID, before, limit)
+}
+
+func (r *tenantLedgerRepository) SetFrozen(ctx context.Context, id uint, frozen bool) error {
+	s, _, err := r.t.store(ctx)
+	if err != nil {
+		return err
+	}
+	return s.Ledger().SetFrozen(ctx, id, frozen)
+}
+
+// Check parcourt les stores de tous les tenants
+func (r *tenantLedgerRepository) Check(ctx context.Context) ([]BalanceMismatch, error) {
+	r.t.mu.Lock()
+	stores := maps.Clone(r.t.stores)
+	r.t.mu.Unlock()
+
+	var mismatches []BalanceMismatch
+	for _, s := range stores {
+		found, err := s.Ledger().Check(ctx)
+		if err != nil {
+			return nil, err
+		}
+		mismatches = append(mismatches, found...)
+	}
+	sort.Slice(mismatches, func(i, j int) bool {
+		if mismatches[i].Tenant != mismatches[j].Tenant {
+			return mismatches[i].Tenant < mismatches[j].Tenant
+		}
+		return mismatches[i].AccountID < mismatches[j].AccountID
+	})
+	return mismatches, nil
+}
@@ -1,289 +1,341 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"net/http"
-	"strconv"
+	"os"
+	"strings"
 
 	"github.com/gin-gonic/gin"
-	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
 
-// Modèle User avec tags GORM
-type User struct {
-	ID    uint   `gorm:"primaryKey" json:"id"`
-	Name  string `gorm:"not null" json:"name" binding:"required,min=2,max=50"`
-	Email string `gorm:"uniqueIndex;not null" json:"email" binding:"required,email"`
-	Age   int    `json:"age" binding:"required,min=1,max=150"`
-	Posts []Post `gorm:"foreignKey:UserID" json:"posts,omitempty"`
-}
-
-// Modèle Post (One-to-Many avec User)
-type Post struct {
-	ID      uint   `gorm:"primaryKey" json:"id"`
-	Title   string `gorm:"not null" json:"title" binding:"required,min=3,max=100"`
-	Content string `json:"content" binding:"required,min=10"`
-	UserID  uint   `gorm:"not null" json:"user_id"`
-	User    User   `gorm:"foreignKey:UserID" json:"user,omitempty"`
-}
-
 var db *gorm.DB
 
 func main() {
-	// Initialiser la base de données
-	var err error
-	db, err = gorm.Open(sqlite.Open("afaapay.db"), &gorm.Config{})
-	if err != nil {
-		panic("Erreur de connexion à la BD: " + err.Error())
+	// Sous-commandes CLI (migrate up|down|status|create|diff)
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(os.Args[1:]))
 	}
 
-	// Auto-migration des modèles
-	db.AutoMigrate(&User{}, &Post{})
-	fmt.Println("✅ Base de données initialisée")
-
-	// Routeur Gin
-	r := gin.Default()
-
-	// Middleware Logger personnalisé
-	r.Use(LoggerMiddleware())
-
-	// Routes publiques v1
-	v1 := r.Group("/v1")
-	{
-		// Users
-		v1.GET("/users", getAllUsers)
-		v1.GET("/users/:id", getUserByID)
-		v1.POST("/users", createUser)
-		v1.PUT("/users/:id", updateUser)
-		v1.DELETE("/users/:id", deleteUser)
-
-		// Posts
-		v1.GET("/posts", getAllPosts)
-		v1.GET("/posts/:id", getPostByID)
-		v1.POST("/posts", createPost)
-		v1.PUT("/posts/:id", updatePost)
-		v1.DELETE("/posts/:id", deletePost)
-
-		// Relations
-		v1.GET("/users/:id/posts", getUserPosts)
+	// Initialiser la base de données (DB_DRIVER, DB_DSN, DB_TIMEZONE) ; attend
+	// jusqu'à DB_CONNECT_TIMEOUT qu'elle réponde
+	if err := connectDatabase(); err != nil {
+		panic("Erreur de connexion à la BD: " + err.Error())
 	}
 
-	// Info API
-	r.GET("/", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{
-			"message": "API avec GORM et Base de Données",
-			"version": "4.0",
-			"db":      "SQLite",
-		})
-	})
-
-	fmt.Println("🚀 Serveur démarré sur http://localhost:8080")
-	r.Run(":8080")
-}
-
-// === MIDDLEWARES ===
-
-func LoggerMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		fmt.Printf("[API] %s %s\n", c.Request.Method, c.Request.URL.Path)
-		c.Next()
+	// Migrations versionnées (voir migrations/ et `migrate status`)
+	if err := migrateOnStart(context.Background()); err != nil {
+		panic("Erreur de migration: " + err.Error())
 	}
-}
-
-// === USERS HANDLERS ===
+	fmt.Printf("✅ Base de données %s initialisée\n", dialect.Label())
 
-// GET /v1/users
-func getAllUsers(c *gin.Context) {
-	var users []User
-	if err := db.Preload("Posts").Find(&users).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur BD"})
-		return
+	// Lectures sur les réplicas (DB_REPLICA_DSNS, DB_REPLICA_POLICY)
+	replicas, err := openReplicas(loadDBConfig(), dialect)
+	if err != nil {
+		panic("Erreur d'ouverture des réplicas: " + err.Error())
 	}
-	c.JSON(http.StatusOK, gin.H{"users": users, "total": len(users)})
-}
-
-// GET /v1/users/:id
-func getUserByID(c *gin.Context) {
-	id := c.Param("id")
-	var user User
-
-	if err := db.Preload("Posts").First(&user, id).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Utilisateur non trouvé"})
-		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur BD"})
+	if replicas != nil {
+		if err := registerReplicaRouting(db, replicas); err != nil {
+			panic("Erreur d'enregistrement du routage des lectures: " + err.Error())
 		}
-		return
+		go replicas.Watch(context.Background(), replicaHealthInterval())
 	}
-	c.JSON(http.StatusOK, user)
-}
-
-// POST /v1/users
-func createUser(c *gin.Context) {
-	var user User
 
-	if err := c.ShouldBindJSON(&user); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
+	// Surveillance de la connexion (DB_HEALTH_INTERVAL)
+	dbHealth := NewDBHealth(db)
+	if interval := dbHealthInterval(); interval > 0 {
+		go dbHealth.Watch(context.Background(), interval)
 	}
 
-	// Vérifier si l'email existe
-	var count int64
-	db.Model(&User{}).Where("email = ?", user.Email).Count(&count)
-	if count > 0 {
-		c.JSON(http.StatusConflict, gin.H{"error": "Email déjà utilisé"})
-		return
+	// Tracing OpenTelemetry (OTEL_TRACES_EXPORTER=console|otlp)
+	shutdownTracing, err := initTracing(context.Background())
+	if err != nil {
+		panic("Erreur d'initialisation du tracing: " + err.Error())
 	}
+	defer shutdownTracing(context.Background())
 
-	if err := db.Create(&user).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur création"})
-		return
+	if err := registerGormTracing(db); err != nil {
+		panic("Erreur d'enregistrement des callbacks GORM: " + err.Error())
 	}
 
-	c.JSON(http.StatusCreated, gin.H{"message": "Utilisateur créé", "user": user})
-}
-
-// PUT /v1/users/:id
-func updateUser(c *gin.Context) {
-	id := c.Param("id")
-	var user User
-
-	if err := c.ShouldBindJSON(&user); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
+	// Validateurs métier (phone_cm, xaf, display_name, slug)
+	if err := registerValidators(); err != nil {
+		panic("Erreur d'enregistrement des validateurs: " + err.Error())
 	}
 
-	// Vérifier si l'utilisateur existe
-	if err := db.Model(&User{}).Where("id = ?", id).Updates(&user).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur mise à jour"})
-		return
+	// Feature flags : chargement initial puis rechargement à chaud
+	flags = NewFlagStore(db)
+	if err := flags.Reload(context.Background()); err != nil {
+		panic("Erreur de chargement des feature flags: " + err.Error())
 	}
+	go flags.Watch(context.Background(), flagRefreshInterval())
 
-	c.JSON(http.StatusOK, gin.H{"message": "Utilisateur mis à jour", "user": user})
-}
-
-// DELETE /v1/users/:id
-func deleteUser(c *gin.Context) {
-	id := c.Param("id")
+	// Repositories (STORE=memory pour travailler sans base), services, handlers
+	repos := newRepositories()
 
-	// Supprimer les posts d'abord (FK)
-	db.Where("user_id = ?", id).Delete(&Post{})
-
-	if err := db.Delete(&User{}, id).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur suppression"})
-		return
+	// Cache des lectures par ID (CACHE=memory|redis|off, CACHE_TTL)
+	cache, err := newCache()
+	if err != nil {
+		panic("Erreur de configuration du cache: " + err.Error())
+	}
+	var readCache *ReadThrough
+	if cache != nil {
+		readCache = NewReadThrough(cache, cacheTTL())
+		repos = withReadCache(repos, readCache)
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Utilisateur supprimé"})
-}
-
-// === POSTS HANDLERS ===
+	// Webhooks sortants (WEBHOOK_*) : les services publient leurs événements
+	webhookService := NewWebhookService(repos.Webhooks, repos.UoW, loadWebhookConfig())
+	if interval := webhookPollInterval(); interval > 0 {
+		go webhookService.Watch(context.Background(), interval)
+	}
+	webhookHandler := NewWebhookHandler(webhookService)
+
+	userHandler := NewUserHandler(NewUserService(repos.Users, repos.UoW, webhookService))
+	postHandler := NewPostHandler(NewPostService(repos.Posts, repos.Users, repos.Tags, repos.UoW, webhookService))
+	tagHandler := NewTagHandler(NewTagService(repos.Tags))
+	searchHandler := NewSearchHandler(NewSearchService(repos.Search))
+	commentHandler := NewCommentHandler(NewCommentService(repos.Comments, repos.Posts, repos.Users, repos.UoW, loadCommentPolicy()))
+	flagHandler := NewFlagHandler(flags)
+	ledgerService := NewLedgerService(repos.Ledger, repos.Users, repos.UoW)
+	ledgerHandler := NewLedgerHandler(ledgerService)
+	transferHandler := NewTransferHandler(NewTransferService(repos.Transfers, ledgerService, repos.UoW, loadTransferLimits()))
+
+	// Mobile money (MTN_*, ORANGE_*, PAYMENT_SIMULATOR_URL, PAYMENT_POLL_INTERVAL)
+	paymentConfig := loadPaymentConfig()
+	providers := paymentConfig.Providers()
+	paymentService := NewPaymentService(repos.Payments, ledgerService, repos.UoW, providers, paymentConfig, webhookService)
+	if len(providers) > 0 {
+		fmt.Printf("📱 Mobile money : %s (callbacks sur %s)\n", strings.Join(providerNames(providers), ", "), paymentConfig.CallbackURL)
+		if interval := paymentPollInterval(); interval > 0 {
+			go paymentService.Watch(context.Background(), interval)
+		}
+	}
+	paymentHandler := NewPaymentHandler(paymentService)
 
-// GET /v1/posts
-func getAllPosts(c *gin.Context) {
-	var posts []Post
-	if err := db.Preload("User").Find(&posts).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur BD"})
-		return
+	// Purge de la corbeille (SOFT_DELETE_RETENTION, PURGE_INTERVAL)
+	purger := NewTrashPurger(repos, trashRetention())
+	if interval := purgeInterval(); interval > 0 {
+		go purger.Watch(context.Background(), interval)
 	}
-	c.JSON(http.StatusOK, gin.H{"posts": posts, "total": len(posts)})
-}
+	purgeHandler := NewPurgeHandler(purger)
+	fixtureHandler := NewFixtureHandler(NewFixtureLoader(repos))
+	dbHandler := NewDBHandler(dbHealth, replicas)
+	cacheHandler := NewCacheHandler(readCache)
+
+	// Sauvegardes (BACKUP_DIR, BACKUP_KEEP, BACKUP_INTERVAL)
+	backups := NewBackupManager(db, loadDBConfig(), loadBackupConfig())
+	if interval := backupInterval(); interval > 0 {
+		go backups.Watch(context.Background(), interval)
+	}
+	backupHandler := NewBackupHandler(backups)
 
-// GET /v1/posts/:id
-func getPostByID(c *gin.Context) {
-	id := c.Param("id")
-	var post Post
+	// Routeur Gin
+	r := gin.Default()
 
-	if err := db.Preload("User").First(&post, id).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Post non trouvé"})
-		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur BD"})
-		}
-		return
-	}
-	c.JSON(http.StatusOK, post)
-}
+	// Tracing des requêtes (span par route)
+	r.Use(TracingMiddleware())
 
-// POST /v1/posts
-func createPost(c *gin.Context) {
-	var post Post
+	// Middleware Logger personnalisé
+	r.Use(LoggerMiddleware())
 
-	if err := c.ShouldBindJSON(&post); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
-	}
+	// X-Read-Your-Writes: true → lectures sur le primaire
+	r.Use(ReadYourWritesMiddleware())
 
-	// Vérifier si l'utilisateur existe
-	var user User
-	if err := db.First(&user, post.UserID).Error; err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Utilisateur non trouvé"})
-		return
-	}
+	// Callbacks des opérateurs mobile money : déclarés avant le middleware
+	// de tenant, le paiement annoncé porte le sien
+	r.POST("/callbacks/:provider", paymentHandler.Callback)
+	r.PUT("/callbacks/:provider", paymentHandler.Callback)
 
-	if err := db.Create(&post).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur création"})
-		return
-	}
+	// Tenant de la requête : token, sous-domaine ou X-Tenant-ID (tenant.go)
+	tenantConfig := loadTenantConfig()
 
-	c.JSON(http.StatusCreated, gin.H{"message": "Post créé", "post": post})
-}
+	// Routes publiques v1
+	v1 := r.Group("/v1", TenantMiddleware(tenantConfig))
+	{
+		// Users
+		v1.GET("/users", userHandler.List)
+		v1.GET("/users/:id", userHandler.Get)
+		v1.POST("/users", userHandler.Create)
+		v1.PUT("/users/:id", userHandler.Update)
+		v1.DELETE("/users/:id", userHandler.Delete)
+		v1.POST("/users/:id/restore", userHandler.Restore)
 
-// PUT /v1/posts/:id
-func updatePost(c *gin.Context) {
-	id := c.Param("id")
-	var post Post
+		// Posts
+		v1.GET("/posts", postHandler.List)
+		v1.GET("/posts/:id", postHandler.Get)
+		v1.POST("/posts", postHandler.Create)
+		v1.PUT("/posts/:id", postHandler.Update)
+		v1.DELETE("/posts/:id", postHandler.Delete)
+		v1.POST("/posts/:id/restore", postHandler.Restore)
+
+		// Commentaires (auteur : l'appelant, claim sub du token)
+		v1.GET("/posts/:id/comments", commentHandler.List)
+		v1.POST("/posts/:id/comments", commentHandler.Create)
+		v1.GET("/posts/:id/comments/:comment_id", commentHandler.Get)
+		v1.PUT("/posts/:id/comments/:comment_id", commentHandler.Update)
+		v1.DELETE("/posts/:id/comments/:comment_id", commentHandler.Delete)
+
+		// Tags
+		v1.GET("/tags", tagHandler.List)
+		v1.POST("/tags", tagHandler.Create)
+
+		// Recherche plein texte
+		v1.GET("/search", searchHandler.Search)
+
+		// Grand livre : portefeuilles, soldes et écritures
+		v1.GET("/users/:id/wallet", ledgerHandler.Wallet)
+		v1.GET("/accounts/:id", ledgerHandler.Get)
+		v1.GET("/accounts/:id/balance", ledgerHandler.Balance)
+		v1.GET("/accounts/:id/entries", ledgerHandler.Entries)
+
+		// Virements (émetteur : l'appelant, header Idempotency-Key)
+		v1.POST("/transfers", transferHandler.Create)
+		v1.GET("/transfers/:id", transferHandler.Get)
+
+		// Dépôts et retraits mobile money (portefeuille de l'appelant, header Idempotency-Key)
+		v1.POST("/payments/deposits", paymentHandler.Deposit)
+		v1.POST("/payments/withdrawals", paymentHandler.Withdraw)
+		v1.GET("/payments/:id", paymentHandler.Get)
+
+		// Webhooks du compte (propriétaire : l'appelant) : endpoints, abonnements, secret
+		v1.POST("/webhooks", webhookHandler.Create)
+		v1.GET("/webhooks", webhookHandler.List)
+		v1.GET("/webhooks/:id", webhookHandler.Get)
+		v1.PUT("/webhooks/:id", webhookHandler.Update)
+		v1.DELETE("/webhooks/:id", webhookHandler.Delete)
+		v1.POST("/webhooks/:id/rotate-secret", webhookHandler.RotateSecret)
 
-	if err := c.ShouldBindJSON(&post); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
+		// Relations
+		v1.GET("/users/:id/posts", userHandler.Posts)
+		v1.POST("/posts/:id/tags", postHandler.AttachTags)
+		v1.DELETE("/posts/:id/tags", postHandler.DetachTags)
 	}
 
-	if err := db.Model(&Post{}).Where("id = ?", id).Updates(&post).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur mise à jour"})
-		return
+	// Routes v2 (activées par feature flag)
+	v2 := r.Group("/v2", TenantMiddleware(tenantConfig))
+	{
+		v2.GET("/profile", RequireFlag("v2_profile"), userHandler.Profile)
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Post mis à jour", "post": post})
-}
+	// Administration (Bearer ADMIN_TOKEN) : opérateur authentifié, tenant
+	// par sous-domaine ou X-Tenant-ID sans token de tenant
+	adminTenants := tenantConfig
+	adminTenants.JWTSecret = nil
+	admin := r.Group("/admin")
+	admin.Use(AdminAuthMiddleware(), TenantMiddleware(adminTenants))
+	{
+		// Feature flags
+		admin.GET("/flags", flagHandler.List)
+		admin.GET("/flags/:key", flagHandler.Get)
+		admin.POST("/flags", flagHandler.Create)
+		admin.PUT("/flags/:key", flagHandler.Update)
+		admin.DELETE("/flags/:key", flagHandler.Delete)
+
+		// Corbeille : listes avec ?trashed=with|only, purge
+		admin.GET("/users", userHandler.List)
+		admin.GET("/posts", postHandler.List)
+		admin.POST("/purge", purgeHandler.Purge)
+
+		// Base de données : santé et pool de connexions
+		admin.GET("/db", dbHandler.Stats)
+
+		// Cache : succès, absences, invalidations
+		admin.GET("/cache", cacheHandler.Stats)
+
+		// Grand livre : écritures manuelles, contrôle des soldes
+		admin.POST("/ledger/entries", ledgerHandler.Post)
+		admin.GET("/ledger/check", ledgerHandler.Check)
+		admin.POST("/accounts/:id/freeze", ledgerHandler.Freeze)
+		admin.POST("/accounts/:id/unfreeze", ledgerHandler.Unfreeze)
+
+		// Virements : annulation
+		admin.POST("/transfers/:id/reverse", transferHandler.Reverse)
+
+		// Mobile money : relecture immédiate des paiements en attente
+		admin.POST("/payments/reconcile", paymentHandler.Reconcile)
+
+		// Webhooks : journal des livraisons (?status=dead : lettres mortes),
+		// relance manuelle, envoi immédiat des livraisons dues
+		admin.GET("/webhooks/deliveries", webhookHandler.Deliveries)
+		admin.GET("/webhooks/deliveries/:id", webhookHandler.Delivery)
+		admin.POST("/webhooks/deliveries/:id/redeliver", webhookHandler.Redeliver)
+		admin.POST("/webhooks/dispatch", webhookHandler.Dispatch)
+
+		// Sauvegardes : liste et sauvegarde immédiate (?kind=sqlite|ndjson)
+		admin.GET("/backups", backupHandler.List)
+		admin.POST("/backups", backupHandler.Create)
+
+		// Données de test (refusé avec APP_ENV=production)
+		admin.POST("/fixtures", fixtureHandler.Load)
+		admin.POST("/seed", fixtureHandler.Seed)
+	}
 
-// DELETE /v1/posts/:id
-func deletePost(c *gin.Context) {
-	id := c.Param("id")
+	// Info API
+	r.GET("/", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"message": "API avec GORM et Base de Données",
+			"version": "4.0",
+			"db":      dialect.Label(),
+		})
+	})
 
-	if err := db.Delete(&Post{}, id).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur suppression"})
-		return
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8080"
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Post supprimé"})
+	fmt.Printf("🚀 Serveur démarré sur http://localhost:%s\n", port)
+	r.Run(":" + port)
 }
 
-// === RELATIONS ===
+// === MIDDLEWARES ===
 
-// GET /v1/users/:id/posts
-func getUserPosts(c *gin.Context) {
-	idStr := c.Param("id")
-	id, err := strconv.ParseUint(idStr, 10, 32)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "ID invalide"})
-		return
+func LoggerMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		fmt.Printf("[API] %s %s\n", c.Request.Method, c.Request.URL.Path)
+		c.Next()
 	}
+}
 
-	var user User
-	if err := db.Preload("Posts").First(&user, id).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Utilisateur non trouvé"})
-		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur BD"})
+// newRepositories choisit l'implémentation des repositories :
+// GORM par défaut, en mémoire avec STORE=memory.
+func newRepositories() Repositories {
+	if strings.EqualFold(os.Getenv("STORE"), "memory") {
+		store := NewMemoryTenants()
+		fmt.Println("🧠 Repositories en mémoire (STORE=memory)")
+		return Repositories{
+			Users:     store.Users(),
+			Posts:     store.Posts(),
+			Tags:      store.Tags(),
+			Comments:  store.Comments(),
+			Ledger:    store.Ledger(),
+			Transfers: store.Transfers(),
+			Payments:  store.Payments(),
+			Webhooks:  store.Webhooks(),
+			Search:    store.Search(),
+			UoW:       store.UnitOfWork(),
+			Tenants:   store.Directory(),
 		}
-		return
 	}
+	return newGormRepositories()
+}
 
-	c.JSON(http.StatusOK, gin.H{
-		"user":        user.Name,
-		"posts_count": len(user.Posts),
-		"posts":       user.Posts,
-	})
+// newGormRepositories : repositories sur la base connectée (db, dialect)
+func newGormRepositories() Repositories {
+	return Repositories{
+		Users:     NewGormUserRepository(db),
+		Posts:     NewGormPostRepository(db),
+		Tags:      NewGormTagRepository(db),
+		Comments:  NewGormCommentRepository(db),
+		Ledger:    NewGormLedgerRepository(db),
+		Transfers: NewGormTransferRepository(db),
+		Payments:  NewGormPaymentRepository(db),
+		Webhooks:  NewGormWebhookRepository(db),
+		Search:    newSearchIndex(db, dialect),
+		UoW:       NewGormUnitOfWork(db),
+		Tenants:   NewGormTenantDirectory(db),
+	}
 }
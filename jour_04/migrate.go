@@ -0,0 +1,591 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// === MIGRATIONS VERSIONNÉES ===
+//
+// Les fichiers SQL de migrations/ sont embarqués dans le binaire :
+//   <version>_<nom>.up.sql             SQL commun à tous les drivers
+//   <version>_<nom>.up.<driver>.sql    variante propre à un driver (prioritaire)
+//   <version>_<nom>.down.sql           retour arrière (même règle de variante)
+//
+// La version est un horodatage AAAAMMJJHHMMSS, ce qui fixe l'ordre d'application.
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+const migrationsDir = "migrations"
+
+var migrationFileRegex = regexp.MustCompile(`^(\d{14})_([a-z0-9_]+)\.(up|down)(?:\.(sqlite|postgres|mysql))?\.sql$`)
+
+// Migration est une migration chargée pour un driver donné
+type Migration struct {
+	Version  string
+	Name     string
+	UpSQL    string
+	DownSQL  string
+	Checksum string
+}
+
+// SchemaMigration trace une migration appliquée
+type SchemaMigration struct {
+	Version   string    `gorm:"primaryKey;size:14"`
+	Name      string    `gorm:"size:255;not null"`
+	Checksum  string    `gorm:"size:64;not null"`
+	AppliedAt time.Time `gorm:"not null"`
+}
+
+func (SchemaMigration) TableName() string { return "schema_migrations" }
+
+// SchemaMigrationLock empêche deux processus de migrer en même temps :
+// la ligne id=1 n'existe que pendant une exécution.
+type SchemaMigrationLock struct {
+	ID       uint      `gorm:"primaryKey;autoIncrement:false"`
+	Owner    string    `gorm:"size:255;not null"`
+	LockedAt time.Time `gorm:"not null"`
+}
+
+func (SchemaMigrationLock) TableName() string { return "schema_migrations_lock" }
+
+// loadMigrations lit les migrations de fsys pour le driver donné, triées par version
+func loadMigrations(fsys fs.FS, driver string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, migrationsDir)
+	if err != nil {
+		return nil, err
+	}
+
+	type files struct {
+		name                           string
+		up, down, upDriver, downDriver string
+	}
+	byVersion := map[string]*files{}
+
+	for _, e := range entries {
+		m := migrationFileRegex.FindStringSubmatch(e.Name())
+		if m == nil {
+			continue
+		}
+		version, name, direction, target := m[1], m[2], m[3], m[4]
+		if target != "" && target != driver {
+			continue
+		}
+
+		f, ok := byVersion[version]
+		if !ok {
+			f = &files{name: name}
+			byVersion[version] = f
+		}
+		if f.name != name {
+			return nil, fmt.Errorf("migration %s: noms différents (%s, %s)", version, f.name, name)
+		}
+
+		content, err := fs.ReadFile(fsys, migrationsDir+"/"+e.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case direction == "up" && target == "":
+			f.up = string(content)
+		case direction == "up":
+			f.upDriver = string(content)
+		case target == "":
+			f.down = string(content)
+		default:
+			f.downDriver = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for version, f := range byVersion {
+		up := firstNonEmpty(f.upDriver, f.up)
+		if up == "" {
+			return nil, fmt.Errorf("migration %s_%s: fichier up manquant pour %s", version, f.name, driver)
+		}
+		sum := sha256.Sum256([]byte(up))
+		migrations = append(migrations, Migration{
+			Version:  version,
+			Name:     f.name,
+			UpSQL:    up,
+			DownSQL:  firstNonEmpty(f.downDriver, f.down),
+			Checksum: hex.EncodeToString(sum[:]),
+		})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if strings.TrimSpace(v) != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// === RUNNER ===
+
+const (
+	migrationLockTimeout    = 30 * time.Second
+	migrationLockStaleAfter = 15 * time.Minute
+)
+
+var ErrChecksumMismatch = errors.New("migration appliquée modifiée depuis (checksum différent)")
+
+// MigrationRunner applique les migrations sur une connexion
+type MigrationRunner struct {
+	db         *gorm.DB
+	migrations []Migration
+	owner      string
+}
+
+func newMigrationRunner(conn *gorm.DB, migrations []Migration) *MigrationRunner {
+	host, _ := os.Hostname()
+	return &MigrationRunner{
+		db:         conn,
+		migrations: migrations,
+		owner:      fmt.Sprintf("%s/%d", host, os.Getpid()),
+	}
+}
+
+// MigrationStatus décrit l'état d'une migration connue ou appliquée
+type MigrationStatus struct {
+	Version   string
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+	Modified  bool  // checksum différent du fichier
+	Missing   bool  // appliquée mais fichier absent
+	Unmet     error // en attente, condition non remplie : sautée par Up
+}
+
+// ensureTables crée les tables de suivi si besoin
+func (r *MigrationRunner) ensureTables(ctx context.Context) error {
+	m := r.db.WithContext(ctx).Migrator()
+	for _, model := range []interface{}{&SchemaMigration{}, &SchemaMigrationLock{}} {
+		if m.HasTable(model) {
+			continue
+		}
+		if err := m.CreateTable(model); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *MigrationRunner) applied(ctx context.Context) (map[string]SchemaMigration, error) {
+	var rows []SchemaMigration
+	if err := r.db.WithContext(ctx).Order("version").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	applied := make(map[string]SchemaMigration, len(rows))
+	for _, row := range rows {
+		applied[row.Version] = row
+	}
+	return applied, nil
+}
+
+// Status liste les migrations connues et appliquées, dans l'ordre des versions
+func (r *MigrationRunner) Status(ctx context.Context) ([]MigrationStatus, error) {
+	if err := r.ensureTables(ctx); err != nil {
+		return nil, err
+	}
+	applied, err := r.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []MigrationStatus
+	for _, m := range r.migrations {
+		s := MigrationStatus{Version: m.Version, Name: m.Name}
+		if row, ok := applied[m.Version]; ok {
+			s.Applied = true
+			s.AppliedAt = row.AppliedAt
+			s.Modified = row.Checksum != m.Checksum
+			delete(applied, m.Version)
+		} else {
+			s.Unmet = r.unmet(ctx, m)
+		}
+		statuses = append(statuses, s)
+	}
+	for _, row := range applied {
+		statuses = append(statuses, MigrationStatus{
+			Version: row.Version, Name: row.Name,
+			Applied: true, AppliedAt: row.AppliedAt, Missing: true,
+		})
+	}
+
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+	return statuses, nil
+}
+
+// Up applique toutes les migrations en attente, chacune dans sa transaction.
+// Refuse de continuer si une migration déjà appliquée a été modifiée.
+func (r *MigrationRunner) Up(ctx context.Context) ([]Migration, error) {
+	return r.UpTo(ctx, "")
+}
+
+// UpTo applique les migrations en attente jusqu'à la version target
+// comprise (toutes si target est vide). Celles dont la condition n'est pas
+// remplie (migrationRequirements) sont sautées et restent en attente.
+func (r *MigrationRunner) UpTo(ctx context.Context, target string) ([]Migration, error) {
+	if err := r.ensureTables(ctx); err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	err := r.withLock(ctx, func() error {
+		applied, err := r.applied(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range r.migrations {
+			if row, ok := applied[m.Version]; ok && row.Checksum != m.Checksum {
+				return fmt.Errorf("%w: %s_%s", ErrChecksumMismatch, m.Version, m.Name)
+			}
+		}
+
+		for _, m := range r.migrations {
+			if target != "" && m.Version > target {
+				break
+			}
+			if _, ok := applied[m.Version]; ok || r.unmet(ctx, m) != nil {
+				continue
+			}
+			if err := r.apply(ctx, m); err != nil {
+				return err
+			}
+			done = append(done, m)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Down annule les `steps` dernières migrations appliquées
+func (r *MigrationRunner) Down(ctx context.Context, steps int) ([]Migration, error) {
+	if err := r.ensureTables(ctx); err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[string]Migration, len(r.migrations))
+	for _, m := range r.migrations {
+		byVersion[m.Version] = m
+	}
+
+	var done []Migration
+	err := r.withLock(ctx, func() error {
+		var rows []SchemaMigration
+		if err := r.db.WithContext(ctx).Order("version DESC").Limit(steps).Find(&rows).Error; err != nil {
+			return err
+		}
+
+		for _, row := range rows {
+			m, ok := byVersion[row.Version]
+			if !ok {
+				return fmt.Errorf("migration %s_%s: fichier absent, retour arrière impossible", row.Version, row.Name)
+			}
+			if m.DownSQL == "" {
+				return fmt.Errorf("migration %s_%s: pas de fichier down", m.Version, m.Name)
+			}
+			if err := r.revert(ctx, m); err != nil {
+				return err
+			}
+			done = append(done, m)
+		}
+		return nil
+	})
+	return done, err
+}
+
+func (r *MigrationRunner) apply(ctx context.Context, m Migration) error {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if check, ok := migrationChecks[m.Version]; ok {
+			if err := check(tx); err != nil {
+				return err
+			}
+		}
+		if err := execSQLScript(tx, m.UpSQL); err != nil {
+			return err
+		}
+		return tx.Create(&SchemaMigration{
+			Version:   m.Version,
+			Name:      m.Name,
+			Checksum:  m.Checksum,
+			AppliedAt: time.Now(),
+		}).Error
+	})
+	if err != nil {
+		return fmt.Errorf("migration %s_%s: %w", m.Version, m.Name, err)
+	}
+	return nil
+}
+
+func (r *MigrationRunner) revert(ctx context.Context, m Migration) error {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := execSQLScript(tx, m.DownSQL); err != nil {
+			return err
+		}
+		return tx.Where("version = ?", m.Version).Delete(&SchemaMigration{}).Error
+	})
+	if err != nil {
+		return fmt.Errorf("retour arrière %s_%s: %w", m.Version, m.Name, err)
+	}
+	return nil
+}
+
+// migrationRequirements : conditions d'une migration, par version. Non
+// remplie, la migration est sautée sans erreur et reste en attente ; un
+// binaire qui la remplit l'appliquera au prochain `migrate up`.
+var migrationRequirements = map[string]func(tx *gorm.DB) error{
+	"20260114090000": requireFTS5, // add_posts_search
+}
+
+// unmet retourne la raison pour laquelle m ne peut pas être appliquée, ou nil
+func (r *MigrationRunner) unmet(ctx context.Context, m Migration) error {
+	if require, ok := migrationRequirements[m.Version]; ok {
+		return require(r.db.WithContext(ctx))
+	}
+	return nil
+}
+
+// migrationChecks : vérifications faites avant d'appliquer une migration,
+// par version. Hors du fichier SQL (le checksum des migrations déjà
+// appliquées ne change pas), elles arrêtent la migration avec un message
+// exploitable au lieu d'une violation de contrainte brute.
+var migrationChecks = map[string]func(tx *gorm.DB) error{
+	"20260117090000": checkEmailCollisions, // normalize_emails
+}
+
+// ErrEmailCollisions : des emails d'un même tenant ne diffèrent que par la
+// casse ou les espaces ; les normaliser violerait idx_users_tenant_email
+var ErrEmailCollisions = errors.New("emails identiques une fois normalisés")
+
+// checkEmailCollisions liste les emails qui seraient en double après
+// LOWER(TRIM(email)), corbeille comprise. Aucune fusion automatique : le
+// compte à garder est une décision métier.
+func checkEmailCollisions(tx *gorm.DB) error {
+	var collisions []struct {
+		TenantID string
+		Email    string
+		Count    int
+	}
+	err := tx.Raw(`SELECT tenant_id, LOWER(TRIM(email)) AS email, COUNT(*) AS count
+		FROM users GROUP BY tenant_id, LOWER(TRIM(email)) HAVING COUNT(*) > 1
+		ORDER BY tenant_id, email`).Scan(&collisions).Error
+	if err != nil || len(collisions) == 0 {
+		return err
+	}
+
+	lines := make([]string, len(collisions))
+	for i, c := range collisions {
+		lines[i] = fmt.Sprintf("  %s : %s (%d comptes)", c.TenantID, c.Email, c.Count)
+	}
+	return fmt.Errorf("%w, à fusionner ou corriger avant de migrer :\n%s", ErrEmailCollisions, strings.Join(lines, "\n"))
+}
+
+// withLock exécute fn en tenant le verrou de migration.
+// Un verrou plus vieux que migrationLockStaleAfter est considéré abandonné.
+func (r *MigrationRunner) withLock(ctx context.Context, fn func() error) error {
+	deadline := time.Now().Add(migrationLockTimeout)
+
+	for {
+		lock := SchemaMigrationLock{ID: 1, Owner: r.owner, LockedAt: time.Now()}
+		err := r.db.WithContext(ctx).Create(&lock).Error
+		if err == nil {
+			break
+		}
+		if !isUniqueViolation(err) {
+			return fmt.Errorf("verrou de migration: %w", err)
+		}
+
+		var current SchemaMigrationLock
+		if err := r.db.WithContext(ctx).First(&current, 1).Error; err == nil &&
+			time.Since(current.LockedAt) > migrationLockStaleAfter {
+			fmt.Printf("⚠️  Verrou de migration abandonné par %s, libération\n", current.Owner)
+			r.db.WithContext(ctx).Where("id = 1 AND owner = ?", current.Owner).Delete(&SchemaMigrationLock{})
+			continue
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("verrou de migration détenu par %s depuis %s", current.Owner, current.LockedAt.Format(time.RFC3339))
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+
+	defer r.db.WithContext(context.Background()).Where("id = 1 AND owner = ?", r.owner).Delete(&SchemaMigrationLock{})
+	return fn()
+}
+
+// execSQLScript exécute un script instruction par instruction
+// (tous les drivers n'acceptent pas plusieurs instructions par Exec).
+func execSQLScript(tx *gorm.DB, script string) error {
+	for _, stmt := range splitSQLStatements(script) {
+		if err := tx.Exec(stmt).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitSQLStatements découpe un script sur les ';' hors chaînes et commentaires
+// et hors corps de trigger (CREATE TRIGGER ... BEGIN ...; END) ou de fonction
+// PostgreSQL ($$ ... $$)
+func splitSQLStatements(script string) []string {
+	var statements []string
+	var current strings.Builder
+	hasCode := false
+	depth := 0 // BEGIN/CASE/IF ouverts dans un CREATE TRIGGER
+	prev := "" // mot précédent, pour distinguer END IF d'un IF ouvrant
+
+	flush := func() {
+		if stmt := strings.TrimSpace(current.String()); hasCode && stmt != "" {
+			statements = append(statements, stmt)
+		}
+		current.Reset()
+		hasCode = false
+	}
+
+	for i := 0; i < len(script); i++ {
+		ch := script[i]
+
+		switch {
+		case ch == '-' && i+1 < len(script) && script[i+1] == '-':
+			// Commentaire ligne : ignoré jusqu'à la fin de ligne
+			for i < len(script) && script[i] != '\n' {
+				i++
+			}
+			current.WriteByte('\n')
+		case ch == '/' && i+1 < len(script) && script[i+1] == '*':
+			end := strings.Index(script[i+2:], "*/")
+			if end < 0 {
+				i = len(script)
+			} else {
+				i += end + 3
+			}
+			current.WriteByte(' ')
+		case ch == '\'' || ch == '"' || ch == '`':
+			// Chaîne ou identifiant quoté : copié tel quel
+			end := i + 1
+			for end < len(script) && script[end] != ch {
+				end++
+			}
+			current.WriteString(script[i:min(end+1, len(script))])
+			hasCode = true
+			i = end
+		case ch == '$' && dollarTag(script[i:]) != "":
+			// Corps PostgreSQL entre $$ ou $tag$ (fonctions) : copié tel quel
+			tag := dollarTag(script[i:])
+			end := strings.Index(script[i+len(tag):], tag)
+			if end < 0 {
+				end = len(script)
+			} else {
+				end += i + 2*len(tag)
+			}
+			current.WriteString(script[i:end])
+			hasCode = true
+			i = end - 1
+		case isSQLWordChar(ch) && (ch < '0' || ch > '9'):
+			end := i
+			for end < len(script) && isSQLWordChar(script[end]) {
+				end++
+			}
+			word := strings.ToUpper(script[i:end])
+			switch {
+			case word == "BEGIN" && strings.Contains(strings.ToUpper(current.String()), "TRIGGER"):
+				depth++
+			case (word == "CASE" || word == "IF" && prev != "END") && depth > 0:
+				depth++
+			case word == "END" && depth > 0:
+				depth--
+			}
+			prev = word
+			current.WriteString(script[i:end])
+			hasCode = true
+			i = end - 1
+		case ch == ';' && depth == 0:
+			flush()
+		default:
+			current.WriteByte(ch)
+			if ch != ' ' && ch != '\t' && ch != '\n' && ch != '\r' {
+				hasCode = true
+			}
+		}
+	}
+	flush()
+
+	return statements
+}
+
+// dollarTag retourne le délimiteur PostgreSQL ($$ ou $tag$) qui ouvre s,
+// vide si s n'en commence pas par un ($1 est un paramètre)
+func dollarTag(s string) string {
+	end := 1
+	for end < len(s) && isSQLWordChar(s[end]) && (end > 1 || s[end] < '0' || s[end] > '9') {
+		end++
+	}
+	if end < len(s) && s[end] == '$' {
+		return s[:end+1]
+	}
+	return ""
+}
+
+func isSQLWordChar(ch byte) bool {
+	return ch == '_' || ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || ch >= '0' && ch <= '9'
+}
+
+// autoMigrateOnStart indique si le serveur applique les migrations au démarrage
+// (DB_AUTO_MIGRATE=false pour les lancer séparément avec `migrate up`).
+func autoMigrateOnStart() bool {
+	return !strings.EqualFold(os.Getenv("DB_AUTO_MIGRATE"), "false")
+}
+
+// migrateOnStart applique les migrations en attente au démarrage du serveur
+func migrateOnStart(ctx context.Context) error {
+	migrations, err := loadMigrations(migrationFiles, dialect.Name())
+	if err != nil {
+		return err
+	}
+
+	runner := newMigrationRunner(db, migrations)
+	if !autoMigrateOnStart() {
+		statuses, err := runner.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, s := range statuses {
+			if !s.Applied && s.Unmet == nil {
+				return fmt.Errorf("migration %s_%s en attente : lancer `migrate up`", s.Version, s.Name)
+			}
+		}
+		return nil
+	}
+
+	applied, err := runner.Up(ctx)
+	for _, m := range applied {
+		fmt.Printf("⬆️  Migration appliquée : %s_%s\n", m.Version, m.Name)
+	}
+	return err
+}
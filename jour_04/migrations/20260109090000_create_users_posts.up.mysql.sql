@@ -0,0 +1,19 @@
+-- Tables initiales (équivalent de l'ancien AutoMigrate de jour_04).
+-- IF NOT EXISTS permet d'adopter une base déjà créée par AutoMigrate.
+CREATE TABLE IF NOT EXISTS users (
+    id    BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    name  VARCHAR(191) NOT NULL,
+    email VARCHAR(191) NOT NULL,
+    age   BIGINT,
+    PRIMARY KEY (id),
+    UNIQUE INDEX idx_users_email (email)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS posts (
+    id      BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    title   VARCHAR(191) NOT NULL,
+    content LONGTEXT,
+    user_id BIGINT UNSIGNED NOT NULL,
+    PRIMARY KEY (id),
+    CONSTRAINT fk_users_posts FOREIGN KEY (user_id) REFERENCES users (id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
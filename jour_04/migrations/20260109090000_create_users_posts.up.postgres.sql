@@ -0,0 +1,17 @@
+-- Tables initiales (équivalent de l'ancien AutoMigrate de jour_04).
+-- IF NOT EXISTS permet d'adopter une base déjà créée par AutoMigrate.
+CREATE TABLE IF NOT EXISTS users (
+    id    BIGSERIAL PRIMARY KEY,
+    name  TEXT NOT NULL,
+    email TEXT NOT NULL,
+    age   BIGINT
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email ON users (email);
+
+CREATE TABLE IF NOT EXISTS posts (
+    id      BIGSERIAL PRIMARY KEY,
+    title   TEXT NOT NULL,
+    content TEXT,
+    user_id BIGINT NOT NULL,
+    CONSTRAINT fk_users_posts FOREIGN KEY (user_id) REFERENCES users (id)
+);
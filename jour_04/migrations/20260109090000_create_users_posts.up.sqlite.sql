@@ -0,0 +1,17 @@
+-- Tables initiales (équivalent de l'ancien AutoMigrate de jour_04).
+-- IF NOT EXISTS permet d'adopter une base déjà créée par AutoMigrate.
+CREATE TABLE IF NOT EXISTS users (
+    id    INTEGER PRIMARY KEY AUTOINCREMENT,
+    name  TEXT NOT NULL,
+    email TEXT NOT NULL,
+    age   INTEGER
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email ON users (email);
+
+CREATE TABLE IF NOT EXISTS posts (
+    id      INTEGER PRIMARY KEY AUTOINCREMENT,
+    title   TEXT NOT NULL,
+    content TEXT,
+    user_id INTEGER NOT NULL,
+    CONSTRAINT fk_users_posts FOREIGN KEY (user_id) REFERENCES users (id)
+);
@@ -0,0 +1,2 @@
+-- Téléphone optionnel au format E.164 (+237XXXXXXXXX)
+ALTER TABLE users ADD COLUMN phone VARCHAR(32);
@@ -0,0 +1,13 @@
+CREATE TABLE feature_flags (
+    id           BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    flag_key     VARCHAR(191) NOT NULL,
+    description  VARCHAR(255),
+    type         VARCHAR(32) NOT NULL DEFAULT 'boolean',
+    enabled      BOOLEAN,
+    rollout      BIGINT,
+    target_users TEXT,
+    target_roles TEXT,
+    updated_at   DATETIME(3) NULL,
+    PRIMARY KEY (id),
+    UNIQUE INDEX idx_feature_flags_key (flag_key)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
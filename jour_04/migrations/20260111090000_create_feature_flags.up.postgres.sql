@@ -0,0 +1,12 @@
+CREATE TABLE feature_flags (
+    id           BIGSERIAL PRIMARY KEY,
+    flag_key     TEXT NOT NULL,
+    description  TEXT,
+    type         TEXT NOT NULL DEFAULT 'boolean',
+    enabled      BOOLEAN,
+    rollout      BIGINT,
+    target_users TEXT,
+    target_roles TEXT,
+    updated_at   TIMESTAMPTZ
+);
+CREATE UNIQUE INDEX idx_feature_flags_key ON feature_flags (flag_key);
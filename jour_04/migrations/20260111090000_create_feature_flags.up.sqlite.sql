@@ -0,0 +1,12 @@
+CREATE TABLE feature_flags (
+    id           INTEGER PRIMARY KEY AUTOINCREMENT,
+    flag_key     TEXT NOT NULL,
+    description  TEXT,
+    type         TEXT NOT NULL DEFAULT 'boolean',
+    enabled      NUMERIC,
+    rollout      INTEGER,
+    target_users TEXT,
+    target_roles TEXT,
+    updated_at   DATETIME
+);
+CREATE UNIQUE INDEX idx_feature_flags_key ON feature_flags (flag_key);
@@ -0,0 +1,16 @@
+CREATE TABLE tags (
+    id   BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    name VARCHAR(191) NOT NULL,
+    PRIMARY KEY (id),
+    UNIQUE INDEX idx_tags_name (name)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- Table de jointure Post <-> Tag (many2many:post_tags)
+CREATE TABLE post_tags (
+    post_id BIGINT UNSIGNED NOT NULL,
+    tag_id  BIGINT UNSIGNED NOT NULL,
+    PRIMARY KEY (post_id, tag_id),
+    INDEX idx_post_tags_tag_id (tag_id),
+    CONSTRAINT fk_post_tags_post FOREIGN KEY (post_id) REFERENCES posts (id),
+    CONSTRAINT fk_post_tags_tag FOREIGN KEY (tag_id) REFERENCES tags (id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
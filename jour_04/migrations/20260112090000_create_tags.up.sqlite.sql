@@ -0,0 +1,15 @@
+CREATE TABLE tags (
+    id   INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL
+);
+CREATE UNIQUE INDEX idx_tags_name ON tags (name);
+
+-- Table de jointure Post <-> Tag (many2many:post_tags)
+CREATE TABLE post_tags (
+    post_id INTEGER NOT NULL,
+    tag_id  INTEGER NOT NULL,
+    PRIMARY KEY (post_id, tag_id),
+    CONSTRAINT fk_post_tags_post FOREIGN KEY (post_id) REFERENCES posts (id),
+    CONSTRAINT fk_post_tags_tag FOREIGN KEY (tag_id) REFERENCES tags (id)
+);
+CREATE INDEX idx_post_tags_tag_id ON post_tags (tag_id);
@@ -0,0 +1,18 @@
+-- Commentaires en fil de discussion : parent_id désigne le commentaire parent
+CREATE TABLE comments (
+    id         BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    post_id    BIGINT UNSIGNED NOT NULL,
+    user_id    BIGINT UNSIGNED NOT NULL,
+    parent_id  BIGINT UNSIGNED NULL,
+    depth      BIGINT NOT NULL DEFAULT 0,
+    content    LONGTEXT NOT NULL,
+    created_at DATETIME(3) NULL,
+    updated_at DATETIME(3) NULL,
+    PRIMARY KEY (id),
+    INDEX idx_comments_post_id (post_id),
+    INDEX idx_comments_user_id (user_id),
+    INDEX idx_comments_parent_id (parent_id),
+    CONSTRAINT fk_posts_comments FOREIGN KEY (post_id) REFERENCES posts (id),
+    CONSTRAINT fk_users_comments FOREIGN KEY (user_id) REFERENCES users (id),
+    CONSTRAINT fk_comments_replies FOREIGN KEY (parent_id) REFERENCES comments (id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
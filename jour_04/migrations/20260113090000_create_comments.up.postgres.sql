@@ -0,0 +1,17 @@
+-- Commentaires en fil de discussion : parent_id désigne le commentaire parent
+CREATE TABLE comments (
+    id         BIGSERIAL PRIMARY KEY,
+    post_id    BIGINT NOT NULL,
+    user_id    BIGINT NOT NULL,
+    parent_id  BIGINT,
+    depth      BIGINT NOT NULL DEFAULT 0,
+    content    TEXT NOT NULL,
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ,
+    CONSTRAINT fk_posts_comments FOREIGN KEY (post_id) REFERENCES posts (id),
+    CONSTRAINT fk_users_comments FOREIGN KEY (user_id) REFERENCES users (id),
+    CONSTRAINT fk_comments_replies FOREIGN KEY (parent_id) REFERENCES comments (id)
+);
+CREATE INDEX idx_comments_post_id ON comments (post_id);
+CREATE INDEX idx_comments_user_id ON comments (user_id);
+CREATE INDEX idx_comments_parent_id ON comments (parent_id);
@@ -0,0 +1,17 @@
+-- Commentaires en fil de discussion : parent_id désigne le commentaire parent
+CREATE TABLE comments (
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    post_id    INTEGER NOT NULL,
+    user_id    INTEGER NOT NULL,
+    parent_id  INTEGER,
+    depth      INTEGER NOT NULL DEFAULT 0,
+    content    TEXT NOT NULL,
+    created_at DATETIME,
+    updated_at DATETIME,
+    CONSTRAINT fk_posts_comments FOREIGN KEY (post_id) REFERENCES posts (id),
+    CONSTRAINT fk_users_comments FOREIGN KEY (user_id) REFERENCES users (id),
+    CONSTRAINT fk_comments_replies FOREIGN KEY (parent_id) REFERENCES comments (id)
+);
+CREATE INDEX idx_comments_post_id ON comments (post_id);
+CREATE INDEX idx_comments_user_id ON comments (user_id);
+CREATE INDEX idx_comments_parent_id ON comments (parent_id);
@@ -0,0 +1 @@
+DROP INDEX ft_posts_search ON posts;
@@ -0,0 +1 @@
+DROP INDEX idx_posts_search;
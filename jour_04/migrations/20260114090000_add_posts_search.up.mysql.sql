@@ -0,0 +1,3 @@
+-- Index FULLTEXT InnoDB, maintenu par MySQL à chaque écriture sur posts.
+-- Les mots plus courts que innodb_ft_min_token_size (3 par défaut) ne sont pas indexés.
+CREATE FULLTEXT INDEX ft_posts_search ON posts (title, content);
@@ -0,0 +1,9 @@
+-- Index GIN sur un tsvector français + anglais (titre en poids A, contenu en B).
+-- Index d'expression : PostgreSQL le maintient à chaque écriture, sans colonne
+-- supplémentaire. L'expression doit rester identique à pgSearchVector (search.go).
+CREATE INDEX idx_posts_search ON posts USING GIN ((
+    setweight(to_tsvector('french', coalesce(title, '')), 'A') ||
+    setweight(to_tsvector('english', coalesce(title, '')), 'A') ||
+    setweight(to_tsvector('french', coalesce(content, '')), 'B') ||
+    setweight(to_tsvector('english', coalesce(content, '')), 'B')
+));
@@ -0,0 +1,11 @@
+-- Horodatages et corbeille (gorm.DeletedAt) : une ligne supprimée garde
+-- deleted_at jusqu'à la purge
+ALTER TABLE users ADD COLUMN created_at DATETIME(3) NULL;
+ALTER TABLE users ADD COLUMN updated_at DATETIME(3) NULL;
+ALTER TABLE users ADD COLUMN deleted_at DATETIME(3) NULL;
+CREATE INDEX idx_users_deleted_at ON users (deleted_at);
+
+ALTER TABLE posts ADD COLUMN created_at DATETIME(3) NULL;
+ALTER TABLE posts ADD COLUMN updated_at DATETIME(3) NULL;
+ALTER TABLE posts ADD COLUMN deleted_at DATETIME(3) NULL;
+CREATE INDEX idx_posts_deleted_at ON posts (deleted_at);
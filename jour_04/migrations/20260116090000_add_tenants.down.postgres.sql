@@ -0,0 +1,13 @@
+DROP INDEX idx_comments_tenant_id;
+ALTER TABLE comments DROP COLUMN tenant_id;
+
+DROP INDEX idx_tags_tenant_name;
+CREATE UNIQUE INDEX idx_tags_name ON tags (name);
+ALTER TABLE tags DROP COLUMN tenant_id;
+
+DROP INDEX idx_posts_tenant_id;
+ALTER TABLE posts DROP COLUMN tenant_id;
+
+DROP INDEX idx_users_tenant_email;
+CREATE UNIQUE INDEX idx_users_email ON users (email);
+ALTER TABLE users DROP COLUMN tenant_id;
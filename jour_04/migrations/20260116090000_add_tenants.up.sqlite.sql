@@ -0,0 +1,16 @@
+-- Multi-tenant : chaque ligne appartient à un tenant (voir tenant.go). Les
+-- données existantes vont au tenant "default" ; l'unicité de l'email et du
+-- nom de tag devient propre à chaque tenant.
+ALTER TABLE users ADD COLUMN tenant_id TEXT NOT NULL DEFAULT 'default';
+DROP INDEX idx_users_email;
+CREATE UNIQUE INDEX idx_users_tenant_email ON users (tenant_id, email);
+
+ALTER TABLE posts ADD COLUMN tenant_id TEXT NOT NULL DEFAULT 'default';
+CREATE INDEX idx_posts_tenant_id ON posts (tenant_id);
+
+ALTER TABLE tags ADD COLUMN tenant_id TEXT NOT NULL DEFAULT 'default';
+DROP INDEX idx_tags_name;
+CREATE UNIQUE INDEX idx_tags_tenant_name ON tags (tenant_id, name);
+
+ALTER TABLE comments ADD COLUMN tenant_id TEXT NOT NULL DEFAULT 'default';
+CREATE INDEX idx_comments_tenant_id ON comments (tenant_id);
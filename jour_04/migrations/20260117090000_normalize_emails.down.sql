@@ -0,0 +1 @@
+-- Rien à annuler : la casse d'origine des emails n'est pas conservée
@@ -0,0 +1,2 @@
+-- Emails comparés sans casse : stockés en minuscules, sans espaces autour
+UPDATE users SET email = LOWER(TRIM(email)) WHERE email <> LOWER(TRIM(email));
@@ -0,0 +1,4 @@
+DROP TABLE journal_lines;
+DROP TABLE journal_entries;
+DROP TABLE accounts;
+DROP FUNCTION ledger_immutable();
@@ -0,0 +1,56 @@
+-- Grand livre en partie double (voir ledger.go). Chaque ligne débite un
+-- compte et en crédite un autre du même montant : toute écriture est donc
+-- équilibrée par construction (débits = crédits), ce que les CHECK garantissent
+-- (MySQL 8.0.16+). accounts.balance est le cache de la somme des lignes
+-- (crédits - débits).
+CREATE TABLE accounts (
+    id         BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    tenant_id  VARCHAR(64) NOT NULL,
+    code       VARCHAR(64) NOT NULL,
+    kind       VARCHAR(16) NOT NULL,
+    user_id    BIGINT UNSIGNED NULL,
+    currency   VARCHAR(3) NOT NULL DEFAULT 'XAF',
+    balance    BIGINT NOT NULL DEFAULT 0,
+    created_at DATETIME(3) NULL,
+    updated_at DATETIME(3) NULL,
+    PRIMARY KEY (id),
+    UNIQUE INDEX idx_accounts_tenant_code (tenant_id, code),
+    INDEX idx_accounts_user_id (user_id),
+    CONSTRAINT chk_accounts_kind CHECK (kind IN ('wallet', 'fees', 'suspense')),
+    CONSTRAINT chk_accounts_wallet_balance CHECK (kind <> 'wallet' OR balance >= 0)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE journal_entries (
+    id          BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    tenant_id   VARCHAR(64) NOT NULL,
+    description LONGTEXT NOT NULL,
+    created_at  DATETIME(3) NULL,
+    PRIMARY KEY (id),
+    INDEX idx_journal_entries_tenant_id (tenant_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE journal_lines (
+    id                BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    tenant_id         VARCHAR(64) NOT NULL,
+    entry_id          BIGINT UNSIGNED NOT NULL,
+    debit_account_id  BIGINT UNSIGNED NOT NULL,
+    credit_account_id BIGINT UNSIGNED NOT NULL,
+    amount            BIGINT NOT NULL,
+    PRIMARY KEY (id),
+    INDEX idx_journal_lines_tenant_id (tenant_id),
+    INDEX idx_journal_lines_entry_id (entry_id),
+    INDEX idx_journal_lines_debit_account_id (debit_account_id),
+    INDEX idx_journal_lines_credit_account_id (credit_account_id),
+    CONSTRAINT fk_journal_entries_lines FOREIGN KEY (entry_id) REFERENCES journal_entries (id),
+    CONSTRAINT fk_journal_lines_debit FOREIGN KEY (debit_account_id) REFERENCES accounts (id),
+    CONSTRAINT fk_journal_lines_credit FOREIGN KEY (credit_account_id) REFERENCES accounts (id),
+    CONSTRAINT chk_journal_lines_amount CHECK (amount > 0),
+    CONSTRAINT chk_journal_lines_accounts CHECK (debit_account_id <> credit_account_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- Écritures immuables : une correction passe par une écriture inverse
+CREATE TRIGGER journal_entries_immutable BEFORE UPDATE ON journal_entries FOR EACH ROW
+    SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'journal_entries : écritures comptables immuables';
+
+CREATE TRIGGER journal_lines_immutable BEFORE UPDATE ON journal_lines FOR EACH ROW
+    SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'journal_lines : écritures comptables immuables';
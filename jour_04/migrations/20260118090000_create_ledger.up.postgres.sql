@@ -0,0 +1,57 @@
+-- Grand livre en partie double (voir ledger.go). Chaque ligne débite un
+-- compte et en crédite un autre du même montant : toute écriture est donc
+-- équilibrée par construction (débits = crédits), ce que les CHECK garantissent.
+-- accounts.balance est le cache de la somme des lignes (crédits - débits).
+CREATE TABLE accounts (
+    id         BIGSERIAL PRIMARY KEY,
+    tenant_id  VARCHAR(64) NOT NULL,
+    code       VARCHAR(64) NOT NULL,
+    kind       VARCHAR(16) NOT NULL CHECK (kind IN ('wallet', 'fees', 'suspense')),
+    user_id    BIGINT,
+    currency   VARCHAR(3) NOT NULL DEFAULT 'XAF',
+    balance    BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ,
+    CONSTRAINT chk_accounts_wallet_balance CHECK (kind <> 'wallet' OR balance >= 0)
+);
+CREATE UNIQUE INDEX idx_accounts_tenant_code ON accounts (tenant_id, code);
+CREATE INDEX idx_accounts_user_id ON accounts (user_id);
+
+CREATE TABLE journal_entries (
+    id          BIGSERIAL PRIMARY KEY,
+    tenant_id   VARCHAR(64) NOT NULL,
+    description TEXT NOT NULL,
+    created_at  TIMESTAMPTZ
+);
+CREATE INDEX idx_journal_entries_tenant_id ON journal_entries (tenant_id);
+
+CREATE TABLE journal_lines (
+    id                BIGSERIAL PRIMARY KEY,
+    tenant_id         VARCHAR(64) NOT NULL,
+    entry_id          BIGINT NOT NULL,
+    debit_account_id  BIGINT NOT NULL,
+    credit_account_id BIGINT NOT NULL,
+    amount            BIGINT NOT NULL,
+    CONSTRAINT fk_journal_entries_lines FOREIGN KEY (entry_id) REFERENCES journal_entries (id),
+    CONSTRAINT fk_journal_lines_debit FOREIGN KEY (debit_account_id) REFERENCES accounts (id),
+    CONSTRAINT fk_journal_lines_credit FOREIGN KEY (credit_account_id) REFERENCES accounts (id),
+    CONSTRAINT chk_journal_lines_amount CHECK (amount > 0),
+    CONSTRAINT chk_journal_lines_accounts CHECK (debit_account_id <> credit_account_id)
+);
+CREATE INDEX idx_journal_lines_tenant_id ON journal_lines (tenant_id);
+CREATE INDEX idx_journal_lines_entry_id ON journal_lines (entry_id);
+CREATE INDEX idx_journal_lines_debit_account_id ON journal_lines (debit_account_id);
+CREATE INDEX idx_journal_lines_credit_account_id ON journal_lines (credit_account_id);
+
+-- Écritures immuables : une correction passe par une écriture inverse
+CREATE FUNCTION ledger_immutable() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION '% : écritures comptables immuables', TG_TABLE_NAME;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER journal_entries_immutable BEFORE UPDATE ON journal_entries
+    FOR EACH ROW EXECUTE FUNCTION ledger_immutable();
+
+CREATE TRIGGER journal_lines_immutable BEFORE UPDATE ON journal_lines
+    FOR EACH ROW EXECUTE FUNCTION ledger_immutable();
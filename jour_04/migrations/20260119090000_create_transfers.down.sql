@@ -0,0 +1,2 @@
+DROP TABLE transfers;
+ALTER TABLE accounts DROP COLUMN frozen;
@@ -0,0 +1,35 @@
+-- Virements entre portefeuilles (voir transfer.go). Un virement est unique
+-- par clé d'idempotence dans son tenant ; entry_id et reversal_entry_id
+-- pointent vers les écritures du grand livre qui l'exécutent et l'annulent.
+ALTER TABLE accounts ADD COLUMN frozen BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE TABLE transfers (
+    id                BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    tenant_id         VARCHAR(64) NOT NULL,
+    idempotency_key   VARCHAR(255) NOT NULL,
+    from_user_id      BIGINT UNSIGNED NOT NULL,
+    to_user_id        BIGINT UNSIGNED NOT NULL,
+    from_account_id   BIGINT UNSIGNED NOT NULL,
+    to_account_id     BIGINT UNSIGNED NOT NULL,
+    amount            BIGINT NOT NULL,
+    currency          VARCHAR(3) NOT NULL DEFAULT 'XAF',
+    description       VARCHAR(255) NOT NULL DEFAULT '',
+    status            VARCHAR(16) NOT NULL,
+    failure_code      VARCHAR(32) NULL,
+    entry_id          BIGINT UNSIGNED NULL,
+    reversal_entry_id BIGINT UNSIGNED NULL,
+    created_at        DATETIME(3) NULL,
+    updated_at        DATETIME(3) NULL,
+    reversed_at       DATETIME(3) NULL,
+    PRIMARY KEY (id),
+    UNIQUE INDEX idx_transfers_tenant_idempotency_key (tenant_id, idempotency_key),
+    INDEX idx_transfers_from_user_created (from_user_id, created_at),
+    INDEX idx_transfers_to_user_id (to_user_id),
+    CONSTRAINT fk_transfers_from_account FOREIGN KEY (from_account_id) REFERENCES accounts (id),
+    CONSTRAINT fk_transfers_to_account FOREIGN KEY (to_account_id) REFERENCES accounts (id),
+    CONSTRAINT fk_transfers_entry FOREIGN KEY (entry_id) REFERENCES journal_entries (id),
+    CONSTRAINT fk_transfers_reversal_entry FOREIGN KEY (reversal_entry_id) REFERENCES journal_entries (id),
+    CONSTRAINT chk_transfers_status CHECK (status IN ('pending', 'completed', 'failed', 'reversed')),
+    CONSTRAINT chk_transfers_amount CHECK (amount > 0),
+    CONSTRAINT chk_transfers_users CHECK (from_user_id <> to_user_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,33 @@
+-- Virements entre portefeuilles (voir transfer.go). Un virement est unique
+-- par clé d'idempotence dans son tenant ; entry_id et reversal_entry_id
+-- pointent vers les écritures du grand livre qui l'exécutent et l'annulent.
+ALTER TABLE accounts ADD COLUMN frozen BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE TABLE transfers (
+    id                BIGSERIAL PRIMARY KEY,
+    tenant_id         VARCHAR(64) NOT NULL,
+    idempotency_key   VARCHAR(255) NOT NULL,
+    from_user_id      BIGINT NOT NULL,
+    to_user_id        BIGINT NOT NULL,
+    from_account_id   BIGINT NOT NULL,
+    to_account_id     BIGINT NOT NULL,
+    amount            BIGINT NOT NULL,
+    currency          VARCHAR(3) NOT NULL DEFAULT 'XAF',
+    description       VARCHAR(255) NOT NULL DEFAULT '',
+    status            VARCHAR(16) NOT NULL CHECK (status IN ('pending', 'completed', 'failed', 'reversed')),
+    failure_code      VARCHAR(32),
+    entry_id          BIGINT,
+    reversal_entry_id BIGINT,
+    created_at        TIMESTAMPTZ,
+    updated_at        TIMESTAMPTZ,
+    reversed_at       TIMESTAMPTZ,
+    CONSTRAINT fk_transfers_from_account FOREIGN KEY (from_account_id) REFERENCES accounts (id),
+    CONSTRAINT fk_transfers_to_account FOREIGN KEY (to_account_id) REFERENCES accounts (id),
+    CONSTRAINT fk_transfers_entry FOREIGN KEY (entry_id) REFERENCES journal_entries (id),
+    CONSTRAINT fk_transfers_reversal_entry FOREIGN KEY (reversal_entry_id) REFERENCES journal_entries (id),
+    CONSTRAINT chk_transfers_amount CHECK (amount > 0),
+    CONSTRAINT chk_transfers_users CHECK (from_user_id <> to_user_id)
+);
+CREATE UNIQUE INDEX idx_transfers_tenant_idempotency_key ON transfers (tenant_id, idempotency_key);
+CREATE INDEX idx_transfers_from_user_created ON transfers (from_user_id, created_at);
+CREATE INDEX idx_transfers_to_user_id ON transfers (to_user_id);
@@ -0,0 +1,33 @@
+-- Virements entre portefeuilles (voir transfer.go). Un virement est unique
+-- par clé d'idempotence dans son tenant ; entry_id et reversal_entry_id
+-- pointent vers les écritures du grand livre qui l'exécutent et l'annulent.
+ALTER TABLE accounts ADD COLUMN frozen NUMERIC NOT NULL DEFAULT 0;
+
+CREATE TABLE transfers (
+    id                INTEGER PRIMARY KEY AUTOINCREMENT,
+    tenant_id         TEXT NOT NULL,
+    idempotency_key   TEXT NOT NULL,
+    from_user_id      INTEGER NOT NULL,
+    to_user_id        INTEGER NOT NULL,
+    from_account_id   INTEGER NOT NULL,
+    to_account_id     INTEGER NOT NULL,
+    amount            INTEGER NOT NULL,
+    currency          TEXT NOT NULL DEFAULT 'XAF',
+    description       TEXT NOT NULL DEFAULT '',
+    status            TEXT NOT NULL CHECK (status IN ('pending', 'completed', 'failed', 'reversed')),
+    failure_code      TEXT,
+    entry_id          INTEGER,
+    reversal_entry_id INTEGER,
+    created_at        DATETIME,
+    updated_at        DATETIME,
+    reversed_at       DATETIME,
+    CONSTRAINT fk_transfers_from_account FOREIGN KEY (from_account_id) REFERENCES accounts (id),
+    CONSTRAINT fk_transfers_to_account FOREIGN KEY (to_account_id) REFERENCES accounts (id),
+    CONSTRAINT fk_transfers_entry FOREIGN KEY (entry_id) REFERENCES journal_entries (id),
+    CONSTRAINT fk_transfers_reversal_entry FOREIGN KEY (reversal_entry_id) REFERENCES journal_entries (id),
+    CONSTRAINT chk_transfers_amount CHECK (amount > 0),
+    CONSTRAINT chk_transfers_users CHECK (from_user_id <> to_user_id)
+);
+CREATE UNIQUE INDEX idx_transfers_tenant_idempotency_key ON transfers (tenant_id, idempotency_key);
+CREATE INDEX idx_transfers_from_user_created ON transfers (from_user_id, created_at);
+CREATE INDEX idx_transfers_to_user_id ON transfers (to_user_id);
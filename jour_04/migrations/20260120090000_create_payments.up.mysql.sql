@@ -0,0 +1,37 @@
+-- Dépôts et retraits mobile money (voir payment.go). reference (UUID) est
+-- transmise à l'opérateur, provider_ref est la sienne ; entry_id et
+-- refund_entry_id pointent vers les écritures de crédit ou de réserve et de
+-- remboursement.
+CREATE TABLE payments (
+    id              BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    tenant_id       VARCHAR(64) NOT NULL,
+    idempotency_key VARCHAR(255) NOT NULL,
+    reference       VARCHAR(36) NOT NULL,
+    kind            VARCHAR(16) NOT NULL,
+    provider        VARCHAR(16) NOT NULL,
+    provider_ref    VARCHAR(64) NULL,
+    user_id         BIGINT UNSIGNED NOT NULL,
+    account_id      BIGINT UNSIGNED NOT NULL,
+    phone           VARCHAR(32) NOT NULL,
+    amount          BIGINT NOT NULL,
+    currency        VARCHAR(3) NOT NULL DEFAULT 'XAF',
+    status          VARCHAR(16) NOT NULL,
+    failure_reason  VARCHAR(255) NULL,
+    entry_id        BIGINT UNSIGNED NULL,
+    refund_entry_id BIGINT UNSIGNED NULL,
+    created_at      DATETIME(3) NULL,
+    updated_at      DATETIME(3) NULL,
+    completed_at    DATETIME(3) NULL,
+    PRIMARY KEY (id),
+    UNIQUE INDEX idx_payments_tenant_idempotency_key (tenant_id, idempotency_key),
+    UNIQUE INDEX idx_payments_reference (reference),
+    INDEX idx_payments_provider_ref (provider_ref),
+    INDEX idx_payments_status (status),
+    INDEX idx_payments_user_id (user_id),
+    CONSTRAINT fk_payments_account FOREIGN KEY (account_id) REFERENCES accounts (id),
+    CONSTRAINT fk_payments_entry FOREIGN KEY (entry_id) REFERENCES journal_entries (id),
+    CONSTRAINT fk_payments_refund_entry FOREIGN KEY (refund_entry_id) REFERENCES journal_entries (id),
+    CONSTRAINT chk_payments_kind CHECK (kind IN ('deposit', 'withdrawal')),
+    CONSTRAINT chk_payments_status CHECK (status IN ('pending', 'completed', 'failed')),
+    CONSTRAINT chk_payments_amount CHECK (amount > 0)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
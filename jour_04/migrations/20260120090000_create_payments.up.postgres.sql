@@ -0,0 +1,34 @@
+-- Dépôts et retraits mobile money (voir payment.go). reference (UUID) est
+-- transmise à l'opérateur, provider_ref est la sienne ; entry_id et
+-- refund_entry_id pointent vers les écritures de crédit ou de réserve et de
+-- remboursement.
+CREATE TABLE payments (
+    id              BIGSERIAL PRIMARY KEY,
+    tenant_id       VARCHAR(64) NOT NULL,
+    idempotency_key VARCHAR(255) NOT NULL,
+    reference       VARCHAR(36) NOT NULL,
+    kind            VARCHAR(16) NOT NULL CHECK (kind IN ('deposit', 'withdrawal')),
+    provider        VARCHAR(16) NOT NULL,
+    provider_ref    VARCHAR(64),
+    user_id         BIGINT NOT NULL,
+    account_id      BIGINT NOT NULL,
+    phone           VARCHAR(32) NOT NULL,
+    amount          BIGINT NOT NULL,
+    currency        VARCHAR(3) NOT NULL DEFAULT 'XAF',
+    status          VARCHAR(16) NOT NULL CHECK (status IN ('pending', 'completed', 'failed')),
+    failure_reason  VARCHAR(255),
+    entry_id        BIGINT,
+    refund_entry_id BIGINT,
+    created_at      TIMESTAMPTZ,
+    updated_at      TIMESTAMPTZ,
+    completed_at    TIMESTAMPTZ,
+    CONSTRAINT fk_payments_account FOREIGN KEY (account_id) REFERENCES accounts (id),
+    CONSTRAINT fk_payments_entry FOREIGN KEY (entry_id) REFERENCES journal_entries (id),
+    CONSTRAINT fk_payments_refund_entry FOREIGN KEY (refund_entry_id) REFERENCES journal_entries (id),
+    CONSTRAINT chk_payments_amount CHECK (amount > 0)
+);
+CREATE UNIQUE INDEX idx_payments_tenant_idempotency_key ON payments (tenant_id, idempotency_key);
+CREATE UNIQUE INDEX idx_payments_reference ON payments (reference);
+CREATE INDEX idx_payments_provider_ref ON payments (provider_ref);
+CREATE INDEX idx_payments_status ON payments (status);
+CREATE INDEX idx_payments_user_id ON payments (user_id);
@@ -0,0 +1,34 @@
+-- Dépôts et retraits mobile money (voir payment.go). reference (UUID) est
+-- transmise à l'opérateur, provider_ref est la sienne ; entry_id et
+-- refund_entry_id pointent vers les écritures de crédit ou de réserve et de
+-- remboursement.
+CREATE TABLE payments (
+    id              INTEGER PRIMARY KEY AUTOINCREMENT,
+    tenant_id       TEXT NOT NULL,
+    idempotency_key TEXT NOT NULL,
+    reference       TEXT NOT NULL,
+    kind            TEXT NOT NULL CHECK (kind IN ('deposit', 'withdrawal')),
+    provider        TEXT NOT NULL,
+    provider_ref    TEXT,
+    user_id         INTEGER NOT NULL,
+    account_id      INTEGER NOT NULL,
+    phone           TEXT NOT NULL,
+    amount          INTEGER NOT NULL,
+    currency        TEXT NOT NULL DEFAULT 'XAF',
+    status          TEXT NOT NULL CHECK (status IN ('pending', 'completed', 'failed')),
+    failure_reason  TEXT,
+    entry_id        INTEGER,
+    refund_entry_id INTEGER,
+    created_at      DATETIME,
+    updated_at      DATETIME,
+    completed_at    DATETIME,
+    CONSTRAINT fk_payments_account FOREIGN KEY (account_id) REFERENCES accounts (id),
+    CONSTRAINT fk_payments_entry FOREIGN KEY (entry_id) REFERENCES journal_entries (id),
+    CONSTRAINT fk_payments_refund_entry FOREIGN KEY (refund_entry_id) REFERENCES journal_entries (id),
+    CONSTRAINT chk_payments_amount CHECK (amount > 0)
+);
+CREATE UNIQUE INDEX idx_payments_tenant_idempotency_key ON payments (tenant_id, idempotency_key);
+CREATE UNIQUE INDEX idx_payments_reference ON payments (reference);
+CREATE INDEX idx_payments_provider_ref ON payments (provider_ref);
+CREATE INDEX idx_payments_status ON payments (status);
+CREATE INDEX idx_payments_user_id ON payments (user_id);
@@ -0,0 +1,57 @@
+-- Webhooks sortants (voir webhook.go). webhook_deliveries est le journal des
+-- livraisons : sans clé étrangère vers webhook_endpoints, il survit à la
+-- suppression d'un endpoint. (status, next_attempt_at) sert au dispatcher.
+CREATE TABLE webhook_endpoints (
+    id                         BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    tenant_id                  VARCHAR(64) NOT NULL,
+    url                        VARCHAR(2048) NOT NULL,
+    description                VARCHAR(255) NULL,
+    events                     VARCHAR(1024) NOT NULL,
+    active                     BOOLEAN NOT NULL DEFAULT TRUE,
+    secret                     VARCHAR(64) NOT NULL,
+    previous_secret            VARCHAR(64) NULL,
+    previous_secret_expires_at DATETIME(3) NULL,
+    created_at                 DATETIME(3) NULL,
+    updated_at                 DATETIME(3) NULL,
+    PRIMARY KEY (id),
+    INDEX idx_webhook_endpoints_tenant_id (tenant_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE webhook_deliveries (
+    id               BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    tenant_id        VARCHAR(64) NOT NULL,
+    endpoint_id      BIGINT UNSIGNED NOT NULL,
+    event_id         VARCHAR(36) NOT NULL,
+    event_type       VARCHAR(64) NOT NULL,
+    payload          TEXT NOT NULL,
+    status           VARCHAR(16) NOT NULL,
+    next_attempt_at  DATETIME(3) NULL,
+    attempts         BIGINT NOT NULL DEFAULT 0,
+    last_status_code BIGINT NULL,
+    last_error       VARCHAR(255) NULL,
+    created_at       DATETIME(3) NULL,
+    updated_at       DATETIME(3) NULL,
+    delivered_at     DATETIME(3) NULL,
+    PRIMARY KEY (id),
+    INDEX idx_webhook_deliveries_tenant_id (tenant_id),
+    INDEX idx_webhook_deliveries_endpoint_id (endpoint_id),
+    INDEX idx_webhook_deliveries_event_id (event_id),
+    INDEX idx_webhook_deliveries_status_next (status, next_attempt_at),
+    CONSTRAINT chk_webhook_deliveries_status CHECK (status IN ('pending', 'succeeded', 'dead'))
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE webhook_attempts (
+    id          BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    tenant_id   VARCHAR(64) NOT NULL,
+    delivery_id BIGINT UNSIGNED NOT NULL,
+    number      BIGINT NOT NULL,
+    status_code BIGINT NULL,
+    error       VARCHAR(255) NULL,
+    duration_ms BIGINT NOT NULL DEFAULT 0,
+    manual      BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at  DATETIME(3) NULL,
+    PRIMARY KEY (id),
+    INDEX idx_webhook_attempts_tenant_id (tenant_id),
+    INDEX idx_webhook_attempts_delivery_id (delivery_id),
+    CONSTRAINT fk_webhook_attempts_delivery FOREIGN KEY (delivery_id) REFERENCES webhook_deliveries (id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,53 @@
+-- Webhooks sortants (voir webhook.go). webhook_deliveries est le journal des
+-- livraisons : sans clé étrangère vers webhook_endpoints, il survit à la
+-- suppression d'un endpoint. (status, next_attempt_at) sert au dispatcher.
+CREATE TABLE webhook_endpoints (
+    id                         BIGSERIAL PRIMARY KEY,
+    tenant_id                  VARCHAR(64) NOT NULL,
+    url                        VARCHAR(2048) NOT NULL,
+    description                VARCHAR(255),
+    events                     VARCHAR(1024) NOT NULL,
+    active                     BOOLEAN NOT NULL DEFAULT TRUE,
+    secret                     VARCHAR(64) NOT NULL,
+    previous_secret            VARCHAR(64),
+    previous_secret_expires_at TIMESTAMPTZ,
+    created_at                 TIMESTAMPTZ,
+    updated_at                 TIMESTAMPTZ
+);
+CREATE INDEX idx_webhook_endpoints_tenant_id ON webhook_endpoints (tenant_id);
+
+CREATE TABLE webhook_deliveries (
+    id               BIGSERIAL PRIMARY KEY,
+    tenant_id        VARCHAR(64) NOT NULL,
+    endpoint_id      BIGINT NOT NULL,
+    event_id         VARCHAR(36) NOT NULL,
+    event_type       VARCHAR(64) NOT NULL,
+    payload          TEXT NOT NULL,
+    status           VARCHAR(16) NOT NULL CHECK (status IN ('pending', 'succeeded', 'dead')),
+    next_attempt_at  TIMESTAMPTZ,
+    attempts         BIGINT NOT NULL DEFAULT 0,
+    last_status_code BIGINT,
+    last_error       VARCHAR(255),
+    created_at       TIMESTAMPTZ,
+    updated_at       TIMESTAMPTZ,
+    delivered_at     TIMESTAMPTZ
+);
+CREATE INDEX idx_webhook_deliveries_tenant_id ON webhook_deliveries (tenant_id);
+CREATE INDEX idx_webhook_deliveries_endpoint_id ON webhook_deliveries (endpoint_id);
+CREATE INDEX idx_webhook_deliveries_event_id ON webhook_deliveries (event_id);
+CREATE INDEX idx_webhook_deliveries_status_next ON webhook_deliveries (status, next_attempt_at);
+
+CREATE TABLE webhook_attempts (
+    id          BIGSERIAL PRIMARY KEY,
+    tenant_id   VARCHAR(64) NOT NULL,
+    delivery_id BIGINT NOT NULL,
+    number      BIGINT NOT NULL,
+    status_code BIGINT,
+    error       VARCHAR(255),
+    duration_ms BIGINT NOT NULL DEFAULT 0,
+    manual      BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at  TIMESTAMPTZ,
+    CONSTRAINT fk_webhook_attempts_delivery FOREIGN KEY (delivery_id) REFERENCES webhook_deliveries (id) ON DELETE CASCADE
+);
+CREATE INDEX idx_webhook_attempts_tenant_id ON webhook_attempts (tenant_id);
+CREATE INDEX idx_webhook_attempts_delivery_id ON webhook_attempts (delivery_id);
@@ -0,0 +1,53 @@
+-- Webhooks sortants (voir webhook.go). webhook_deliveries est le journal des
+-- livraisons : sans clé étrangère vers webhook_endpoints, il survit à la
+-- suppression d'un endpoint. (status, next_attempt_at) sert au dispatcher.
+CREATE TABLE webhook_endpoints (
+    id                         INTEGER PRIMARY KEY AUTOINCREMENT,
+    tenant_id                  TEXT NOT NULL,
+    url                        TEXT NOT NULL,
+    description                TEXT,
+    events                     TEXT NOT NULL,
+    active                     NUMERIC NOT NULL DEFAULT 1,
+    secret                     TEXT NOT NULL,
+    previous_secret            TEXT,
+    previous_secret_expires_at DATETIME,
+    created_at                 DATETIME,
+    updated_at                 DATETIME
+);
+CREATE INDEX idx_webhook_endpoints_tenant_id ON webhook_endpoints (tenant_id);
+
+CREATE TABLE webhook_deliveries (
+    id               INTEGER PRIMARY KEY AUTOINCREMENT,
+    tenant_id        TEXT NOT NULL,
+    endpoint_id      INTEGER NOT NULL,
+    event_id         TEXT NOT NULL,
+    event_type       TEXT NOT NULL,
+    payload          TEXT NOT NULL,
+    status           TEXT NOT NULL CHECK (status IN ('pending', 'succeeded', 'dead')),
+    next_attempt_at  DATETIME,
+    attempts         INTEGER NOT NULL DEFAULT 0,
+    last_status_code INTEGER,
+    last_error       TEXT,
+    created_at       DATETIME,
+    updated_at       DATETIME,
+    delivered_at     DATETIME
+);
+CREATE INDEX idx_webhook_deliveries_tenant_id ON webhook_deliveries (tenant_id);
+CREATE INDEX idx_webhook_deliveries_endpoint_id ON webhook_deliveries (endpoint_id);
+CREATE INDEX idx_webhook_deliveries_event_id ON webhook_deliveries (event_id);
+CREATE INDEX idx_webhook_deliveries_status_next ON webhook_deliveries (status, next_attempt_at);
+
+CREATE TABLE webhook_attempts (
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    tenant_id   TEXT NOT NULL,
+    delivery_id INTEGER NOT NULL,
+    number      INTEGER NOT NULL,
+    status_code INTEGER,
+    error       TEXT,
+    duration_ms INTEGER NOT NULL DEFAULT 0,
+    manual      NUMERIC NOT NULL DEFAULT 0,
+    created_at  DATETIME,
+    CONSTRAINT fk_webhook_attempts_delivery FOREIGN KEY (delivery_id) REFERENCES webhook_deliveries (id) ON DELETE CASCADE
+);
+CREATE INDEX idx_webhook_attempts_tenant_id ON webhook_attempts (tenant_id);
+CREATE INDEX idx_webhook_attempts_delivery_id ON webhook_attempts (delivery_id);
@@ -0,0 +1,4 @@
+DROP TRIGGER journal_lines_no_delete ON journal_lines;
+DROP TRIGGER journal_entries_no_delete ON journal_entries;
+DROP FUNCTION ledger_no_delete();
+DROP TABLE ledger_maintenance;
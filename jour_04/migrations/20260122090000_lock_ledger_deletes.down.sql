@@ -0,0 +1,3 @@
+DROP TRIGGER journal_lines_no_delete;
+DROP TRIGGER journal_entries_no_delete;
+DROP TABLE ledger_maintenance;
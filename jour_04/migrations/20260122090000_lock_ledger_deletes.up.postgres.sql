@@ -0,0 +1,23 @@
+-- Les écritures du grand livre ne se suppriment pas plus qu'elles ne se
+-- modifient : un DELETE réécrirait l'historique et désynchroniserait le
+-- cache accounts.balance. Seul l'import NDJSON (voir importNDJSON dans
+-- export.go) passe outre, en posant une ligne dans ledger_maintenance le
+-- temps de sa transaction : les autres connexions ne la voient jamais.
+CREATE TABLE ledger_maintenance (
+    reason VARCHAR(64) NOT NULL
+);
+
+CREATE FUNCTION ledger_no_delete() RETURNS trigger AS $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM ledger_maintenance) THEN
+        RAISE EXCEPTION '% : écritures comptables immuables', TG_TABLE_NAME;
+    END IF;
+    RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER journal_entries_no_delete BEFORE DELETE ON journal_entries
+    FOR EACH ROW EXECUTE FUNCTION ledger_no_delete();
+
+CREATE TRIGGER journal_lines_no_delete BEFORE DELETE ON journal_lines
+    FOR EACH ROW EXECUTE FUNCTION ledger_no_delete();
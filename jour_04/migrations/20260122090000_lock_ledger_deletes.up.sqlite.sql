@@ -0,0 +1,18 @@
+-- Les écritures du grand livre ne se suppriment pas plus qu'elles ne se
+-- modifient : un DELETE réécrirait l'historique et désynchroniserait le
+-- cache accounts.balance. Seul l'import NDJSON (voir importNDJSON dans
+-- export.go) passe outre, en posant une ligne dans ledger_maintenance le
+-- temps de sa transaction : les autres connexions ne la voient jamais.
+CREATE TABLE ledger_maintenance (
+    reason VARCHAR(64) NOT NULL
+);
+
+CREATE TRIGGER journal_entries_no_delete BEFORE DELETE ON journal_entries
+WHEN NOT EXISTS (SELECT 1 FROM ledger_maintenance) BEGIN
+    SELECT RAISE(ABORT, 'journal_entries : écritures comptables immuables');
+END;
+
+CREATE TRIGGER journal_lines_no_delete BEFORE DELETE ON journal_lines
+WHEN NOT EXISTS (SELECT 1 FROM ledger_maintenance) BEGIN
+    SELECT RAISE(ABORT, 'journal_lines : écritures comptables immuables');
+END;
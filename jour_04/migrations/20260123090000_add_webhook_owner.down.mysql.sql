@@ -0,0 +1,2 @@
+DROP INDEX idx_webhook_endpoints_owner_id ON webhook_endpoints;
+ALTER TABLE webhook_endpoints DROP COLUMN owner_id;
@@ -0,0 +1,2 @@
+DROP INDEX idx_webhook_endpoints_owner_id;
+ALTER TABLE webhook_endpoints DROP COLUMN owner_id;
@@ -0,0 +1,5 @@
+-- Propriétaire d'un endpoint : l'utilisateur qui l'a enregistré (claim sub
+-- du token). Les endpoints antérieurs gardent 0 : plus aucun appelant ne
+-- les voit, ils continuent de recevoir leurs livraisons.
+ALTER TABLE webhook_endpoints ADD COLUMN owner_id BIGINT NOT NULL DEFAULT 0;
+CREATE INDEX idx_webhook_endpoints_owner_id ON webhook_endpoints (owner_id);
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Modèle User avec tags GORM
+type User struct {
+	ID       uint   `gorm:"primaryKey" json:"id"`
+	TenantID string `gorm:"size:64;not null;uniqueIndex:idx_users_tenant_email,priority:1" json:"-"` // voir tenant.go
+	Name     string `gorm:"not null" json:"name" binding:"required,min=2,max=50,display_name"`
+	Email    string `gorm:"not null;uniqueIndex:idx_users_tenant_email,priority:2" json:"email" binding:"required,email"`
+	Phone    string `json:"phone,omitempty" binding:"omitempty,phone_cm"`
+	Age      int    `json:"age" binding:"required,min=1,max=150"`
+	Posts    []Post `gorm:"foreignKey:UserID" json:"posts,omitempty" ondelete:"cascade"`
+
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"deleted_at"` // corbeille (voir cascade.go)
+
+	// Les commentaires restent dans les fils de discussion (auteur remplacé)
+	Comments []Comment `gorm:"foreignKey:UserID" json:"-" ondelete:"reassign"`
+}
+
+// Tombstone : auteur de remplacement quand une relation de User est
+// déclarée ondelete:"reassign" (voir cascade.go)
+func (User) Tombstone() interface{} {
+	return &User{Name: "Utilisateur supprimé", Email: "utilisateur.supprime@afaapay.invalid", Age: 1}
+}
+
+// Modèle Post (One-to-Many avec User)
+type Post struct {
+	ID       uint   `gorm:"primaryKey" json:"id"`
+	TenantID string `gorm:"size:64;not null;index" json:"-"`
+	Title    string `gorm:"not null" json:"title" binding:"required,min=3,max=100"`
+	Content  string `json:"content" binding:"required,min=10"`
+	UserID   uint   `gorm:"not null" json:"user_id"`
+	User     *User  `gorm:"foreignKey:UserID" json:"user,omitempty"`
+	Tags     []Tag  `gorm:"many2many:post_tags" json:"tags,omitempty"`
+
+	Comments []Comment `gorm:"foreignKey:PostID" json:"comments,omitempty" ondelete:"cascade"`
+
+	// Nombre de commentaires, calculé par sous-requête à la lecture
+	CommentsCount int64 `gorm:"->;-:migration" json:"comments_count"`
+
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"deleted_at"` // corbeille (voir cascade.go)
+}
+
+// Modèle Tag (Many-to-Many avec Post via la table post_tags)
+type Tag struct {
+	ID       uint   `gorm:"primaryKey" json:"id"`
+	TenantID string `gorm:"size:64;not null;uniqueIndex:idx_tags_tenant_name,priority:1" json:"-"`
+	Name     string `gorm:"not null;uniqueIndex:idx_tags_tenant_name,priority:2" json:"name" binding:"required,max=30,slug"`
+	Posts    []Post `gorm:"many2many:post_tags" json:"posts,omitempty"`
+}
+
+// Modèle Comment (appartient à Post et User) ; ParentID désigne le commentaire
+// auquel on répond, Depth sa profondeur (0 pour un commentaire de premier niveau)
+type Comment struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	TenantID  string    `gorm:"size:64;not null;index" json:"-"`
+	PostID    uint      `gorm:"not null;index" json:"post_id"`
+	UserID    uint      `gorm:"not null;index" json:"user_id"`
+	ParentID  *uint     `gorm:"index" json:"parent_id"`
+	Depth     int       `gorm:"not null;default:0" json:"depth"`
+	Content   string    `gorm:"not null" json:"content"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	User      *User     `gorm:"foreignKey:UserID" json:"user,omitempty"`
+	Replies   []Comment `gorm:"foreignKey:ParentID" json:"replies,omitempty" ondelete:"cascade"`
+}
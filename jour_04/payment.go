@@ -0,0 +1,591 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// === DÉPÔTS ET RETRAITS MOBILE MONEY ===
+//
+// Un dépôt est une collecte chez l'opérateur : le client valide sur son
+// téléphone, puis le portefeuille est crédité (attente → portefeuille). Un
+// retrait réserve d'abord les fonds (portefeuille → attente, dans la
+// transaction qui crée le paiement), puis demande le décaissement ; en cas
+// d'échec, une écriture inverse les rend.
+//
+// Le résultat arrive par callback (POST /callbacks/:provider) ou, à défaut,
+// par la relecture périodique des paiements en attente (PAYMENT_POLL_INTERVAL).
+// Dans les deux cas l'état est relu auprès de l'opérateur : un callback
+// forgé ne peut rien créditer. Un paiement ne quitte "pending" qu'une fois,
+// sous verrou : callbacks en double et relectures concurrentes sont sans effet.
+
+// Types de paiement
+const (
+	PaymentDeposit    = "deposit"
+	PaymentWithdrawal = "withdrawal"
+)
+
+// Statuts d'un paiement
+const (
+	PaymentPending   = "pending"
+	PaymentCompleted = "completed"
+	PaymentFailed    = "failed"
+)
+
+// paymentLabels : libellés des écritures et des demandes à l'opérateur
+var paymentLabels = map[string]string{
+	PaymentDeposit:    "Dépôt",
+	PaymentWithdrawal: "Retrait",
+}
+
+// paymentOperations : opération demandée à l'opérateur pour chaque type
+var paymentOperations = map[string]string{
+	PaymentDeposit:    PaymentCollection,
+	PaymentWithdrawal: PaymentDisbursement,
+}
+
+// Payment : dépôt ou retrait mobile money. Reference (UUID) est transmise à
+// l'opérateur ; EntryID est l'écriture du crédit (dépôt) ou de la réserve
+// (retrait), RefundEntryID celle qui rend les fonds d'un retrait en échec.
+type Payment struct {
+	ID             uint       `gorm:"primaryKey" json:"id"`
+	TenantID       string     `gorm:"size:64;not null;uniqueIndex:idx_payments_tenant_idempotency_key,priority:1" json:"-"`
+	IdempotencyKey string     `gorm:"size:255;not null;uniqueIndex:idx_payments_tenant_idempotency_key,priority:2" json:"idempotency_key"`
+	Reference      string     `gorm:"size:36;not null;uniqueIndex" json:"reference"`
+	Kind           string     `gorm:"size:16;not null" json:"kind"`
+	Provider       string     `gorm:"size:16;not null" json:"provider"`
+	ProviderRef    string     `gorm:"size:64;index" json:"provider_ref,omitempty"`
+	UserID         uint       `gorm:"not null;index" json:"user_id"`
+	AccountID      uint       `gorm:"not null" json:"account_id"`
+	Phone          string     `gorm:"size:32;not null" json:"phone"`
+	Amount         int64      `gorm:"not null" json:"amount"`
+	Currency       string     `gorm:"size:3;not null;default:XAF" json:"currency"`
+	Status         string     `gorm:"size:16;not null;index" json:"status"`
+	FailureReason  string     `gorm:"size:255" json:"failure_reason,omitempty"`
+	EntryID        *uint      `json:"entry_id,omitempty"`
+	RefundEntryID  *uint      `json:"refund_entry_id,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+	CompletedAt    *time.Time `json:"completed_at,omitempty"`
+}
+
+type PaymentRepository interface {
+	// Get retourne un paiement, ou ErrNotFound
+	Get(ctx context.Context, id uint) (*Payment, error)
+	// GetByKey retourne le paiement de cette clé d'idempotence, ou ErrNotFound
+	GetByKey(ctx context.Context, key string) (*Payment, error)
+	// Lock relit le paiement, verrouillé jusqu'à la fin de la transaction
+	Lock(ctx context.Context, id uint) (*Payment, error)
+	// Create insère le paiement ; *ConflictError si la clé existe déjà
+	Create(ctx context.Context, payment *Payment) error
+	// Update enregistre le statut, la référence de l'opérateur, la raison
+	// d'un échec, les écritures et la date de fin
+	Update(ctx context.Context, payment *Payment) error
+	// FindByReference cherche, tous tenants confondus, le paiement de
+	// l'opérateur dont ref est notre référence ou la sienne ; ErrNotFound sinon
+	FindByReference(ctx context.Context, provider, ref string) (*Payment, error)
+	// ListPending retourne, tous tenants confondus, au plus limit paiements
+	// en attente créés avant before, les plus anciens d'abord
+	ListPending(ctx context.Context, before time.Time, limit int) ([]Payment, error)
+}
+
+// === SERVICE ===
+
+var (
+	ErrPaymentNotFound  = errors.New("paiement non trouvé")
+	ErrUnknownProvider  = errors.New("opérateur non configuré")
+	ErrPaymentKeyReused = errors.New("clé d'idempotence déjà utilisée pour un autre paiement")
+)
+
+// paymentPollBatch : paiements relus par passage
+const paymentPollBatch = 100
+
+// paymentPollInterval lit PAYMENT_POLL_INTERVAL (1m par défaut, 0 = pas de
+// relecture périodique)
+func paymentPollInterval() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("PAYMENT_POLL_INTERVAL")); err == nil && d >= 0 {
+		return d
+	}
+	return time.Minute
+}
+
+// PaymentOrder : dépôt ou retrait demandé par UserID
+type PaymentOrder struct {
+	IdempotencyKey string
+	Kind           string
+	Provider       string
+	UserID         uint
+	Phone          string
+	Amount         int64
+}
+
+type PaymentService struct {
+	payments  PaymentRepository
+	ledger    *LedgerService
+	uow       UnitOfWork
+	providers map[string]PaymentProvider
+	cfg       PaymentConfig
+	events    EventPublisher
+}
+
+func NewPaymentService(payments PaymentRepository, ledger *LedgerService, uow UnitOfWork,
+	providers map[string]PaymentProvider, cfg PaymentConfig, events EventPublisher) *PaymentService {
+	return &PaymentService{payments: payments, ledger: ledger, uow: uow, providers: providers, cfg: cfg, events: events}
+}
+
+// Get retourne un paiement
+func (s *PaymentService) Get(ctx context.Context, id uint) (*Payment, error) {
+	payment, err := s.payments.Get(ctx, id)
+	if errors.Is(err, ErrNotFound) {
+		return nil, ErrPaymentNotFound
+	}
+	return payment, err
+}
+
+// Create enregistre le paiement (et réserve les fonds d'un retrait) puis le
+// transmet à l'opérateur. Le paiement retourné est en général "pending".
+// Opérateur injoignable : le paiement reste en attente, l'issue sera relue.
+// Même clé : le paiement déjà enregistré (replayed).
+func (s *PaymentService) Create(ctx context.Context, order PaymentOrder) (payment *Payment, replayed bool, err error) {
+	provider, ok := s.providers[order.Provider]
+	if !ok {
+		return nil, false, ErrUnknownProvider
+	}
+	if existing, err := s.payments.GetByKey(usePrimary(ctx), order.IdempotencyKey); err == nil {
+		return s.replay(existing, order)
+	} else if !errors.Is(err, ErrNotFound) {
+		return nil, false, err
+	}
+
+	wallet, err := s.ledger.Wallet(ctx, order.UserID)
+	if err != nil {
+		return nil, false, err
+	}
+	suspense, err := s.ledger.SystemAccount(ctx, AccountSuspense)
+	if err != nil {
+		return nil, false, err
+	}
+
+	payment = &Payment{
+		IdempotencyKey: order.IdempotencyKey,
+		Reference:      uuid.NewString(),
+		Kind:           order.Kind,
+		Provider:       order.Provider,
+		UserID:         order.UserID,
+		AccountID:      wallet.ID,
+		Phone:          order.Phone,
+		Amount:         order.Amount,
+		Currency:       wallet.Currency,
+		Status:         PaymentPending,
+	}
+	err = s.uow.Do(serializable(ctx), func(ctx context.Context) error {
+		if order.Kind == PaymentWithdrawal {
+			entryID, err := s.reserve(ctx, payment, suspense.ID)
+			if err != nil {
+				return err
+			}
+			payment.EntryID = &entryID
+		}
+		return s.payments.Create(ctx, payment)
+	})
+	if errors.Is(err, ErrConflict) {
+		existing, err := s.payments.GetByKey(usePrimary(ctx), order.IdempotencyKey)
+		if err != nil {
+			return nil, false, err
+		}
+		return s.replay(existing, order)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	req := s.providerRequest(payment)
+	req.CallbackURL = s.cfg.CallbackURL + "/callbacks/" + provider.Name()
+	req.Description = fmt.Sprintf("%s #%d", paymentLabels[payment.Kind], payment.ID)
+	var result *ProviderResult
+	if payment.Kind == PaymentWithdrawal {
+		result, err = provider.Disburse(ctx, req)
+	} else {
+		result, err = provider.Collect(ctx, req)
+	}
+
+	switch {
+	case err == nil:
+	case errors.Is(err, ErrProviderRejected):
+		result = &ProviderResult{Status: ProviderFailed, Reason: err.Error()}
+	default:
+		// Issue inconnue : la relecture tranchera
+		fmt.Printf("[PAYMENT] %s #%d : %v\n", payment.Provider, payment.ID, err)
+		if result == nil {
+			return payment, false, nil
+		}
+	}
+	payment, err = s.settle(ctx, payment.ID, result)
+	if err != nil {
+		return nil, false, err
+	}
+	if payment.Status == PaymentFailed {
+		return payment, false, ErrProviderRejected
+	}
+	return payment, false, nil
+}
+
+// reserve verrouille le portefeuille et passe l'écriture portefeuille →
+// attente d'un retrait (dans l'unité de travail de Create)
+func (s *PaymentService) reserve(ctx context.Context, payment *Payment, suspenseID uint) (uint, error) {
+	accounts, err := s.ledger.Lock(ctx, payment.AccountID)
+	if err != nil {
+		return 0, err
+	}
+	if accounts[0].Frozen {
+		return 0, fmt.Errorf("%w : %s", ErrAccountFrozen, accounts[0].Code)
+	}
+	entry := JournalEntry{
+		Description: fmt.Sprintf("%s %s %s", paymentLabels[payment.Kind], payment.Provider, payment.Reference),
+		Lines: []JournalLine{{
+			DebitAccountID: payment.AccountID, CreditAccountID: suspenseID, Amount: payment.Amount,
+		}},
+	}
+	if err := s.ledger.Post(ctx, &entry); err != nil {
+		return 0, err
+	}
+	return entry.ID, nil
+}
+
+// replay retourne le paiement déjà enregistré sous cette clé, qui ne sert
+// qu'à une seule demande
+func (s *PaymentService) replay(payment *Payment, order PaymentOrder) (*Payment, bool, error) {
+	if payment.Kind != order.Kind || payment.Provider != order.Provider || payment.UserID != order.UserID ||
+		payment.Phone != order.Phone || payment.Amount != order.Amount {
+		return nil, true, ErrPaymentKeyReused
+	}
+	return payment, true, nil
+}
+
+func (s *PaymentService) providerRequest(payment *Payment) PaymentRequest {
+	return PaymentRequest{
+		Kind:        paymentOperations[payment.Kind],
+		Reference:   payment.Reference,
+		ProviderRef: payment.ProviderRef,
+		Phone:       payment.Phone,
+		Amount:      payment.Amount,
+		Currency:    payment.Currency,
+	}
+}
+
+// settle applique le résultat de l'opérateur : un paiement en attente passe
+// à "completed" (dépôt crédité) ou "failed" (retrait remboursé) ; un
+// paiement déjà réglé est retourné tel quel
+func (s *PaymentService) settle(ctx context.Context, id uint, result *ProviderResult) (*Payment, error) {
+	suspense, err := s.ledger.SystemAccount(ctx, AccountSuspense)
+	if err != nil {
+		return nil, err
+	}
+
+	var payment *Payment
+	err = s.uow.Do(serializable(ctx), func(ctx context.Context) error {
+		var err error
+		payment, err = s.payments.Lock(ctx, id)
+		if err != nil {
+			return err
+		}
+		if payment.Status != PaymentPending {
+			return nil
+		}
+		if result.ProviderRef != "" && payment.ProviderRef == "" {
+			payment.ProviderRef = result.ProviderRef
+		}
+
+		now := time.Now()
+		switch result.Status {
+		case ProviderSuccessful:
+			if payment.Kind == PaymentDeposit {
+				entryID, err := s.move(ctx, payment, suspense.ID, payment.AccountID, paymentLabels[PaymentDeposit])
+				if err != nil {
+					return err
+				}
+				payment.EntryID = &entryID
+			}
+			payment.Status, payment.CompletedAt = PaymentCompleted, &now
+		case ProviderFailed:
+			if payment.Kind == PaymentWithdrawal && payment.EntryID != nil {
+				entryID, err := s.move(ctx, payment, suspense.ID, payment.AccountID, "Remboursement du retrait")
+				if err != nil {
+					return err
+				}
+				payment.RefundEntryID = &entryID
+			}
+			payment.Status, payment.CompletedAt = PaymentFailed, &now
+			payment.FailureReason = truncate(result.Reason, 255)
+		}
+		if err := s.payments.Update(ctx, payment); err != nil {
+			return err
+		}
+		switch payment.Status {
+		case PaymentCompleted:
+			return s.events.Publish(ctx, EventPaymentSucceeded, payment)
+		case PaymentFailed:
+			return s.events.Publish(ctx, EventPaymentFailed, payment)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return payment, nil
+}
+
+// move passe l'écriture debit → credit du montant du paiement
+func (s *PaymentService) move(ctx context.Context, payment *Payment, debit, credit uint, label string) (uint, error) {
+	entry := JournalEntry{
+		Description: fmt.Sprintf("%s %s %s", label, payment.Provider, payment.Reference),
+		Lines:       []JournalLine{{DebitAccountID: debit, CreditAccountID: credit, Amount: payment.Amount}},
+	}
+	if err := s.ledger.Post(ctx, &entry); err != nil {
+		return 0, err
+	}
+	return entry.ID, nil
+}
+
+// Refresh relit l'état du paiement chez l'opérateur et l'applique. Une
+// opération inconnue de l'opérateur n'a jamais eu lieu : échec.
+func (s *PaymentService) Refresh(ctx context.Context, payment *Payment) (*Payment, error) {
+	if payment.Status != PaymentPending {
+		return payment, nil
+	}
+	provider, ok := s.providers[payment.Provider]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+
+	result, err := provider.Status(ctx, s.providerRequest(payment))
+	if errors.Is(err, ErrOperationNotFound) {
+		result, err = &ProviderResult{Status: ProviderFailed, Reason: ErrOperationNotFound.Error()}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.settle(ctx, payment.ID, result)
+}
+
+// HandleCallback retrouve le paiement annoncé par l'opérateur et relit son
+// état (le contenu du callback n'est pas cru sur parole)
+func (s *PaymentService) HandleCallback(ctx context.Context, providerName string, r *http.Request) (*Payment, error) {
+	provider, ok := s.providers[providerName]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+	result, err := provider.ParseCallback(r)
+	if err != nil {
+		return nil, err
+	}
+
+	ref := result.Reference
+	if ref == "" {
+		ref = result.ProviderRef
+	}
+	payment, err := s.payments.FindByReference(ctx, providerName, ref)
+	if errors.Is(err, ErrNotFound) {
+		return nil, ErrPaymentNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.Refresh(withTenant(ctx, payment.TenantID), payment)
+}
+
+// Reconcile relit les paiements en attente dont l'initiation est terminée
+// (créés depuis plus que le délai d'appel à l'opérateur) ; retourne le
+// nombre de paiements relus et réglés
+func (s *PaymentService) Reconcile(ctx context.Context) (checked, settled int, err error) {
+	pending, err := s.payments.ListPending(ctx, time.Now().Add(-s.cfg.Timeout), paymentPollBatch)
+	if err != nil {
+		return 0, 0, err
+	}
+	var errs []error
+	for _, p := range pending {
+		checked++
+		payment, err := s.Refresh(withTenant(ctx, p.TenantID), &p)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("paiement %d : %w", p.ID, err))
+			continue
+		}
+		if payment.Status != PaymentPending {
+			settled++
+		}
+	}
+	return checked, settled, errors.Join(errs...)
+}
+
+// Watch relit les paiements en attente à intervalle régulier
+func (s *PaymentService) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			checked, settled, err := s.Reconcile(ctx)
+			if err != nil {
+				fmt.Printf("[PAYMENT] Erreur: %v\n", err)
+			}
+			if settled > 0 {
+				fmt.Printf("[PAYMENT] %d paiement(s) relu(s), %d réglé(s)\n", checked, settled)
+			}
+		}
+	}
+}
+
+// truncate coupe s à n octets au plus, sans couper un caractère
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// === HANDLERS ===
+
+type PaymentHandler struct {
+	payments *PaymentService
+}
+
+func NewPaymentHandler(payments *PaymentService) *PaymentHandler {
+	return &PaymentHandler{payments: payments}
+}
+
+func respondPaymentError(c *gin.Context, payment *Payment, err error, fallback string) {
+	switch {
+	case errors.Is(err, ErrPaymentNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Paiement non trouvé"})
+	case errors.Is(err, ErrUnknownProvider):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Opérateur non configuré"})
+	case errors.Is(err, ErrPaymentKeyReused):
+		c.JSON(http.StatusConflict, gin.H{"error": "Clé d'idempotence déjà utilisée pour un autre paiement", "code": "idempotency_key_reused"})
+	case errors.Is(err, ErrAccountFrozen):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Compte gelé", "code": "account_frozen"})
+	case errors.Is(err, ErrProviderRejected):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Demande refusée par l'opérateur", "code": "provider_rejected", "payment": payment})
+	case errors.Is(err, ErrProviderUnavailable):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Opérateur indisponible"})
+	default:
+		respondLedgerError(c, err, fallback)
+	}
+}
+
+// paymentRequest : corps de POST /v1/payments/{deposits|withdrawals}
+type paymentRequest struct {
+	Provider string `json:"provider" binding:"required,oneof=mtn orange"`
+	Phone    string `json:"phone" binding:"required,phone_cm"`
+	Amount   int64  `json:"amount" binding:"required,xaf"`
+}
+
+// POST /v1/payments/deposits (appelant, header Idempotency-Key requis)
+func (h *PaymentHandler) Deposit(c *gin.Context) {
+	h.create(c, PaymentDeposit)
+}
+
+// POST /v1/payments/withdrawals (appelant, header Idempotency-Key requis)
+func (h *PaymentHandler) Withdraw(c *gin.Context) {
+	h.create(c, PaymentWithdrawal)
+}
+
+func (h *PaymentHandler) create(c *gin.Context, kind string) {
+	userID, ok := requireCaller(c)
+	if !ok {
+		return
+	}
+	key := c.GetHeader("Idempotency-Key")
+	if key == "" || len(key) > 255 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Header Idempotency-Key requis (255 caractères maximum)"})
+		return
+	}
+
+	var req paymentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondValidationError(c, err)
+		return
+	}
+
+	payment, replayed, err := h.payments.Create(c.Request.Context(), PaymentOrder{
+		IdempotencyKey: key,
+		Kind:           kind,
+		Provider:       req.Provider,
+		UserID:         userID,
+		Phone:          req.Phone,
+		Amount:         req.Amount,
+	})
+	if err != nil {
+		respondPaymentError(c, payment, err, "Erreur de paiement")
+		return
+	}
+	if replayed {
+		c.Header("Idempotent-Replayed", "true")
+		c.JSON(http.StatusOK, payment)
+		return
+	}
+	c.JSON(http.StatusAccepted, payment)
+}
+
+// GET /v1/payments/:id (titulaire : l'appelant)
+func (h *PaymentHandler) Get(c *gin.Context) {
+	id, ok := parseID(c)
+	if !ok {
+		return
+	}
+	userID, ok := requireCaller(c)
+	if !ok {
+		return
+	}
+
+	payment, err := h.payments.Get(c.Request.Context(), id)
+	if err == nil && payment.UserID != userID {
+		err = ErrPaymentNotFound
+	}
+	if err != nil {
+		respondPaymentError(c, nil, err, "Erreur BD")
+		return
+	}
+	c.JSON(http.StatusOK, payment)
+}
+
+// POST|PUT /callbacks/:provider - notification de l'opérateur. 503 si son
+// API ne répond pas : l'opérateur renverra le callback.
+func (h *PaymentHandler) Callback(c *gin.Context) {
+	payment, err := h.payments.HandleCallback(c.Request.Context(), c.Param("provider"), c.Request)
+	switch {
+	case err == nil:
+		c.JSON(http.StatusOK, gin.H{"id": payment.ID, "status": payment.Status})
+	case errors.Is(err, ErrUnknownProvider), errors.Is(err, ErrPaymentNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrProviderUnavailable):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Opérateur indisponible"})
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	}
+}
+
+// POST /admin/payments/reconcile - relit tout de suite les paiements en attente
+func (h *PaymentHandler) Reconcile(c *gin.Context) {
+	checked, settled, err := h.payments.Reconcile(c.Request.Context())
+	resp := gin.H{"checked": checked, "settled": settled}
+	if err != nil {
+		resp["error"] = err.Error()
+		c.JSON(http.StatusBadGateway, resp)
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
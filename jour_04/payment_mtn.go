@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// === MTN MOBILE MONEY (MoMo API) ===
+//
+// Produits "collection" (requesttopay) et "disbursement" (transfer), chacun
+// avec sa clé d'abonnement et son jeton. Notre référence sert de
+// X-Reference-Id et d'externalId : Status la relit et le callback la
+// rappelle.
+
+// MTNConfig : accès à l'API MoMo
+type MTNConfig struct {
+	BaseURL         string
+	APIUser         string
+	APIKey          string
+	CollectionKey   string // Ocp-Apim-Subscription-Key du produit collection
+	DisbursementKey string // Ocp-Apim-Subscription-Key du produit disbursement
+	TargetEnv       string // X-Target-Environment (sandbox, mtncameroon)
+}
+
+type mtnProvider struct {
+	cfg    MTNConfig
+	client *http.Client
+	tokens map[string]*accessToken // par produit
+}
+
+func newMTNProvider(cfg MTNConfig, client *http.Client) *mtnProvider {
+	p := &mtnProvider{cfg: cfg, client: client, tokens: map[string]*accessToken{}}
+	for _, product := range []string{PaymentCollection, PaymentDisbursement} {
+		p.tokens[product] = &accessToken{fetch: func(ctx context.Context) (string, time.Duration, error) {
+			return p.fetchToken(ctx, product)
+		}}
+	}
+	return p
+}
+
+// mtnParty : payeur (collection) ou bénéficiaire (disbursement)
+type mtnParty struct {
+	PartyIDType string `json:"partyIdType"`
+	PartyID     string `json:"partyId"`
+}
+
+// mtnTransaction : corps des demandes, des réponses de Status et des callbacks
+type mtnTransaction struct {
+	Amount                 string    `json:"amount"`
+	Currency               string    `json:"currency"`
+	ExternalID             string    `json:"externalId"`
+	Payer                  *mtnParty `json:"payer,omitempty"`
+	Payee                  *mtnParty `json:"payee,omitempty"`
+	PayerMessage           string    `json:"payerMessage,omitempty"`
+	PayeeNote              string    `json:"payeeNote,omitempty"`
+	FinancialTransactionID string    `json:"financialTransactionId,omitempty"`
+	Status                 string    `json:"status,omitempty"` // PENDING, SUCCESSFUL, FAILED
+	Reason                 string    `json:"reason,omitempty"`
+}
+
+func (p *mtnProvider) Name() string { return ProviderMTN }
+
+// product : chemin de l'API et clé d'abonnement du type d'opération
+func (p *mtnProvider) product(kind string) (path, resource, key string) {
+	if kind == PaymentDisbursement {
+		return "disbursement", "transfer", p.cfg.DisbursementKey
+	}
+	return "collection", "requesttopay", p.cfg.CollectionKey
+}
+
+// POST /{produit}/token/ (Basic api_user:api_key)
+func (p *mtnProvider) fetchToken(ctx context.Context, kind string) (string, time.Duration, error) {
+	path, _, key := p.product(kind)
+	req, err := newJSONRequest(ctx, http.MethodPost, p.cfg.BaseURL+"/"+path+"/token/", nil)
+	if err != nil {
+		return "", 0, err
+	}
+	req.SetBasicAuth(p.cfg.APIUser, p.cfg.APIKey)
+	req.Header.Set("Ocp-Apim-Subscription-Key", key)
+
+	var resp tokenResponse
+	if err := callProvider(p.client, req, &resp); err != nil {
+		return "", 0, fmt.Errorf("jeton MTN %s : %w", path, err)
+	}
+	return resp.AccessToken, resp.ttl(), nil
+}
+
+// request prépare un appel authentifié au produit du type d'opération
+func (p *mtnProvider) request(ctx context.Context, kind, method, url string, body interface{}) (*http.Request, error) {
+	token, err := p.tokens[kind].Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	req, err := newJSONRequest(ctx, method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	_, _, key := p.product(kind)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("X-Target-Environment", p.cfg.TargetEnv)
+	req.Header.Set("Ocp-Apim-Subscription-Key", key)
+	return req, nil
+}
+
+func (p *mtnProvider) Collect(ctx context.Context, req PaymentRequest) (*ProviderResult, error) {
+	req.Kind = PaymentCollection
+	return p.initiate(ctx, req)
+}
+
+func (p *mtnProvider) Disburse(ctx context.Context, req PaymentRequest) (*ProviderResult, error) {
+	req.Kind = PaymentDisbursement
+	return p.initiate(ctx, req)
+}
+
+// POST /{produit}/v1_0/{requesttopay|transfer} : 202, résultat par callback
+func (p *mtnProvider) initiate(ctx context.Context, req PaymentRequest) (*ProviderResult, error) {
+	path, resource, _ := p.product(req.Kind)
+	party := &mtnParty{PartyIDType: "MSISDN", PartyID: msisdn(req.Phone)}
+	tx := mtnTransaction{
+		Amount:       strconv.FormatInt(req.Amount, 10),
+		Currency:     req.Currency,
+		ExternalID:   req.Reference,
+		PayerMessage: req.Description,
+		PayeeNote:    req.Description,
+	}
+	if req.Kind == PaymentDisbursement {
+		tx.Payee = party
+	} else {
+		tx.Payer = party
+	}
+
+	httpReq, err := p.request(ctx, req.Kind, http.MethodPost, p.cfg.BaseURL+"/"+path+"/v1_0/"+resource, tx)
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("X-Reference-Id", req.Reference)
+	if req.CallbackURL != "" {
+		httpReq.Header.Set("X-Callback-Url", req.CallbackURL)
+	}
+	if err := callProvider(p.client, httpReq, nil); err != nil {
+		return nil, err
+	}
+	return &ProviderResult{Reference: req.Reference, Status: ProviderPending}, nil
+}
+
+// GET /{produit}/v1_0/{requesttopay|transfer}/{X-Reference-Id}
+func (p *mtnProvider) Status(ctx context.Context, req PaymentRequest) (*ProviderResult, error) {
+	path, resource, _ := p.product(req.Kind)
+	httpReq, err := p.request(ctx, req.Kind, http.MethodGet, p.cfg.BaseURL+"/"+path+"/v1_0/"+resource+"/"+req.Reference, nil)
+	if err != nil {
+		return nil, err
+	}
+	var tx mtnTransaction
+	if err := callProvider(p.client, httpReq, &tx); err != nil {
+		return nil, err
+	}
+	result := mtnResult(tx)
+	result.Reference = req.Reference
+	return result, nil
+}
+
+// ParseCallback : même corps que Status ; externalId est notre référence
+func (p *mtnProvider) ParseCallback(r *http.Request) (*ProviderResult, error) {
+	var tx mtnTransaction
+	if err := json.NewDecoder(r.Body).Decode(&tx); err != nil {
+		return nil, fmt.Errorf("callback MTN illisible : %w", err)
+	}
+	if tx.ExternalID == "" {
+		return nil, errors.New("callback MTN sans externalId")
+	}
+	result := mtnResult(tx)
+	result.Reference = tx.ExternalID
+	return result, nil
+}
+
+func mtnResult(tx mtnTransaction) *ProviderResult {
+	result := &ProviderResult{ProviderRef: tx.FinancialTransactionID, Status: ProviderPending, Reason: tx.Reason}
+	switch tx.Status {
+	case "SUCCESSFUL":
+		result.Status = ProviderSuccessful
+	case "FAILED", "REJECTED", "TIMEOUT":
+		result.Status = ProviderFailed
+	}
+	return result
+}
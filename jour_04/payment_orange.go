@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// === ORANGE MONEY (API marchand OM) ===
+//
+// Paiement marchand ("mp", collecte) et dépôt ("cashin", décaissement) se
+// font en deux temps : init retourne un payToken, pay lance l'opération
+// (le client valide sur son téléphone). Le payToken identifie l'opération
+// pour paymentstatus et dans le callback ; notre référence voyage dans
+// orderId.
+
+// OrangeConfig : accès à l'API Orange Money
+type OrangeConfig struct {
+	BaseURL       string
+	ClientID      string // OAuth2 client_credentials
+	ClientSecret  string
+	APIUsername   string // X-AUTH-TOKEN
+	APIPassword   string
+	ChannelMSISDN string // compte marchand
+	PIN           string
+}
+
+// orangeAPI : préfixe des opérations
+const orangeAPI = "/omcoreapis/1.0.2"
+
+type orangeProvider struct {
+	cfg    OrangeConfig
+	client *http.Client
+	token  *accessToken
+}
+
+func newOrangeProvider(cfg OrangeConfig, client *http.Client) *orangeProvider {
+	p := &orangeProvider{cfg: cfg, client: client}
+	p.token = &accessToken{fetch: p.fetchToken}
+	return p
+}
+
+// orangePay : corps de {mp|cashin}/pay
+type orangePay struct {
+	NotifURL          string `json:"notifUrl"`
+	ChannelUserMsisdn string `json:"channelUserMsisdn"`
+	Amount            string `json:"amount"`
+	SubscriberMsisdn  string `json:"subscriberMsisdn"`
+	PIN               string `json:"pin"`
+	OrderID           string `json:"orderId"`
+	Description       string `json:"description"`
+	PayToken          string `json:"payToken"`
+}
+
+// orangeData : opération dans les réponses ({"message":..., "data":{...}})
+// et dans les callbacks
+type orangeData struct {
+	PayToken string `json:"payToken"`
+	OrderID  string `json:"orderId,omitempty"`
+	Status   string `json:"status"` // INITIATED, PENDING, SUCCESSFULL, FAILED, CANCELLED, EXPIRED
+	TxnID    string `json:"txnid,omitempty"`
+	Message  string `json:"inittxnmessage,omitempty"`
+}
+
+type orangeResponse struct {
+	Message string     `json:"message"`
+	Data    orangeData `json:"data"`
+}
+
+func (p *orangeProvider) Name() string { return ProviderOrange }
+
+// resource : "mp" pour une collecte, "cashin" pour un décaissement
+func (p *orangeProvider) resource(kind string) string {
+	if kind == PaymentDisbursement {
+		return "cashin"
+	}
+	return "mp"
+}
+
+// POST /token (Basic client_id:client_secret, grant_type=client_credentials)
+func (p *orangeProvider) fetchToken(ctx context.Context) (string, time.Duration, error) {
+	form := url.Values{"grant_type": {"client_credentials"}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.cfg.BaseURL+"/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", 0, err
+	}
+	req.SetBasicAuth(p.cfg.ClientID, p.cfg.ClientSecret)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	var resp tokenResponse
+	if err := callProvider(p.client, req, &resp); err != nil {
+		return "", 0, fmt.Errorf("jeton Orange : %w", err)
+	}
+	return resp.AccessToken, resp.ttl(), nil
+}
+
+// call envoie un appel authentifié et décode data
+func (p *orangeProvider) call(ctx context.Context, method, path string, body interface{}) (*orangeData, error) {
+	token, err := p.token.Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	req, err := newJSONRequest(ctx, method, p.cfg.BaseURL+orangeAPI+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("X-AUTH-TOKEN", base64.StdEncoding.EncodeToString([]byte(p.cfg.APIUsername+":"+p.cfg.APIPassword)))
+
+	var resp orangeResponse
+	if err := callProvider(p.client, req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp.Data, nil
+}
+
+func (p *orangeProvider) Collect(ctx context.Context, req PaymentRequest) (*ProviderResult, error) {
+	req.Kind = PaymentCollection
+	return p.initiate(ctx, req)
+}
+
+func (p *orangeProvider) Disburse(ctx context.Context, req PaymentRequest) (*ProviderResult, error) {
+	req.Kind = PaymentDisbursement
+	return p.initiate(ctx, req)
+}
+
+// POST {mp|cashin}/init puis {mp|cashin}/pay
+func (p *orangeProvider) initiate(ctx context.Context, req PaymentRequest) (*ProviderResult, error) {
+	res := p.resource(req.Kind)
+	init, err := p.call(ctx, http.MethodPost, "/"+res+"/init", nil)
+	if err != nil {
+		return nil, err
+	}
+	if init.PayToken == "" {
+		return nil, fmt.Errorf("%w : init Orange sans payToken", ErrProviderUnavailable)
+	}
+
+	data, err := p.call(ctx, http.MethodPost, "/"+res+"/pay", orangePay{
+		NotifURL:          req.CallbackURL,
+		ChannelUserMsisdn: p.cfg.ChannelMSISDN,
+		Amount:            strconv.FormatInt(req.Amount, 10),
+		SubscriberMsisdn:  localNumber(req.Phone),
+		PIN:               p.cfg.PIN,
+		OrderID:           req.Reference,
+		Description:       req.Description,
+		PayToken:          init.PayToken,
+	})
+	if err != nil {
+		// L'opération existe peut-être : le payToken permet de la relire
+		return &ProviderResult{Reference: req.Reference, ProviderRef: init.PayToken, Status: ProviderPending}, err
+	}
+	result := orangeResult(*data)
+	result.Reference, result.ProviderRef = req.Reference, init.PayToken
+	return result, nil
+}
+
+// GET {mp|cashin}/paymentstatus/{payToken}
+func (p *orangeProvider) Status(ctx context.Context, req PaymentRequest) (*ProviderResult, error) {
+	if req.ProviderRef == "" {
+		// Pas de payToken : l'init n'a jamais abouti
+		return nil, ErrOperationNotFound
+	}
+	data, err := p.call(ctx, http.MethodGet, "/"+p.resource(req.Kind)+"/paymentstatus/"+url.PathEscape(req.ProviderRef), nil)
+	if err != nil {
+		return nil, err
+	}
+	result := orangeResult(*data)
+	result.Reference, result.ProviderRef = req.Reference, req.ProviderRef
+	return result, nil
+}
+
+// ParseCallback : {"payToken":..., "orderId":..., "status":...}
+func (p *orangeProvider) ParseCallback(r *http.Request) (*ProviderResult, error) {
+	var data orangeData
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		return nil, fmt.Errorf("callback Orange illisible : %w", err)
+	}
+	if data.PayToken == "" && data.OrderID == "" {
+		return nil, errors.New("callback Orange sans payToken ni orderId")
+	}
+	result := orangeResult(data)
+	result.Reference, result.ProviderRef = data.OrderID, data.PayToken
+	return result, nil
+}
+
+func orangeResult(data orangeData) *ProviderResult {
+	result := &ProviderResult{ProviderRef: data.PayToken, Status: ProviderPending, Reason: data.Message}
+	switch data.Status {
+	case "SUCCESSFULL", "SUCCESSFUL":
+		result.Status = ProviderSuccessful
+	case "FAILED", "CANCELLED", "EXPIRED":
+		result.Status = ProviderFailed
+	}
+	return result
+}
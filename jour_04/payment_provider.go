@@ -0,0 +1,288 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// === OPÉRATEURS MOBILE MONEY ===
+//
+// PaymentProvider cache l'API HTTP d'un opérateur (MTN MoMo, Orange Money)
+// derrière quatre opérations : collecte (le client paie depuis son compte
+// mobile money), décaissement (on lui envoie de l'argent), état d'une
+// opération et lecture d'un callback. Les opérateurs sont asynchrones :
+// l'initiation répond "pending", le résultat arrive plus tard par callback
+// ou par Status. payment.go ne croit jamais un callback sur parole : il
+// relit l'état auprès de l'opérateur avant d'écrire dans le grand livre.
+//
+// `jour04 simulate` lance un faux serveur des deux API, avec délais et
+// échecs configurables (simulator.go), pour tout faire tourner hors ligne.
+
+// Opérateurs
+const (
+	ProviderMTN    = "mtn"
+	ProviderOrange = "orange"
+)
+
+// Types d'opération chez l'opérateur
+const (
+	PaymentCollection   = "collection"   // le client paie
+	PaymentDisbursement = "disbursement" // le client reçoit
+)
+
+// États d'une opération chez l'opérateur
+const (
+	ProviderPending    = "pending"
+	ProviderSuccessful = "successful"
+	ProviderFailed     = "failed"
+)
+
+var (
+	// ErrProviderUnavailable : réseau, délai dépassé ou erreur 5xx ; l'issue
+	// de la demande est inconnue
+	ErrProviderUnavailable = errors.New("opérateur indisponible")
+	// ErrProviderRejected : demande refusée (4xx), rien n'a été fait
+	ErrProviderRejected = errors.New("demande refusée par l'opérateur")
+	// ErrOperationNotFound : l'opérateur ne connaît pas cette référence
+	ErrOperationNotFound = errors.New("opération inconnue de l'opérateur")
+)
+
+// PaymentRequest : opération demandée à l'opérateur
+type PaymentRequest struct {
+	Kind        string // PaymentCollection ou PaymentDisbursement
+	Reference   string // notre référence (UUID v4), unique
+	ProviderRef string // référence de l'opérateur, pour Status
+	Phone       string // +237XXXXXXXXX
+	Amount      int64
+	Currency    string
+	Description string
+	CallbackURL string
+}
+
+// ProviderResult : état d'une opération vu par l'opérateur. Un callback
+// donne Reference, ProviderRef ou les deux.
+type ProviderResult struct {
+	Reference   string
+	ProviderRef string
+	Status      string // ProviderPending, ProviderSuccessful, ProviderFailed
+	Reason      string
+}
+
+type PaymentProvider interface {
+	// Name : identifiant de l'opérateur (mtn, orange)
+	Name() string
+	// Collect demande au client de payer Amount depuis son compte
+	Collect(ctx context.Context, req PaymentRequest) (*ProviderResult, error)
+	// Disburse envoie Amount sur le compte du client
+	Disburse(ctx context.Context, req PaymentRequest) (*ProviderResult, error)
+	// Status relit l'état d'une opération (Kind, Reference, ProviderRef) ;
+	// ErrOperationNotFound si l'opérateur ne la connaît pas
+	Status(ctx context.Context, req PaymentRequest) (*ProviderResult, error)
+	// ParseCallback lit la notification envoyée par l'opérateur
+	ParseCallback(r *http.Request) (*ProviderResult, error)
+}
+
+// === CONFIGURATION ===
+
+// PaymentConfig : opérateurs configurés et URL publique des callbacks.
+// Variables d'environnement :
+//   - MTN_BASE_URL, MTN_API_USER, MTN_API_KEY, MTN_COLLECTION_KEY,
+//     MTN_DISBURSEMENT_KEY, MTN_TARGET_ENVIRONMENT (sandbox par défaut)
+//   - ORANGE_BASE_URL, ORANGE_CLIENT_ID, ORANGE_CLIENT_SECRET,
+//     ORANGE_API_USERNAME, ORANGE_API_PASSWORD, ORANGE_CHANNEL_MSISDN, ORANGE_PIN
+//   - PAYMENT_SIMULATOR_URL : adresse de `jour04 simulate` ; les deux
+//     opérateurs y pointent par défaut, avec des identifiants factices
+//   - PAYMENT_CALLBACK_URL : adresse publique de l'API (http://localhost:$PORT)
+//   - PAYMENT_PROVIDER_TIMEOUT : délai d'un appel à l'opérateur (15s)
+type PaymentConfig struct {
+	MTN         MTNConfig
+	Orange      OrangeConfig
+	CallbackURL string
+	Timeout     time.Duration
+}
+
+func loadPaymentConfig() PaymentConfig {
+	sim := strings.TrimSuffix(os.Getenv("PAYMENT_SIMULATOR_URL"), "/")
+	env := func(name string) string {
+		if v := os.Getenv(name); v != "" {
+			return v
+		}
+		if sim == "" {
+			return ""
+		}
+		if strings.HasSuffix(name, "_BASE_URL") {
+			return sim
+		}
+		return "simulateur"
+	}
+
+	cfg := PaymentConfig{
+		MTN: MTNConfig{
+			BaseURL:         strings.TrimSuffix(env("MTN_BASE_URL"), "/"),
+			APIUser:         env("MTN_API_USER"),
+			APIKey:          env("MTN_API_KEY"),
+			CollectionKey:   env("MTN_COLLECTION_KEY"),
+			DisbursementKey: env("MTN_DISBURSEMENT_KEY"),
+			TargetEnv:       os.Getenv("MTN_TARGET_ENVIRONMENT"),
+		},
+		Orange: OrangeConfig{
+			BaseURL:       strings.TrimSuffix(env("ORANGE_BASE_URL"), "/"),
+			ClientID:      env("ORANGE_CLIENT_ID"),
+			ClientSecret:  env("ORANGE_CLIENT_SECRET"),
+			APIUsername:   env("ORANGE_API_USERNAME"),
+			APIPassword:   env("ORANGE_API_PASSWORD"),
+			ChannelMSISDN: env("ORANGE_CHANNEL_MSISDN"),
+			PIN:           env("ORANGE_PIN"),
+		},
+		CallbackURL: strings.TrimSuffix(os.Getenv("PAYMENT_CALLBACK_URL"), "/"),
+		Timeout:     15 * time.Second,
+	}
+	if cfg.MTN.TargetEnv == "" {
+		cfg.MTN.TargetEnv = "sandbox"
+	}
+	if cfg.CallbackURL == "" {
+		port := os.Getenv("PORT")
+		if port == "" {
+			port = "8080"
+		}
+		cfg.CallbackURL = "http://localhost:" + port
+	}
+	if d, err := time.ParseDuration(os.Getenv("PAYMENT_PROVIDER_TIMEOUT")); err == nil && d > 0 {
+		cfg.Timeout = d
+	}
+	return cfg
+}
+
+// Providers construit les adaptateurs des opérateurs configurés (URL de
+// base renseignée)
+func (cfg PaymentConfig) Providers() map[string]PaymentProvider {
+	client := &http.Client{Timeout: cfg.Timeout}
+	providers := map[string]PaymentProvider{}
+	if cfg.MTN.BaseURL != "" {
+		providers[ProviderMTN] = newMTNProvider(cfg.MTN, client)
+	}
+	if cfg.Orange.BaseURL != "" {
+		providers[ProviderOrange] = newOrangeProvider(cfg.Orange, client)
+	}
+	return providers
+}
+
+// providerNames : noms triés, pour les logs
+func providerNames(providers map[string]PaymentProvider) []string {
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// === HTTP ===
+
+// accessToken : jeton OAuth2 mis en cache jusqu'à une minute avant son
+// expiration
+type accessToken struct {
+	mu      sync.Mutex
+	value   string
+	expires time.Time
+	fetch   func(ctx context.Context) (token string, ttl time.Duration, err error)
+}
+
+func (t *accessToken) Get(ctx context.Context) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.value != "" && time.Now().Before(t.expires) {
+		return t.value, nil
+	}
+	value, ttl, err := t.fetch(ctx)
+	if err != nil {
+		return "", err
+	}
+	t.value, t.expires = value, time.Now().Add(ttl-time.Minute)
+	return value, nil
+}
+
+// tokenResponse : réponse OAuth2 commune aux deux opérateurs
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+func (r tokenResponse) ttl() time.Duration {
+	if r.ExpiresIn <= 0 {
+		return time.Hour
+	}
+	return time.Duration(r.ExpiresIn) * time.Second
+}
+
+// callProvider envoie la requête et décode la réponse JSON dans out (nil :
+// réponse ignorée). Erreur réseau ou 5xx : ErrProviderUnavailable ; 404 :
+// ErrOperationNotFound ; autre 4xx : ErrProviderRejected.
+func callProvider(client *http.Client, req *http.Request, out interface{}) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w : %v", ErrProviderUnavailable, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("%w : %v", ErrProviderUnavailable, err)
+	}
+
+	switch {
+	case resp.StatusCode >= 500:
+		return fmt.Errorf("%w : %s %s → %d %s", ErrProviderUnavailable, req.Method, req.URL.Path, resp.StatusCode, body)
+	case resp.StatusCode == http.StatusNotFound:
+		return fmt.Errorf("%w : %s", ErrOperationNotFound, req.URL.Path)
+	case resp.StatusCode >= 400:
+		return fmt.Errorf("%w : %d %s", ErrProviderRejected, resp.StatusCode, body)
+	}
+	if out == nil || len(bytes.TrimSpace(body)) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("%w : réponse illisible : %v", ErrProviderUnavailable, err)
+	}
+	return nil
+}
+
+// newJSONRequest prépare une requête avec un corps JSON (body nil : sans corps)
+func newJSONRequest(ctx context.Context, method, url string, body interface{}) (*http.Request, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return req, nil
+}
+
+// msisdn : numéro international sans "+" (237XXXXXXXXX)
+func msisdn(phone string) string {
+	return strings.TrimPrefix(phone, "+")
+}
+
+// localNumber : numéro camerounais sans indicatif (6XXXXXXXX)
+func localNumber(phone string) string {
+	return strings.TrimPrefix(msisdn(phone), "237")
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// === PAIEMENTS : REPOSITORIES ===
+
+type gormPaymentRepository struct {
+	db *gorm.DB
+}
+
+func NewGormPaymentRepository(db *gorm.DB) PaymentRepository {
+	return &gormPaymentRepository{db: db}
+}
+
+func (r *gormPaymentRepository) Get(ctx context.Context, id uint) (*Payment, error) {
+	var payment Payment
+	if err := dbFromContext(ctx, r.db).First(&payment, id).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &payment, nil
+}
+
+func (r *gormPaymentRepository) GetByKey(ctx context.Context, key string) (*Payment, error) {
+	var payment Payment
+	if err := dbFromContext(ctx, r.db).Where("idempotency_key = ?", key).First(&payment).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &payment, nil
+}
+
+func (r *gormPaymentRepository) Lock(ctx context.Context, id uint) (*Payment, error) {
+	var payment Payment
+	err := dbFromContext(ctx, r.db).Clauses(clause.Locking{Strength: "UPDATE"}).First(&payment, id).Error
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return &payment, nil
+}
+
+func (r *gormPaymentRepository) Create(ctx context.Context, payment *Payment) error {
+	return translateError(dbFromContext(ctx, r.db).Create(payment).Error)
+}
+
+func (r *gormPaymentRepository) Update(ctx context.Context, payment *Payment) error {
+	return dbFromContext(ctx, r.db).Model(payment).
+		Select("Status", "ProviderRef", "FailureReason", "EntryID", "RefundEntryID", "CompletedAt", "UpdatedAt").
+		Updates(payment).Error
+}
+
+// FindByReference : le callback arrive hors de tout tenant
+func (r *gormPaymentRepository) FindByReference(ctx context.Context, provider, ref string) (*Payment, error) {
+	var payment Payment
+	err := dbFromContext(allTenants(ctx), r.db).
+		Where("provider = ? AND (reference = ? OR provider_ref = ?)", provider, ref, ref).
+		First(&payment).Error
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return &payment, nil
+}
+
+func (r *gormPaymentRepository) ListPending(ctx context.Context, before time.Time, limit int) ([]Payment, error) {
+	var payments []Payment
+	err := dbFromContext(allTenants(ctx), r.db).
+		Where("status = ? AND created_at < ?", PaymentPending, before).
+		Order("created_at, id").Limit(limit).Find(&payments).Error
+	return payments, err
+}
+
+// --- En mémoire ---
+
+type memoryPaymentRepository struct {
+	s *MemoryStore
+}
+
+func (s *MemoryStore) Payments() PaymentRepository { return &memoryPaymentRepository{s} }
+
+func (r *memoryPaymentRepository) Get(_ context.Context, id uint) (*Payment, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	p, ok := r.s.payments[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &p, nil
+}
+
+func (r *memoryPaymentRepository) GetByKey(_ context.Context, key string) (*Payment, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	for _, p := range r.s.payments {
+		if p.IdempotencyKey == key {
+			return &p, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// Lock : les unités de travail en mémoire sont déjà sérialisées
+func (r *memoryPaymentRepository) Lock(ctx context.Context, id uint) (*Payment, error) {
+	return r.Get(ctx, id)
+}
+
+func (r *memoryPaymentRepository) Create(_ context.Context, payment *Payment) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, p := range r.s.payments {
+		if p.IdempotencyKey == payment.IdempotencyKey {
+			return &ConflictError{Field: "idempotency_key"}
+		}
+		if p.Reference == payment.Reference {
+			return &ConflictError{Field: "reference"}
+		}
+	}
+	payment.ID = r.s.nextPaymentID
+	r.s.nextPaymentID++
+	payment.CreatedAt = time.Now()
+	payment.UpdatedAt = payment.CreatedAt
+	r.s.payments[payment.ID] = *payment
+	return nil
+}
+
+func (r *memoryPaymentRepository) Update(_ context.Context, payment *Payment) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	p, ok := r.s.payments[payment.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	p.Status, p.ProviderRef, p.FailureReason = payment.Status, payment.ProviderRef, payment.FailureReason
+	p.EntryID, p.RefundEntryID, p.CompletedAt = payment.EntryID, payment.RefundEntryID, payment.CompletedAt
+	p.UpdatedAt = time.Now()
+	r.s.payments[p.ID] = p
+	payment.UpdatedAt = p.UpdatedAt
+	return nil
+}
+
+func (r *memoryPaymentRepository) FindByReference(_ context.Context, provider, ref string) (*Payment, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	for _, p := range r.s.payments {
+		if p.Provider == provider && (p.Reference == ref || p.ProviderRef == ref) {
+			return &p, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *memoryPaymentRepository) ListPending(_ context.Context, before time.Time, limit int) ([]Payment, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	var payments []Payment
+	for _, p := range r.s.payments {
+		if p.Status == PaymentPending && p.CreatedAt.Before(before) {
+			payments = append(payments, p)
+		}
+	}
+	sortPendingPayments(payments)
+	if len(payments) > limit {
+		payments = payments[:limit]
+	}
+	return payments, nil
+}
+
+// sortPendingPayments : les plus anciens d'abord
+func sortPendingPayments(payments []Payment) {
+	slices.SortFunc(payments, func(a, b Payment) int {
+		if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+			return c
+		}
+		return int(a.ID) - int(b.ID)
+	})
+}
+
+// --- En mémoire, par tenant ---
+
+type tenantPaymentRepository struct {
+	t *MemoryTenants
+}
+
+func (t *MemoryTenants) Payments() PaymentRepository { return &tenantPaymentRepository{t} }
+
+func (r *tenantPaymentRepository) Get(ctx context.Context, id uint) (*Payment, error) {
+	s, _, err := r.t.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.Payments().Get(ctx, id)
+}
+
+func (r *tenantPaymentRepository) GetByKey(ctx context.Context, key string) (*Payment, error) {
+	s, _, err := r.t.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.Payments().GetByKey(ctx, key)
+}
+
+func (r *tenantPaymentRepository) Lock(ctx context.Context, id uint) (*Payment, error) {
+	s, _, err := r.t.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.Payments().Lock(ctx, id)
+}
+
+func (r *tenantPaymentRepository) Create(ctx context.Context, payment *Payment) error {
+	s, tenant, err := r.t.store(ctx)
+	if err != nil {
+		return err
+	}
+	payment.TenantID = tenant
+	return s.Payments().Create(ctx, payment)
+}
+
+func (r *tenantPaymentRepository) Update(ctx context.Context, payment *Payment) error {
+	s, _, err := r.t.store(ctx)
+	if err != nil {
+		return err
+	}
+	return s.Payments().Update(ctx, payment)
+}
+
+func (r *tenantPaymentRepository) FindByReference(ctx context.Context, provider, ref string) (*Payment, error) {
+	for _, s := range r.t.allStores() {
+		if p, err := s.Payments().FindByReference(ctx, provider, ref); err == nil {
+			return p, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *tenantPaymentRepository) ListPending(ctx context.Context, before time.Time, limit int) ([]Payment, error) {
+	var payments []Payment
+	for _, s := range r.t.allStores() {
+		pending, err := s.Payments().ListPending(ctx, before, limit)
+		if err != nil {
+			return nil, err
+		}
+		payments = append(payments, pending...)
+	}
+	sortPendingPayments(payments)
+	if len(payments) > limit {
+		payments = payments[:limit]
+	}
+	return payments, nil
+}
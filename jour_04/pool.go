@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// === POOL DE CONNEXIONS ===
+//
+// database/sql écarte d'elle-même une connexion cassée et en ouvre une
+// nouvelle à la requête suivante : après une coupure passagère (redémarrage
+// de PostgreSQL, bascule réseau), le pool se reconstitue sans redémarrer le
+// serveur. ConnMaxLifetime et ConnMaxIdleTime renouvellent les connexions
+// avant qu'un proxy ou le serveur ne les ferme, et DBHealth vérifie la base
+// à intervalle régulier pour signaler perte et rétablissement.
+
+// PoolConfig : réglage du pool (0 = illimité pour MaxOpenConns et les durées)
+type PoolConfig struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+}
+
+// defaultServerPool : PostgreSQL et MySQL
+var defaultServerPool = PoolConfig{
+	MaxOpenConns:    25,
+	MaxIdleConns:    10,
+	ConnMaxLifetime: 30 * time.Minute,
+	ConnMaxIdleTime: 5 * time.Minute,
+}
+
+// loadPoolConfig applique DB_MAX_OPEN_CONNS, DB_MAX_IDLE_CONNS,
+// DB_CONN_MAX_LIFETIME et DB_CONN_MAX_IDLE_TIME aux valeurs du dialecte
+func loadPoolConfig(pool PoolConfig) PoolConfig {
+	if n, err := strconv.Atoi(os.Getenv("DB_MAX_OPEN_CONNS")); err == nil && n >= 0 {
+		pool.MaxOpenConns = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("DB_MAX_IDLE_CONNS")); err == nil && n >= 0 {
+		pool.MaxIdleConns = n
+	}
+	if d, err := time.ParseDuration(os.Getenv("DB_CONN_MAX_LIFETIME")); err == nil && d >= 0 {
+		pool.ConnMaxLifetime = d
+	}
+	if d, err := time.ParseDuration(os.Getenv("DB_CONN_MAX_IDLE_TIME")); err == nil && d >= 0 {
+		pool.ConnMaxIdleTime = d
+	}
+	return pool
+}
+
+// pool est le réglage appliqué à la connexion courante
+var pool PoolConfig
+
+func configurePool(conn *gorm.DB, cfg PoolConfig) error {
+	sqlDB, err := conn.DB()
+	if err != nil {
+		return err
+	}
+	applyPool(sqlDB, cfg)
+	pool = cfg
+	return nil
+}
+
+func applyPool(sqlDB *sql.DB, cfg PoolConfig) {
+	sqlDB.SetMaxOpenConns(cfg.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(cfg.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	sqlDB.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+}
+
+// retryWithBackoff appelle fn jusqu'à ce qu'elle réussisse ou que timeout
+// soit écoulé (0 = une seule tentative). Attente exponentielle de 500ms à
+// 10s, avec ±20 % d'aléa pour que plusieurs instances ne frappent pas la
+// base au même instant.
+func retryWithBackoff(ctx context.Context, timeout time.Duration, label string, fn func() error) error {
+	deadline := time.Now().Add(timeout)
+	wait := 500 * time.Millisecond
+
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil {
+			if attempt > 1 {
+				fmt.Printf("✅ %s joignable après %d tentatives\n", label, attempt)
+			}
+			return nil
+		}
+
+		delay := time.Duration(float64(wait) * (0.8 + 0.4*rand.Float64()))
+		if time.Now().Add(delay).After(deadline) {
+			return fmt.Errorf("%d tentative(s) en %s: %w", attempt, timeout, err)
+		}
+		fmt.Printf("⏳ %s indisponible (tentative %d), nouvel essai dans %s : %v\n",
+			label, attempt, delay.Round(time.Millisecond), err)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		wait = min(wait*2, 10*time.Second)
+	}
+}
+
+// === SANTÉ DE LA BASE ===
+
+type DBHealth struct {
+	db *gorm.DB
+
+	mu        sync.RWMutex
+	healthy   bool
+	lastError string
+	lastCheck time.Time
+	downSince time.Time
+}
+
+func NewDBHealth(db *gorm.DB) *DBHealth {
+	return &DBHealth{db: db, healthy: true, lastCheck: time.Now()}
+}
+
+// Check interroge la base (Ping, 5s au plus) et journalise les changements
+// d'état
+func (h *DBHealth) Check(ctx context.Context) error {
+	sqlDB, err := h.db.DB()
+	if err == nil {
+		pingCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		err = sqlDB.PingContext(pingCtx)
+		cancel()
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	now := time.Now()
+	h.lastCheck = now
+	switch {
+	case err != nil && h.healthy:
+		h.healthy, h.downSince, h.lastError = false, now, err.Error()
+		fmt.Printf("[DB] Connexion perdue : %v\n", err)
+	case err != nil:
+		h.lastError = err.Error()
+	case !h.healthy:
+		h.healthy, h.lastError = true, ""
+		fmt.Printf("[DB] Connexion rétablie après %s\n", now.Sub(h.downSince).Round(time.Second))
+	}
+	return err
+}
+
+// Watch vérifie la base à intervalle régulier
+func (h *DBHealth) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			h.Check(ctx)
+		}
+	}
+}
+
+// dbHealthInterval retourne 0 si la vérification périodique est désactivée
+func dbHealthInterval() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("DB_HEALTH_INTERVAL")); err == nil && d >= 0 {
+		return d
+	}
+	return 15 * time.Second
+}
+
+// === ADMIN HANDLER ===
+
+type DBHandler struct {
+	health   *DBHealth
+	replicas *ReplicaSet
+}
+
+// replicas peut être nil (pas de DB_REPLICA_DSNS)
+func NewDBHandler(health *DBHealth, replicas *ReplicaSet) *DBHandler {
+	return &DBHandler{health: health, replicas: replicas}
+}
+
+// GET /admin/db - état de la base, statistiques du pool (database/sql) et
+// réplicas
+func (h *DBHandler) Stats(c *gin.Context) {
+	sqlDB, err := h.health.db.DB()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur BD"})
+		return
+	}
+	stats := sqlDB.Stats()
+
+	h.health.mu.RLock()
+	health := gin.H{"healthy": h.health.healthy, "last_check": h.health.lastCheck}
+	if !h.health.healthy {
+		health["error"] = h.health.lastError
+		health["down_since"] = h.health.downSince
+	}
+	h.health.mu.RUnlock()
+
+	response := gin.H{
+		"driver": dialect.Name(),
+		"health": health,
+		"config": gin.H{
+			"max_open_conns":     pool.MaxOpenConns,
+			"max_idle_conns":     pool.MaxIdleConns,
+			"conn_max_lifetime":  pool.ConnMaxLifetime.String(),
+			"conn_max_idle_time": pool.ConnMaxIdleTime.String(),
+		},
+		"pool": gin.H{
+			"open_connections":     stats.OpenConnections,
+			"in_use":               stats.InUse,
+			"idle":                 stats.Idle,
+			"wait_count":           stats.WaitCount,
+			"wait_duration_ms":     stats.WaitDuration.Milliseconds(),
+			"max_idle_closed":      stats.MaxIdleClosed,
+			"max_idle_time_closed": stats.MaxIdleTimeClosed,
+			"max_lifetime_closed":  stats.MaxLifetimeClosed,
+		},
+	}
+	if h.replicas != nil {
+		response["read_replicas"] = h.replicas.Stats()
+	}
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// === PURGE DE LA CORBEILLE ===
+//
+// Les users et posts supprimés restent à la corbeille (deleted_at) pendant
+// SOFT_DELETE_RETENTION (30 jours par défaut), puis sont supprimés
+// définitivement avec leurs politiques ondelete : toutes les PURGE_INTERVAL
+// (1h par défaut, 0 = désactivé), via POST /admin/purge ou `go run . purge`.
+// La purge parcourt tous les tenants, chacun avec son propre contexte.
+
+type TrashPurger struct {
+	users     UserRepository
+	posts     PostRepository
+	tenants   TenantDirectory
+	retention time.Duration
+}
+
+func NewTrashPurger(repos Repositories, retention time.Duration) *TrashPurger {
+	return &TrashPurger{users: repos.Users, posts: repos.Posts, tenants: repos.Tenants, retention: retention}
+}
+
+// PurgeReport : nombre d'enregistrements supprimés définitivement
+type PurgeReport struct {
+	Before time.Time `json:"before"`
+	Users  int64     `json:"users"`
+	Posts  int64     `json:"posts"`
+}
+
+// Purge supprime ce qui est à la corbeille depuis plus de olderThan, dans
+// tous les tenants. Les posts d'abord : ceux d'un utilisateur purgé partent
+// avec lui (cascade).
+func (p *TrashPurger) Purge(ctx context.Context, olderThan time.Duration) (PurgeReport, error) {
+	report := PurgeReport{Before: time.Now().Add(-olderThan)}
+
+	tenants, err := p.tenants.List(ctx)
+	if err != nil {
+		return report, fmt.Errorf("liste des tenants: %w", err)
+	}
+	for _, tenant := range tenants {
+		tenantCtx := withTenant(ctx, tenant)
+		posts, err := p.posts.Purge(tenantCtx, report.Before)
+		if err != nil {
+			return report, fmt.Errorf("purge des posts (%s): %w", tenant, err)
+		}
+		users, err := p.users.Purge(tenantCtx, report.Before)
+		if err != nil {
+			return report, fmt.Errorf("purge des utilisateurs (%s): %w", tenant, err)
+		}
+		report.Posts += posts
+		report.Users += users
+	}
+	return report, nil
+}
+
+// Watch purge à intervalle régulier avec la rétention configurée
+func (p *TrashPurger) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			report, err := p.Purge(ctx, p.retention)
+			if err != nil {
+				fmt.Printf("[PURGE] Erreur: %v\n", err)
+				continue
+			}
+			if report.Users+report.Posts > 0 {
+				fmt.Printf("[PURGE] %d utilisateur(s), %d post(s) supprimés définitivement\n", report.Users, report.Posts)
+			}
+		}
+	}
+}
+
+func trashRetention() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("SOFT_DELETE_RETENTION")); err == nil && d >= 0 {
+		return d
+	}
+	return 30 * 24 * time.Hour
+}
+
+// purgeInterval retourne 0 si la purge périodique est désactivée
+func purgeInterval() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("PURGE_INTERVAL")); err == nil && d >= 0 {
+		return d
+	}
+	return time.Hour
+}
+
+// === ADMIN HANDLER ===
+
+type PurgeHandler struct {
+	purger *TrashPurger
+}
+
+func NewPurgeHandler(purger *TrashPurger) *PurgeHandler {
+	return &PurgeHandler{purger: purger}
+}
+
+// POST /admin/purge?older_than=720h (rétention configurée par défaut)
+func (h *PurgeHandler) Purge(c *gin.Context) {
+	olderThan := h.purger.retention
+	if raw := c.Query("older_than"); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "older_than doit être une durée (ex. 720h)"})
+			return
+		}
+		olderThan = d
+	}
+
+	report, err := h.purger.Purge(c.Request.Context(), olderThan)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur de purge"})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
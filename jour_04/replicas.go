@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// === RÉPLICAS EN LECTURE ===
+//
+// Avec DB_REPLICA_DSNS, les lectures (SELECT, Raw().Scan) faites hors
+// transaction partent vers un réplica ; les écritures, les transactions
+// (unit of work comprise) et les SELECT ... FOR UPDATE restent sur le
+// primaire. Le routage est un callback GORM : les repositories ne changent
+// pas.
+//
+// Un réplica peut être en retard sur le primaire. Pour relire ce qu'on vient
+// d'écrire, usePrimary(ctx) force le primaire (header X-Read-Your-Writes
+// côté client). Un réplica qui ne répond plus au ping sort de la rotation et
+// y revient dès qu'il répond ; sans réplica disponible, tout va au primaire.
+
+// Politiques de choix du réplica (DB_REPLICA_POLICY)
+const (
+	ReplicaRandom     = "random"
+	ReplicaRoundRobin = "round_robin"
+	ReplicaLeastConns = "least_conns"
+)
+
+type replica struct {
+	name    string
+	open    func() (*gorm.DB, error)
+	healthy atomic.Bool
+
+	mu        sync.Mutex
+	sqlDB     *sql.DB // nil tant que l'ouverture échoue
+	lastError string
+}
+
+type ReplicaSet struct {
+	policy   string
+	replicas []*replica
+	next     atomic.Uint64
+}
+
+// openReplicas ouvre les réplicas de DB_REPLICA_DSNS (séparés par des
+// virgules), avec le driver et le réglage de pool du primaire. Un réplica
+// injoignable au démarrage est gardé hors rotation et réessayé à chaque
+// vérification, pas fatal. Retourne nil sans réplica configuré.
+func openReplicas(cfg DBConfig, d Dialect) (*ReplicaSet, error) {
+	var dsns []string
+	for _, dsn := range strings.Split(os.Getenv("DB_REPLICA_DSNS"), ",") {
+		if dsn = strings.TrimSpace(dsn); dsn != "" {
+			dsns = append(dsns, dsn)
+		}
+	}
+	if len(dsns) == 0 {
+		return nil, nil
+	}
+
+	policy := strings.ToLower(os.Getenv("DB_REPLICA_POLICY"))
+	switch policy {
+	case "":
+		policy = ReplicaRoundRobin
+	case ReplicaRandom, ReplicaRoundRobin, ReplicaLeastConns:
+	default:
+		return nil, fmt.Errorf("DB_REPLICA_POLICY inconnue: %q (%s, %s, %s)",
+			policy, ReplicaRandom, ReplicaRoundRobin, ReplicaLeastConns)
+	}
+
+	set := &ReplicaSet{policy: policy}
+	for i, dsn := range dsns {
+		replicaCfg := cfg
+		replicaCfg.DSN = dsn
+		set.replicas = append(set.replicas, &replica{
+			name: "replica" + strconv.Itoa(i+1),
+			open: func() (*gorm.DB, error) {
+				return gorm.Open(d.Dialector(replicaCfg), &gorm.Config{DisableAutomaticPing: true})
+			},
+		})
+	}
+	set.Check(context.Background())
+	return set, nil
+}
+
+// connect ouvre le pool du réplica au premier appel réussi
+func (r *replica) connect() (*sql.DB, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.sqlDB != nil {
+		return r.sqlDB, nil
+	}
+
+	conn, err := r.open()
+	if err != nil {
+		return nil, err
+	}
+	sqlDB, err := conn.DB()
+	if err != nil {
+		return nil, err
+	}
+	applyPool(sqlDB, loadPoolConfig(dialect.DefaultPool()))
+	r.sqlDB = sqlDB
+	return sqlDB, nil
+}
+
+// pick choisit un réplica en service selon la politique ; nil si aucun
+func (s *ReplicaSet) pick() *replica {
+	var up []*replica
+	for _, r := range s.replicas {
+		if r.healthy.Load() {
+			up = append(up, r)
+		}
+	}
+	if len(up) == 0 {
+		return nil
+	}
+
+	switch s.policy {
+	case ReplicaRandom:
+		return up[rand.IntN(len(up))]
+	case ReplicaLeastConns:
+		best := up[0]
+		for _, r := range up[1:] {
+			if r.sqlDB.Stats().InUse < best.sqlDB.Stats().InUse {
+				best = r
+			}
+		}
+		return best
+	}
+	return up[(s.next.Add(1)-1)%uint64(len(up))]
+}
+
+// Check pingue chaque réplica (5s au plus) et met à jour la rotation
+func (s *ReplicaSet) Check(ctx context.Context) {
+	for _, r := range s.replicas {
+		sqlDB, err := r.connect()
+		if err == nil {
+			pingCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+			err = sqlDB.PingContext(pingCtx)
+			cancel()
+		}
+
+		r.mu.Lock()
+		switch was := r.healthy.Load(); {
+		case err != nil:
+			r.lastError = err.Error()
+			r.healthy.Store(false)
+			if was {
+				fmt.Printf("[DB] %s retiré de la rotation : %v\n", r.name, err)
+			}
+		case !was:
+			r.lastError = ""
+			r.healthy.Store(true)
+			fmt.Printf("[DB] %s en rotation\n", r.name)
+		}
+		r.mu.Unlock()
+	}
+}
+
+// Watch vérifie les réplicas à intervalle régulier
+func (s *ReplicaSet) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.Check(ctx)
+		}
+	}
+}
+
+// replicaHealthInterval : DB_REPLICA_HEALTH_INTERVAL, 5s par défaut
+func replicaHealthInterval() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("DB_REPLICA_HEALTH_INTERVAL")); err == nil && d > 0 {
+		return d
+	}
+	return 5 * time.Second
+}
+
+// Stats : état de chaque réplica pour GET /admin/db
+func (s *ReplicaSet) Stats() gin.H {
+	list := make([]gin.H, 0, len(s.replicas))
+	for _, r := range s.replicas {
+		r.mu.Lock()
+		entry := gin.H{"name": r.name, "healthy": r.healthy.Load()}
+		if r.sqlDB != nil {
+			stats := r.sqlDB.Stats()
+			entry["open_connections"] = stats.OpenConnections
+			entry["in_use"] = stats.InUse
+			entry["idle"] = stats.Idle
+		}
+		if r.lastError != "" {
+			entry["error"] = r.lastError
+		}
+		r.mu.Unlock()
+		list = append(list, entry)
+	}
+	return gin.H{"policy": s.policy, "replicas": list}
+}
+
+// === ROUTAGE ===
+
+type primaryKey struct{}
+
+// usePrimary force le primaire pour les lectures faites avec ce contexte
+// (relire ses propres écritures malgré le retard des réplicas)
+func usePrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+// registerReplicaRouting branche le routage sur les callbacks Query et Row
+func registerReplicaRouting(db *gorm.DB, set *ReplicaSet) error {
+	route := func(tx *gorm.DB) {
+		stmt := tx.Statement
+		if _, inTx := stmt.ConnPool.(gorm.TxCommitter); inTx {
+			return
+		}
+		if forced, _ := stmt.Context.Value(primaryKey{}).(bool); forced {
+			return
+		}
+		if _, locking := stmt.Clauses["FOR"]; locking {
+			return
+		}
+		// Raw : le SQL est déjà écrit, seul un SELECT peut aller au réplica
+		if sql := strings.ToUpper(strings.TrimSpace(stmt.SQL.String())); sql != "" &&
+			!strings.HasPrefix(sql, "SELECT") && !strings.HasPrefix(sql, "WITH") {
+			return
+		}
+		if r := set.pick(); r != nil {
+			stmt.ConnPool = r.sqlDB
+		}
+	}
+
+	cb := db.Callback()
+	if err := cb.Query().Before("gorm:query").Register("replicas:route_query", route); err != nil {
+		return err
+	}
+	return cb.Row().Before("gorm:row").Register("replicas:route_row", route)
+}
+
+// ReadYourWritesMiddleware : avec X-Read-Your-Writes: true, la requête lit
+// sur le primaire
+func ReadYourWritesMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if ok, _ := strconv.ParseBool(c.GetHeader("X-Read-Your-Writes")); ok {
+			c.Request = c.Request.WithContext(usePrimary(c.Request.Context()))
+		}
+		c.Next()
+	}
+}
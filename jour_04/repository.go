@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// === REPOSITORIES ===
+//
+// Les repositories isolent l'accès aux données : les handlers et services ne
+// connaissent que ces interfaces, implémentées avec GORM (repository_gorm.go)
+// ou en mémoire (repository_memory.go).
+
+var (
+	ErrNotFound = errors.New("enregistrement non trouvé")
+	ErrConflict = errors.New("valeur déjà utilisée")
+)
+
+// ConflictError : violation d'une contrainte d'unicité. Field est la colonne
+// concernée ("email"), vide si le driver ne permet pas de la retrouver.
+// errors.Is(err, ErrConflict) reconnaît tout conflit,
+// errors.Is(err, &ConflictError{Field: "email"}) seulement celui de ce champ.
+type ConflictError struct {
+	Field string
+}
+
+func (e *ConflictError) Error() string {
+	if e.Field == "" {
+		return ErrConflict.Error()
+	}
+	return e.Field + " déjà utilisé"
+}
+
+func (e *ConflictError) Is(target error) bool {
+	if target == ErrConflict {
+		return true
+	}
+	t, ok := target.(*ConflictError)
+	return ok && t.Field == e.Field
+}
+
+// ReadOptions restreint ce qu'une lecture charge (?fields= et ?include=,
+// validés par fieldsets.go). La valeur zéro lit toutes les colonnes et
+// aucune relation.
+type ReadOptions struct {
+	// Fields : colonnes à lire (noms JSON) ; vide = toutes. L'ID et les clés
+	// nécessaires aux relations incluses sont lus en plus si besoin.
+	Fields []string
+	// Include : relations à précharger, en notation pointée ("posts.tags")
+	Include []string
+	// Trashed : lit aussi (TrashedWith) ou seulement (TrashedOnly) les
+	// enregistrements à la corbeille ; vide = seulement les autres
+	Trashed string
+	// Filter : expression ?filter= des listes (filter.go) ; nil = aucun
+	// filtre, ignoré par Get
+	Filter *Filter
+}
+
+const (
+	TrashedWith = "with"
+	TrashedOnly = "only"
+)
+
+// Shows indique si un enregistrement supprimé à deleted est lu avec Trashed
+func (o ReadOptions) Shows(deleted gorm.DeletedAt) bool {
+	switch o.Trashed {
+	case TrashedWith:
+		return true
+	case TrashedOnly:
+		return deleted.Valid
+	}
+	return !deleted.Valid
+}
+
+// Includes indique si la relation path est demandée, directement ou via
+// une relation imbriquée ("posts" est inclus par "posts.tags")
+func (o ReadOptions) Includes(path string) bool {
+	return slices.ContainsFunc(o.Include, func(inc string) bool {
+		return inc == path || strings.HasPrefix(inc, path+".")
+	})
+}
+
+// Reads indique si la colonne field est demandée
+func (o ReadOptions) Reads(field string) bool {
+	return len(o.Fields) == 0 || slices.Contains(o.Fields, field)
+}
+
+type UserRepository interface {
+	// List retourne les utilisateurs, avec les relations demandées par opts
+	List(ctx context.Context, opts ReadOptions) ([]User, error)
+	// Get retourne un utilisateur, avec les relations demandées par opts,
+	// ou ErrNotFound
+	Get(ctx context.Context, id uint, opts ReadOptions) (*User, error)
+	// GetByEmail retourne l'utilisateur ayant cet email, ou ErrNotFound
+	GetByEmail(ctx context.Context, email string) (*User, error)
+	// Create insère l'utilisateur et renseigne son ID ; *ConflictError si l'email existe
+	// (dans le tenant)
+	Create(ctx context.Context, user *User) error
+	// Update écrit les champs fields de user (zéros compris) dans l'utilisateur
+	// id puis recharge user (sans relations) ; ErrNotFound s'il n'existe pas
+	Update(ctx context.Context, id uint, user *User, fields []string) error
+	// Delete met l'utilisateur à la corbeille en appliquant les politiques
+	// ondelete (cascade.go) ; *RestrictError si une relation restrict a
+	// encore des enregistrements
+	Delete(ctx context.Context, id uint) error
+	// Restore sort l'utilisateur de la corbeille, avec ses posts supprimés en
+	// même temps que lui si withPosts ; ErrNotFound s'il n'y est pas
+	Restore(ctx context.Context, id uint, withPosts bool) error
+	// Purge supprime définitivement les utilisateurs mis à la corbeille
+	// avant before et retourne leur nombre
+	Purge(ctx context.Context, before time.Time) (int64, error)
+}
+
+// PostFilter restreint PostRepository.List
+type PostFilter struct {
+	// Tags : noms de tags (sans doublons) ; vide = pas de filtre
+	Tags []string
+	// MatchAll : le post doit porter tous les tags, sinon au moins un
+	MatchAll bool
+}
+
+type PostRepository interface {
+	// List retourne les posts filtrés avec leur nombre de commentaires et
+	// les relations demandées par opts
+	List(ctx context.Context, filter PostFilter, opts ReadOptions) ([]Post, error)
+	// Get retourne un post avec son nombre de commentaires et les relations
+	// demandées par opts, ou ErrNotFound
+	Get(ctx context.Context, id uint, opts ReadOptions) (*Post, error)
+	ListByUser(ctx context.Context, userID uint) ([]Post, error)
+	Create(ctx context.Context, post *Post) error
+	// Update écrit les champs fields de post (zéros compris) dans le post id
+	// puis recharge post (sans relations) ; ErrNotFound s'il n'existe pas
+	Update(ctx context.Context, id uint, post *Post, fields []string) error
+	// Delete met le post à la corbeille ; ses commentaires et tags restent
+	// jusqu'à la purge
+	Delete(ctx context.Context, id uint) error
+	// Restore sort le post de la corbeille ; ErrNotFound s'il n'y est pas
+	Restore(ctx context.Context, id uint) error
+	// Purge supprime définitivement les posts mis à la corbeille avant
+	// before et retourne leur nombre
+	Purge(ctx context.Context, before time.Time) (int64, error)
+	// AttachTags ajoute les tags au post (sans effet s'ils y sont déjà)
+	AttachTags(ctx context.Context, postID uint, tags []Tag) error
+	// DetachTags retire les tags du post
+	DetachTags(ctx context.Context, postID uint, tags []Tag) error
+}
+
+// TagCount : tag et nombre de posts qui le portent
+type TagCount struct {
+	Tag
+	PostsCount int64 `json:"posts_count"`
+}
+
+type TagRepository interface {
+	// List retourne les tags triés par nom avec leur nombre de posts
+	List(ctx context.Context) ([]TagCount, error)
+	// GetByNames retourne les tags existants parmi names
+	GetByNames(ctx context.Context, names []string) ([]Tag, error)
+	// Create insère le tag ; *ConflictError si le nom existe
+	Create(ctx context.Context, tag *Tag) error
+}
+
+type CommentRepository interface {
+	// ListByPost retourne les commentaires du post avec leur auteur, triés par ID
+	ListByPost(ctx context.Context, postID uint) ([]Comment, error)
+	// Get retourne un commentaire avec son auteur, ou ErrNotFound
+	Get(ctx context.Context, id uint) (*Comment, error)
+	Create(ctx context.Context, comment *Comment) error
+	// Update écrit les champs fields de comment dans le commentaire id puis
+	// recharge comment ; ErrNotFound s'il n'existe pas
+	Update(ctx context.Context, id uint, comment *Comment, fields []string) error
+	// Delete supprime le commentaire et ses réponses (ondelete sur Replies)
+	Delete(ctx context.Context, id uint) error
+}
+
+// Repositories regroupe les implémentations choisies au démarrage
+type Repositories struct {
+	Users     UserRepository
+	Posts     PostRepository
+	Tags      TagRepository
+	Comments  CommentRepository
+	Ledger    LedgerRepository
+	Transfers TransferRepository
+	Payments  PaymentRepository
+	Webhooks  WebhookRepository
+	Search    SearchIndex
+	UoW       UnitOfWork
+	Tenants   TenantDirectory
+}
+
+// translateError convertit les erreurs GORM/driver en erreurs du repository :
+// la contrainte d'unicité de la base tranche les écritures concurrentes, sa
+// violation devient une *ConflictError quel que soit le driver
+func translateError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return ErrNotFound
+	}
+	if dialect != nil {
+		if column, ok := dialect.UniqueViolation(err); ok {
+			return &ConflictError{Field: column}
+		}
+	}
+	return err
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"errors"
+)
+
+// === REPOSITORIES AVEC CACHE ===
+//
+// Décorateurs des repositories (GORM ou mémoire) : Get par ID passe par le
+// cache (cache.go), les écritures invalident les clés touchées. Seule la
+// lecture par défaut est mise en cache, l'enregistrement complet : ?fields=
+// est appliqué par le handler, ?include= et ?trashed= lisent la base.
+//
+// Un post en cache porte son nombre de commentaires : créer ou supprimer un
+// commentaire invalide le post, mettre un utilisateur à la corbeille
+// invalide ses posts.
+
+// withReadCache décore les repositories de repos
+func withReadCache(repos Repositories, rt *ReadThrough) Repositories {
+	repos.Users = &cachedUserRepository{UserRepository: repos.Users, posts: repos.Posts, rt: rt}
+	repos.Posts = &cachedPostRepository{PostRepository: repos.Posts, rt: rt}
+	repos.Comments = &cachedCommentRepository{CommentRepository: repos.Comments, rt: rt}
+	return repos
+}
+
+// cacheable : lecture par défaut, hors colonnes demandées
+func cacheable(opts ReadOptions) bool {
+	return len(opts.Include) == 0 && opts.Trashed == ""
+}
+
+type cachedUserRepository struct {
+	UserRepository
+	posts PostRepository
+	rt    *ReadThrough
+}
+
+func (r *cachedUserRepository) Get(ctx context.Context, id uint, opts ReadOptions) (*User, error) {
+	key, ok := cacheKey(ctx, "user", id)
+	if !ok || !cacheable(opts) {
+		return r.UserRepository.Get(ctx, id, opts)
+	}
+
+	var user User
+	err := r.rt.Fetch(ctx, key, &user, func(ctx context.Context, dest interface{}) error {
+		u, err := r.UserRepository.Get(ctx, id, ReadOptions{})
+		if err != nil {
+			return err
+		}
+		*dest.(*User) = *u
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (r *cachedUserRepository) Update(ctx context.Context, id uint, user *User, fields []string) error {
+	if err := r.UserRepository.Update(ctx, id, user, fields); err != nil {
+		return err
+	}
+	r.invalidate(ctx, id)
+	return nil
+}
+
+// Delete invalide aussi les posts, mis à la corbeille avec l'utilisateur
+func (r *cachedUserRepository) Delete(ctx context.Context, id uint) error {
+	posts, err := r.posts.ListByUser(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := r.UserRepository.Delete(ctx, id); err != nil {
+		return err
+	}
+	r.invalidate(ctx, id)
+	for _, p := range posts {
+		if key, ok := cacheKey(ctx, "post", p.ID); ok {
+			r.rt.Invalidate(ctx, key)
+		}
+	}
+	return nil
+}
+
+func (r *cachedUserRepository) Restore(ctx context.Context, id uint, withPosts bool) error {
+	if err := r.UserRepository.Restore(ctx, id, withPosts); err != nil {
+		return err
+	}
+	r.invalidate(ctx, id)
+	return nil
+}
+
+func (r *cachedUserRepository) invalidate(ctx context.Context, id uint) {
+	if key, ok := cacheKey(ctx, "user", id); ok {
+		r.rt.Invalidate(ctx, key)
+	}
+}
+
+type cachedPostRepository struct {
+	PostRepository
+	rt *ReadThrough
+}
+
+func (r *cachedPostRepository) Get(ctx context.Context, id uint, opts ReadOptions) (*Post, error) {
+	key, ok := cacheKey(ctx, "post", id)
+	if !ok || !cacheable(opts) {
+		return r.PostRepository.Get(ctx, id, opts)
+	}
+
+	var post Post
+	err := r.rt.Fetch(ctx, key, &post, func(ctx context.Context, dest interface{}) error {
+		p, err := r.PostRepository.Get(ctx, id, ReadOptions{})
+		if err != nil {
+			return err
+		}
+		*dest.(*Post) = *p
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &post, nil
+}
+
+func (r *cachedPostRepository) Update(ctx context.Context, id uint, post *Post, fields []string) error {
+	if err := r.PostRepository.Update(ctx, id, post, fields); err != nil {
+		return err
+	}
+	r.invalidate(ctx, id)
+	return nil
+}
+
+func (r *cachedPostRepository) Delete(ctx context.Context, id uint) error {
+	if err := r.PostRepository.Delete(ctx, id); err != nil {
+		return err
+	}
+	r.invalidate(ctx, id)
+	return nil
+}
+
+func (r *cachedPostRepository) Restore(ctx context.Context, id uint) error {
+	if err := r.PostRepository.Restore(ctx, id); err != nil {
+		return err
+	}
+	r.invalidate(ctx, id)
+	return nil
+}
+
+func (r *cachedPostRepository) AttachTags(ctx context.Context, postID uint, tags []Tag) error {
+	if err := r.PostRepository.AttachTags(ctx, postID, tags); err != nil {
+		return err
+	}
+	r.invalidate(ctx, postID)
+	return nil
+}
+
+func (r *cachedPostRepository) DetachTags(ctx context.Context, postID uint, tags []Tag) error {
+	if err := r.PostRepository.DetachTags(ctx, postID, tags); err != nil {
+		return err
+	}
+	r.invalidate(ctx, postID)
+	return nil
+}
+
+func (r *cachedPostRepository) invalidate(ctx context.Context, id uint) {
+	if key, ok := cacheKey(ctx, "post", id); ok {
+		r.rt.Invalidate(ctx, key)
+	}
+}
+
+// cachedCommentRepository ne met rien en cache : il invalide le post dont
+// le nombre de commentaires change
+type cachedCommentRepository struct {
+	CommentRepository
+	rt *ReadThrough
+}
+
+func (r *cachedCommentRepository) Create(ctx context.Context, comment *Comment) error {
+	if err := r.CommentRepository.Create(ctx, comment); err != nil {
+		return err
+	}
+	r.invalidatePost(ctx, comment.PostID)
+	return nil
+}
+
+func (r *cachedCommentRepository) Delete(ctx context.Context, id uint) error {
+	comment, err := r.CommentRepository.Get(ctx, id)
+	if errors.Is(err, ErrNotFound) {
+		return r.CommentRepository.Delete(ctx, id)
+	}
+	if err != nil {
+		return err
+	}
+	if err := r.CommentRepository.Delete(ctx, id); err != nil {
+		return err
+	}
+	r.invalidatePost(ctx, comment.PostID)
+	return nil
+}
+
+func (r *cachedCommentRepository) invalidatePost(ctx context.Context, postID uint) {
+	if key, ok := cacheKey(ctx, "post", postID); ok {
+		r.rt.Invalidate(ctx, key)
+	}
+}
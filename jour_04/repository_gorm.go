@@ -0,0 +1,364 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// === REPOSITORIES GORM ===
+
+// commentsCountColumn calcule comments_count dans le SELECT des posts : une
+// sous-requête corrélée, donc une seule requête quel que soit le nombre de posts
+const commentsCountColumn = "(SELECT COUNT(*) FROM comments WHERE comments.post_id = posts.id) AS comments_count"
+
+func withCommentsCount(db *gorm.DB) *gorm.DB {
+	return db.Select("posts.*, " + commentsCountColumn)
+}
+
+// withKeys ajoute à fields les clés absentes (ID, clés étrangères des
+// relations incluses), sans lesquelles les Preload ne peuvent pas se faire
+func withKeys(fields []string, keys ...string) []string {
+	for _, k := range keys {
+		if !slices.Contains(fields, k) {
+			fields = append([]string{k}, fields...)
+		}
+	}
+	return fields
+}
+
+// withTrashed applique ReadOptions.Trashed à la table table
+func withTrashed(table string, opts ReadOptions) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		switch opts.Trashed {
+		case TrashedWith:
+			return db.Unscoped()
+		case TrashedOnly:
+			return db.Unscoped().Where(table + ".deleted_at IS NOT NULL")
+		}
+		return db
+	}
+}
+
+// withFilter applique ReadOptions.Filter (listes) à la table table
+func withFilter(table string, opts ReadOptions) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if opts.Filter == nil {
+			return db
+		}
+		condition, args := opts.Filter.SQL(table)
+		return db.Where(condition, args...)
+	}
+}
+
+// userReadScope lit les colonnes demandées par opts et précharge les
+// relations incluses (une requête par relation)
+func userReadScope(opts ReadOptions) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		db = db.Scopes(withTrashed("users", opts))
+		if len(opts.Fields) > 0 {
+			var columns []string
+			for _, f := range withKeys(opts.Fields, "id") {
+				columns = append(columns, "users."+f)
+			}
+			db = db.Select(columns)
+		}
+		if opts.Includes("posts") {
+			db = db.Preload("Posts", withCommentsCount)
+		}
+		if opts.Includes("posts.tags") {
+			db = db.Preload("Posts.Tags")
+		}
+		return db
+	}
+}
+
+// postReadScope lit les colonnes demandées par opts (comments_count compris)
+// et précharge les relations incluses (une requête par relation)
+func postReadScope(opts ReadOptions) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		db = db.Scopes(withTrashed("posts", opts))
+		if len(opts.Fields) == 0 {
+			db = db.Scopes(withCommentsCount)
+		} else {
+			keys := []string{"id"}
+			if opts.Includes("user") {
+				keys = append(keys, "user_id")
+			}
+			var columns []string
+			for _, f := range withKeys(opts.Fields, keys...) {
+				if f == "comments_count" {
+					columns = append(columns, commentsCountColumn)
+				} else {
+					columns = append(columns, "posts."+f)
+				}
+			}
+			db = db.Select(columns)
+		}
+
+		if opts.Includes("user") {
+			db = db.Preload("User")
+		}
+		if opts.Includes("tags") {
+			db = db.Preload("Tags")
+		}
+		if opts.Includes("comments") {
+			db = db.Preload("Comments", func(db *gorm.DB) *gorm.DB { return db.Order("comments.id") })
+		}
+		if opts.Includes("comments.user") {
+			db = db.Preload("Comments.User")
+		}
+		return db
+	}
+}
+
+type gormUserRepository struct {
+	db *gorm.DB
+}
+
+func NewGormUserRepository(db *gorm.DB) UserRepository {
+	return &gormUserRepository{db: db}
+}
+
+func (r *gormUserRepository) List(ctx context.Context, opts ReadOptions) ([]User, error) {
+	var users []User
+	err := dbFromContext(ctx, r.db).Scopes(userReadScope(opts), withFilter("users", opts)).
+		Order("users.id").Find(&users).Error
+	return users, translateError(err)
+}
+
+func (r *gormUserRepository) Get(ctx context.Context, id uint, opts ReadOptions) (*User, error) {
+	var user User
+	if err := dbFromContext(ctx, r.db).Scopes(userReadScope(opts)).First(&user, id).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &user, nil
+}
+
+func (r *gormUserRepository) GetByEmail(ctx context.Context, email string) (*User, error) {
+	var user User
+	if err := dbFromContext(ctx, r.db).Where("email = ?", email).First(&user).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &user, nil
+}
+
+func (r *gormUserRepository) Create(ctx context.Context, user *User) error {
+	return translateError(dbFromContext(ctx, r.db).Create(user).Error)
+}
+
+func (r *gormUserRepository) Update(ctx context.Context, id uint, user *User, fields []string) error {
+	user.ID = id
+	return translateError(updateByID(dbFromContext(ctx, r.db), user, id, fields, userReadScope(ReadOptions{})))
+}
+
+// Delete met l'utilisateur à la corbeille selon les politiques ondelete de User
+func (r *gormUserRepository) Delete(ctx context.Context, id uint) error {
+	err := dbFromContext(ctx, r.db).Transaction(func(tx *gorm.DB) error {
+		return deleteWithPolicies(tx, &User{}, []interface{}{id})
+	})
+	return translateError(err)
+}
+
+func (r *gormUserRepository) Restore(ctx context.Context, id uint, withPosts bool) error {
+	err := dbFromContext(ctx, r.db).Transaction(func(tx *gorm.DB) error {
+		return restoreFromTrash(tx, &User{}, id, withPosts)
+	})
+	return translateError(err)
+}
+
+func (r *gormUserRepository) Purge(ctx context.Context, before time.Time) (int64, error) {
+	return purgeTrash(dbFromContext(ctx, r.db), &User{}, "users", before)
+}
+
+type gormPostRepository struct {
+	db *gorm.DB
+}
+
+func NewGormPostRepository(db *gorm.DB) PostRepository {
+	return &gormPostRepository{db: db}
+}
+
+func (r *gormPostRepository) List(ctx context.Context, filter PostFilter, opts ReadOptions) ([]Post, error) {
+	query := dbFromContext(ctx, r.db).Scopes(postReadScope(opts), withFilter("posts", opts))
+
+	if len(filter.Tags) > 0 {
+		tagged := dbFromContext(ctx, r.db).Table("post_tags").
+			Select("post_tags.post_id").
+			Joins("JOIN tags ON tags.id = post_tags.tag_id").
+			Where("tags.name IN ?", filter.Tags)
+		if filter.MatchAll {
+			tagged = tagged.Group("post_tags.post_id").
+				Having("COUNT(DISTINCT post_tags.tag_id) = ?", len(filter.Tags))
+		}
+		query = query.Where("posts.id IN (?)", tagged)
+	}
+
+	var posts []Post
+	err := query.Order("posts.id").Find(&posts).Error
+	return posts, translateError(err)
+}
+
+func (r *gormPostRepository) Get(ctx context.Context, id uint, opts ReadOptions) (*Post, error) {
+	var post Post
+	if err := dbFromContext(ctx, r.db).Scopes(postReadScope(opts)).First(&post, id).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &post, nil
+}
+
+func (r *gormPostRepository) ListByUser(ctx context.Context, userID uint) ([]Post, error) {
+	var posts []Post
+	err := dbFromContext(ctx, r.db).Where("user_id = ?", userID).Find(&posts).Error
+	return posts, translateError(err)
+}
+
+func (r *gormPostRepository) Create(ctx context.Context, post *Post) error {
+	return translateError(dbFromContext(ctx, r.db).Create(post).Error)
+}
+
+func (r *gormPostRepository) Update(ctx context.Context, id uint, post *Post, fields []string) error {
+	post.ID = id
+	return translateError(updateByID(dbFromContext(ctx, r.db), post, id, fields, postReadScope(ReadOptions{})))
+}
+
+func (r *gormPostRepository) Delete(ctx context.Context, id uint) error {
+	err := dbFromContext(ctx, r.db).Transaction(func(tx *gorm.DB) error {
+		return deleteWithPolicies(tx, &Post{}, []interface{}{id})
+	})
+	return translateError(err)
+}
+
+func (r *gormPostRepository) Restore(ctx context.Context, id uint) error {
+	err := dbFromContext(ctx, r.db).Transaction(func(tx *gorm.DB) error {
+		return restoreFromTrash(tx, &Post{}, id, true)
+	})
+	return translateError(err)
+}
+
+func (r *gormPostRepository) Purge(ctx context.Context, before time.Time) (int64, error) {
+	return purgeTrash(dbFromContext(ctx, r.db), &Post{}, "posts", before)
+}
+
+func (r *gormPostRepository) AttachTags(ctx context.Context, postID uint, tags []Tag) error {
+	post := Post{ID: postID}
+	return translateError(dbFromContext(ctx, r.db).Model(&post).Association("Tags").Append(tags))
+}
+
+func (r *gormPostRepository) DetachTags(ctx context.Context, postID uint, tags []Tag) error {
+	post := Post{ID: postID}
+	return translateError(dbFromContext(ctx, r.db).Model(&post).Association("Tags").Delete(tags))
+}
+
+type gormTagRepository struct {
+	db *gorm.DB
+}
+
+func NewGormTagRepository(db *gorm.DB) TagRepository {
+	return &gormTagRepository{db: db}
+}
+
+func (r *gormTagRepository) List(ctx context.Context) ([]TagCount, error) {
+	var tags []TagCount
+	err := dbFromContext(ctx, r.db).Model(&Tag{}).
+		Select("tags.id, tags.name, COUNT(posts.id) AS posts_count").
+		Joins("LEFT JOIN post_tags ON post_tags.tag_id = tags.id").
+		Joins("LEFT JOIN posts ON posts.id = post_tags.post_id AND posts.deleted_at IS NULL").
+		Group("tags.id, tags.name").
+		Order("tags.name").
+		Scan(&tags).Error
+	return tags, translateError(err)
+}
+
+func (r *gormTagRepository) GetByNames(ctx context.Context, names []string) ([]Tag, error) {
+	var tags []Tag
+	err := dbFromContext(ctx, r.db).Where("name IN ?", names).Find(&tags).Error
+	return tags, translateError(err)
+}
+
+func (r *gormTagRepository) Create(ctx context.Context, tag *Tag) error {
+	return translateError(dbFromContext(ctx, r.db).Create(tag).Error)
+}
+
+type gormCommentRepository struct {
+	db *gorm.DB
+}
+
+func NewGormCommentRepository(db *gorm.DB) CommentRepository {
+	return &gormCommentRepository{db: db}
+}
+
+func (r *gormCommentRepository) ListByPost(ctx context.Context, postID uint) ([]Comment, error) {
+	var comments []Comment
+	err := dbFromContext(ctx, r.db).Preload("User").Where("post_id = ?", postID).Order("id").Find(&comments).Error
+	return comments, translateError(err)
+}
+
+func (r *gormCommentRepository) Get(ctx context.Context, id uint) (*Comment, error) {
+	var comment Comment
+	if err := dbFromContext(ctx, r.db).Preload("User").First(&comment, id).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &comment, nil
+}
+
+func (r *gormCommentRepository) Create(ctx context.Context, comment *Comment) error {
+	return translateError(dbFromContext(ctx, r.db).Create(comment).Error)
+}
+
+func (r *gormCommentRepository) Update(ctx context.Context, id uint, comment *Comment, fields []string) error {
+	comment.ID = id
+	preloadUser := func(db *gorm.DB) *gorm.DB { return db.Preload("User") }
+	return translateError(updateByID(dbFromContext(ctx, r.db), comment, id, fields, preloadUser))
+}
+
+func (r *gormCommentRepository) Delete(ctx context.Context, id uint) error {
+	err := dbFromContext(ctx, r.db).Transaction(func(tx *gorm.DB) error {
+		return deleteWithPolicies(tx, &Comment{}, []interface{}{id})
+	})
+	return translateError(err)
+}
+
+// purgeTrash supprime définitivement les enregistrements de model mis à la
+// corbeille avant before : deleteWithPolicies sur une session Unscoped,
+// donc politiques ondelete complètes (reassign, enfants, jointures)
+func purgeTrash(db *gorm.DB, model interface{}, table string, before time.Time) (int64, error) {
+	var ids []interface{}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		purge := tx.Unscoped().Session(&gorm.Session{})
+		if err := purge.Model(model).Where(table+".deleted_at < ?", before).Pluck(table+".id", &ids).Error; err != nil {
+			return err
+		}
+		return deleteWithPolicies(purge, model, ids)
+	})
+	if err != nil {
+		return 0, translateError(err)
+	}
+	return int64(len(ids)), nil
+}
+
+// updateByID est le chemin de mise à jour commun : vérifie que l'enregistrement
+// existe (gorm.ErrRecordNotFound sinon), écrit uniquement les champs fields
+// avec Select pour que les valeurs zéro soient appliquées, puis recharge dest
+// avec les scopes de lecture du repository. Le nombre de lignes affectées
+// n'est pas utilisé : MySQL compte 0 ligne quand les valeurs sont inchangées.
+func updateByID(db *gorm.DB, dest interface{}, id uint, fields []string, scopes ...func(*gorm.DB) *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(dest).Where("id = ?", id).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		if len(fields) > 0 {
+			if err := tx.Model(dest).Where("id = ?", id).Select(fields).Updates(dest).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Scopes(scopes...).First(dest, id).Error
+	})
+}
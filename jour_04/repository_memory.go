@@ -0,0 +1,873 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// === REPOSITORIES EN MÉMOIRE ===
+//
+// MemoryStore partage les données entre les repositories pour pouvoir
+// reproduire les Preload (posts d'un utilisateur, auteur et tags d'un post).
+// Les valeurs sont copiées à l'entrée et à la sortie : un appelant ne peut
+// pas modifier le contenu du store sans passer par les repositories.
+
+type MemoryStore struct {
+	mu         sync.RWMutex
+	txMu       sync.Mutex // sérialise les unités de travail (unit_of_work.go)
+	users      map[uint]User
+	posts      map[uint]Post
+	tags       map[uint]Tag
+	postTags   map[postTag]struct{} // table de jointure post_tags
+	comments   map[uint]Comment
+	nextUserID uint
+	nextPostID uint
+	nextTagID  uint
+	nextCommID uint
+
+	// Grand livre (ledger_repository.go)
+	accounts      map[uint]Account
+	entries       map[uint]JournalEntry // sans Lines
+	lines         map[uint]JournalLine
+	nextAccountID uint
+	nextEntryID   uint
+	nextLineID    uint
+
+	// Virements (transfer_repository.go)
+	transfers      map[uint]Transfer
+	nextTransferID uint
+	payments       map[uint]Payment
+	nextPaymentID  uint
+
+	// Webhooks (webhook_repository.go)
+	webhookEndpoints  map[uint]WebhookEndpoint
+	webhookDeliveries map[uint]WebhookDelivery
+	webhookAttempts   map[uint]WebhookAttempt
+	nextEndpointID    uint
+	nextDeliveryID    uint
+	nextAttemptID     uint
+}
+
+type postTag struct {
+	PostID, TagID uint
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		users:      map[uint]User{},
+		posts:      map[uint]Post{},
+		tags:       map[uint]Tag{},
+		postTags:   map[postTag]struct{}{},
+		comments:   map[uint]Comment{},
+		nextUserID: 1,
+		nextPostID: 1,
+		nextTagID:  1,
+		nextCommID: 1,
+
+		accounts:      map[uint]Account{},
+		entries:       map[uint]JournalEntry{},
+		lines:         map[uint]JournalLine{},
+		nextAccountID: 1,
+		nextEntryID:   1,
+		nextLineID:    1,
+
+		transfers:      map[uint]Transfer{},
+		nextTransferID: 1,
+		payments:       map[uint]Payment{},
+		nextPaymentID:  1,
+
+		webhookEndpoints:  map[uint]WebhookEndpoint{},
+		webhookDeliveries: map[uint]WebhookDelivery{},
+		webhookAttempts:   map[uint]WebhookAttempt{},
+		nextEndpointID:    1,
+		nextDeliveryID:    1,
+		nextAttemptID:     1,
+	}
+}
+
+func (s *MemoryStore) Users() UserRepository       { return &memoryUserRepository{s} }
+func (s *MemoryStore) Posts() PostRepository       { return &memoryPostRepository{s} }
+func (s *MemoryStore) Tags() TagRepository         { return &memoryTagRepository{s} }
+func (s *MemoryStore) Comments() CommentRepository { return &memoryCommentRepository{s} }
+func (s *MemoryStore) Search() SearchIndex         { return &memorySearch{s} }
+func (s *MemoryStore) UnitOfWork() UnitOfWork      { return &memoryUnitOfWork{s} }
+
+// memorySnapshot est une copie du store, restaurée si une unité de travail échoue
+type memorySnapshot struct {
+	users      map[uint]User
+	posts      map[uint]Post
+	tags       map[uint]Tag
+	postTags   map[postTag]struct{}
+	comments   map[uint]Comment
+	nextUserID uint
+	nextPostID uint
+	nextTagID  uint
+	nextCommID uint
+
+	accounts      map[uint]Account
+	entries       map[uint]JournalEntry
+	lines         map[uint]JournalLine
+	nextAccountID uint
+	nextEntryID   uint
+	nextLineID    uint
+
+	transfers      map[uint]Transfer
+	nextTransferID uint
+	payments       map[uint]Payment
+	nextPaymentID  uint
+
+	webhookEndpoints  map[uint]WebhookEndpoint
+	webhookDeliveries map[uint]WebhookDelivery
+	webhookAttempts   map[uint]WebhookAttempt
+	nextEndpointID    uint
+	nextDeliveryID    uint
+	nextAttemptID     uint
+}
+
+func (s *MemoryStore) snapshot() memorySnapshot {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return memorySnapshot{
+		users:      maps.Clone(s.users),
+		posts:      maps.Clone(s.posts),
+		tags:       maps.Clone(s.tags),
+		postTags:   maps.Clone(s.postTags),
+		comments:   maps.Clone(s.comments),
+		nextUserID: s.nextUserID,
+		nextPostID: s.nextPostID,
+		nextTagID:  s.nextTagID,
+		nextCommID: s.nextCommID,
+
+		accounts:      maps.Clone(s.accounts),
+		entries:       maps.Clone(s.entries),
+		lines:         maps.Clone(s.lines),
+		nextAccountID: s.nextAccountID,
+		nextEntryID:   s.nextEntryID,
+		nextLineID:    s.nextLineID,
+
+		transfers:      maps.Clone(s.transfers),
+		nextTransferID: s.nextTransferID,
+		payments:       maps.Clone(s.payments),
+		nextPaymentID:  s.nextPaymentID,
+
+		webhookEndpoints:  maps.Clone(s.webhookEndpoints),
+		webhookDeliveries: maps.Clone(s.webhookDeliveries),
+		webhookAttempts:   maps.Clone(s.webhookAttempts),
+		nextEndpointID:    s.nextEndpointID,
+		nextDeliveryID:    s.nextDeliveryID,
+		nextAttemptID:     s.nextAttemptID,
+	}
+}
+
+func (s *MemoryStore) restore(snap memorySnapshot) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.users, s.posts, s.tags, s.postTags, s.comments = snap.users, snap.posts, snap.tags, snap.postTags, snap.comments
+	s.nextUserID, s.nextPostID, s.nextTagID, s.nextCommID = snap.nextUserID, snap.nextPostID, snap.nextTagID, snap.nextCommID
+	s.accounts, s.entries, s.lines = snap.accounts, snap.entries, snap.lines
+	s.nextAccountID, s.nextEntryID, s.nextLineID = snap.nextAccountID, snap.nextEntryID, snap.nextLineID
+	s.transfers, s.nextTransferID = snap.transfers, snap.nextTransferID
+	s.payments, s.nextPaymentID = snap.payments, snap.nextPaymentID
+	s.webhookEndpoints, s.webhookDeliveries, s.webhookAttempts = snap.webhookEndpoints, snap.webhookDeliveries, snap.webhookAttempts
+	s.nextEndpointID, s.nextDeliveryID, s.nextAttemptID = snap.nextEndpointID, snap.nextDeliveryID, snap.nextAttemptID
+}
+
+// postsOf retourne les posts d'un utilisateur triés par ID, hors corbeille
+// (verrou tenu)
+func (s *MemoryStore) postsOf(userID uint) []Post {
+	var posts []Post
+	for _, p := range s.posts {
+		if p.UserID == userID && !p.DeletedAt.Valid {
+			p.CommentsCount = s.commentsCount(p.ID)
+			posts = append(posts, p)
+		}
+	}
+	sort.Slice(posts, func(i, j int) bool { return posts[i].ID < posts[j].ID })
+	return posts
+}
+
+// tagsOf retourne les tags d'un post triés par ID (verrou tenu)
+func (s *MemoryStore) tagsOf(postID uint) []Tag {
+	var tags []Tag
+	for pt := range s.postTags {
+		if pt.PostID == postID {
+			tags = append(tags, s.tags[pt.TagID])
+		}
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i].ID < tags[j].ID })
+	return tags
+}
+
+// deletePost supprime définitivement le post, ses lignes de jointure et ses
+// commentaires (verrou tenu)
+func (s *MemoryStore) deletePost(id uint) {
+	delete(s.posts, id)
+	for pt := range s.postTags {
+		if pt.PostID == id {
+			delete(s.postTags, pt)
+		}
+	}
+	for _, c := range s.comments {
+		if c.PostID == id {
+			s.deleteComment(c.ID)
+		}
+	}
+}
+
+// deleteComment supprime le commentaire et ses réponses (verrou tenu)
+func (s *MemoryStore) deleteComment(id uint) {
+	delete(s.comments, id)
+	for _, c := range s.comments {
+		if c.ParentID != nil && *c.ParentID == id {
+			s.deleteComment(c.ID)
+		}
+	}
+}
+
+// commentsOf retourne les commentaires d'un post triés par ID, avec leur
+// auteur si withAuthor (verrou tenu)
+func (s *MemoryStore) commentsOf(postID uint, withAuthor bool) []Comment {
+	var comments []Comment
+	for _, c := range s.comments {
+		if c.PostID != postID {
+			continue
+		}
+		if u, ok := s.users[c.UserID]; ok && withAuthor && !u.DeletedAt.Valid {
+			c.User = &u
+		}
+		comments = append(comments, c)
+	}
+	sort.Slice(comments, func(i, j int) bool { return comments[i].ID < comments[j].ID })
+	return comments
+}
+
+// commentsCount compte les commentaires d'un post (verrou tenu)
+func (s *MemoryStore) commentsCount(postID uint) int64 {
+	var n int64
+	for _, c := range s.comments {
+		if c.PostID == postID {
+			n++
+		}
+	}
+	return n
+}
+
+// --- Users ---
+
+type memoryUserRepository struct {
+	s *MemoryStore
+}
+
+// withRelations attache les relations incluses par opts (verrou tenu) ; les
+// colonnes ne sont pas filtrées, la réponse HTTP l'est (fieldsets.go)
+func (r *memoryUserRepository) withRelations(u User, opts ReadOptions) User {
+	if opts.Includes("posts") {
+		u.Posts = r.s.postsOf(u.ID)
+		if opts.Includes("posts.tags") {
+			for i := range u.Posts {
+				u.Posts[i].Tags = r.s.tagsOf(u.Posts[i].ID)
+			}
+		}
+	}
+	return u
+}
+
+func (r *memoryUserRepository) List(_ context.Context, opts ReadOptions) ([]User, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	users := make([]User, 0, len(r.s.users))
+	for _, u := range r.s.users {
+		if opts.Shows(u.DeletedAt) && opts.Filter.Match(u) {
+			users = append(users, r.withRelations(u, opts))
+		}
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	return users, nil
+}
+
+func (r *memoryUserRepository) Get(_ context.Context, id uint, opts ReadOptions) (*User, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	u, ok := r.s.users[id]
+	if !ok || !opts.Shows(u.DeletedAt) {
+		return nil, ErrNotFound
+	}
+	u = r.withRelations(u, opts)
+	return &u, nil
+}
+
+func (r *memoryUserRepository) GetByEmail(_ context.Context, email string) (*User, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	for _, u := range r.s.users {
+		if strings.EqualFold(u.Email, email) && !u.DeletedAt.Valid {
+			return &u, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// emailTaken vérifie l'unicité de l'email, réservé jusqu'à la purge comme
+// avec l'index unique de la base (verrou tenu)
+func (r *memoryUserRepository) emailTaken(email string, exceptID uint) bool {
+	for _, u := range r.s.users {
+		if strings.EqualFold(u.Email, email) && u.ID != exceptID {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *memoryUserRepository) Create(_ context.Context, user *User) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if r.emailTaken(user.Email, 0) {
+		return &ConflictError{Field: "email"}
+	}
+
+	user.ID = r.s.nextUserID
+	r.s.nextUserID++
+	user.CreatedAt = time.Now()
+	user.UpdatedAt = user.CreatedAt
+
+	stored := *user
+	stored.Posts = nil
+	r.s.users[user.ID] = stored
+	return nil
+}
+
+func (r *memoryUserRepository) Update(_ context.Context, id uint, user *User, fields []string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	stored, ok := r.s.users[id]
+	if !ok || stored.DeletedAt.Valid {
+		return ErrNotFound
+	}
+	if slices.Contains(fields, "Email") && r.emailTaken(user.Email, id) {
+		return &ConflictError{Field: "email"}
+	}
+
+	copyFields(&stored, user, fields)
+	stored.UpdatedAt = time.Now()
+	r.s.users[id] = stored
+
+	*user = stored
+	return nil
+}
+
+// Delete met l'utilisateur à la corbeille comme softDelete (cascade.go) :
+// ses posts y vont avec lui si User.Posts est en cascade, restrict est
+// vérifié, le reste attend la purge
+func (r *memoryUserRepository) Delete(_ context.Context, id uint) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	u, ok := r.s.users[id]
+	if !ok || u.DeletedAt.Valid {
+		return nil
+	}
+	deleted := gorm.DeletedAt{Time: time.Now(), Valid: true}
+
+	var postIDs, commentIDs []uint
+	for _, p := range r.s.postsOf(id) {
+		postIDs = append(postIDs, p.ID)
+	}
+	for _, c := range r.s.comments {
+		if c.UserID == id {
+			commentIDs = append(commentIDs, c.ID)
+		}
+	}
+
+	err := r.trashPolicy(id, "Posts", postIDs, func(postID uint) {
+		p := r.s.posts[postID]
+		p.DeletedAt = deleted
+		r.s.posts[postID] = p
+	})
+	if err != nil {
+		return err
+	}
+	if err := r.trashPolicy(id, "Comments", commentIDs, nil); err != nil {
+		return err
+	}
+
+	u.DeletedAt = deleted
+	r.s.users[id] = u
+	return nil
+}
+
+// trashPolicy applique la politique de User.field à la mise à la corbeille
+// (verrou tenu) ; trash est nil quand les enfants n'ont pas de corbeille
+func (r *memoryUserRepository) trashPolicy(id uint, field string, children []uint, trash func(id uint)) error {
+	switch policy := onDeletePolicy(User{}, field); policy {
+	case "":
+	case OnDeleteCascade:
+		if trash != nil {
+			for _, child := range children {
+				trash(child)
+			}
+		}
+	case OnDeleteRestrict:
+		if len(children) > 0 {
+			return &RestrictError{Relation: "User." + field, Count: int64(len(children))}
+		}
+	case OnDeleteReassign:
+		if tomb, ok := r.findTombstone(); ok && tomb.ID == id {
+			return ErrTombstoneDelete
+		}
+	default:
+		return fmt.Errorf("User.%s : politique ondelete inconnue %q", field, policy)
+	}
+	return nil
+}
+
+func (r *memoryUserRepository) Restore(_ context.Context, id uint, withPosts bool) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	u, ok := r.s.users[id]
+	if !ok || !u.DeletedAt.Valid {
+		return ErrNotFound
+	}
+
+	// Posts mis à la corbeille avec l'utilisateur : même date de suppression
+	if withPosts && onDeletePolicy(User{}, "Posts") == OnDeleteCascade {
+		for postID, p := range r.s.posts {
+			if p.UserID == id && p.DeletedAt.Valid && p.DeletedAt.Time.Equal(u.DeletedAt.Time) {
+				p.DeletedAt = gorm.DeletedAt{}
+				r.s.posts[postID] = p
+			}
+		}
+	}
+
+	u.DeletedAt = gorm.DeletedAt{}
+	r.s.users[id] = u
+	return nil
+}
+
+func (r *memoryUserRepository) Purge(_ context.Context, before time.Time) (int64, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var purged int64
+	for id, u := range r.s.users {
+		if !u.DeletedAt.Valid || !u.DeletedAt.Time.Before(before) {
+			continue
+		}
+		if err := r.purge(id); err != nil {
+			return purged, err
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// purge supprime définitivement l'utilisateur en appliquant les politiques
+// ondelete de User.Posts et User.Comments ; les posts et commentaires
+// supprimés emportent leurs commentaires et réponses (verrou tenu)
+func (r *memoryUserRepository) purge(id uint) error {
+	var postIDs, commentIDs []uint
+	for _, p := range r.s.posts {
+		if p.UserID == id {
+			postIDs = append(postIDs, p.ID)
+		}
+	}
+	err := r.applyPolicy(id, "Posts", postIDs, r.s.deletePost, func(postID, to uint) {
+		p := r.s.posts[postID]
+		p.UserID = to
+		r.s.posts[postID] = p
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, c := range r.s.comments {
+		if c.UserID == id {
+			commentIDs = append(commentIDs, c.ID)
+		}
+	}
+	err = r.applyPolicy(id, "Comments", commentIDs, r.s.deleteComment, func(commentID, to uint) {
+		c := r.s.comments[commentID]
+		c.UserID = to
+		r.s.comments[commentID] = c
+	})
+	if err != nil {
+		return err
+	}
+
+	delete(r.s.users, id)
+	return nil
+}
+
+// applyPolicy applique aux enfants la politique déclarée sur User.field,
+// à la purge (verrou tenu)
+func (r *memoryUserRepository) applyPolicy(id uint, field string, children []uint,
+	remove func(id uint), reassign func(id, to uint)) error {
+	switch policy := onDeletePolicy(User{}, field); policy {
+	case "":
+	case OnDeleteCascade:
+		for _, child := range children {
+			remove(child)
+		}
+	case OnDeleteRestrict:
+		if len(children) > 0 {
+			return &RestrictError{Relation: "User." + field, Count: int64(len(children))}
+		}
+	case OnDeleteReassign:
+		if len(children) == 0 {
+			return nil
+		}
+		tomb := r.tombstone()
+		if tomb.ID == id {
+			return ErrTombstoneDelete
+		}
+		for _, child := range children {
+			reassign(child, tomb.ID)
+		}
+	default:
+		return fmt.Errorf("User.%s : politique ondelete inconnue %q", field, policy)
+	}
+	return nil
+}
+
+// findTombstone retrouve l'utilisateur de remplacement (verrou tenu)
+func (r *memoryUserRepository) findTombstone() (User, bool) {
+	tomb := User{}.Tombstone().(*User)
+	for _, u := range r.s.users {
+		if u.Email == tomb.Email {
+			return u, true
+		}
+	}
+	return User{}, false
+}
+
+// tombstone retrouve ou crée l'utilisateur de remplacement (verrou tenu)
+func (r *memoryUserRepository) tombstone() User {
+	if u, ok := r.findTombstone(); ok {
+		return u
+	}
+	tomb := *User{}.Tombstone().(*User)
+	tomb.ID = r.s.nextUserID
+	r.s.nextUserID++
+	r.s.users[tomb.ID] = tomb
+	return tomb
+}
+
+// --- Posts ---
+
+type memoryPostRepository struct {
+	s *MemoryStore
+}
+
+// withRelations calcule le nombre de commentaires du post et attache les
+// relations incluses par opts (verrou tenu)
+func (r *memoryPostRepository) withRelations(p Post, opts ReadOptions) Post {
+	p.CommentsCount = r.s.commentsCount(p.ID)
+	if u, ok := r.s.users[p.UserID]; ok && opts.Includes("user") && !u.DeletedAt.Valid {
+		p.User = &u
+	}
+	if opts.Includes("tags") {
+		p.Tags = r.s.tagsOf(p.ID)
+	}
+	if opts.Includes("comments") {
+		p.Comments = r.s.commentsOf(p.ID, opts.Includes("comments.user"))
+	}
+	return p
+}
+
+// matches applique le filtre par tags (verrou tenu)
+func (r *memoryPostRepository) matches(p Post, filter PostFilter) bool {
+	if len(filter.Tags) == 0 {
+		return true
+	}
+	found := 0
+	for _, t := range r.s.tagsOf(p.ID) {
+		if slices.Contains(filter.Tags, t.Name) {
+			found++
+		}
+	}
+	if filter.MatchAll {
+		return found == len(filter.Tags)
+	}
+	return found > 0
+}
+
+func (r *memoryPostRepository) List(_ context.Context, filter PostFilter, opts ReadOptions) ([]Post, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	posts := make([]Post, 0, len(r.s.posts))
+	for _, p := range r.s.posts {
+		if opts.Shows(p.DeletedAt) && r.matches(p, filter) && opts.Filter.Match(p) {
+			posts = append(posts, r.withRelations(p, opts))
+		}
+	}
+	sort.Slice(posts, func(i, j int) bool { return posts[i].ID < posts[j].ID })
+	return posts, nil
+}
+
+func (r *memoryPostRepository) Get(_ context.Context, id uint, opts ReadOptions) (*Post, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	p, ok := r.s.posts[id]
+	if !ok || !opts.Shows(p.DeletedAt) {
+		return nil, ErrNotFound
+	}
+	p = r.withRelations(p, opts)
+	return &p, nil
+}
+
+func (r *memoryPostRepository) ListByUser(_ context.Context, userID uint) ([]Post, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	return r.s.postsOf(userID), nil
+}
+
+func (r *memoryPostRepository) Create(_ context.Context, post *Post) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	post.ID = r.s.nextPostID
+	r.s.nextPostID++
+	post.CreatedAt = time.Now()
+	post.UpdatedAt = post.CreatedAt
+
+	stored := *post
+	stored.User, stored.Tags, stored.Comments = nil, nil, nil
+	r.s.posts[post.ID] = stored
+	return nil
+}
+
+func (r *memoryPostRepository) Update(_ context.Context, id uint, post *Post, fields []string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	stored, ok := r.s.posts[id]
+	if !ok || stored.DeletedAt.Valid {
+		return ErrNotFound
+	}
+
+	copyFields(&stored, post, fields)
+	stored.UpdatedAt = time.Now()
+	r.s.posts[id] = stored
+
+	*post = r.withRelations(stored, ReadOptions{})
+	return nil
+}
+
+// Delete met le post à la corbeille ; commentaires et tags restent en place
+func (r *memoryPostRepository) Delete(_ context.Context, id uint) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if p, ok := r.s.posts[id]; ok && !p.DeletedAt.Valid {
+		p.DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+		r.s.posts[id] = p
+	}
+	return nil
+}
+
+func (r *memoryPostRepository) Restore(_ context.Context, id uint) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	p, ok := r.s.posts[id]
+	if !ok || !p.DeletedAt.Valid {
+		return ErrNotFound
+	}
+	p.DeletedAt = gorm.DeletedAt{}
+	r.s.posts[id] = p
+	return nil
+}
+
+func (r *memoryPostRepository) Purge(_ context.Context, before time.Time) (int64, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var purged int64
+	for id, p := range r.s.posts {
+		if p.DeletedAt.Valid && p.DeletedAt.Time.Before(before) {
+			r.s.deletePost(id)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+func (r *memoryPostRepository) AttachTags(_ context.Context, postID uint, tags []Tag) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, t := range tags {
+		r.s.postTags[postTag{PostID: postID, TagID: t.ID}] = struct{}{}
+	}
+	return nil
+}
+
+func (r *memoryPostRepository) DetachTags(_ context.Context, postID uint, tags []Tag) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, t := range tags {
+		delete(r.s.postTags, postTag{PostID: postID, TagID: t.ID})
+	}
+	return nil
+}
+
+// --- Tags ---
+
+type memoryTagRepository struct {
+	s *MemoryStore
+}
+
+func (r *memoryTagRepository) List(_ context.Context) ([]TagCount, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	counts := map[uint]int64{}
+	for pt := range r.s.postTags {
+		if !r.s.posts[pt.PostID].DeletedAt.Valid {
+			counts[pt.TagID]++
+		}
+	}
+
+	tags := make([]TagCount, 0, len(r.s.tags))
+	for _, t := range r.s.tags {
+		tags = append(tags, TagCount{Tag: t, PostsCount: counts[t.ID]})
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i].Name < tags[j].Name })
+	return tags, nil
+}
+
+func (r *memoryTagRepository) GetByNames(_ context.Context, names []string) ([]Tag, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	var tags []Tag
+	for _, t := range r.s.tags {
+		if slices.Contains(names, t.Name) {
+			tags = append(tags, t)
+		}
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i].ID < tags[j].ID })
+	return tags, nil
+}
+
+func (r *memoryTagRepository) Create(_ context.Context, tag *Tag) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, t := range r.s.tags {
+		if t.Name == tag.Name {
+			return &ConflictError{Field: "name"}
+		}
+	}
+
+	tag.ID = r.s.nextTagID
+	r.s.nextTagID++
+
+	stored := *tag
+	stored.Posts = nil
+	r.s.tags[tag.ID] = stored
+	return nil
+}
+
+// copyFields copie les champs nommés de src vers dst (mêmes types pointés),
+// valeurs zéro comprises, comme Select(fields).Updates de GORM
+func copyFields(dst, src interface{}, fields []string) {
+	d, v := reflect.ValueOf(dst).Elem(), reflect.ValueOf(src).Elem()
+	for _, name := range fields {
+		d.FieldByName(name).Set(v.FieldByName(name))
+	}
+}
+
+// --- Comments ---
+
+type memoryCommentRepository struct {
+	s *MemoryStore
+}
+
+// withAuthor attache l'auteur au commentaire, sauf s'il est à la corbeille
+// (verrou tenu)
+func (r *memoryCommentRepository) withAuthor(c Comment) Comment {
+	if u, ok := r.s.users[c.UserID]; ok && !u.DeletedAt.Valid {
+		c.User = &u
+	}
+	return c
+}
+
+func (r *memoryCommentRepository) ListByPost(_ context.Context, postID uint) ([]Comment, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	return r.s.commentsOf(postID, true), nil
+}
+
+func (r *memoryCommentRepository) Get(_ context.Context, id uint) (*Comment, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	c, ok := r.s.comments[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	c = r.withAuthor(c)
+	return &c, nil
+}
+
+func (r *memoryCommentRepository) Create(_ context.Context, comment *Comment) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	comment.ID = r.s.nextCommID
+	r.s.nextCommID++
+	comment.CreatedAt = time.Now()
+	comment.UpdatedAt = comment.CreatedAt
+
+	stored := *comment
+	stored.User, stored.Replies = nil, nil
+	r.s.comments[comment.ID] = stored
+	return nil
+}
+
+func (r *memoryCommentRepository) Update(_ context.Context, id uint, comment *Comment, fields []string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	stored, ok := r.s.comments[id]
+	if !ok {
+		return ErrNotFound
+	}
+
+	copyFields(&stored, comment, fields)
+	stored.UpdatedAt = time.Now()
+	r.s.comments[id] = stored
+
+	*comment = r.withAuthor(stored)
+	return nil
+}
+
+func (r *memoryCommentRepository) Delete(_ context.Context, id uint) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	r.s.deleteComment(id)
+	return nil
+}
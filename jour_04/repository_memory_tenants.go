@@ -0,0 +1,334 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+)
+
+// === MULTI-TENANT EN MÉMOIRE ===
+//
+// Un MemoryStore par tenant, créé au premier accès : l'isolation vient de la
+// séparation des données plutôt que d'un filtre (voir tenant.go pour GORM).
+// Les IDs sont donc propres à chaque tenant. Chaque appel est aiguillé vers
+// le store du tenant de son contexte ; sans tenant, ErrNoTenant.
+
+type MemoryTenants struct {
+	mu     sync.Mutex
+	stores map[string]*MemoryStore
+}
+
+func NewMemoryTenants() *MemoryTenants {
+	return &MemoryTenants{stores: map[string]*MemoryStore{}}
+}
+
+func (t *MemoryTenants) Users() UserRepository       { return &tenantUserRepository{t} }
+func (t *MemoryTenants) Posts() PostRepository       { return &tenantPostRepository{t} }
+func (t *MemoryTenants) Tags() TagRepository         { return &tenantTagRepository{t} }
+func (t *MemoryTenants) Comments() CommentRepository { return &tenantCommentRepository{t} }
+func (t *MemoryTenants) Search() SearchIndex         { return &tenantSearch{t} }
+func (t *MemoryTenants) UnitOfWork() UnitOfWork      { return &tenantUnitOfWork{t} }
+func (t *MemoryTenants) Directory() TenantDirectory  { return t }
+
+// store retourne le store du tenant de ctx (et son nom)
+func (t *MemoryTenants) store(ctx context.Context) (*MemoryStore, string, error) {
+	tenant, ok := tenantOf(ctx)
+	if !ok {
+		return nil, "", ErrNoTenant
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s, ok := t.stores[tenant]
+	if !ok {
+		s = NewMemoryStore()
+		t.stores[tenant] = s
+	}
+	return s, tenant, nil
+}
+
+// allStores : copie des stores de tous les tenants (requêtes de maintenance)
+func (t *MemoryTenants) allStores() []*MemoryStore {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	stores := make([]*MemoryStore, 0, len(t.stores))
+	for _, s := range t.stores {
+		stores = append(stores, s)
+	}
+	return stores
+}
+
+// List : tenants ayant au moins un utilisateur, corbeille comprise
+func (t *MemoryTenants) List(context.Context) ([]string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var tenants []string
+	for tenant, s := range t.stores {
+		s.mu.RLock()
+		if len(s.users) > 0 {
+			tenants = append(tenants, tenant)
+		}
+		s.mu.RUnlock()
+	}
+	slices.Sort(tenants)
+	return tenants, nil
+}
+
+type tenantUserRepository struct {
+	t *MemoryTenants
+}
+
+func (r *tenantUserRepository) List(ctx context.Context, opts ReadOptions) ([]User, error) {
+	s, _, err := r.t.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.Users().List(ctx, opts)
+}
+
+func (r *tenantUserRepository) Get(ctx context.Context, id uint, opts ReadOptions) (*User, error) {
+	s, _, err := r.t.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.Users().Get(ctx, id, opts)
+}
+
+func (r *tenantUserRepository) GetByEmail(ctx context.Context, email string) (*User, error) {
+	s, _, err := r.t.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.Users().GetByEmail(ctx, email)
+}
+
+func (r *tenantUserRepository) Create(ctx context.Context, user *User) error {
+	s, tenant, err := r.t.store(ctx)
+	if err != nil {
+		return err
+	}
+	user.TenantID = tenant
+	return s.Users().Create(ctx, user)
+}
+
+func (r *tenantUserRepository) Update(ctx context.Context, id uint, user *User, fields []string) error {
+	s, _, err := r.t.store(ctx)
+	if err != nil {
+		return err
+	}
+	return s.Users().Update(ctx, id, user, fields)
+}
+
+func (r *tenantUserRepository) Delete(ctx context.Context, id uint) error {
+	s, _, err := r.t.store(ctx)
+	if err != nil {
+		return err
+	}
+	return s.Users().Delete(ctx, id)
+}
+
+func (r *tenantUserRepository) Restore(ctx context.Context, id uint, withPosts bool) error {
+	s, _, err := r.t.store(ctx)
+	if err != nil {
+		return err
+	}
+	return s.Users().Restore(ctx, id, withPosts)
+}
+
+func (r *tenantUserRepository) Purge(ctx context.Context, before time.Time) (int64, error) {
+	s, _, err := r.t.store(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return s.Users().Purge(ctx, before)
+}
+
+type tenantPostRepository struct {
+	t *MemoryTenants
+}
+
+func (r *tenantPostRepository) List(ctx context.Context, filter PostFilter, opts ReadOptions) ([]Post, error) {
+	s, _, err := r.t.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.Posts().List(ctx, filter, opts)
+}
+
+func (r *tenantPostRepository) Get(ctx context.Context, id uint, opts ReadOptions) (*Post, error) {
+	s, _, err := r.t.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.Posts().Get(ctx, id, opts)
+}
+
+func (r *tenantPostRepository) ListByUser(ctx context.Context, userID uint) ([]Post, error) {
+	s, _, err := r.t.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.Posts().ListByUser(ctx, userID)
+}
+
+func (r *tenantPostRepository) Create(ctx context.Context, post *Post) error {
+	s, tenant, err := r.t.store(ctx)
+	if err != nil {
+		return err
+	}
+	post.TenantID = tenant
+	return s.Posts().Create(ctx, post)
+}
+
+func (r *tenantPostRepository) Update(ctx context.Context, id uint, post *Post, fields []string) error {
+	s, _, err := r.t.store(ctx)
+	if err != nil {
+		return err
+	}
+	return s.Posts().Update(ctx, id, post, fields)
+}
+
+func (r *tenantPostRepository) Delete(ctx context.Context, id uint) error {
+	s, _, err := r.t.store(ctx)
+	if err != nil {
+		return err
+	}
+	return s.Posts().Delete(ctx, id)
+}
+
+func (r *tenantPostRepository) Restore(ctx context.Context, id uint) error {
+	s, _, err := r.t.store(ctx)
+	if err != nil {
+		return err
+	}
+	return s.Posts().Restore(ctx, id)
+}
+
+func (r *tenantPostRepository) Purge(ctx context.Context, before time.Time) (int64, error) {
+	s, _, err := r.t.store(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return s.Posts().Purge(ctx, before)
+}
+
+func (r *tenantPostRepository) AttachTags(ctx context.Context, postID uint, tags []Tag) error {
+	s, _, err := r.t.store(ctx)
+	if err != nil {
+		return err
+	}
+	return s.Posts().AttachTags(ctx, postID, tags)
+}
+
+func (r *tenantPostRepository) DetachTags(ctx context.Context, postID uint, tags []Tag) error {
+	s, _, err := r.t.store(ctx)
+	if err != nil {
+		return err
+	}
+	return s.Posts().DetachTags(ctx, postID, tags)
+}
+
+type tenantTagRepository struct {
+	t *MemoryTenants
+}
+
+func (r *tenantTagRepository) List(ctx context.Context) ([]TagCount, error) {
+	s, _, err := r.t.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.Tags().List(ctx)
+}
+
+func (r *tenantTagRepository) GetByNames(ctx context.Context, names []string) ([]Tag, error) {
+	s, _, err := r.t.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.Tags().GetByNames(ctx, names)
+}
+
+func (r *tenantTagRepository) Create(ctx context.Context, tag *Tag) error {
+	s, tenant, err := r.t.store(ctx)
+	if err != nil {
+		return err
+	}
+	tag.TenantID = tenant
+	return s.Tags().Create(ctx, tag)
+}
+
+type tenantCommentRepository struct {
+	t *MemoryTenants
+}
+
+func (r *tenantCommentRepository) ListByPost(ctx context.Context, postID uint) ([]Comment, error) {
+	s, _, err := r.t.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.Comments().ListByPost(ctx, postID)
+}
+
+func (r *tenantCommentRepository) Get(ctx context.Context, id uint) (*Comment, error) {
+	s, _, err := r.t.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.Comments().Get(ctx, id)
+}
+
+func (r *tenantCommentRepository) Create(ctx context.Context, comment *Comment) error {
+	s, tenant, err := r.t.store(ctx)
+	if err != nil {
+		return err
+	}
+	comment.TenantID = tenant
+	return s.Comments().Create(ctx, comment)
+}
+
+func (r *tenantCommentRepository) Update(ctx context.Context, id uint, comment *Comment, fields []string) error {
+	s, _, err := r.t.store(ctx)
+	if err != nil {
+		return err
+	}
+	return s.Comments().Update(ctx, id, comment, fields)
+}
+
+func (r *tenantCommentRepository) Delete(ctx context.Context, id uint) error {
+	s, _, err := r.t.store(ctx)
+	if err != nil {
+		return err
+	}
+	return s.Comments().Delete(ctx, id)
+}
+
+type tenantSearch struct {
+	t *MemoryTenants
+}
+
+func (r *tenantSearch) Search(ctx context.Context, query string, limit int) ([]SearchHit, error) {
+	s, _, err := r.t.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.Search().Search(ctx, query, limit)
+}
+
+func (r *tenantSearch) Reindex(context.Context) error { return nil }
+
+// tenantUnitOfWork : unité de travail sur le store du tenant ; les unités de
+// travail de tenants différents ne se bloquent pas
+type tenantUnitOfWork struct {
+	t *MemoryTenants
+}
+
+func (u *tenantUnitOfWork) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	s, _, err := u.t.store(ctx)
+	if err != nil {
+		return err
+	}
+	return s.UnitOfWork().Do(ctx, fn)
+}
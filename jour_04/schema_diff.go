@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// appModels liste les modèles couverts par `migrate diff`
+func appModels() []interface{} {
+	return []interface{}{&User{}, &Post{}, &Tag{}, &Comment{}, &FeatureFlag{},
+		&Account{}, &JournalEntry{}, &JournalLine{}, &Transfer{}, &Payment{},
+		&WebhookEndpoint{}, &WebhookDelivery{}, &WebhookAttempt{}}
+}
+
+// sqlCapture est un logger GORM qui collecte le SQL d'une session DryRun
+type sqlCapture struct {
+	statements []string
+}
+
+func (c *sqlCapture) LogMode(logger.LogLevel) logger.Interface      { return c }
+func (c *sqlCapture) Info(context.Context, string, ...interface{})  {}
+func (c *sqlCapture) Warn(context.Context, string, ...interface{})  {}
+func (c *sqlCapture) Error(context.Context, string, ...interface{}) {}
+
+func (c *sqlCapture) Trace(_ context.Context, _ time.Time, fc func() (string, int64), _ error) {
+	sql, _ := fc()
+	c.statements = append(c.statements, sql+";")
+}
+
+// drain retourne et vide le SQL collecté
+func (c *sqlCapture) drain() []string {
+	out := c.statements
+	c.statements = nil
+	return out
+}
+
+// diffSchema compare les modèles à la base réelle et produit un brouillon
+// de migration (up/down) dans le dialecte courant. Seuls les ajouts sont
+// générés ; les colonnes en trop dans la base sont signalées en commentaire.
+func diffSchema(conn *gorm.DB, models []interface{}) (string, string, error) {
+	capture := &sqlCapture{}
+	dry := conn.Session(&gorm.Session{DryRun: true, Logger: capture})
+	live := conn.Migrator()
+
+	var up, down []string
+
+	for _, model := range models {
+		stmt := &gorm.Statement{DB: conn}
+		if err := stmt.Parse(model); err != nil {
+			return "", "", err
+		}
+		sch := stmt.Schema
+		table := stmt.Quote(sch.Table)
+
+		if !live.HasTable(model) {
+			if err := dry.Migrator().CreateTable(model); err != nil {
+				return "", "", err
+			}
+			up = append(up, "-- Table "+sch.Table)
+			up = append(up, capture.drain()...)
+			down = append([]string{"DROP TABLE " + table + ";"}, down...)
+			continue
+		}
+
+		// Colonnes manquantes
+		for _, field := range sch.Fields {
+			if field.DBName == "" || field.IgnoreMigration || live.HasColumn(model, field.DBName) {
+				continue
+			}
+			if err := dry.Migrator().AddColumn(model, field.Name); err != nil {
+				return "", "", err
+			}
+			up = append(up, fmt.Sprintf("-- Colonne %s.%s", sch.Table, field.DBName))
+			up = append(up, capture.drain()...)
+			down = append([]string{fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s;", table, stmt.Quote(field.DBName))}, down...)
+		}
+
+		// Index manquants
+		for _, idx := range sch.ParseIndexes() {
+			if live.HasIndex(model, idx.Name) {
+				continue
+			}
+			if err := dry.Migrator().CreateIndex(model, idx.Name); err != nil {
+				return "", "", err
+			}
+			up = append(up, "-- Index "+idx.Name)
+			up = append(up, capture.drain()...)
+			if err := dry.Migrator().DropIndex(model, idx.Name); err != nil {
+				return "", "", err
+			}
+			down = append(capture.drain(), down...)
+		}
+
+		// Colonnes présentes en base mais absentes du modèle
+		columns, err := live.ColumnTypes(model)
+		if err != nil {
+			return "", "", err
+		}
+		for _, col := range columns {
+			if sch.LookUpField(col.Name()) == nil {
+				up = append(up, fmt.Sprintf("-- Colonne %s.%s absente du modèle, à supprimer ?", sch.Table, col.Name()))
+				up = append(up, fmt.Sprintf("-- ALTER TABLE %s DROP COLUMN %s;", table, stmt.Quote(col.Name())))
+			}
+		}
+	}
+
+	if len(up) == 0 {
+		return "", "", nil
+	}
+
+	header := fmt.Sprintf("-- Brouillon généré par `migrate diff` (%s) : à relire avant application\n", dialect.Label())
+	return header + strings.Join(up, "\n") + "\n", strings.Join(down, "\n") + "\n", nil
+}
@@ -0,0 +1,410 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"gorm.io/gorm"
+)
+
+// === RECHERCHE PLEIN TEXTE ===
+//
+// Une implémentation par base, choisie avec le driver :
+//   - SQLite     : table FTS5 posts_fts synchronisée par triggers ; sans
+//     FTS5 (binaire compilé sans -tags sqlite_fts5), migration sautée et
+//     recherche par LIKE, sans index
+//   - PostgreSQL : index GIN sur un tsvector français + anglais
+//   - MySQL      : index FULLTEXT InnoDB
+//
+// Dans les trois cas l'index est tenu à jour par la base elle-même à chaque
+// INSERT, UPDATE et DELETE sur posts (suppressions en cascade comprises) ;
+// Reindex le reconstruit entièrement (commande `reindex`). Les posts à la
+// corbeille restent indexés jusqu'à la purge mais sont exclus des résultats.
+// L'index couvre tous les tenants : chaque requête filtre posts.tenant_id.
+
+// SearchHit est un post trouvé, avec sa pertinence (plus grand = meilleur)
+// et des extraits où les termes trouvés sont entourés de <mark></mark>
+type SearchHit struct {
+	Post           Post    `gorm:"embedded" json:"post"`
+	Relevance      float64 `json:"relevance"`
+	TitleHighlight string  `json:"title_highlight"`
+	Snippet        string  `json:"snippet"`
+}
+
+type SearchIndex interface {
+	// Search retourne au plus limit posts contenant tous les termes de query
+	Search(ctx context.Context, query string, limit int) ([]SearchHit, error)
+	// Reindex reconstruit l'index depuis la table posts
+	Reindex(ctx context.Context) error
+}
+
+var (
+	ErrNoFTS5            = errors.New("SQLite compilé sans FTS5 (-tags sqlite_fts5)")
+	ErrSearchUnavailable = errors.New("base indexée avec FTS5 (posts_fts) : compiler avec -tags sqlite_fts5")
+)
+
+// newSearchIndex retourne l'implémentation du dialecte ; sur SQLite, la
+// recherche par LIKE tant que posts_fts n'existe pas
+func newSearchIndex(conn *gorm.DB, d Dialect) SearchIndex {
+	switch d.Name() {
+	case "postgres":
+		return &postgresSearch{db: conn}
+	case "mysql":
+		return &mysqlSearch{db: conn}
+	}
+	if !conn.Migrator().HasTable("posts_fts") {
+		return &likeSearch{db: conn}
+	}
+	return &sqliteSearch{db: conn}
+}
+
+// requireFTS5 : condition de la migration add_posts_search. FTS5 n'est
+// compilé dans go-sqlite3 qu'avec le tag sqlite_fts5 ; sans lui la
+// migration reste en attente et la recherche passe par LIKE.
+func requireFTS5(tx *gorm.DB) error {
+	if tx.Dialector.Name() != "sqlite" {
+		return nil
+	}
+	var enabled bool
+	if err := tx.Raw("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&enabled).Error; err != nil {
+		return err
+	}
+	if !enabled {
+		return ErrNoFTS5
+	}
+	return nil
+}
+
+// checkSearchSupport refuse une base SQLite déjà indexée avec FTS5 quand le
+// binaire ne l'a pas : les triggers de posts_fts feraient échouer toute
+// écriture sur posts
+func checkSearchSupport(conn *gorm.DB, d Dialect) error {
+	if d.Name() != "sqlite" || !conn.Migrator().HasTable("posts_fts") {
+		return nil
+	}
+	err := requireFTS5(conn)
+	if errors.Is(err, ErrNoFTS5) {
+		return ErrSearchUnavailable
+	}
+	return err
+}
+
+// scoreTerms : pertinence calculée hors de la base, occurrences des termes
+// (celles du titre comptant triple) ; 0 si un terme manque
+func scoreTerms(title, content string, terms []string) float64 {
+	title, content = strings.ToLower(title), strings.ToLower(content)
+	relevance := 0.0
+	for _, t := range terms {
+		t = strings.ToLower(t)
+		n := 3*strings.Count(title, t) + strings.Count(content, t)
+		if n == 0 {
+			return 0
+		}
+		relevance += float64(n)
+	}
+	return relevance
+}
+
+// sortHits trie par pertinence décroissante puis par ID et garde limit résultats
+func sortHits(hits []SearchHit, limit int) []SearchHit {
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Relevance != hits[j].Relevance {
+			return hits[i].Relevance > hits[j].Relevance
+		}
+		return hits[i].Post.ID < hits[j].Post.ID
+	})
+	if len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return hits
+}
+
+// searchTerms découpe la requête en mots (lettres et chiffres)
+func searchTerms(query string) []string {
+	return strings.FieldsFunc(query, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// searchSelect : colonnes communes aux requêtes de recherche
+const searchSelect = "posts.*, " + commentsCountColumn
+
+// --- SQLite (FTS5) ---
+
+type sqliteSearch struct {
+	db *gorm.DB
+}
+
+func (s *sqliteSearch) Search(ctx context.Context, query string, limit int) ([]SearchHit, error) {
+	// Chaque terme entre guillemets : la syntaxe FTS5 de l'utilisateur n'est
+	// pas interprétée, et les termes sont combinés en ET
+	terms := searchTerms(query)
+	for i, t := range terms {
+		terms[i] = `"` + t + `"`
+	}
+
+	tenant, ok := tenantOf(ctx)
+	if !ok {
+		return nil, ErrNoTenant
+	}
+
+	var hits []SearchHit
+	err := dbFromContext(ctx, s.db).Raw(`
+		SELECT `+searchSelect+`,
+		       -bm25(posts_fts, 10.0, 1.0) AS relevance,
+		       highlight(posts_fts, 0, '<mark>', '</mark>') AS title_highlight,
+		       snippet(posts_fts, 1, '<mark>', '</mark>', '…', 16) AS snippet
+		FROM posts_fts
+		JOIN posts ON posts.id = posts_fts.rowid
+		WHERE posts_fts MATCH ? AND posts.deleted_at IS NULL AND posts.tenant_id = ?
+		ORDER BY relevance DESC, posts.id
+		LIMIT ?`, strings.Join(terms, " "), tenant, limit).Scan(&hits).Error
+	return hits, err
+}
+
+func (s *sqliteSearch) Reindex(ctx context.Context) error {
+	return dbFromContext(ctx, s.db).Exec("INSERT INTO posts_fts(posts_fts) VALUES ('rebuild')").Error
+}
+
+// --- SQLite sans FTS5 (LIKE) ---
+
+// likeSearch parcourt les posts contenant chaque terme (LIKE, insensible à
+// la casse pour l'ASCII seulement, accents compris) : pas d'index, pour le
+// développement avec un binaire compilé sans -tags sqlite_fts5.
+// Pertinence et extraits calculés comme en mémoire.
+type likeSearch struct {
+	db *gorm.DB
+}
+
+func (s *likeSearch) Search(ctx context.Context, query string, limit int) ([]SearchHit, error) {
+	terms := searchTerms(query)
+	if len(terms) == 0 {
+		return nil, nil
+	}
+
+	tenant, ok := tenantOf(ctx)
+	if !ok {
+		return nil, ErrNoTenant
+	}
+
+	// Les termes ne contiennent que des lettres et des chiffres : ni % ni _
+	tx := dbFromContext(ctx, s.db).Table("posts").Select(searchSelect).
+		Where("posts.deleted_at IS NULL AND posts.tenant_id = ?", tenant)
+	for _, t := range terms {
+		like := "%" + t + "%"
+		tx = tx.Where("(posts.title LIKE ? OR posts.content LIKE ?)", like, like)
+	}
+	var hits []SearchHit
+	if err := tx.Scan(&hits).Error; err != nil {
+		return nil, err
+	}
+
+	matched := hits[:0]
+	for _, hit := range hits {
+		// LIKE ignore la casse ASCII, strings.ToLower toutes les autres :
+		// un post retenu par la base peut ne pas l'être ici, jamais l'inverse
+		if hit.Relevance = scoreTerms(hit.Post.Title, hit.Post.Content, terms); hit.Relevance == 0 {
+			continue
+		}
+		hit.TitleHighlight = highlightTerms(hit.Post.Title, terms)
+		hit.Snippet = snippetAround(hit.Post.Content, terms, 16)
+		matched = append(matched, hit)
+	}
+	return sortHits(matched, limit), nil
+}
+
+func (s *likeSearch) Reindex(context.Context) error { return nil }
+
+// --- PostgreSQL (tsvector + GIN) ---
+
+// pgSearchVector doit rester identique à l'expression de idx_posts_search
+// (migration add_posts_search) pour que l'index soit utilisé
+const pgSearchVector = `(
+    setweight(to_tsvector('french', coalesce(title, '')), 'A') ||
+    setweight(to_tsvector('english', coalesce(title, '')), 'A') ||
+    setweight(to_tsvector('french', coalesce(content, '')), 'B') ||
+    setweight(to_tsvector('english', coalesce(content, '')), 'B')
+)`
+
+type postgresSearch struct {
+	db *gorm.DB
+}
+
+func (s *postgresSearch) Search(ctx context.Context, query string, limit int) ([]SearchHit, error) {
+	// Requête analysée en français et en anglais : un terme trouve ses
+	// variantes dans les deux langues (« recherches » → « recherch »)
+	text := strings.Join(searchTerms(query), " ")
+
+	tenant, ok := tenantOf(ctx)
+	if !ok {
+		return nil, ErrNoTenant
+	}
+
+	var hits []SearchHit
+	err := dbFromContext(ctx, s.db).Raw(`
+		WITH q AS (
+		    SELECT plainto_tsquery('french', ?) || plainto_tsquery('english', ?) AS query
+		)
+		SELECT `+searchSelect+`,
+		       ts_rank(`+pgSearchVector+`, q.query) AS relevance,
+		       ts_headline('french', posts.title, q.query,
+		                   'StartSel=<mark>, StopSel=</mark>, HighlightAll=true') AS title_highlight,
+		       ts_headline('french', coalesce(posts.content, ''), q.query,
+		                   'StartSel=<mark>, StopSel=</mark>, MaxWords=16, MinWords=6') AS snippet
+		FROM posts, q
+		WHERE `+pgSearchVector+` @@ q.query AND posts.deleted_at IS NULL AND posts.tenant_id = ?
+		ORDER BY relevance DESC, posts.id
+		LIMIT ?`, text, text, tenant, limit).Scan(&hits).Error
+	return hits, err
+}
+
+func (s *postgresSearch) Reindex(ctx context.Context) error {
+	return dbFromContext(ctx, s.db).Exec("REINDEX INDEX idx_posts_search").Error
+}
+
+// --- MySQL (FULLTEXT) ---
+
+type mysqlSearch struct {
+	db *gorm.DB
+}
+
+func (s *mysqlSearch) Search(ctx context.Context, query string, limit int) ([]SearchHit, error) {
+	// Mode booléen : +terme exige chaque terme, * accepte les mots plus longs
+	terms := searchTerms(query)
+	boolean := make([]string, len(terms))
+	for i, t := range terms {
+		boolean[i] = "+" + t + "*"
+	}
+	against := strings.Join(boolean, " ")
+
+	tenant, ok := tenantOf(ctx)
+	if !ok {
+		return nil, ErrNoTenant
+	}
+
+	var hits []SearchHit
+	err := dbFromContext(ctx, s.db).Raw(`
+		SELECT `+searchSelect+`,
+		       MATCH(posts.title, posts.content) AGAINST (? IN BOOLEAN MODE) AS relevance
+		FROM posts
+		WHERE MATCH(posts.title, posts.content) AGAINST (? IN BOOLEAN MODE) AND posts.deleted_at IS NULL AND posts.tenant_id = ?
+		ORDER BY relevance DESC, posts.id
+		LIMIT ?`, against, against, tenant, limit).Scan(&hits).Error
+	if err != nil {
+		return nil, err
+	}
+
+	// MySQL n'a pas d'équivalent à highlight/snippet : extraits calculés ici
+	for i := range hits {
+		hits[i].TitleHighlight = highlightTerms(hits[i].Post.Title, terms)
+		hits[i].Snippet = snippetAround(hits[i].Post.Content, terms, 16)
+	}
+	return hits, nil
+}
+
+// Reindex reconstruit la table, index FULLTEXT compris
+func (s *mysqlSearch) Reindex(ctx context.Context) error {
+	return dbFromContext(ctx, s.db).Exec("ALTER TABLE posts ENGINE=InnoDB").Error
+}
+
+// --- Mémoire ---
+
+// memorySearch parcourt les posts du store : toujours à jour, sans index.
+// Pertinence : scoreTerms.
+type memorySearch struct {
+	s *MemoryStore
+}
+
+func (m *memorySearch) Search(_ context.Context, query string, limit int) ([]SearchHit, error) {
+	terms := searchTerms(query)
+
+	m.s.mu.RLock()
+	defer m.s.mu.RUnlock()
+
+	var hits []SearchHit
+	for _, p := range m.s.posts {
+		if p.DeletedAt.Valid {
+			continue
+		}
+		relevance := scoreTerms(p.Title, p.Content, terms)
+		if relevance == 0 {
+			continue
+		}
+
+		p.CommentsCount = m.s.commentsCount(p.ID)
+		hits = append(hits, SearchHit{
+			Post:           p,
+			Relevance:      relevance,
+			TitleHighlight: highlightTerms(p.Title, terms),
+			Snippet:        snippetAround(p.Content, terms, 16),
+		})
+	}
+	return sortHits(hits, limit), nil
+}
+
+func (m *memorySearch) Reindex(context.Context) error { return nil }
+
+// --- Extraits ---
+
+// termsRegex reconnaît les termes (insensible à la casse)
+func termsRegex(terms []string) *regexp.Regexp {
+	quoted := make([]string, len(terms))
+	for i, t := range terms {
+		quoted[i] = regexp.QuoteMeta(t)
+	}
+	return regexp.MustCompile(`(?i)(` + strings.Join(quoted, "|") + `)`)
+}
+
+// highlightTerms entoure chaque occurrence des termes de <mark></mark>
+func highlightTerms(text string, terms []string) string {
+	if len(terms) == 0 {
+		return text
+	}
+	return termsRegex(terms).ReplaceAllString(text, "<mark>${1}</mark>")
+}
+
+// snippetAround extrait au plus maxWords mots autour de la première
+// occurrence d'un terme, surlignés
+func snippetAround(text string, terms []string, maxWords int) string {
+	words := strings.Fields(text)
+	if len(words) == 0 || len(terms) == 0 {
+		return text
+	}
+
+	re := termsRegex(terms)
+	first := 0
+	for i, w := range words {
+		if re.MatchString(w) {
+			first = i
+			break
+		}
+	}
+
+	start := max(0, first-maxWords/2)
+	end := min(len(words), start+maxWords)
+	start = max(0, end-maxWords)
+
+	snippet := highlightTerms(strings.Join(words[start:end], " "), terms)
+	if start > 0 {
+		snippet = "…" + snippet
+	}
+	if end < len(words) {
+		snippet += "…"
+	}
+	return snippet
+}
+
+// reindexPosts reconstruit l'index et retourne le nombre de posts indexés
+func reindexPosts(ctx context.Context, conn *gorm.DB, d Dialect) (int64, error) {
+	if err := newSearchIndex(conn, d).Reindex(ctx); err != nil {
+		return 0, fmt.Errorf("reindex %s: %w", d.Label(), err)
+	}
+	var count int64
+	err := conn.WithContext(allTenants(ctx)).Model(&Post{}).Count(&count).Error
+	return count, err
+}
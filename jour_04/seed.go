@@ -0,0 +1,519 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"golang.org/x/text/unicode/norm"
+	"gopkg.in/yaml.v3"
+)
+
+// === FIXTURES ===
+//
+// Une fixture décrit un état connu de la base (users, tags, posts,
+// commentaires) dans un fichier YAML ou JSON. Les enregistrements se
+// désignent par des références (ref) et non par des IDs : la même fixture se
+// charge sur SQLite, PostgreSQL, MySQL ou en mémoire, dans une base vide ou
+// non. Le chargement passe par les services (mêmes validations et règles
+// métier que l'API) dans une seule unit of work : tout ou rien.
+//
+//	users:
+//	  - {ref: awa, name: Awa Ngono, email: awa@example.com, age: 31}
+//	tags: [go, gin]
+//	posts:
+//	  - {ref: intro, author: awa, title: Bonjour, content: Premier post de Awa, tags: [go]}
+//	comments:
+//	  - {ref: c1, post: intro, author: awa, content: Merci !}
+//	  - {post: intro, author: awa, parent: c1, content: Une réponse}
+
+var ErrInvalidFixture = errors.New("fixture invalide")
+
+type Fixtures struct {
+	Users    []UserFixture    `json:"users,omitempty" yaml:"users,omitempty"`
+	Tags     []string         `json:"tags,omitempty" yaml:"tags,omitempty"`
+	Posts    []PostFixture    `json:"posts,omitempty" yaml:"posts,omitempty"`
+	Comments []CommentFixture `json:"comments,omitempty" yaml:"comments,omitempty"`
+}
+
+type UserFixture struct {
+	Ref   string `json:"ref,omitempty" yaml:"ref,omitempty"`
+	Name  string `json:"name" yaml:"name"`
+	Email string `json:"email" yaml:"email"`
+	Phone string `json:"phone,omitempty" yaml:"phone,omitempty"`
+	Age   int    `json:"age" yaml:"age"`
+}
+
+type PostFixture struct {
+	Ref     string   `json:"ref,omitempty" yaml:"ref,omitempty"`
+	Author  string   `json:"author" yaml:"author"`
+	Title   string   `json:"title" yaml:"title"`
+	Content string   `json:"content" yaml:"content"`
+	Tags    []string `json:"tags,omitempty" yaml:"tags,omitempty,flow"`
+}
+
+// CommentFixture : Parent désigne le commentaire auquel on répond
+type CommentFixture struct {
+	Ref     string `json:"ref,omitempty" yaml:"ref,omitempty"`
+	Post    string `json:"post" yaml:"post"`
+	Author  string `json:"author" yaml:"author"`
+	Parent  string `json:"parent,omitempty" yaml:"parent,omitempty"`
+	Content string `json:"content" yaml:"content"`
+}
+
+// FixtureResult : IDs attribués à chaque référence
+type FixtureResult struct {
+	Users    map[string]uint `json:"users"`
+	Posts    map[string]uint `json:"posts"`
+	Comments map[string]uint `json:"comments"`
+	Tags     int             `json:"tags_created"`
+}
+
+// decodeFixtures lit une fixture ; format "yaml" ou "json"
+func decodeFixtures(data []byte, format string) (*Fixtures, error) {
+	var fx Fixtures
+	var err error
+	switch format {
+	case "yaml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		err = dec.Decode(&fx)
+	case "json":
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(&fx)
+	default:
+		return nil, fmt.Errorf("%w : format %q (yaml ou json)", ErrInvalidFixture, format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w : %v", ErrInvalidFixture, err)
+	}
+	return &fx, nil
+}
+
+// readFixtures lit un fichier .yaml, .yml ou .json
+func readFixtures(path string) (*Fixtures, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	format := strings.TrimPrefix(filepath.Ext(path), ".")
+	if format == "yml" {
+		format = "yaml"
+	}
+	fx, err := decodeFixtures(data, format)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return fx, nil
+}
+
+// writeFixtures écrit la fixture en YAML ou en JSON selon l'extension
+func writeFixtures(path string, fx *Fixtures) error {
+	var buf bytes.Buffer
+	switch filepath.Ext(path) {
+	case ".yaml", ".yml":
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(2)
+		if err := enc.Encode(fx); err != nil {
+			return err
+		}
+	case ".json":
+		enc := json.NewEncoder(&buf)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(fx); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("extension inconnue pour %s (.yaml, .yml ou .json)", path)
+	}
+	return os.WriteFile(path, buf.Bytes(), 0o644)
+}
+
+// Merge ajoute other à la fixture : les références sont communes
+func (fx *Fixtures) Merge(other *Fixtures) {
+	fx.Users = append(fx.Users, other.Users...)
+	fx.Tags = append(fx.Tags, other.Tags...)
+	fx.Posts = append(fx.Posts, other.Posts...)
+	fx.Comments = append(fx.Comments, other.Comments...)
+}
+
+type FixtureLoader struct {
+	users    *UserService
+	posts    *PostService
+	tags     *TagService
+	comments *CommentService
+	uow      UnitOfWork
+}
+
+func NewFixtureLoader(repos Repositories) *FixtureLoader {
+	return &FixtureLoader{
+		users:    NewUserService(repos.Users, repos.UoW, discardEvents{}),
+		posts:    NewPostService(repos.Posts, repos.Users, repos.Tags, repos.UoW, discardEvents{}),
+		tags:     NewTagService(repos.Tags),
+		comments: NewCommentService(repos.Comments, repos.Posts, repos.Users, repos.UoW, loadCommentPolicy()),
+		uow:      repos.UoW,
+	}
+}
+
+// Load insère la fixture dans l'ordre users, tags, posts, commentaires. Un
+// tag déjà présent est réutilisé ; toute autre erreur annule le chargement.
+func (l *FixtureLoader) Load(ctx context.Context, fx *Fixtures) (*FixtureResult, error) {
+	result := &FixtureResult{Users: map[string]uint{}, Posts: map[string]uint{}, Comments: map[string]uint{}}
+
+	err := l.uow.Do(ctx, func(ctx context.Context) error {
+		for i, f := range fx.Users {
+			user := User{Name: f.Name, Email: f.Email, Phone: f.Phone, Age: f.Age}
+			if err := l.create(result.Users, f.Ref, &user, func() (uint, error) {
+				err := l.users.Create(ctx, &user)
+				return user.ID, err
+			}); err != nil {
+				return fmt.Errorf("users[%d]: %w", i, err)
+			}
+		}
+
+		for i, name := range uniqueNames(fx.Tags) {
+			tag := Tag{Name: name}
+			if err := binding.Validator.ValidateStruct(&tag); err != nil {
+				return fmt.Errorf("tags[%d]: %w", i, err)
+			}
+			err := l.tags.Create(ctx, &tag)
+			switch {
+			case errors.Is(err, ErrTagTaken):
+			case err != nil:
+				return fmt.Errorf("tags[%d]: %w", i, err)
+			default:
+				result.Tags++
+			}
+		}
+
+		for i, f := range fx.Posts {
+			authorID, err := resolveRef(result.Users, "author", f.Author)
+			if err != nil {
+				return fmt.Errorf("posts[%d]: %w", i, err)
+			}
+			post := Post{Title: f.Title, Content: f.Content, UserID: authorID}
+			if err := l.create(result.Posts, f.Ref, &post, func() (uint, error) {
+				if err := l.posts.Create(ctx, &post); err != nil {
+					return 0, err
+				}
+				if len(f.Tags) > 0 {
+					_, err := l.posts.AttachTags(ctx, post.ID, f.Tags)
+					return post.ID, err
+				}
+				return post.ID, nil
+			}); err != nil {
+				return fmt.Errorf("posts[%d]: %w", i, err)
+			}
+		}
+
+		for i, f := range fx.Comments {
+			if err := l.loadComment(ctx, result, f); err != nil {
+				return fmt.Errorf("comments[%d]: %w", i, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (l *FixtureLoader) loadComment(ctx context.Context, result *FixtureResult, f CommentFixture) error {
+	postID, err := resolveRef(result.Posts, "post", f.Post)
+	if err != nil {
+		return err
+	}
+	authorID, err := resolveRef(result.Users, "author", f.Author)
+	if err != nil {
+		return err
+	}
+	comment := Comment{Content: f.Content}
+	if f.Parent != "" {
+		parentID, err := resolveRef(result.Comments, "parent", f.Parent)
+		if err != nil {
+			return err
+		}
+		comment.ParentID = &parentID
+	}
+
+	return l.create(result.Comments, f.Ref, &commentRequest{Content: f.Content}, func() (uint, error) {
+		err := l.comments.Create(ctx, postID, authorID, &comment)
+		return comment.ID, err
+	})
+}
+
+// create valide v (règles binding des modèles), appelle insert et
+// enregistre l'ID obtenu sous ref
+func (l *FixtureLoader) create(refs map[string]uint, ref string, v interface{}, insert func() (uint, error)) error {
+	if _, taken := refs[ref]; taken && ref != "" {
+		return fmt.Errorf("%w : référence %q en double", ErrInvalidFixture, ref)
+	}
+	if err := binding.Validator.ValidateStruct(v); err != nil {
+		return err
+	}
+	id, err := insert()
+	if err != nil {
+		return err
+	}
+	if ref != "" {
+		refs[ref] = id
+	}
+	return nil
+}
+
+func resolveRef(refs map[string]uint, field, ref string) (uint, error) {
+	id, ok := refs[ref]
+	if !ok {
+		return 0, fmt.Errorf("%w : %s %q ne désigne aucun enregistrement déjà chargé", ErrInvalidFixture, field, ref)
+	}
+	return id, nil
+}
+
+// === GÉNÉRATEUR ===
+//
+// generateFixtures produit des données réalistes (noms français et
+// camerounais, numéros +237, posts et fils de commentaires) à partir d'une
+// graine : mêmes graine et volumes, même fixture, octet pour octet.
+
+// SeedVolumes : nombre d'enregistrements à générer
+type SeedVolumes struct {
+	Users    int
+	Posts    int
+	Comments int
+}
+
+var (
+	seedFirstNames = []string{
+		"Awa", "Noah", "Bella", "Aminatou", "Hamadou", "Fadimatou", "Moussa", "Brice", "Landry", "Armelle",
+		"Nadège", "Blaise", "Cyrille", "Gaëlle", "Murielle", "Rodrigue", "Ornella", "Yannick", "Chantal", "Franck",
+		"Jean-Paul", "Marie-Claire", "Hervé", "Éloïse", "Stéphanie", "Samuel", "Thérèse", "Arnaud", "Léa", "Mathieu",
+	}
+	seedLastNames = []string{
+		"Ngono", "Mvondo", "Eto", "Mbarga", "Atangana", "Fotso", "Kamga", "Tchoumi", "Nkwenti", "Abena",
+		"Essomba", "Manga", "Ndongo", "Owona", "Njoya", "Tagne", "Kengne", "Djomo", "Bassong", "Nana",
+		"Dupont", "Martin", "Lefèvre", "Moreau", "Bernard", "Girard", "Ngo Bayiha", "Onana", "Mballa", "Yaya",
+	}
+	seedTopics = []string{
+		"Go", "Gin", "GORM", "SQLite", "PostgreSQL", "MySQL", "le Mobile Money", "les API REST",
+		"les migrations", "OpenTelemetry", "les tests de bout en bout", "les feature flags",
+	}
+	seedTitles = []string{
+		"Premiers pas avec %s", "%s en production à Douala", "Ce que j'ai appris sur %s",
+		"%s : retour d'expérience", "Pourquoi nous avons adopté %s", "%s depuis Yaoundé",
+		"Dix astuces pour %s", "%s sans douleur",
+	}
+	seedSentences = []string{
+		"Nous avons commencé par un prototype simple avant de passer à l'échelle.",
+		"La connexion est parfois instable, il faut donc prévoir des reprises.",
+		"Les paiements Mobile Money arrivent en quelques secondes la plupart du temps.",
+		"Le plus difficile a été de garder des migrations réversibles.",
+		"Les tests de bout en bout nous ont évité plusieurs régressions.",
+		"Les traces nous ont montré une requête N+1 que personne n'avait vue.",
+		"Les clients de Bafoussam et de Garoua utilisent surtout le mobile.",
+		"Un index bien choisi a divisé le temps de réponse par dix.",
+		"Nous gardons la configuration dans des variables d'environnement.",
+		"La documentation en français a beaucoup aidé l'équipe.",
+	}
+	seedComments = []string{
+		"Merci pour le partage !", "Très clair, je vais essayer.", "Et en production, ça tient la charge ?",
+		"Même constat chez nous à Douala.", "Tu aurais un exemple de code ?", "Bien vu pour l'index.",
+		"On a eu le même problème avec les migrations.", "Article utile, bravo.",
+	}
+	seedTags = []string{"go", "gin", "gorm", "sqlite", "postgres", "mysql", "api", "mobile-money", "douala", "yaounde"}
+)
+
+func generateFixtures(seed uint64, volumes SeedVolumes) *Fixtures {
+	rng := rand.New(rand.NewPCG(seed, seed))
+	pick := func(list []string) string { return list[rng.IntN(len(list))] }
+
+	fx := &Fixtures{Tags: slices.Clone(seedTags)}
+
+	emails := map[string]bool{}
+	for i := 0; i < volumes.Users; i++ {
+		first, last := pick(seedFirstNames), pick(seedLastNames)
+		user := UserFixture{
+			Ref:  "user" + strconv.Itoa(i+1),
+			Name: first + " " + last,
+			Age:  18 + rng.IntN(53),
+		}
+		local := emailPart(first) + "." + emailPart(last)
+		user.Email = local + "@example.com"
+		for n := 2; emails[user.Email]; n++ {
+			user.Email = fmt.Sprintf("%s%d@example.com", local, n)
+		}
+		emails[user.Email] = true
+		if rng.IntN(4) > 0 {
+			// MTN (67, 68) et Orange (69, 65)
+			user.Phone = fmt.Sprintf("+2376%s%07d", pick([]string{"7", "8", "9", "5"}), rng.IntN(10_000_000))
+		}
+		fx.Users = append(fx.Users, user)
+	}
+	if len(fx.Users) == 0 {
+		return fx
+	}
+
+	for i := 0; i < volumes.Posts; i++ {
+		post := PostFixture{
+			Ref:    "post" + strconv.Itoa(i+1),
+			Author: fx.Users[rng.IntN(len(fx.Users))].Ref,
+			Title:  capitalize(fmt.Sprintf(pick(seedTitles), pick(seedTopics))),
+		}
+		sentences := make([]string, 2+rng.IntN(3))
+		for j := range sentences {
+			sentences[j] = pick(seedSentences)
+		}
+		post.Content = strings.Join(sentences, " ")
+		for _, j := range rng.Perm(len(seedTags))[:rng.IntN(4)] {
+			post.Tags = append(post.Tags, seedTags[j])
+		}
+		fx.Posts = append(fx.Posts, post)
+	}
+	if len(fx.Posts) == 0 {
+		return fx
+	}
+
+	// Un commentaire sur trois répond à un commentaire de premier niveau
+	// du même post (profondeur 1, admise par toute COMMENTS_MAX_DEPTH >= 1)
+	topLevel := map[string][]string{}
+	for i := 0; i < volumes.Comments; i++ {
+		comment := CommentFixture{
+			Ref:     "comment" + strconv.Itoa(i+1),
+			Post:    fx.Posts[rng.IntN(len(fx.Posts))].Ref,
+			Author:  fx.Users[rng.IntN(len(fx.Users))].Ref,
+			Content: pick(seedComments),
+		}
+		if parents := topLevel[comment.Post]; len(parents) > 0 && rng.IntN(3) == 0 {
+			comment.Parent = parents[rng.IntN(len(parents))]
+		} else {
+			topLevel[comment.Post] = append(topLevel[comment.Post], comment.Ref)
+		}
+		fx.Comments = append(fx.Comments, comment)
+	}
+	return fx
+}
+
+func capitalize(s string) string {
+	r := []rune(s)
+	r[0] = unicode.ToUpper(r[0])
+	return string(r)
+}
+
+// emailPart : "Ngo Bayiha" devient "ngobayiha", "Éloïse" devient "eloise"
+func emailPart(name string) string {
+	var b strings.Builder
+	for _, r := range norm.NFD.String(name) {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			b.WriteRune(unicode.ToLower(r))
+		}
+	}
+	return b.String()
+}
+
+// seedAllowed : seed et fixtures sont réservés au développement et aux tests
+func seedAllowed() bool {
+	return !strings.EqualFold(os.Getenv("APP_ENV"), "production")
+}
+
+// === ADMIN HANDLER ===
+
+type FixtureHandler struct {
+	loader *FixtureLoader
+}
+
+func NewFixtureHandler(loader *FixtureLoader) *FixtureHandler {
+	return &FixtureHandler{loader: loader}
+}
+
+// POST /admin/fixtures - corps YAML (Content-Type: application/yaml) ou JSON
+func (h *FixtureHandler) Load(c *gin.Context) {
+	if !h.allowed(c) {
+		return
+	}
+
+	data, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Corps illisible"})
+		return
+	}
+	format := "json"
+	switch c.ContentType() {
+	case "application/yaml", "application/x-yaml", "text/yaml":
+		format = "yaml"
+	}
+	fx, err := decodeFixtures(data, format)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	h.load(c, fx)
+}
+
+// POST /admin/seed?seed=42&users=20&posts=60&comments=120
+func (h *FixtureHandler) Seed(c *gin.Context) {
+	if !h.allowed(c) {
+		return
+	}
+
+	seed, err := strconv.ParseUint(c.DefaultQuery("seed", "42"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "seed doit être un entier positif"})
+		return
+	}
+	var volumes SeedVolumes
+	for _, v := range []struct {
+		name string
+		dest *int
+		def  string
+	}{{"users", &volumes.Users, "20"}, {"posts", &volumes.Posts, "60"}, {"comments", &volumes.Comments, "120"}} {
+		n, err := strconv.Atoi(c.DefaultQuery(v.name, v.def))
+		if err != nil || n < 0 || n > 10_000 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": v.name + " doit être un entier entre 0 et 10000"})
+			return
+		}
+		*v.dest = n
+	}
+	h.load(c, generateFixtures(seed, volumes))
+}
+
+func (h *FixtureHandler) allowed(c *gin.Context) bool {
+	if !seedAllowed() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Fixtures désactivées en production"})
+		return false
+	}
+	return true
+}
+
+func (h *FixtureHandler) load(c *gin.Context, fx *Fixtures) {
+	result, err := h.loader.Load(c.Request.Context(), fx)
+
+	var verrs validator.ValidationErrors
+	switch {
+	case err == nil:
+		c.JSON(http.StatusCreated, result)
+	case errors.As(err, &verrs):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Fixture invalide : " + err.Error(), "fields": validationErrors(err)})
+	case errors.Is(err, ErrConflict):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrInvalidFixture), errors.Is(err, ErrMaxDepth), errors.Is(err, ErrParentNotFound),
+		errors.As(err, new(*UnknownTagsError)):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur de chargement des fixtures"})
+	}
+}
@@ -0,0 +1,512 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// === SERVICES (règles métier) ===
+
+var (
+	ErrUserNotFound   = errors.New("utilisateur non trouvé")
+	ErrPostNotFound   = errors.New("post non trouvé")
+	ErrEmailTaken     = &ConflictError{Field: "email"}
+	ErrAuthorNotFound = errors.New("auteur non trouvé")
+	ErrTagTaken       = errors.New("tag déjà existant")
+	ErrNotTrashed     = errors.New("absent de la corbeille")
+	ErrAuthorTrashed  = errors.New("auteur à la corbeille")
+)
+
+// UnknownTagsError liste les tags demandés qui n'existent pas
+type UnknownTagsError struct {
+	Names []string
+}
+
+func (e *UnknownTagsError) Error() string {
+	return "tags inconnus : " + strings.Join(e.Names, ", ")
+}
+
+type UserService struct {
+	users  UserRepository
+	uow    UnitOfWork
+	events EventPublisher
+}
+
+func NewUserService(users UserRepository, uow UnitOfWork, events EventPublisher) *UserService {
+	return &UserService{users: users, uow: uow, events: events}
+}
+
+func (s *UserService) List(ctx context.Context, opts ReadOptions) ([]User, error) {
+	return s.users.List(ctx, opts)
+}
+
+func (s *UserService) Get(ctx context.Context, id uint, opts ReadOptions) (*User, error) {
+	user, err := s.users.Get(ctx, id, opts)
+	if errors.Is(err, ErrNotFound) {
+		return nil, ErrUserNotFound
+	}
+	return user, err
+}
+
+// Create refuse un email déjà utilisé (y compris celui d'un utilisateur à la
+// corbeille, réservé jusqu'à la purge). L'unicité est laissée à l'index de
+// la base : deux inscriptions simultanées ne peuvent pas passer toutes les
+// deux une vérification préalable, la seconde reçoit ErrEmailTaken.
+func (s *UserService) Create(ctx context.Context, user *User) error {
+	user.CreatedAt, user.UpdatedAt, user.DeletedAt = time.Time{}, time.Time{}, gorm.DeletedAt{}
+	user.Email = normalizeEmail(user.Email)
+	return s.uow.Do(ctx, func(ctx context.Context) error {
+		if err := s.users.Create(ctx, user); err != nil {
+			return err
+		}
+		return s.events.Publish(ctx, EventUserCreated, user)
+	})
+}
+
+// Update écrit les champs envoyés et renvoie dans user la ligne enregistrée ;
+// refuse de prendre l'email d'un autre utilisateur (ErrEmailTaken)
+func (s *UserService) Update(ctx context.Context, id uint, user *User, fields []string) error {
+	if slices.Contains(fields, "Email") {
+		user.Email = normalizeEmail(user.Email)
+	}
+	err := s.uow.Do(ctx, func(ctx context.Context) error {
+		return s.users.Update(ctx, id, user, fields)
+	})
+	if errors.Is(err, ErrNotFound) {
+		return ErrUserNotFound
+	}
+	return err
+}
+
+// Delete met l'utilisateur à la corbeille ; ses posts suivent la politique
+// ondelete déclarée sur User.Posts (cascade, restrict ou reassign)
+func (s *UserService) Delete(ctx context.Context, id uint) error {
+	return s.uow.Do(ctx, func(ctx context.Context) error {
+		return s.users.Delete(ctx, id)
+	})
+}
+
+// Restore sort l'utilisateur de la corbeille, avec les posts supprimés en
+// même temps que lui si withPosts
+func (s *UserService) Restore(ctx context.Context, id uint, withPosts bool) (*User, error) {
+	var user *User
+	err := s.uow.Do(ctx, func(ctx context.Context) error {
+		if err := s.users.Restore(ctx, id, withPosts); err != nil {
+			return err
+		}
+		var err error
+		user, err = s.users.Get(ctx, id, ReadOptions{Include: []string{"posts"}})
+		return err
+	})
+	if errors.Is(err, ErrNotFound) {
+		return nil, ErrNotTrashed
+	}
+	return user, err
+}
+
+// normalizeEmail : les emails sont comparés sans casse, donc stockés en
+// minuscules
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+type PostService struct {
+	posts  PostRepository
+	users  UserRepository
+	tags   TagRepository
+	uow    UnitOfWork
+	events EventPublisher
+}
+
+func NewPostService(posts PostRepository, users UserRepository, tags TagRepository, uow UnitOfWork, events EventPublisher) *PostService {
+	return &PostService{posts: posts, users: users, tags: tags, uow: uow, events: events}
+}
+
+func (s *PostService) List(ctx context.Context, filter PostFilter, opts ReadOptions) ([]Post, error) {
+	filter.Tags = uniqueNames(filter.Tags)
+	return s.posts.List(ctx, filter, opts)
+}
+
+func (s *PostService) Get(ctx context.Context, id uint, opts ReadOptions) (*Post, error) {
+	post, err := s.posts.Get(ctx, id, opts)
+	if errors.Is(err, ErrNotFound) {
+		return nil, ErrPostNotFound
+	}
+	return post, err
+}
+
+// Create vérifie que l'auteur existe
+func (s *PostService) Create(ctx context.Context, post *Post) error {
+	post.CreatedAt, post.UpdatedAt, post.DeletedAt = time.Time{}, time.Time{}, gorm.DeletedAt{}
+	return s.uow.Do(ctx, func(ctx context.Context) error {
+		if _, err := s.users.Get(ctx, post.UserID, ReadOptions{}); err != nil {
+			if errors.Is(err, ErrNotFound) {
+				return ErrAuthorNotFound
+			}
+			return err
+		}
+		if err := s.posts.Create(ctx, post); err != nil {
+			return err
+		}
+		return s.events.Publish(ctx, EventPostCreated, post)
+	})
+}
+
+// Update écrit les champs envoyés et renvoie dans post la ligne enregistrée ;
+// un changement d'auteur doit viser un utilisateur existant
+func (s *PostService) Update(ctx context.Context, id uint, post *Post, fields []string) error {
+	err := s.uow.Do(ctx, func(ctx context.Context) error {
+		if slices.Contains(fields, "UserID") {
+			if _, err := s.users.Get(ctx, post.UserID, ReadOptions{}); err != nil {
+				if errors.Is(err, ErrNotFound) {
+					return ErrAuthorNotFound
+				}
+				return err
+			}
+		}
+		return s.posts.Update(ctx, id, post, fields)
+	})
+	if errors.Is(err, ErrNotFound) {
+		return ErrPostNotFound
+	}
+	return err
+}
+
+func (s *PostService) Delete(ctx context.Context, id uint) error {
+	return s.posts.Delete(ctx, id)
+}
+
+// Restore sort le post de la corbeille ; refusé tant que son auteur y est
+func (s *PostService) Restore(ctx context.Context, id uint) (*Post, error) {
+	var post *Post
+	err := s.uow.Do(ctx, func(ctx context.Context) error {
+		trashed, err := s.posts.Get(ctx, id, ReadOptions{Trashed: TrashedOnly})
+		switch {
+		case errors.Is(err, ErrNotFound):
+			return ErrNotTrashed
+		case err != nil:
+			return err
+		}
+		_, err = s.users.Get(ctx, trashed.UserID, ReadOptions{})
+		switch {
+		case errors.Is(err, ErrNotFound):
+			return ErrAuthorTrashed
+		case err != nil:
+			return err
+		}
+
+		if err := s.posts.Restore(ctx, id); err != nil {
+			return err
+		}
+		post, err = s.Get(ctx, id, ReadOptions{})
+		return err
+	})
+	return post, err
+}
+
+// AttachTags ajoute des tags existants au post ; retourne le post et ses tags
+func (s *PostService) AttachTags(ctx context.Context, postID uint, names []string) (*Post, error) {
+	return s.changeTags(ctx, postID, names, s.posts.AttachTags)
+}
+
+// DetachTags retire des tags du post ; retourne le post et ses tags
+func (s *PostService) DetachTags(ctx context.Context, postID uint, names []string) (*Post, error) {
+	return s.changeTags(ctx, postID, names, s.posts.DetachTags)
+}
+
+func (s *PostService) changeTags(ctx context.Context, postID uint, names []string,
+	apply func(ctx context.Context, postID uint, tags []Tag) error) (*Post, error) {
+	var post *Post
+	err := s.uow.Do(ctx, func(ctx context.Context) error {
+		if _, err := s.Get(ctx, postID, ReadOptions{}); err != nil {
+			return err
+		}
+		tags, err := s.resolveTags(ctx, names)
+		if err != nil {
+			return err
+		}
+		if err := apply(ctx, postID, tags); err != nil {
+			return err
+		}
+		post, err = s.Get(ctx, postID, ReadOptions{Include: []string{"tags"}})
+		return err
+	})
+	return post, err
+}
+
+// resolveTags charge les tags par nom ; *UnknownTagsError si certains manquent
+func (s *PostService) resolveTags(ctx context.Context, names []string) ([]Tag, error) {
+	names = uniqueNames(names)
+	tags, err := s.tags.GetByNames(ctx, names)
+	if err != nil {
+		return nil, err
+	}
+	if len(tags) == len(names) {
+		return tags, nil
+	}
+
+	var missing []string
+	for _, name := range names {
+		if !slices.ContainsFunc(tags, func(t Tag) bool { return t.Name == name }) {
+			missing = append(missing, name)
+		}
+	}
+	return nil, &UnknownTagsError{Names: missing}
+}
+
+// uniqueNames retire les doublons en gardant l'ordre
+func uniqueNames(names []string) []string {
+	var unique []string
+	for _, name := range names {
+		if !slices.Contains(unique, name) {
+			unique = append(unique, name)
+		}
+	}
+	return unique
+}
+
+type TagService struct {
+	tags TagRepository
+}
+
+func NewTagService(tags TagRepository) *TagService {
+	return &TagService{tags: tags}
+}
+
+func (s *TagService) List(ctx context.Context) ([]TagCount, error) {
+	return s.tags.List(ctx)
+}
+
+func (s *TagService) Create(ctx context.Context, tag *Tag) error {
+	err := s.tags.Create(ctx, tag)
+	if errors.Is(err, ErrConflict) {
+		return ErrTagTaken
+	}
+	return err
+}
+
+var (
+	ErrCommentNotFound  = errors.New("commentaire non trouvé")
+	ErrParentNotFound   = errors.New("commentaire parent non trouvé")
+	ErrMaxDepth         = errors.New("profondeur maximale de réponse atteinte")
+	ErrNotAuthor        = errors.New("seul l'auteur peut modifier ce commentaire")
+	ErrEditWindowClosed = errors.New("délai de modification dépassé")
+)
+
+// CommentPolicy : règles des fils de discussion
+type CommentPolicy struct {
+	// MaxDepth : profondeur maximale d'une réponse (0 = pas de réponse)
+	MaxDepth int
+	// EditWindow : délai après la création pendant lequel l'auteur peut
+	// modifier ou supprimer son commentaire (0 = sans limite)
+	EditWindow time.Duration
+}
+
+// loadCommentPolicy lit COMMENTS_MAX_DEPTH (3 par défaut) et
+// COMMENTS_EDIT_WINDOW (15m par défaut)
+func loadCommentPolicy() CommentPolicy {
+	policy := CommentPolicy{MaxDepth: 3, EditWindow: 15 * time.Minute}
+	if n, err := strconv.Atoi(os.Getenv("COMMENTS_MAX_DEPTH")); err == nil && n >= 0 {
+		policy.MaxDepth = n
+	}
+	if d, err := time.ParseDuration(os.Getenv("COMMENTS_EDIT_WINDOW")); err == nil && d >= 0 {
+		policy.EditWindow = d
+	}
+	return policy
+}
+
+type CommentService struct {
+	comments CommentRepository
+	posts    PostRepository
+	users    UserRepository
+	uow      UnitOfWork
+	policy   CommentPolicy
+}
+
+func NewCommentService(comments CommentRepository, posts PostRepository, users UserRepository,
+	uow UnitOfWork, policy CommentPolicy) *CommentService {
+	return &CommentService{comments: comments, posts: posts, users: users, uow: uow, policy: policy}
+}
+
+// List retourne les commentaires du post à plat, triés par ID
+func (s *CommentService) List(ctx context.Context, postID uint) ([]Comment, error) {
+	if _, err := s.posts.Get(ctx, postID, ReadOptions{}); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil, ErrPostNotFound
+		}
+		return nil, err
+	}
+	return s.comments.ListByPost(ctx, postID)
+}
+
+// Tree retourne les commentaires de premier niveau, chacun avec ses réponses
+// imbriquées ; les commentaires sont chargés en une seule requête
+func (s *CommentService) Tree(ctx context.Context, postID uint) ([]Comment, error) {
+	flat, err := s.List(ctx, postID)
+	if err != nil {
+		return nil, err
+	}
+	return buildCommentTree(flat), nil
+}
+
+// buildCommentTree range les commentaires (triés par ID) sous leur parent
+func buildCommentTree(flat []Comment) []Comment {
+	children := map[uint][]Comment{} // 0 : premier niveau
+	for _, c := range flat {
+		var parent uint
+		if c.ParentID != nil {
+			parent = *c.ParentID
+		}
+		children[parent] = append(children[parent], c)
+	}
+
+	var attach func(parent uint) []Comment
+	attach = func(parent uint) []Comment {
+		nodes := children[parent]
+		for i := range nodes {
+			nodes[i].Replies = attach(nodes[i].ID)
+		}
+		return nodes
+	}
+	return attach(0)
+}
+
+// Get retourne un commentaire du post
+func (s *CommentService) Get(ctx context.Context, postID, id uint) (*Comment, error) {
+	comment, err := s.comments.Get(ctx, id)
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return nil, ErrCommentNotFound
+	case err != nil:
+		return nil, err
+	case comment.PostID != postID:
+		return nil, ErrCommentNotFound
+	}
+	return comment, nil
+}
+
+// Create ajoute un commentaire (ou une réponse si ParentID est renseigné)
+// écrit par authorID ; la réponse doit viser un commentaire du même post et
+// respecter la profondeur maximale
+func (s *CommentService) Create(ctx context.Context, postID, authorID uint, comment *Comment) error {
+	return s.uow.Do(ctx, func(ctx context.Context) error {
+		if _, err := s.posts.Get(ctx, postID, ReadOptions{}); err != nil {
+			if errors.Is(err, ErrNotFound) {
+				return ErrPostNotFound
+			}
+			return err
+		}
+		if _, err := s.users.Get(ctx, authorID, ReadOptions{}); err != nil {
+			if errors.Is(err, ErrNotFound) {
+				return ErrAuthorNotFound
+			}
+			return err
+		}
+
+		comment.PostID, comment.UserID, comment.Depth = postID, authorID, 0
+		if comment.ParentID != nil {
+			parent, err := s.Get(ctx, postID, *comment.ParentID)
+			if errors.Is(err, ErrCommentNotFound) {
+				return ErrParentNotFound
+			}
+			if err != nil {
+				return err
+			}
+			if parent.Depth+1 > s.policy.MaxDepth {
+				return ErrMaxDepth
+			}
+			comment.Depth = parent.Depth + 1
+		}
+
+		if err := s.comments.Create(ctx, comment); err != nil {
+			return err
+		}
+		created, err := s.comments.Get(ctx, comment.ID)
+		if err != nil {
+			return err
+		}
+		*comment = *created
+		return nil
+	})
+}
+
+// Update remplace le contenu ; réservé à l'auteur pendant EditWindow
+func (s *CommentService) Update(ctx context.Context, postID, id, callerID uint, content string) (*Comment, error) {
+	comment := &Comment{Content: content}
+	err := s.uow.Do(ctx, func(ctx context.Context) error {
+		if err := s.checkAuthor(ctx, postID, id, callerID); err != nil {
+			return err
+		}
+		return s.comments.Update(ctx, id, comment, []string{"Content"})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return comment, nil
+}
+
+// Delete supprime le commentaire et ses réponses ; réservé à l'auteur
+// pendant EditWindow
+func (s *CommentService) Delete(ctx context.Context, postID, id, callerID uint) error {
+	return s.uow.Do(ctx, func(ctx context.Context) error {
+		if err := s.checkAuthor(ctx, postID, id, callerID); err != nil {
+			return err
+		}
+		return s.comments.Delete(ctx, id)
+	})
+}
+
+func (s *CommentService) checkAuthor(ctx context.Context, postID, id, callerID uint) error {
+	comment, err := s.Get(ctx, postID, id)
+	if err != nil {
+		return err
+	}
+	if comment.UserID != callerID {
+		return ErrNotAuthor
+	}
+	if s.policy.EditWindow > 0 && time.Since(comment.CreatedAt) > s.policy.EditWindow {
+		return ErrEditWindowClosed
+	}
+	return nil
+}
+
+var ErrEmptyQuery = errors.New("requête de recherche vide")
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+)
+
+type SearchService struct {
+	index SearchIndex
+}
+
+func NewSearchService(index SearchIndex) *SearchService {
+	return &SearchService{index: index}
+}
+
+// Search cherche les posts contenant tous les mots de query ; limit est
+// ramené entre 1 et maxSearchLimit (defaultSearchLimit si 0)
+func (s *SearchService) Search(ctx context.Context, query string, limit int) ([]SearchHit, error) {
+	if len(searchTerms(query)) == 0 {
+		return nil, ErrEmptyQuery
+	}
+	if limit <= 0 {
+		limit = defaultSearchLimit
+	}
+	hits, err := s.index.Search(ctx, query, min(limit, maxSearchLimit))
+	if err != nil {
+		return nil, err
+	}
+	if hits == nil {
+		hits = []SearchHit{}
+	}
+	return hits, nil
+}
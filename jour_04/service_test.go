@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// Chemin de mise à jour des services sur les repositories en mémoire :
+// ligne absente, ligne enregistrée renvoyée, clé étrangère vérifiée et
+// valeurs zéro écrites pour les champs envoyés (Select).
+
+// newTestServices : services sur un store vide avec deux utilisateurs et un post
+func newTestServices(t *testing.T) (*UserService, *PostService, []User, Post) {
+	t.Helper()
+	store := NewMemoryStore()
+	users := NewUserService(store.Users(), store.UnitOfWork(), discardEvents{})
+	posts := NewPostService(store.Posts(), store.Users(), store.Tags(), store.UnitOfWork(), discardEvents{})
+
+	ctx := context.Background()
+	authors := []User{
+		{Name: "Noah Mvondo", Email: "noah@example.com", Phone: "+237699112233", Age: 25},
+		{Name: "Bella Eto", Email: "bella@example.com", Age: 28},
+	}
+	for i := range authors {
+		if err := users.Create(ctx, &authors[i]); err != nil {
+			t.Fatalf("création de %s : %v", authors[i].Name, err)
+		}
+	}
+	post := Post{Title: "Premier post", Content: "Contenu du premier post", UserID: authors[0].ID}
+	if err := posts.Create(ctx, &post); err != nil {
+		t.Fatalf("création du post : %v", err)
+	}
+	return users, posts, authors, post
+}
+
+func TestUserServiceUpdate(t *testing.T) {
+	tests := []struct {
+		name    string
+		id      func(authors []User) uint
+		user    User
+		fields  []string
+		wantErr error
+		check   func(t *testing.T, got User)
+	}{
+		{
+			name:    "utilisateur inexistant",
+			id:      func([]User) uint { return 999 },
+			user:    User{Name: "Fantôme"},
+			fields:  []string{"Name"},
+			wantErr: ErrUserNotFound,
+		},
+		{
+			name:   "ligne enregistrée renvoyée",
+			id:     func(a []User) uint { return a[0].ID },
+			user:   User{Name: "Noah M."},
+			fields: []string{"Name"},
+			check: func(t *testing.T, got User) {
+				if got.Name != "Noah M." || got.Email != "noah@example.com" || got.Phone != "+237699112233" || got.Age != 25 {
+					t.Errorf("ligne renvoyée = %+v, champs non envoyés attendus inchangés", got)
+				}
+				if got.CreatedAt.IsZero() || got.UpdatedAt.IsZero() {
+					t.Errorf("dates non rechargées : %+v", got)
+				}
+			},
+		},
+		{
+			name:   "valeur zéro écrite",
+			id:     func(a []User) uint { return a[0].ID },
+			user:   User{Phone: ""},
+			fields: []string{"Phone"},
+			check: func(t *testing.T, got User) {
+				if got.Phone != "" || got.Name != "Noah Mvondo" {
+					t.Errorf("ligne renvoyée = %+v, téléphone vide attendu", got)
+				}
+			},
+		},
+		{
+			name:    "email d'un autre utilisateur (casse)",
+			id:      func(a []User) uint { return a[0].ID },
+			user:    User{Email: " BELLA@example.com"},
+			fields:  []string{"Email"},
+			wantErr: ErrEmailTaken,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			users, _, authors, _ := newTestServices(t)
+			ctx := context.Background()
+			id := tt.id(authors)
+			user := tt.user
+
+			err := users.Update(ctx, id, &user, tt.fields)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Update() = %v, attendu %v", err, tt.wantErr)
+			}
+			if tt.check == nil {
+				return
+			}
+			tt.check(t, user)
+			stored, err := users.Get(ctx, id, ReadOptions{})
+			if err != nil {
+				t.Fatalf("Get() = %v", err)
+			}
+			tt.check(t, *stored)
+		})
+	}
+}
+
+func TestPostServiceUpdate(t *testing.T) {
+	tests := []struct {
+		name    string
+		id      func(post Post) uint
+		post    func(authors []User) Post
+		fields  []string
+		wantErr error
+		check   func(t *testing.T, got Post, authors []User)
+	}{
+		{
+			name:    "post inexistant",
+			id:      func(Post) uint { return 999 },
+			post:    func([]User) Post { return Post{Title: "Titre"} },
+			fields:  []string{"Title"},
+			wantErr: ErrPostNotFound,
+		},
+		{
+			name:    "auteur inexistant",
+			id:      func(p Post) uint { return p.ID },
+			post:    func([]User) Post { return Post{UserID: 999} },
+			fields:  []string{"UserID"},
+			wantErr: ErrAuthorNotFound,
+		},
+		{
+			name:   "auteur changé, ligne enregistrée renvoyée",
+			id:     func(p Post) uint { return p.ID },
+			post:   func(a []User) Post { return Post{UserID: a[1].ID} },
+			fields: []string{"UserID"},
+			check: func(t *testing.T, got Post, a []User) {
+				if got.UserID != a[1].ID || got.Title != "Premier post" || got.Content != "Contenu du premier post" {
+					t.Errorf("ligne renvoyée = %+v", got)
+				}
+			},
+		},
+		{
+			name:   "valeur zéro écrite",
+			id:     func(p Post) uint { return p.ID },
+			post:   func([]User) Post { return Post{Content: ""} },
+			fields: []string{"Content"},
+			check: func(t *testing.T, got Post, _ []User) {
+				if got.Content != "" || got.Title != "Premier post" {
+					t.Errorf("ligne renvoyée = %+v, contenu vide attendu", got)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, posts, authors, created := newTestServices(t)
+			ctx := context.Background()
+			id := tt.id(created)
+			post := tt.post(authors)
+
+			err := posts.Update(ctx, id, &post, tt.fields)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Update() = %v, attendu %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				// Rien n'a changé
+				stored, err := posts.Get(ctx, created.ID, ReadOptions{})
+				if err != nil {
+					t.Fatalf("Get() = %v", err)
+				}
+				if stored.UserID != created.UserID || stored.Title != created.Title {
+					t.Errorf("post modifié malgré l'erreur : %+v", stored)
+				}
+				return
+			}
+			tt.check(t, post, authors)
+			stored, err := posts.Get(ctx, id, ReadOptions{})
+			if err != nil {
+				t.Fatalf("Get() = %v", err)
+			}
+			tt.check(t, *stored, authors)
+		})
+	}
+}
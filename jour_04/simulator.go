@@ -0,0 +1,571 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// === SIMULATEUR MTN MOMO / ORANGE MONEY ===
+//
+// `jour04 simulate` sert les routes des deux API utilisées par
+// payment_mtn.go et payment_orange.go, en mémoire : jetons OAuth2,
+// initiation, état, puis callback après SIM_CALLBACK_DELAY. L'issue dépend
+// des deux derniers chiffres du numéro :
+//
+//	…00  échec (solde insuffisant)
+//	…01  reste en attente (pas de callback ; POST /_sim/operations/:id/resolve)
+//	…02  HTTP 500 à l'initiation, rien n'est enregistré
+//	…03  réussit sans callback (seule la relecture le voit)
+//	sinon réussit, ou échoue avec la probabilité SIM_FAILURE_RATE
+//
+// GET /_sim/operations liste les opérations reçues.
+//
+// Le simulateur sert aussi de destinataire de webhooks (webhook.go) :
+// POST /_sim/webhooks/:name enregistre la requête et répond ?status= (200
+// par défaut), GET /_sim/webhooks/:name liste les requêtes reçues et
+// GET /_sim/webhooks/:name/last renvoie la dernière telle quelle (corps et
+// headers X-Webhook-*), pour vérifier la signature.
+
+// SimulatorConfig : SIM_PORT (8090), SIM_LATENCY (délai de chaque réponse),
+// SIM_CALLBACK_DELAY (2s), SIM_FAILURE_RATE (0 à 1), SIM_CALLBACKS (true)
+type SimulatorConfig struct {
+	Port          string
+	Latency       time.Duration
+	CallbackDelay time.Duration
+	FailureRate   float64
+	Callbacks     bool
+}
+
+func loadSimulatorConfig() SimulatorConfig {
+	cfg := SimulatorConfig{Port: os.Getenv("SIM_PORT"), CallbackDelay: 2 * time.Second, Callbacks: true}
+	if cfg.Port == "" {
+		cfg.Port = "8090"
+	}
+	if d, err := time.ParseDuration(os.Getenv("SIM_LATENCY")); err == nil && d >= 0 {
+		cfg.Latency = d
+	}
+	if d, err := time.ParseDuration(os.Getenv("SIM_CALLBACK_DELAY")); err == nil && d >= 0 {
+		cfg.CallbackDelay = d
+	}
+	if f, err := strconv.ParseFloat(os.Getenv("SIM_FAILURE_RATE"), 64); err == nil && f >= 0 && f <= 1 {
+		cfg.FailureRate = f
+	}
+	if b, err := strconv.ParseBool(os.Getenv("SIM_CALLBACKS")); err == nil {
+		cfg.Callbacks = b
+	}
+	return cfg
+}
+
+// simOperation : opération reçue par le simulateur. ID est le X-Reference-Id
+// (MTN) ou le payToken (Orange).
+type simOperation struct {
+	ID          string    `json:"id"`
+	Provider    string    `json:"provider"`
+	Kind        string    `json:"kind"`
+	Reference   string    `json:"reference"` // externalId ou orderId
+	Phone       string    `json:"phone"`
+	Amount      string    `json:"amount"`
+	Currency    string    `json:"currency"`
+	Status      string    `json:"status"` // statut dans le vocabulaire de l'opérateur
+	Reason      string    `json:"reason,omitempty"`
+	TxnID       string    `json:"txn_id,omitempty"`
+	CallbackURL string    `json:"callback_url,omitempty"`
+	Callback    string    `json:"callback,omitempty"` // résultat du callback envoyé
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type Simulator struct {
+	cfg    SimulatorConfig
+	client *http.Client
+
+	mu     sync.Mutex
+	ops    map[string]*simOperation
+	tokens map[string]time.Time
+	hooks  map[string][]simWebhook
+}
+
+func NewSimulator(cfg SimulatorConfig) *Simulator {
+	return &Simulator{
+		cfg:    cfg,
+		client: &http.Client{Timeout: 10 * time.Second},
+		ops:    map[string]*simOperation{},
+		tokens: map[string]time.Time{},
+		hooks:  map[string][]simWebhook{},
+	}
+}
+
+// Router : routes MTN, Orange, d'introspection et de réception de webhooks
+func (s *Simulator) Router() *gin.Engine {
+	r := gin.New()
+	r.Use(gin.Recovery(), func(c *gin.Context) {
+		if s.cfg.Latency > 0 {
+			time.Sleep(s.cfg.Latency)
+		}
+		c.Next()
+	})
+
+	// MTN MoMo
+	for _, product := range []string{"collection", "disbursement"} {
+		r.POST("/"+product+"/token/", s.issueToken)
+	}
+	mtn := r.Group("/", s.requireToken)
+	{
+		mtn.POST("/collection/v1_0/requesttopay", s.mtnInitiate(PaymentCollection))
+		mtn.GET("/collection/v1_0/requesttopay/:id", s.mtnStatus)
+		mtn.POST("/disbursement/v1_0/transfer", s.mtnInitiate(PaymentDisbursement))
+		mtn.GET("/disbursement/v1_0/transfer/:id", s.mtnStatus)
+	}
+
+	// Orange Money
+	r.POST("/token", s.issueToken)
+	orange := r.Group(orangeAPI, s.requireToken)
+	{
+		orange.POST("/:res/init", s.orangeInit)
+		orange.POST("/:res/pay", s.orangePay)
+		orange.GET("/:res/paymentstatus/:id", s.orangeStatus)
+	}
+
+	// Introspection
+	r.GET("/_sim/operations", s.listOperations)
+	r.POST("/_sim/operations/:id/resolve", s.resolveOperation)
+
+	// Destinataire de webhooks
+	r.POST("/_sim/webhooks/:name", s.receiveWebhook)
+	r.GET("/_sim/webhooks/:name", s.listWebhooks)
+	r.GET("/_sim/webhooks/:name/last", s.lastWebhook)
+	return r
+}
+
+// === JETONS ===
+
+// POST /{produit}/token/ (MTN) et /token (Orange) : Basic requis
+func (s *Simulator) issueToken(c *gin.Context) {
+	if user, pass, ok := c.Request.BasicAuth(); !ok || user == "" || pass == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Basic auth requis"})
+		return
+	}
+	token := fmt.Sprintf("sim-%016x", rand.Uint64())
+	s.mu.Lock()
+	s.tokens[token] = time.Now().Add(time.Hour)
+	s.mu.Unlock()
+	c.JSON(http.StatusOK, gin.H{"access_token": token, "token_type": "Bearer", "expires_in": 3600})
+}
+
+func (s *Simulator) requireToken(c *gin.Context) {
+	token, _ := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	s.mu.Lock()
+	expires, ok := s.tokens[token]
+	s.mu.Unlock()
+	if !ok || time.Now().After(expires) {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "jeton invalide ou expiré"})
+		return
+	}
+	c.Next()
+}
+
+// === MTN ===
+
+// POST /{produit}/v1_0/{requesttopay|transfer} : 202, puis callback (PUT)
+func (s *Simulator) mtnInitiate(kind string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader("X-Reference-Id")
+		var tx mtnTransaction
+		if err := c.ShouldBindJSON(&tx); err != nil || id == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"code": "INVALID_REQUEST", "message": "X-Reference-Id et corps JSON requis"})
+			return
+		}
+		party := tx.Payer
+		if kind == PaymentDisbursement {
+			party = tx.Payee
+		}
+		if party == nil || party.PartyID == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"code": "PAYER_NOT_FOUND", "message": "partyId requis"})
+			return
+		}
+
+		op := &simOperation{
+			ID: id, Provider: ProviderMTN, Kind: kind, Reference: tx.ExternalID,
+			Phone: party.PartyID, Amount: tx.Amount, Currency: tx.Currency,
+			Status: "PENDING", CallbackURL: c.GetHeader("X-Callback-Url"),
+		}
+		if status, msg := s.accept(op); status != 0 {
+			c.JSON(status, gin.H{"code": "REQUEST_REJECTED", "message": msg})
+			return
+		}
+		c.Status(http.StatusAccepted)
+	}
+}
+
+// GET /{produit}/v1_0/{requesttopay|transfer}/:id
+func (s *Simulator) mtnStatus(c *gin.Context) {
+	op, ok := s.operation(c.Param("id"), ProviderMTN)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"code": "RESOURCE_NOT_FOUND", "message": "Requested resource was not found."})
+		return
+	}
+	c.JSON(http.StatusOK, mtnBody(op))
+}
+
+func mtnBody(op simOperation) mtnTransaction {
+	tx := mtnTransaction{
+		Amount: op.Amount, Currency: op.Currency, ExternalID: op.Reference,
+		FinancialTransactionID: op.TxnID, Status: op.Status, Reason: op.Reason,
+	}
+	party := &mtnParty{PartyIDType: "MSISDN", PartyID: op.Phone}
+	if op.Kind == PaymentDisbursement {
+		tx.Payee = party
+	} else {
+		tx.Payer = party
+	}
+	return tx
+}
+
+// === ORANGE ===
+
+// POST {mp|cashin}/init : payToken d'une opération à venir
+func (s *Simulator) orangeInit(c *gin.Context) {
+	kind, ok := orangeKind(c.Param("res"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"message": "ressource inconnue"})
+		return
+	}
+	op := &simOperation{
+		ID: fmt.Sprintf("MP%010d", rand.Int64N(1e10)), Provider: ProviderOrange, Kind: kind,
+		Status: "INITIATED", CreatedAt: time.Now(),
+	}
+	s.mu.Lock()
+	s.ops[op.ID] = op
+	s.mu.Unlock()
+	c.JSON(http.StatusOK, orangeResponse{Message: "Payment request successfully initiated", Data: orangeData{PayToken: op.ID}})
+}
+
+// POST {mp|cashin}/pay : lance l'opération du payToken, puis callback (POST)
+func (s *Simulator) orangePay(c *gin.Context) {
+	var req orangePay
+	if err := c.ShouldBindJSON(&req); err != nil || req.PayToken == "" || req.SubscriberMsisdn == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "payToken et subscriberMsisdn requis"})
+		return
+	}
+
+	// Le payToken initié est retiré : accept l'enregistre à nouveau, complet
+	s.mu.Lock()
+	op, ok := s.ops[req.PayToken]
+	initiated := ok && op.Status == "INITIATED"
+	if initiated {
+		delete(s.ops, req.PayToken)
+	}
+	s.mu.Unlock()
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"message": "payToken inconnu"})
+		return
+	}
+	if !initiated {
+		c.JSON(http.StatusConflict, gin.H{"message": "payToken déjà utilisé"})
+		return
+	}
+
+	op.Reference, op.Phone, op.Amount, op.Currency = req.OrderID, req.SubscriberMsisdn, req.Amount, ledgerCurrency
+	op.Status, op.CallbackURL = "PENDING", req.NotifURL
+	if status, msg := s.accept(op); status != 0 {
+		c.JSON(status, gin.H{"message": msg})
+		return
+	}
+	c.JSON(http.StatusOK, orangeResponse{Message: "Merchant payment successfully initiated", Data: orangeBody(*op)})
+}
+
+// GET {mp|cashin}/paymentstatus/:id
+func (s *Simulator) orangeStatus(c *gin.Context) {
+	op, ok := s.operation(c.Param("id"), ProviderOrange)
+	if !ok || op.Status == "INITIATED" {
+		c.JSON(http.StatusNotFound, gin.H{"message": "payToken inconnu"})
+		return
+	}
+	c.JSON(http.StatusOK, orangeResponse{Message: "Transaction retrieved successfully", Data: orangeBody(op)})
+}
+
+func orangeKind(res string) (string, bool) {
+	switch res {
+	case "mp":
+		return PaymentCollection, true
+	case "cashin":
+		return PaymentDisbursement, true
+	}
+	return "", false
+}
+
+func orangeBody(op simOperation) orangeData {
+	status := op.Status
+	if status == "SUCCESSFUL" {
+		status = "SUCCESSFULL" // sic
+	}
+	return orangeData{PayToken: op.ID, OrderID: op.Reference, Status: status, TxnID: op.TxnID, Message: op.Reason}
+}
+
+// === COMPORTEMENT ===
+
+// accept enregistre l'opération et programme son issue ; retourne un statut
+// HTTP d'erreur (et son message) si elle est refusée
+func (s *Simulator) accept(op *simOperation) (int, string) {
+	suffix := op.Phone[max(len(op.Phone)-2, 0):]
+	if suffix == "02" {
+		return http.StatusInternalServerError, "erreur interne simulée"
+	}
+
+	s.mu.Lock()
+	if _, exists := s.ops[op.ID]; exists {
+		s.mu.Unlock()
+		return http.StatusConflict, "référence déjà utilisée"
+	}
+	op.CreatedAt = time.Now()
+	s.ops[op.ID] = op
+	s.mu.Unlock()
+
+	if suffix != "01" {
+		time.AfterFunc(s.cfg.CallbackDelay, func() { s.complete(op.ID, suffix != "03") })
+	}
+	return 0, ""
+}
+
+// complete fixe l'issue de l'opération et envoie le callback
+func (s *Simulator) complete(id string, notify bool) {
+	s.mu.Lock()
+	op, ok := s.ops[id]
+	if !ok || op.Status != "PENDING" {
+		s.mu.Unlock()
+		return
+	}
+	switch {
+	case strings.HasSuffix(op.Phone, "00"):
+		op.Status, op.Reason = "FAILED", "NOT_ENOUGH_FUNDS"
+	case rand.Float64() < s.cfg.FailureRate:
+		op.Status, op.Reason = "FAILED", "INTERNAL_PROCESSING_ERROR"
+	default:
+		op.Status, op.TxnID = "SUCCESSFUL", strconv.FormatInt(rand.Int64N(1e10), 10)
+	}
+	snapshot := *op
+	s.mu.Unlock()
+
+	if notify {
+		s.notify(snapshot)
+	}
+}
+
+// notify : PUT (MTN) ou POST (Orange) sur l'URL de callback de l'opération
+func (s *Simulator) notify(op simOperation) {
+	if !s.cfg.Callbacks || op.CallbackURL == "" {
+		return
+	}
+	method, body := http.MethodPut, any(mtnBody(op))
+	if op.Provider == ProviderOrange {
+		method, body = http.MethodPost, orangeBody(op)
+	}
+	data, _ := json.Marshal(body)
+	req, err := http.NewRequest(method, op.CallbackURL, bytes.NewReader(data))
+	if err != nil {
+		s.recordCallback(op.ID, err.Error())
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	result := ""
+	if err != nil {
+		result = err.Error()
+	} else {
+		resp.Body.Close()
+		result = resp.Status
+	}
+	fmt.Printf("[SIM] callback %s %s → %s\n", op.Provider, op.ID, result)
+	s.recordCallback(op.ID, result)
+}
+
+func (s *Simulator) recordCallback(id, result string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if op, ok := s.ops[id]; ok {
+		op.Callback = result
+	}
+}
+
+func (s *Simulator) operation(id, provider string) (simOperation, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	op, ok := s.ops[id]
+	if !ok || op.Provider != provider {
+		return simOperation{}, false
+	}
+	return *op, true
+}
+
+// === INTROSPECTION ===
+
+// GET /_sim/operations (?provider=, ?status=)
+func (s *Simulator) listOperations(c *gin.Context) {
+	s.mu.Lock()
+	ops := make([]simOperation, 0, len(s.ops))
+	for _, op := range s.ops {
+		if p := c.Query("provider"); p != "" && op.Provider != p {
+			continue
+		}
+		if st := c.Query("status"); st != "" && !strings.EqualFold(op.Status, st) {
+			continue
+		}
+		ops = append(ops, *op)
+	}
+	s.mu.Unlock()
+
+	slices.SortFunc(ops, func(a, b simOperation) int { return a.CreatedAt.Compare(b.CreatedAt) })
+	c.JSON(http.StatusOK, gin.H{"data": ops, "count": len(ops)})
+}
+
+// POST /_sim/operations/:id/resolve {"status": "SUCCESSFUL"|"FAILED"} :
+// règle une opération en attente et envoie son callback
+func (s *Simulator) resolveOperation(c *gin.Context) {
+	var req struct {
+		Status string `json:"status" binding:"required,oneof=SUCCESSFUL FAILED"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status : SUCCESSFUL ou FAILED"})
+		return
+	}
+
+	s.mu.Lock()
+	op, ok := s.ops[c.Param("id")]
+	if !ok || op.Status != "PENDING" {
+		s.mu.Unlock()
+		c.JSON(http.StatusNotFound, gin.H{"error": "Aucune opération en attente avec cet id"})
+		return
+	}
+	op.Status = req.Status
+	if req.Status == "FAILED" {
+		op.Reason = "PAYER_LIMIT_REACHED"
+	} else {
+		op.TxnID = strconv.FormatInt(rand.Int64N(1e10), 10)
+	}
+	snapshot := *op
+	s.mu.Unlock()
+
+	s.notify(snapshot)
+	c.JSON(http.StatusOK, snapshot)
+}
+
+// === COMMANDE ===
+
+// === RÉCEPTION DE WEBHOOKS ===
+
+// simWebhook : requête reçue sur /_sim/webhooks/:name
+type simWebhook struct {
+	Event      string    `json:"event"`
+	EventID    string    `json:"event_id"`
+	Delivery   string    `json:"delivery"`
+	Timestamp  string    `json:"timestamp"`
+	Signature  string    `json:"signature"`
+	Body       string    `json:"body"`
+	Status     int       `json:"status"` // code renvoyé
+	ReceivedAt time.Time `json:"received_at"`
+}
+
+// POST /_sim/webhooks/:name (?status= : code à renvoyer)
+func (s *Simulator) receiveWebhook(c *gin.Context) {
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, 1<<20))
+	if err != nil {
+		c.Status(http.StatusBadRequest)
+		return
+	}
+	status := http.StatusOK
+	if n, err := strconv.Atoi(c.Query("status")); err == nil && n >= 200 && n <= 599 {
+		status = n
+	}
+
+	hook := simWebhook{
+		Event:      c.GetHeader("X-Webhook-Event"),
+		EventID:    c.GetHeader("X-Webhook-ID"),
+		Delivery:   c.GetHeader("X-Webhook-Delivery"),
+		Timestamp:  c.GetHeader("X-Webhook-Timestamp"),
+		Signature:  c.GetHeader("X-Webhook-Signature"),
+		Body:       string(body),
+		Status:     status,
+		ReceivedAt: time.Now(),
+	}
+	s.mu.Lock()
+	s.hooks[c.Param("name")] = append(s.hooks[c.Param("name")], hook)
+	s.mu.Unlock()
+
+	fmt.Printf("[SIM] webhook %s %s → %d\n", c.Param("name"), hook.Event, status)
+	c.Status(status)
+}
+
+// GET /_sim/webhooks/:name (?event=)
+func (s *Simulator) listWebhooks(c *gin.Context) {
+	s.mu.Lock()
+	hooks := []simWebhook{}
+	for _, h := range s.hooks[c.Param("name")] {
+		if e := c.Query("event"); e == "" || h.Event == e {
+			hooks = append(hooks, h)
+		}
+	}
+	s.mu.Unlock()
+
+	c.JSON(http.StatusOK, gin.H{"data": hooks, "count": len(hooks)})
+}
+
+// GET /_sim/webhooks/:name/last : corps reçu octet pour octet, headers
+// X-Webhook-* recopiés
+func (s *Simulator) lastWebhook(c *gin.Context) {
+	s.mu.Lock()
+	hooks := s.hooks[c.Param("name")]
+	var hook simWebhook
+	if len(hooks) > 0 {
+		hook = hooks[len(hooks)-1]
+	}
+	s.mu.Unlock()
+
+	if hook.ReceivedAt.IsZero() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "aucun webhook reçu"})
+		return
+	}
+	c.Header("X-Webhook-Event", hook.Event)
+	c.Header("X-Webhook-ID", hook.EventID)
+	c.Header("X-Webhook-Delivery", hook.Delivery)
+	c.Header("X-Webhook-Timestamp", hook.Timestamp)
+	c.Header("X-Webhook-Signature", hook.Signature)
+	c.Data(http.StatusOK, "application/json", []byte(hook.Body))
+}
+
+func runSimulateCommand(args []string) int {
+	cfg := loadSimulatorConfig()
+	fs := flag.NewFlagSet("simulate", flag.ContinueOnError)
+	fs.StringVar(&cfg.Port, "port", cfg.Port, "port d'écoute")
+	fs.DurationVar(&cfg.Latency, "latency", cfg.Latency, "délai de chaque réponse")
+	fs.DurationVar(&cfg.CallbackDelay, "callback-delay", cfg.CallbackDelay, "délai avant l'issue et le callback")
+	fs.Float64Var(&cfg.FailureRate, "failure-rate", cfg.FailureRate, "probabilité d'échec (0 à 1)")
+	fs.BoolVar(&cfg.Callbacks, "callbacks", cfg.Callbacks, "envoyer les callbacks")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if cfg.FailureRate < 0 || cfg.FailureRate > 1 {
+		fmt.Fprintln(os.Stderr, "❌ -failure-rate doit être entre 0 et 1")
+		return 2
+	}
+
+	fmt.Printf("📱 Simulateur MTN/Orange sur :%s (callbacks après %s, échecs %.0f%%)\n",
+		cfg.Port, cfg.CallbackDelay, cfg.FailureRate*100)
+	if err := http.ListenAndServe(":"+cfg.Port, NewSimulator(cfg).Router()); err != nil {
+		fmt.Fprintln(os.Stderr, "❌", err)
+		return 1
+	}
+	return 0
+}
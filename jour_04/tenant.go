@@ -0,0 +1,390 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// === MULTI-TENANT ===
+//
+// Chaque marchand (tenant) a ses propres users, posts, tags et commentaires.
+// Tout modèle GORM ayant un champ TenantID est isolé par des callbacks :
+// chaque SELECT, UPDATE et DELETE reçoit WHERE tenant_id = <tenant du
+// contexte>, chaque INSERT est estampillé, et tenant_id n'est jamais mis à
+// jour. Sans tenant dans le contexte, la requête échoue (ErrNoTenant) :
+// un oubli ne peut pas lire les lignes de tous les tenants.
+//
+// Seul le SQL brut (Raw, Exec) échappe aux callbacks ; il filtre lui-même
+// avec tenantOf (voir search.go).
+//
+// Le tenant d'une requête HTTP vient, au choix :
+//   - du claim "tenant" d'un JWT HS256 (Authorization: Bearer, TENANT_JWT_SECRET)
+//   - du sous-domaine (<tenant>.TENANT_DOMAIN)
+//   - du header X-Tenant-ID
+//
+// Avec TENANT_JWT_SECRET, le token est obligatoire (401 sans token valide) :
+// sous-domaine et header ne font que le confirmer, un client ne choisit pas
+// son tenant. Sans secret (développement), sous-domaine et header suffisent.
+// Des sources en désaccord sont refusées (403). Sans aucune source, le tenant
+// est TENANT_DEFAULT ("default"), ou 400 avec TENANT_REQUIRED=true. TENANTS
+// (liste séparée par des virgules) restreint les tenants acceptés. Les
+// routes /admin (ADMIN_TOKEN) prennent le tenant du sous-domaine ou du
+// header, sans token : l'opérateur est déjà authentifié.
+//
+// L'utilisateur appelant (émetteur d'un virement, titulaire d'un paiement,
+// auteur d'un commentaire) est le claim "sub" du même token, son rôle (ciblage
+// des feature flags) le claim "role". Les headers X-User-ID et X-User-Role ne
+// sont lus qu'avec AUTH_TRUST_USER_HEADER=true (développement, tests) : sinon
+// n'importe quel client débiterait le portefeuille de son choix.
+
+const defaultTenant = "default"
+
+var (
+	ErrNoTenant = errors.New("aucun tenant dans le contexte")
+
+	errInvalidToken = errors.New("token invalide")
+)
+
+type tenantKey struct{}
+
+type callerKey struct{}
+
+type allTenantsKey struct{}
+
+// withTenant rattache les requêtes faites avec ce contexte au tenant (et
+// annule un allTenants hérité)
+func withTenant(ctx context.Context, tenant string) context.Context {
+	ctx = context.WithValue(ctx, allTenantsKey{}, false)
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// tenantOf retourne le tenant du contexte
+func tenantOf(ctx context.Context) (string, bool) {
+	tenant, ok := ctx.Value(tenantKey{}).(string)
+	return tenant, ok && tenant != ""
+}
+
+// identity : utilisateur authentifié et son rôle
+type identity struct {
+	UserID uint
+	Role   string
+}
+
+// withCaller rattache l'utilisateur authentifié au contexte
+func withCaller(ctx context.Context, who identity) context.Context {
+	return context.WithValue(ctx, callerKey{}, who)
+}
+
+// callerOf retourne l'utilisateur authentifié du contexte (0 si aucun)
+func callerOf(ctx context.Context) uint {
+	who, _ := ctx.Value(callerKey{}).(identity)
+	return who.UserID
+}
+
+// callerRoleOf retourne le rôle de l'appelant ("" si aucun)
+func callerRoleOf(ctx context.Context) string {
+	who, _ := ctx.Value(callerKey{}).(identity)
+	return who.Role
+}
+
+// allTenants lève le filtre des lectures, même si ctx a un tenant
+// (maintenance : liste des tenants, comptages). Les INSERT exigent toujours
+// un tenant.
+func allTenants(ctx context.Context) context.Context {
+	return context.WithValue(ctx, allTenantsKey{}, true)
+}
+
+func isAllTenants(ctx context.Context) bool {
+	all, _ := ctx.Value(allTenantsKey{}).(bool)
+	return all
+}
+
+// === CALLBACKS GORM ===
+
+// registerTenantScoping branche l'isolation sur toutes les opérations GORM
+func registerTenantScoping(db *gorm.DB) error {
+	cb := db.Callback()
+	return errors.Join(
+		cb.Create().Before("gorm:create").Register("tenant:stamp", stampTenant),
+		cb.Query().Before("gorm:query").Register("tenant:filter_query", filterTenant),
+		cb.Row().Before("gorm:row").Register("tenant:filter_row", filterTenant),
+		cb.Update().Before("gorm:update").Register("tenant:filter_update", func(tx *gorm.DB) {
+			filterTenant(tx)
+			// Une ligne ne change jamais de tenant
+			if field := tenantField(tx.Statement.Schema); field != nil {
+				tx.Statement.Omits = append(tx.Statement.Omits, field.DBName)
+			}
+		}),
+		cb.Delete().Before("gorm:delete").Register("tenant:filter_delete", filterTenant),
+	)
+}
+
+// tenantField retourne le champ TenantID du modèle, nil s'il n'est pas isolé
+func tenantField(sch *schema.Schema) *schema.Field {
+	if sch == nil {
+		return nil
+	}
+	return sch.LookUpField("TenantID")
+}
+
+func filterTenant(tx *gorm.DB) {
+	stmt := tx.Statement
+	field := tenantField(stmt.Schema)
+	if field == nil || tx.Error != nil {
+		return
+	}
+
+	if isAllTenants(stmt.Context) {
+		return
+	}
+	tenant, ok := tenantOf(stmt.Context)
+	if !ok {
+		tx.AddError(ErrNoTenant)
+		return
+	}
+	stmt.AddClause(clause.Where{Exprs: []clause.Expression{
+		clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: tenant},
+	}})
+}
+
+func stampTenant(tx *gorm.DB) {
+	stmt := tx.Statement
+	field := tenantField(stmt.Schema)
+	if field == nil || tx.Error != nil {
+		return
+	}
+
+	tenant, ok := tenantOf(stmt.Context)
+	if !ok {
+		tx.AddError(ErrNoTenant)
+		return
+	}
+	rv := stmt.ReflectValue
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			if err := field.Set(stmt.Context, reflect.Indirect(rv.Index(i)), tenant); err != nil {
+				tx.AddError(err)
+			}
+		}
+	case reflect.Struct:
+		if err := field.Set(stmt.Context, rv, tenant); err != nil {
+			tx.AddError(err)
+		}
+	}
+}
+
+// TenantDirectory liste les tenants ayant des données
+type TenantDirectory interface {
+	List(ctx context.Context) ([]string, error)
+}
+
+type gormTenantDirectory struct {
+	db *gorm.DB
+}
+
+func NewGormTenantDirectory(db *gorm.DB) TenantDirectory {
+	return &gormTenantDirectory{db: db}
+}
+
+// List : tenants ayant au moins un utilisateur (corbeille comprise), les
+// posts et commentaires appartenant à des utilisateurs du même tenant
+func (d *gormTenantDirectory) List(ctx context.Context) ([]string, error) {
+	var tenants []string
+	err := dbFromContext(allTenants(ctx), d.db).Unscoped().Model(&User{}).
+		Distinct("tenant_id").Order("tenant_id").Pluck("tenant_id", &tenants).Error
+	return tenants, err
+}
+
+// === RÉSOLUTION DU TENANT (HTTP) ===
+
+type TenantConfig struct {
+	Default   string   // tenant sans source (vide si TENANT_REQUIRED)
+	Allowed   []string // vide = tout slug valide
+	Domain    string   // domaine parent des sous-domaines de tenant
+	JWTSecret []byte   // non vide = token obligatoire ; vide = tokens ignorés
+	// TrustUserHeader : X-User-ID et X-User-Role acceptés comme appelant
+	// sans token (AUTH_TRUST_USER_HEADER, développement et tests uniquement)
+	TrustUserHeader bool
+}
+
+func loadTenantConfig() TenantConfig {
+	cfg := TenantConfig{
+		Default:   os.Getenv("TENANT_DEFAULT"),
+		Domain:    strings.ToLower(strings.TrimPrefix(os.Getenv("TENANT_DOMAIN"), ".")),
+		JWTSecret: []byte(os.Getenv("TENANT_JWT_SECRET")),
+	}
+	if cfg.Default == "" {
+		cfg.Default = defaultTenant
+	}
+	if strings.EqualFold(os.Getenv("TENANT_REQUIRED"), "true") {
+		cfg.Default = ""
+	}
+	cfg.TrustUserHeader = strings.EqualFold(os.Getenv("AUTH_TRUST_USER_HEADER"), "true")
+	for _, t := range strings.Split(os.Getenv("TENANTS"), ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			cfg.Allowed = append(cfg.Allowed, t)
+		}
+	}
+	return cfg
+}
+
+// TenantMiddleware résout le tenant de la requête et le place dans son contexte
+func TenantMiddleware(cfg TenantConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		type source struct{ name, tenant string }
+		var sources []source
+		var caller identity
+
+		if len(cfg.JWTSecret) > 0 {
+			token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+			if !ok {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Token de tenant requis (Authorization: Bearer)"})
+				return
+			}
+			claims, err := parseTenantToken(token, cfg.JWTSecret, time.Now())
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Token de tenant invalide"})
+				return
+			}
+			// En premier : les autres sources doivent le confirmer
+			sources = append(sources, source{"token", claims.Tenant})
+			caller = identity{UserID: claims.UserID, Role: claims.Role}
+		}
+		if cfg.TrustUserHeader {
+			if caller.UserID == 0 {
+				id, _ := strconv.ParseUint(c.GetHeader("X-User-ID"), 10, 32)
+				caller.UserID = uint(id)
+			}
+			if caller.Role == "" {
+				caller.Role = c.GetHeader("X-User-Role")
+			}
+		}
+		if tenant := tenantFromHost(c.Request.Host, cfg.Domain); tenant != "" {
+			sources = append(sources, source{"sous-domaine", tenant})
+		}
+		if tenant := c.GetHeader("X-Tenant-ID"); tenant != "" {
+			sources = append(sources, source{"X-Tenant-ID", tenant})
+		}
+
+		tenant := cfg.Default
+		if len(sources) > 0 {
+			tenant = sources[0].tenant
+			for _, s := range sources[1:] {
+				if s.tenant != tenant {
+					c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+						"error": "Tenant incohérent : " + sources[0].name + " et " + s.name + " diffèrent",
+					})
+					return
+				}
+			}
+		}
+
+		switch {
+		case tenant == "":
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": "Tenant requis (token, sous-domaine ou X-Tenant-ID)",
+			})
+			return
+		case len(tenant) > 64 || !slugRegex.MatchString(tenant):
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Tenant invalide : " + tenant})
+			return
+		case len(cfg.Allowed) > 0 && !slices.Contains(cfg.Allowed, tenant):
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Tenant inconnu : " + tenant})
+			return
+		}
+
+		ctx := withTenant(c.Request.Context(), tenant)
+		if caller != (identity{}) {
+			ctx = withCaller(ctx, caller)
+		}
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
+
+// tenantFromHost : "boutique.api.afaapay.cm" donne "boutique" pour le
+// domaine "api.afaapay.cm"
+func tenantFromHost(host, domain string) string {
+	if domain == "" {
+		return ""
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	sub, ok := strings.CutSuffix(strings.ToLower(host), "."+domain)
+	if !ok {
+		return ""
+	}
+	return sub
+}
+
+// tenantClaims : claims utiles d'un token de tenant ; UserID vient de "sub"
+// (identifiant numérique en chaîne, 0 si absent)
+type tenantClaims struct {
+	Tenant string
+	UserID uint
+	Role   string
+}
+
+// parseTenantToken vérifie un JWT HS256 et retourne ses claims "tenant",
+// "sub" et "role"
+func parseTenantToken(token string, secret []byte, now time.Time) (tenantClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return tenantClaims{}, errInvalidToken
+	}
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	signature, err := base64.RawURLEncoding.Strict().DecodeString(parts[2])
+	if err != nil || subtle.ConstantTimeCompare(signature, mac.Sum(nil)) != 1 {
+		return tenantClaims{}, errInvalidToken
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	var claims struct {
+		Tenant string `json:"tenant"`
+		Sub    string `json:"sub"`
+		Role   string `json:"role"`
+		Exp    int64  `json:"exp"`
+	}
+	for i, dest := range []interface{}{&header, &claims} {
+		raw, err := base64.RawURLEncoding.DecodeString(parts[i])
+		if err != nil || json.Unmarshal(raw, dest) != nil {
+			return tenantClaims{}, errInvalidToken
+		}
+	}
+	if header.Alg != "HS256" || claims.Tenant == "" || (claims.Exp != 0 && now.Unix() >= claims.Exp) {
+		return tenantClaims{}, errInvalidToken
+	}
+	result := tenantClaims{Tenant: claims.Tenant, Role: claims.Role}
+	if claims.Sub != "" {
+		id, err := strconv.ParseUint(claims.Sub, 10, 32)
+		if err != nil || id == 0 {
+			return tenantClaims{}, errInvalidToken
+		}
+		result.UserID = uint(id)
+	}
+	return result, nil
+}
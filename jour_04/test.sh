@@ -0,0 +1,1252 @@
+#!/bin/bash
+
+# Tests de bout en bout de l'API Jour 4 sur SQLite (aucun service externe)
+# Usage: ./test.sh               (repositories GORM)
+#        STORE=memory ./test.sh  (repositories en mémoire)
+#
+# Le script compile le serveur, le démarre sur une base SQLite temporaire,
+# vérifie les codes HTTP attendus puis arrête le serveur.
+
+PORT="${PORT:-18080}"
+BASE_URL="http://localhost:$PORT"
+ADMIN_TOKEN="test-admin-token"
+TENANT_JWT_SECRET="test-tenant-secret"
+
+# Couleurs pour l'affichage
+GREEN='\033[0;32m'
+RED='\033[0;31m'
+BLUE='\033[0;34m'
+NC='\033[0m' # No Color
+
+WORKDIR=$(mktemp -d)
+FAILED=0
+PASSED=0
+
+cleanup() {
+    [ -n "$SERVER_PID" ] && kill "$SERVER_PID" 2>/dev/null
+    [ -n "$REPLICA_PID" ] && kill "$REPLICA_PID" 2>/dev/null
+    [ -n "$AUTH_PID" ] && kill "$AUTH_PID" 2>/dev/null
+    [ -n "$NOFTS_PID" ] && kill "$NOFTS_PID" 2>/dev/null
+    [ -n "$REDIS_PID" ] && kill "$REDIS_PID" 2>/dev/null
+    [ -n "$SIM_PID" ] && kill "$SIM_PID" 2>/dev/null
+    rm -rf "$WORKDIR"
+}
+trap cleanup EXIT
+
+echo "🧪 Tests de l'API Jour 4 - GORM (SQLite temporaire)"
+echo "===================================================="
+echo ""
+
+echo "🔨 Compilation..."
+go build -tags sqlite_fts5 -o "$WORKDIR/api" . || exit 1
+
+DB_DRIVER=sqlite DB_DSN="$WORKDIR/test.db" PORT=$PORT ADMIN_TOKEN=$ADMIN_TOKEN \
+TENANT_DOMAIN=api.test AUTH_TRUST_USER_HEADER=true \
+COMMENTS_MAX_DEPTH=2 COMMENTS_EDIT_WINDOW=3s BACKUP_DIR="$WORKDIR/backups" BACKUP_KEEP=2 \
+TRANSFER_MAX_AMOUNT=5000 TRANSFER_DAILY_LIMIT=8000 \
+PAYMENT_SIMULATOR_URL="http://localhost:$((PORT + 3))" PAYMENT_CALLBACK_URL=$BASE_URL \
+PAYMENT_PROVIDER_TIMEOUT=1s PAYMENT_POLL_INTERVAL=1h \
+WEBHOOK_POLL_INTERVAL=100ms WEBHOOK_RETRY_BASE=100ms WEBHOOK_RETRY_MAX=200ms WEBHOOK_MAX_ATTEMPTS=3 \
+WEBHOOK_ALLOW_PRIVATE=true \
+GIN_MODE=release "$WORKDIR/api" > "$WORKDIR/server.log" 2>&1 &
+SERVER_PID=$!
+
+# Attendre que le serveur réponde
+for i in $(seq 1 50); do
+    curl -s "$BASE_URL/" > /dev/null && break
+    sleep 0.2
+done
+
+# Fonction de vérification : check <nom> <status attendu> <méthode> <endpoint> [data] [headers...]
+check() {
+    local name=$1
+    local expected=$2
+    local method=$3
+    local endpoint=$4
+    local data=$5
+    shift 5 2>/dev/null || shift $#
+
+    local args=(-s -w "\n%{http_code}" -X "$method" "$BASE_URL$endpoint")
+    local content_type="Content-Type: application/json"
+    for h in "$@"; do
+        args+=(-H "$h")
+        [[ "$h" == Content-Type:* ]] && content_type=""
+    done
+    if [ -n "$data" ]; then
+        [ -n "$content_type" ] && args+=(-H "$content_type")
+        args+=(--data-binary "$data")
+    fi
+
+    response=$(curl "${args[@]}")
+    http_code=$(echo "$response" | tail -n1)
+    body=$(echo "$response" | head -n-1)
+
+    if [ "$http_code" = "$expected" ]; then
+        echo -e "${GREEN}✔${NC} $name ($http_code)"
+        PASSED=$((PASSED + 1))
+    else
+        echo -e "${RED}✘ $name : attendu $expected, reçu $http_code${NC}"
+        echo "  $body"
+        FAILED=$((FAILED + 1))
+    fi
+}
+
+# Vérifie que le corps de la dernière réponse contient (ou non, avec !) un motif :
+# expect <nom> [!] <motif>
+expect() {
+    local name=$1
+    local negate=""
+    if [ "$2" = "!" ]; then
+        negate=1
+        shift
+    fi
+    local pattern=$2
+
+    local found=""
+    echo "$body" | grep -qF -- "$pattern" && found=1
+
+    if [ "$found" != "$negate" ]; then
+        echo -e "${GREEN}✔${NC} $name"
+        PASSED=$((PASSED + 1))
+    else
+        echo -e "${RED}✘ $name : motif ${negate:+absent }attendu $pattern${NC}"
+        echo "  $body"
+        FAILED=$((FAILED + 1))
+    fi
+}
+
+echo -e "${BLUE}📝 1. Users${NC}"
+check "Créer un utilisateur" 201 POST "/v1/users" \
+    '{"name":"Noah Mvondo","email":"noah@example.com","age":25,"phone":"+237699112233"}'
+check "Email déjà utilisé" 409 POST "/v1/users" \
+    '{"name":"Noah Bis","email":"noah@example.com","age":30}'
+expect "  champ en conflit" '"field":"email"'
+check "Email déjà utilisé (casse différente)" 409 POST "/v1/users" \
+    '{"name":"Noah Bis","email":"Noah@Example.COM","age":30}'
+check "Validation par champ" 400 POST "/v1/users" \
+    '{"name":"A","email":"invalide","age":0}'
+check "Lister les utilisateurs" 200 GET "/v1/users"
+check "Récupérer l'utilisateur 1" 200 GET "/v1/users/1"
+check "Utilisateur inexistant" 404 GET "/v1/users/999"
+
+echo -e "${BLUE}📝 2. Posts${NC}"
+check "Créer un post" 201 POST "/v1/posts" \
+    '{"title":"Premier post","content":"Contenu du premier post","user_id":1}'
+check "Post avec auteur inexistant" 400 POST "/v1/posts" \
+    '{"title":"Orphelin","content":"Contenu sans auteur","user_id":999}'
+check "Posts de l'utilisateur 1" 200 GET "/v1/users/1/posts"
+
+echo -e "${BLUE}🚩 3. Feature flags${NC}"
+check "v2 masquée sans flag" 404 GET "/v2/profile" "" "X-User-ID: 1"
+check "Admin sans token" 401 GET "/admin/flags"
+check "Créer le flag v2_profile" 201 POST "/admin/flags" \
+    '{"key":"v2_profile","enabled":true}' "Authorization: Bearer $ADMIN_TOKEN"
+check "v2 visible avec flag" 200 GET "/v2/profile" "" "X-User-ID: 1"
+
+echo -e "${BLUE}🗑️  4. Suppressions (ondelete)${NC}"
+check "Créer l'utilisateur 2" 201 POST "/v1/users" \
+    '{"name":"Awa Ngono","email":"awa@example.com","age":31}'
+check "Créer un post de l'utilisateur 2" 201 POST "/v1/posts" \
+    '{"title":"Post à supprimer","content":"Supprimé avec son auteur","user_id":2}'
+check "Supprimer l'utilisateur 2" 200 DELETE "/v1/users/2"
+check "Post supprimé en cascade" 404 GET "/v1/posts/2"
+check "Posts de l'utilisateur 1 conservés" 200 GET "/v1/posts/1"
+
+echo -e "${BLUE}✏️  5. Mises à jour${NC}"
+check "Créer l'utilisateur 3" 201 POST "/v1/users" \
+    '{"name":"Bella Eto","email":"bella@example.com","age":28}'
+
+# Cas : nom | status | endpoint | corps | motif attendu dans la réponse ("!motif" = absent)
+UPDATE_CASES=(
+    "Utilisateur inexistant|404|/v1/users/999|{\"name\":\"Fantome\",\"email\":\"f@example.com\",\"age\":20}|Utilisateur non trouvé"
+    "Validation par champ|400|/v1/users/1|{\"name\":\"N\",\"email\":\"noah@example.com\",\"age\":25}|\"fields\""
+    "Email d'un autre utilisateur|409|/v1/users/1|{\"name\":\"Noah Mvondo\",\"email\":\"bella@example.com\",\"age\":25}|Email déjà utilisé"
+    "Email d'un autre utilisateur (casse)|409|/v1/users/1|{\"name\":\"Noah Mvondo\",\"email\":\"BELLA@example.com\",\"age\":25}|\"field\":\"email\""
+    "Ligne enregistrée renvoyée|200|/v1/users/1|{\"id\":42,\"name\":\"Noah M.\",\"email\":\"noah@example.com\",\"age\":26}|\"phone\":\"+237699112233\""
+    "Valeur zéro appliquée|200|/v1/users/1|{\"name\":\"Noah M.\",\"email\":\"noah@example.com\",\"age\":26,\"phone\":\"\"}|!\"phone\""
+    "Corps partiel (âge seul)|200|/v1/users/1|{\"age\":27}|\"name\":\"Noah M.\",\"email\":\"noah@example.com\",\"age\":27"
+    "Corps partiel validé|400|/v1/users/1|{\"age\":200}|\"age\":[\"doit être inférieur ou égal à 150\"]"
+    "Zéro explicite sur un champ requis|400|/v1/users/1|{\"age\":0}|\"age\":[\"ce champ est requis\"]"
+    "Champs absents non validés|400|/v1/users/1|{\"age\":0}|!\"name\""
+    "Corps vide|200|/v1/users/1|{}|\"age\":27"
+    "Post inexistant|404|/v1/posts/999|{\"title\":\"Titre\",\"content\":\"Contenu modifié\",\"user_id\":1}|Post non trouvé"
+    "Post vers auteur inexistant|400|/v1/posts/1|{\"title\":\"Titre\",\"content\":\"Contenu modifié\",\"user_id\":999}|Utilisateur non trouvé"
+    "Post déplacé vers l'utilisateur 3|200|/v1/posts/1|{\"title\":\"Titre\",\"content\":\"Contenu modifié\",\"user_id\":3}|\"user_id\":3"
+    "Post partiel (titre seul)|200|/v1/posts/1|{\"title\":\"Titre revu\"}|\"content\":\"Contenu modifié\",\"user_id\":3"
+    "Post partiel validé|400|/v1/posts/1|{\"content\":\"Court\"}|\"content\":[\"doit contenir au moins 10 caractères\"]"
+)
+for case in "${UPDATE_CASES[@]}"; do
+    IFS='|' read -r name status endpoint data pattern <<< "$case"
+    check "PUT $name" "$status" PUT "$endpoint" "$data"
+    if [ "${pattern:0:1}" = "!" ]; then
+        expect "  réponse de \"$name\"" ! "${pattern:1}"
+    else
+        expect "  réponse de \"$name\"" "$pattern"
+    fi
+done
+check "Post 999 toujours absent" 404 GET "/v1/posts/999"
+check "Auteur du post 1 persisté" 200 GET "/v1/posts/1"
+expect "  user_id persisté" '"user_id":3'
+
+echo -e "${BLUE}🏷️  6. Tags${NC}"
+check "Créer le tag go" 201 POST "/v1/tags" '{"name":"go"}'
+check "Créer le tag gin" 201 POST "/v1/tags" '{"name":"gin"}'
+check "Tag en doublon" 409 POST "/v1/tags" '{"name":"go"}'
+check "Tag invalide" 400 POST "/v1/tags" '{"name":"Go Lang"}'
+check "Taguer le post 1 (go, gin)" 200 POST "/v1/posts/1/tags" '{"tags":["go","gin"]}'
+expect "  tags préchargés" '"name":"gin"'
+check "Tag inconnu" 400 POST "/v1/posts/1/tags" '{"tags":["rust"]}'
+check "Taguer un post inexistant" 404 POST "/v1/posts/999/tags" '{"tags":["go"]}'
+check "Créer un post tagué go" 201 POST "/v1/posts" \
+    '{"title":"Second post","content":"Contenu du second post","user_id":1}'
+check "Taguer le post 3 (go)" 200 POST "/v1/posts/3/tags" '{"tags":["go"]}'
+check "Posts tagués go" 200 GET "/v1/posts?tag=go"
+expect "  deux posts" '"total":2'
+check "Posts tagués go ou gin" 200 GET "/v1/posts?tag=go&tag=gin"
+expect "  deux posts" '"total":2'
+check "Posts tagués go et gin" 200 GET "/v1/posts?tag=go&tag=gin&match=all"
+expect "  un post" '"total":1'
+check "match invalide" 400 GET "/v1/posts?tag=go&match=some"
+check "Compteurs par tag" 200 GET "/v1/tags"
+expect "  go sur deux posts" '"name":"go","posts_count":2'
+check "Retirer gin du post 1" 200 DELETE "/v1/posts/1/tags" '{"tags":["gin"]}'
+expect "  gin retiré" ! '"name":"gin"'
+check "Supprimer le post 3" 200 DELETE "/v1/posts/3"
+check "Compteurs après suppression" 200 GET "/v1/tags"
+expect "  go sur un post" '"name":"go","posts_count":1'
+
+echo -e "${BLUE}💬 7. Commentaires (profondeur max 2, modification pendant 3s)${NC}"
+check "Commenter sans X-User-ID" 401 POST "/v1/posts/1/comments" '{"content":"Anonyme"}'
+check "Commenter le post 1" 201 POST "/v1/posts/1/comments" '{"content":"Premier commentaire"}' "X-User-ID: 1"
+check "Répondre (profondeur 1)" 201 POST "/v1/posts/1/comments" \
+    '{"content":"Réponse","parent_id":1}' "X-User-ID: 3"
+check "Répondre (profondeur 2)" 201 POST "/v1/posts/1/comments" \
+    '{"content":"Réponse à la réponse","parent_id":2}' "X-User-ID: 1"
+check "Profondeur maximale" 400 POST "/v1/posts/1/comments" \
+    '{"content":"Trop profond","parent_id":3}' "X-User-ID: 3"
+check "Parent inexistant" 400 POST "/v1/posts/1/comments" \
+    '{"content":"Orphelin","parent_id":999}' "X-User-ID: 1"
+check "Post inexistant" 404 POST "/v1/posts/999/comments" '{"content":"Perdu"}' "X-User-ID: 1"
+check "Auteur inexistant" 400 POST "/v1/posts/1/comments" '{"content":"Fantôme"}' "X-User-ID: 999"
+check "Liste à plat" 200 GET "/v1/posts/1/comments"
+expect "  trois commentaires" '"total":3'
+check "Arbre" 200 GET "/v1/posts/1/comments?format=tree"
+expect "  un fil" '"total":1'
+expect "  réponses imbriquées" '"replies":[{'
+check "Nombre de commentaires des posts" 200 GET "/v1/posts"
+expect "  comments_count" '"comments_count":3'
+check "Nombre de commentaires des posts d'un utilisateur" 200 GET "/v1/users/3?include=posts"
+expect "  comments_count" '"comments_count":3'
+check "Commentaire sur un autre post" 404 GET "/v1/posts/999/comments/1"
+check "Modifier le commentaire d'un autre" 403 PUT "/v1/posts/1/comments/1" '{"content":"Pirate"}' "X-User-ID: 3"
+check "Modifier son commentaire" 200 PUT "/v1/posts/1/comments/1" '{"content":"Commentaire corrigé"}' "X-User-ID: 1"
+expect "  contenu enregistré" '"content":"Commentaire corrigé"'
+check "Supprimer sa réponse (et ses réponses)" 200 DELETE "/v1/posts/1/comments/2" "" "X-User-ID: 3"
+check "Réponse imbriquée supprimée" 404 GET "/v1/posts/1/comments/3"
+check "Créer l'utilisateur 4" 201 POST "/v1/users" '{"name":"Chris Abena","email":"chris@example.com","age":40}'
+check "Commentaire de l'utilisateur 4" 201 POST "/v1/posts/1/comments" '{"content":"Bientôt parti"}' "X-User-ID: 4"
+check "Supprimer l'utilisateur 4" 200 DELETE "/v1/users/4"
+check "Commentaire conservé" 200 GET "/v1/posts/1/comments/4"
+expect "  auteur à la corbeille" ! '"user":'
+check "Purger la corbeille" 200 POST "/admin/purge?older_than=0s" "" "Authorization: Bearer $ADMIN_TOKEN"
+expect "  utilisateurs 2 et 4 purgés" '"users":2'
+check "Commentaire après la purge" 200 GET "/v1/posts/1/comments/4"
+expect "  auteur remplacé" '"name":"Utilisateur supprimé"'
+sleep 3
+check "Modifier après le délai" 403 PUT "/v1/posts/1/comments/1" '{"content":"Trop tard"}' "X-User-ID: 1"
+check "Supprimer le post 1" 200 DELETE "/v1/posts/1"
+check "Commentaires du post supprimé" 404 GET "/v1/posts/1/comments"
+
+echo -e "${BLUE}🔎 8. Recherche${NC}"
+check "Créer un post sur SQLite" 201 POST "/v1/posts" \
+    '{"title":"Recherche plein texte avec SQLite","content":"Les triggers tiennent la table FTS5 a jour","user_id":3}'
+check "Créer un post sur la pagination" 201 POST "/v1/posts" \
+    '{"title":"Pagination","content":"La recherche plein texte couvre aussi le contenu","user_id":3}'
+check "Rechercher sqlite" 200 GET "/v1/search?q=sqlite"
+expect "  un résultat" '"total":1'
+expect "  titre surligné" '\u003cmark\u003eSQLite\u003c/mark\u003e'
+check "Rechercher plein texte" 200 GET "/v1/search?q=plein+texte"
+expect "  deux résultats" '"total":2'
+expect "  titre d'abord" '"results":[{"post":{"id":4,'
+check "Tous les termes requis" 200 GET "/v1/search?q=pagination+sqlite"
+expect "  aucun résultat" '"results":[]'
+check "Renommer le post 5" 200 PUT "/v1/posts/5" \
+    '{"title":"Pagination avec SQLite","content":"La recherche plein texte couvre aussi le contenu","user_id":3}'
+check "Index mis à jour" 200 GET "/v1/search?q=sqlite"
+expect "  deux résultats" '"total":2'
+check "Supprimer le post 4" 200 DELETE "/v1/posts/4"
+check "Post supprimé de l'index" 200 GET "/v1/search?q=sqlite"
+expect "  un résultat" '"total":1'
+check "Recherche sans q" 400 GET "/v1/search"
+check "Recherche sans mot" 400 GET "/v1/search?q=%2B%2A"
+
+# Binaire compilé sans -tags sqlite_fts5 : la migration de l'index est
+# sautée et la recherche passe par LIKE, au lieu de refuser de démarrer
+go build -o "$WORKDIR/api-nofts" . || exit 1
+NOFTS_DB="$WORKDIR/nofts.db"
+body=$(DB_DSN="$NOFTS_DB" "$WORKDIR/api-nofts" migrate up 2>&1 && DB_DSN="$NOFTS_DB" "$WORKDIR/api-nofts" migrate status 2>&1)
+expect "Sans FTS5 : migrations appliquées" "add_webhook_owner"
+expect "  index plein texte sauté" "add_posts_search                    en attente, sautée"
+NOFTS_PORT=$((PORT + 5))
+DB_DSN="$NOFTS_DB" DB_AUTO_MIGRATE=false PORT=$NOFTS_PORT GIN_MODE=release \
+    "$WORKDIR/api-nofts" > "$WORKDIR/nofts.log" 2>&1 &
+NOFTS_PID=$!
+MAIN_URL=$BASE_URL
+BASE_URL="http://localhost:$NOFTS_PORT"
+for i in $(seq 1 50); do
+    curl -s "$BASE_URL/" > /dev/null && break
+    sleep 0.2
+done
+check "Sans FTS5 : le serveur démarre" 201 POST "/v1/users" '{"name":"Awa Ngono","email":"awa@example.com","age":31}'
+check "  créer un post" 201 POST "/v1/posts" \
+    '{"title":"Recherche avec SQLite","content":"Sans FTS5, LIKE parcourt les posts","user_id":1}'
+check "  rechercher (LIKE)" 200 GET "/v1/search?q=SQLITE+like"
+expect "  trouvé, casse ignorée" '"total":1'
+expect "  titre surligné" '\u003cmark\u003eSQLite\u003c/mark\u003e'
+check "  tous les termes requis" 200 GET "/v1/search?q=sqlite+pagination"
+expect "  aucun résultat" '"results":[]'
+kill "$NOFTS_PID" 2>/dev/null
+wait "$NOFTS_PID" 2>/dev/null
+BASE_URL=$MAIN_URL
+body=$(DB_DSN="$NOFTS_DB" "$WORKDIR/api" migrate up 2>&1)
+expect "Avec le tag : la migration sautée est appliquée" "add_posts_search"
+body=$(DB_DSN="$NOFTS_DB" "$WORKDIR/api-nofts" migrate status 2>&1)
+expect "  base indexée refusée sans le tag" "compiler avec -tags sqlite_fts5"
+
+echo -e "${BLUE}🧩 9. Champs et relations (?fields=, ?include=)${NC}"
+check "Taguer le post 5 (go)" 200 POST "/v1/posts/5/tags" '{"tags":["go"]}'
+check "Commenter le post 5" 201 POST "/v1/posts/5/comments" '{"content":"Bien vu"}' "X-User-ID: 1"
+check "Utilisateur sans relations par défaut" 200 GET "/v1/users/3"
+expect "  pas de posts" ! '"posts"'
+check "Champs choisis" 200 GET "/v1/users?fields=id,name"
+expect "  nom renvoyé" '"name":"Noah M."'
+expect "  email absent" ! '"email"'
+check "Posts et tags inclus" 200 GET "/v1/users/3?fields=name&include=posts.tags"
+expect "  posts inclus" '"posts":[{'
+expect "  tags inclus" '"name":"go"'
+expect "  age absent" ! '"age"'
+check "Posts sans auteur par défaut" 200 GET "/v1/posts"
+expect "  pas d'auteur" ! '"user":'
+check "Auteur inclus, titre seul" 200 GET "/v1/posts?fields=title&include=user"
+expect "  auteur inclus" '"user":{"id":3'
+expect "  contenu absent" ! '"content"'
+check "Commentaires et auteurs inclus" 200 GET "/v1/posts/5?include=comments.user"
+expect "  auteur du commentaire" '"content":"Bien vu"'
+expect "  auteur inclus" '"name":"Noah M."'
+check "Champ inconnu" 400 GET "/v1/users?fields=password"
+expect "  champs autorisés" '"allowed"'
+check "Relation inconnue" 400 GET "/v1/posts?include=author"
+check "Include trop profond" 400 GET "/v1/users?include=posts.tags.posts"
+
+echo -e "${BLUE}♻️  10. Corbeille${NC}"
+AUTH="Authorization: Bearer $ADMIN_TOKEN"
+check "Créer l'utilisateur 6" 201 POST "/v1/users" '{"name":"Eve Manga","email":"eve@example.com","age":33}'
+expect "  created_at" '"created_at":"20'
+check "Créer le post 6" 201 POST "/v1/posts" \
+    '{"title":"Post de Eve","content":"Contenu du post de Eve","user_id":6}'
+check "Supprimer l'utilisateur 6" 200 DELETE "/v1/users/6"
+check "Utilisateur à la corbeille" 404 GET "/v1/users/6"
+check "Post à la corbeille avec lui" 404 GET "/v1/posts/6"
+check "Email réservé jusqu'à la purge" 409 POST "/v1/users" '{"name":"Eve Bis","email":"eve@example.com","age":33}'
+check "Corbeille hors administration" 403 GET "/v1/users?trashed=only"
+check "Corbeille des utilisateurs" 200 GET "/admin/users?trashed=only" "" "$AUTH"
+expect "  seulement l'utilisateur 6" '"total":1'
+expect "  deleted_at renseigné" '"deleted_at":"20'
+check "Posts avec la corbeille" 200 GET "/admin/posts?trashed=with" "" "$AUTH"
+expect "  post 6 listé" '"title":"Post de Eve"'
+check "trashed invalide" 400 GET "/admin/posts?trashed=all" "" "$AUTH"
+check "Restaurer un post dont l'auteur est à la corbeille" 409 POST "/v1/posts/6/restore"
+check "Restaurer l'utilisateur 6 et ses posts" 200 POST "/v1/users/6/restore?with_posts=true"
+check "Post restauré avec lui" 200 GET "/v1/posts/6"
+check "Restaurer hors corbeille" 404 POST "/v1/users/6/restore"
+check "Supprimer à nouveau l'utilisateur 6" 200 DELETE "/v1/users/6"
+check "Restaurer l'utilisateur 6 seul" 200 POST "/v1/users/6/restore"
+check "Post resté à la corbeille" 404 GET "/v1/posts/6"
+check "Restaurer le post 6" 200 POST "/v1/posts/6/restore"
+check "Post restauré" 200 GET "/v1/posts/6"
+check "Purge avec la rétention par défaut" 200 POST "/admin/purge" "" "$AUTH"
+expect "  rien de purgé" '"users":0'
+
+echo -e "${BLUE}🌱 11. Données de test (seed, fixtures)${NC}"
+"$WORKDIR/api" seed -seed 7 -users 5 -posts 8 -comments 10 -dump "$WORKDIR/seed_a.yaml" > /dev/null
+"$WORKDIR/api" seed -seed 7 -users 5 -posts 8 -comments 10 -dump "$WORKDIR/seed_b.yaml" > /dev/null
+if cmp -s "$WORKDIR/seed_a.yaml" "$WORKDIR/seed_b.yaml"; then
+    echo -e "${GREEN}✔${NC} Même graine, même fixture"
+    PASSED=$((PASSED + 1))
+else
+    echo -e "${RED}✘ Même graine, même fixture : les fichiers diffèrent${NC}"
+    FAILED=$((FAILED + 1))
+fi
+if DB_DRIVER=sqlite DB_DSN="$WORKDIR/seed.db" "$WORKDIR/api" seed fixtures/demo.yaml "$WORKDIR/seed_a.yaml" > /dev/null; then
+    echo -e "${GREEN}✔${NC} seed en ligne de commande sur une base neuve"
+    PASSED=$((PASSED + 1))
+else
+    echo -e "${RED}✘ seed en ligne de commande sur une base neuve${NC}"
+    FAILED=$((FAILED + 1))
+fi
+
+check "Fixtures sans token" 401 POST "/admin/fixtures" '{}'
+check "Charger fixtures/demo.yaml" 201 POST "/admin/fixtures" "$(cat fixtures/demo.yaml)" "$AUTH" \
+    "Content-Type: application/yaml"
+expect "  IDs par référence" '"mireille":'
+check "Posts de la fixture" 200 GET "/v1/posts?tag=douala"
+expect "  post tagué douala" '"title":"Paiements Mobile Money depuis Douala"'
+check "Fixture rechargée : email déjà utilisé" 409 POST "/admin/fixtures" "$(cat fixtures/demo.yaml)" "$AUTH" \
+    "Content-Type: application/yaml"
+check "Référence inconnue" 400 POST "/admin/fixtures" \
+    '{"posts":[{"author":"personne","title":"Orphelin","content":"Sans auteur connu"}]}' "$AUTH"
+check "Fixture invalide (validation)" 400 POST "/admin/fixtures" \
+    '{"users":[{"name":"A","email":"invalide","age":0}]}' "$AUTH"
+expect "  erreurs par champ" '"fields"'
+check "Champ inconnu" 400 POST "/admin/fixtures" '{"utilisateurs":[]}' "$AUTH"
+check "Générer des données" 201 POST "/admin/seed?seed=7&users=5&posts=8&comments=10" "" "$AUTH"
+expect "  références générées" '"user5":'
+check "Volume invalide" 400 POST "/admin/seed?users=-1" "" "$AUTH"
+
+echo -e "${BLUE}🔌 12. Pool de connexions${NC}"
+check "État de la base" 200 GET "/admin/db" "" "$AUTH"
+expect "  base joignable" '"healthy":true'
+expect "  un seul écrivain SQLite" '"max_open_conns":1'
+expect "  statistiques du pool" '"open_connections":'
+
+echo -e "${BLUE}📚 13. Réplicas en lecture (fichiers SQLite)${NC}"
+# Le primaire reçoit la fixture ; replica1 en est une copie figée, replica2 est injoignable.
+# Second serveur, toujours sur les repositories GORM (même avec STORE=memory), sans
+# cache (le cache se remplit depuis le primaire)
+DB_DRIVER=sqlite DB_DSN="$WORKDIR/primary.db" "$WORKDIR/api" seed fixtures/demo.yaml > /dev/null
+cp "$WORKDIR/primary.db" "$WORKDIR/replica1.db"
+[ -f "$WORKDIR/primary.db-wal" ] && cp "$WORKDIR/primary.db-wal" "$WORKDIR/replica1.db-wal"
+
+REPLICA_PORT=$((PORT + 1))
+STORE=gorm CACHE=off DB_DRIVER=sqlite DB_DSN="$WORKDIR/primary.db" PORT=$REPLICA_PORT ADMIN_TOKEN=$ADMIN_TOKEN \
+DB_REPLICA_DSNS="$WORKDIR/replica1.db,$WORKDIR/absent/replica2.db" DB_REPLICA_POLICY=round_robin \
+GIN_MODE=release "$WORKDIR/api" > "$WORKDIR/replicas.log" 2>&1 &
+REPLICA_PID=$!
+MAIN_URL=$BASE_URL
+BASE_URL="http://localhost:$REPLICA_PORT"
+for i in $(seq 1 50); do
+    curl -s "$BASE_URL/" > /dev/null && break
+    sleep 0.2
+done
+
+check "Écriture sur le primaire" 201 POST "/v1/users" '{"name":"Ruth Nana","email":"ruth@example.com","age":22}'
+check "Lecture sur le réplica (en retard)" 404 GET "/v1/users/4"
+check "Lecture de ses écritures (X-Read-Your-Writes)" 200 GET "/v1/users/4" "" "X-Read-Your-Writes: true"
+for i in 1 2 3; do
+    check "Lecture $i, réplica injoignable hors rotation" 200 GET "/v1/users/1"
+done
+check "Mise à jour en transaction (primaire)" 200 PUT "/v1/users/4" '{"name":"Ruth Nana","email":"ruth@example.com","age":23}'
+check "État des réplicas" 200 GET "/admin/db" "" "$AUTH"
+expect "  politique" '"policy":"round_robin"'
+expect "  replica1 en rotation" '"healthy":true,"idle"'
+expect "  replica2 retiré" '"healthy":false'
+
+kill "$REPLICA_PID" 2>/dev/null
+BASE_URL=$MAIN_URL
+
+echo -e "${BLUE}🏢 14. Multi-tenant${NC}"
+# Tout ce qui précède est dans le tenant "default" (aucune source de tenant)
+ACME="X-Tenant-ID: acme"
+GLOBEX="X-Tenant-ID: globex"
+
+# JWT HS256 signé avec TENANT_JWT_SECRET : tenant_token <tenant> <exp> [utilisateur] [rôle]
+b64url() { openssl base64 -A | tr '+/' '-_' | tr -d '='; }
+tenant_token() {
+    local header payload signature
+    header=$(printf '{"alg":"HS256","typ":"JWT"}' | b64url)
+    payload=$(printf '{"tenant":"%s","exp":%d%s%s}' "$1" "$2" "${3:+,\"sub\":\"$3\"}" "${4:+,\"role\":\"$4\"}" | b64url)
+    signature=$(printf '%s.%s' "$header" "$payload" | openssl dgst -sha256 -hmac "$TENANT_JWT_SECRET" -binary | b64url)
+    echo "$header.$payload.$signature"
+}
+ACME_TOKEN=$(tenant_token acme $(($(date +%s) + 3600)))
+EXPIRED_TOKEN=$(tenant_token acme $(($(date +%s) - 60)))
+
+check "Utilisateurs d'acme (aucun)" 200 GET "/v1/users" "" "$ACME"
+expect "  rien du tenant default" ! 'mireille.atangana@example.com'
+check "Créer un utilisateur dans acme" 201 POST "/v1/users" \
+    '{"name":"Awa Ndiaye","email":"awa@example.com","age":30}' "$ACME"
+expect "  tenant_id non exposé" ! '"tenant_id"'
+ACME_USER=$(echo "$body" | grep -o '"id":[0-9]*' | head -1 | cut -d: -f2)
+check "Créer un post dans acme" 201 POST "/v1/posts" \
+    "{\"title\":\"Caisse acme\",\"content\":\"Rapprochement des caisses acme\",\"user_id\":$ACME_USER}" "$ACME"
+ACME_POST=$(echo "$body" | grep -o '"id":[0-9]*' | head -1 | cut -d: -f2)
+
+check "globex ne lit pas l'utilisateur d'acme" 404 GET "/v1/users/$ACME_USER" "" "$GLOBEX"
+check "globex ne modifie pas l'utilisateur d'acme" 404 PUT "/v1/users/$ACME_USER" \
+    '{"name":"Pirate","email":"pirate@example.com","age":40}' "$GLOBEX"
+check "DELETE depuis globex sans effet" 200 DELETE "/v1/users/$ACME_USER" "" "$GLOBEX"
+check "globex ne lit pas le post d'acme" 404 GET "/v1/posts/$ACME_POST" "" "$GLOBEX"
+check "globex ne commente pas le post d'acme" 404 POST "/v1/posts/$ACME_POST/comments" \
+    '{"content":"Intrusion"}' "$GLOBEX" "X-User-ID: $ACME_USER"
+check "globex ne trouve pas le post d'acme" 200 GET "/v1/search?q=caisses" "" "$GLOBEX"
+expect "  aucun résultat" ! 'Caisse acme'
+check "L'utilisateur d'acme est intact" 200 GET "/v1/users/$ACME_USER" "" "$ACME"
+expect "  nom inchangé" '"name":"Awa Ndiaye"'
+check "acme trouve son post" 200 GET "/v1/search?q=caisses" "" "$ACME"
+expect "  résultat" 'Caisse acme'
+
+check "Même email dans globex" 201 POST "/v1/users" \
+    '{"name":"Awa Ndiaye","email":"awa@example.com","age":31}' "$GLOBEX"
+check "Email en double dans acme" 409 POST "/v1/users" \
+    '{"name":"Awa Bis","email":"awa@example.com","age":32}' "$ACME"
+check "Tag go dans acme" 201 POST "/v1/tags" '{"name":"go"}' "$ACME"
+check "Tag go en double dans acme" 409 POST "/v1/tags" '{"name":"go"}' "$ACME"
+check "Tags de globex (aucun)" 200 GET "/v1/tags" "" "$GLOBEX"
+expect "  pas le tag d'acme" ! '"name":"go"'
+
+check "Tenant par sous-domaine" 200 GET "/v1/users/$ACME_USER" "" "Host: acme.api.test"
+check "Sous-domaine et header en désaccord" 403 GET "/v1/users" "" "Host: acme.api.test" "$GLOBEX"
+check "Tenant invalide" 400 GET "/v1/users" "" "X-Tenant-ID: Acme!"
+
+# Second serveur avec TENANT_JWT_SECRET : token obligatoire, sous-domaine et
+# X-Tenant-ID ne font que le confirmer
+AUTH_PORT=$((PORT + 4))
+DB_DRIVER=sqlite DB_DSN="$WORKDIR/auth.db" PORT=$AUTH_PORT ADMIN_TOKEN=$ADMIN_TOKEN \
+TENANT_JWT_SECRET=$TENANT_JWT_SECRET TENANT_DOMAIN=api.test \
+PAYMENT_SIMULATOR_URL="http://localhost:$((PORT + 3))" PAYMENT_POLL_INTERVAL=1h \
+GIN_MODE=release "$WORKDIR/api" > "$WORKDIR/auth.log" 2>&1 &
+AUTH_PID=$!
+MAIN_URL=$BASE_URL
+BASE_URL="http://localhost:$AUTH_PORT"
+for i in $(seq 1 50); do
+    curl -s "$BASE_URL/" > /dev/null && break
+    sleep 0.2
+done
+ACME_BEARER="Authorization: Bearer $ACME_TOKEN"
+GLOBEX_BEARER="Authorization: Bearer $(tenant_token globex $(($(date +%s) + 3600)))"
+
+check "Créer un utilisateur dans acme (token)" 201 POST "/v1/users" \
+    '{"name":"Awa Ndiaye","email":"awa@example.com","age":30}' "$ACME_BEARER"
+TOKEN_USER=$(echo "$body" | grep -o '"id":[0-9]*' | head -1 | cut -d: -f2)
+check "Tenant par token" 200 GET "/v1/users/$TOKEN_USER" "" "$ACME_BEARER"
+check "Token confirmé par le header" 200 GET "/v1/users/$TOKEN_USER" "" "$ACME_BEARER" "$ACME"
+check "Token confirmé par le sous-domaine" 200 GET "/v1/users/$TOKEN_USER" "" "$ACME_BEARER" "Host: acme.api.test"
+check "Sans token" 401 GET "/v1/users"
+check "X-Tenant-ID seul ne lit pas acme" 401 GET "/v1/users/$TOKEN_USER" "" "$ACME"
+expect "  aucune ligne" ! 'awa@example.com'
+check "Sous-domaine seul ne lit pas acme" 401 GET "/v1/users/$TOKEN_USER" "" "Host: acme.api.test"
+check "Token de globex et header acme" 403 GET "/v1/users/$TOKEN_USER" "" "$GLOBEX_BEARER" "$ACME"
+check "Token de globex et sous-domaine acme" 403 GET "/v1/users/$TOKEN_USER" "" "$GLOBEX_BEARER" "Host: acme.api.test"
+check "globex ne lit pas l'utilisateur d'acme" 404 GET "/v1/users/$TOKEN_USER" "" "$GLOBEX_BEARER"
+check "Token expiré" 401 GET "/v1/users" "" "Authorization: Bearer $EXPIRED_TOKEN"
+FORGED_PAYLOAD=$(printf '{"tenant":"globex","exp":%d}' $(($(date +%s) + 3600)) | b64url)
+check "Token falsifié" 401 GET "/v1/users" "" "Authorization: Bearer ${ACME_TOKEN%%.*}.$FORGED_PAYLOAD.${ACME_TOKEN##*.}"
+check "Administration : tenant par header" 200 GET "/admin/users" "" "$AUTH" "$ACME"
+expect "  utilisateur d'acme" 'awa@example.com'
+
+# Appelant : claim sub du token ; X-User-ID ignoré sans AUTH_TRUST_USER_HEADER
+check "Créer un second utilisateur dans acme" 201 POST "/v1/users" \
+    '{"name":"Boris Ela","email":"boris@example.com","age":40}' "$ACME_BEARER"
+BORIS=$(echo "$body" | grep -o '"id":[0-9]*' | head -1 | cut -d: -f2)
+AWA_BEARER="Authorization: Bearer $(tenant_token acme $(($(date +%s) + 3600)) "$TOKEN_USER")"
+BORIS_BEARER="Authorization: Bearer $(tenant_token acme $(($(date +%s) + 3600)) "$BORIS")"
+check "Dépôt sur le portefeuille d'Awa" 201 POST "/admin/ledger/entries" \
+    '{"description":"Dépôt","lines":[{"debit":"suspense","credit":"wallet:'"$TOKEN_USER"'","amount":5000}]}' "$AUTH" "$ACME"
+check "Virement avec X-User-ID seul" 401 POST "/v1/transfers" \
+    '{"to_user_id":'"$BORIS"',"amount":1000}' "$ACME_BEARER" "X-User-ID: $TOKEN_USER" "Idempotency-Key: auth-1"
+check "Boris se fait passer pour Awa" 422 POST "/v1/transfers" \
+    '{"to_user_id":'"$TOKEN_USER"',"amount":1000}' "$BORIS_BEARER" "X-User-ID: $TOKEN_USER" "Idempotency-Key: auth-2"
+expect "  portefeuille de Boris débité (vide)" '"code":"insufficient_funds"'
+check "Virement d'Awa (claim sub)" 201 POST "/v1/transfers" \
+    '{"to_user_id":'"$BORIS"',"amount":1000}' "$AWA_BEARER" "Idempotency-Key: auth-3"
+expect "  émetteur tiré du token" "\"from_user_id\":$TOKEN_USER,"
+check "Retrait avec X-User-ID seul" 401 POST "/v1/payments/withdrawals" \
+    '{"provider":"mtn","phone":"+237670000001","amount":1000}' "$ACME_BEARER" "X-User-ID: $TOKEN_USER" "Idempotency-Key: auth-4"
+check "Dépôt avec X-User-ID seul" 401 POST "/v1/payments/deposits" \
+    '{"provider":"mtn","phone":"+237670000001","amount":1000}' "$ACME_BEARER" "X-User-ID: $TOKEN_USER" "Idempotency-Key: auth-5"
+check "Boris retire depuis le portefeuille d'Awa" 422 POST "/v1/payments/withdrawals" \
+    '{"provider":"mtn","phone":"+237670000001","amount":3000}' "$BORIS_BEARER" "X-User-ID: $TOKEN_USER" "Idempotency-Key: auth-6"
+expect "  portefeuille de Boris (1000 XAF) débité, pas celui d'Awa" '"code":"insufficient_funds"'
+check "Token au sub invalide" 401 GET "/v1/users" "" "Authorization: Bearer $(tenant_token acme $(($(date +%s) + 3600)) abc)"
+check "Flag v2_profile réservé au rôle beta" 201 POST "/admin/flags" \
+    '{"key":"v2_profile","enabled":true,"target_roles":["beta"]}' "Authorization: Bearer $ADMIN_TOKEN"
+check "Rôle beta annoncé par X-User-Role" 404 GET "/v2/profile" "" "$AWA_BEARER" "X-User-Role: beta"
+check "Rôle beta du token" 200 GET "/v2/profile" "" \
+    "Authorization: Bearer $(tenant_token acme $(($(date +%s) + 3600)) "$TOKEN_USER" beta)"
+expect "  profil de l'appelant" "\"id\":$TOKEN_USER,"
+
+kill "$AUTH_PID" 2>/dev/null
+BASE_URL=$MAIN_URL
+
+check "Corbeille d'acme" 200 DELETE "/v1/users/$ACME_USER" "" "$ACME"
+check "Purge de tous les tenants" 200 POST "/admin/purge?older_than=0s" "" "$AUTH"
+check "Utilisateur d'acme purgé" 404 POST "/v1/users/$ACME_USER/restore" "" "$ACME"
+check "globex garde son utilisateur" 200 GET "/v1/users" "" "$GLOBEX"
+expect "  awa@example.com" 'awa@example.com'
+
+echo -e "${BLUE}⚡ 15. Cache des lectures${NC}"
+# cache_stat <compteur> : valeur dans GET /admin/cache
+cache_stat() {
+    curl -s "$BASE_URL/admin/cache" -H "$AUTH" | grep -o "\"$1\":[0-9]*" | cut -d: -f2
+}
+# expect_more <nom> <avant> <après> : le compteur a augmenté
+expect_more() {
+    if [ "${3:-0}" -gt "${2:-0}" ]; then
+        echo -e "${GREEN}✔${NC} $1 ($2 → $3)"
+        PASSED=$((PASSED + 1))
+    else
+        echo -e "${RED}✘ $1 : $2 → $3${NC}"
+        FAILED=$((FAILED + 1))
+    fi
+}
+
+check "État du cache" 200 GET "/admin/cache" "" "$AUTH"
+expect "  LRU en mémoire" '"driver":"memory"'
+check "Créer un utilisateur" 201 POST "/v1/users" '{"name":"Cécile Ebogo","email":"cecile@example.com","age":45}'
+CACHED_USER=$(echo "$body" | grep -o '"id":[0-9]*' | head -1 | cut -d: -f2)
+MISSES=$(cache_stat misses)
+check "Première lecture (absence)" 200 GET "/v1/users/$CACHED_USER"
+expect_more "  absence comptée" "$MISSES" "$(cache_stat misses)"
+HITS=$(cache_stat hits)
+check "Deuxième lecture (cache)" 200 GET "/v1/users/$CACHED_USER"
+expect_more "  succès compté" "$HITS" "$(cache_stat hits)"
+check "Lecture partielle servie par le cache" 200 GET "/v1/users/$CACHED_USER?fields=name"
+expect "  champs demandés seulement" ! '"email"'
+check "Mise à jour" 200 PUT "/v1/users/$CACHED_USER" '{"name":"Cécile Ebogo Mbia","email":"cecile@example.com","age":45}'
+check "Lecture après mise à jour" 200 GET "/v1/users/$CACHED_USER"
+expect "  invalidée" '"name":"Cécile Ebogo Mbia"'
+
+check "Créer un post" 201 POST "/v1/posts" \
+    "{\"title\":\"Post en cache\",\"content\":\"Contenu lu depuis le cache\",\"user_id\":$CACHED_USER}"
+CACHED_POST=$(echo "$body" | grep -o '"id":[0-9]*' | head -1 | cut -d: -f2)
+check "Lire le post" 200 GET "/v1/posts/$CACHED_POST"
+check "Relire le post (cache)" 200 GET "/v1/posts/$CACHED_POST"
+expect "  aucun commentaire" '"comments_count":0'
+check "Commenter" 201 POST "/v1/posts/$CACHED_POST/comments" '{"content":"Premier commentaire"}' "X-User-ID: $CACHED_USER"
+check "Relire le post" 200 GET "/v1/posts/$CACHED_POST"
+expect "  nombre de commentaires à jour" '"comments_count":1'
+check "Supprimer l'auteur" 200 DELETE "/v1/users/$CACHED_USER"
+check "Auteur plus servi par le cache" 404 GET "/v1/users/$CACHED_USER"
+check "Post parti à la corbeille avec lui" 404 GET "/v1/posts/$CACHED_POST"
+
+echo -e "${BLUE}⚡ 16. Cache Redis (serveur simulé)${NC}"
+REDIS_PORT=$((PORT + 2))
+CACHE=redis REDIS_URL=fake CACHE_TTL=1s DB_DRIVER=sqlite DB_DSN="$WORKDIR/redis.db" PORT=$REDIS_PORT \
+ADMIN_TOKEN=$ADMIN_TOKEN GIN_MODE=release "$WORKDIR/api" > "$WORKDIR/redis.log" 2>&1 &
+REDIS_PID=$!
+MAIN_URL=$BASE_URL
+BASE_URL="http://localhost:$REDIS_PORT"
+for i in $(seq 1 50); do
+    curl -s "$BASE_URL/" > /dev/null && break
+    sleep 0.2
+done
+
+check "État du cache" 200 GET "/admin/cache" "" "$AUTH"
+expect "  Redis" '"driver":"redis"'
+check "Créer un utilisateur" 201 POST "/v1/users" '{"name":"Yannick Essomba","email":"yannick@example.com","age":38}'
+check "Première lecture" 200 GET "/v1/users/1"
+HITS=$(cache_stat hits)
+check "Deuxième lecture (Redis)" 200 GET "/v1/users/1"
+expect_more "  succès compté" "$HITS" "$(cache_stat hits)"
+check "Mise à jour" 200 PUT "/v1/users/1" '{"name":"Yannick Essomba Jr","email":"yannick@example.com","age":38}'
+check "Lecture après mise à jour" 200 GET "/v1/users/1"
+expect "  invalidée dans Redis" '"name":"Yannick Essomba Jr"'
+sleep 1.2
+MISSES=$(cache_stat misses)
+check "Lecture après CACHE_TTL" 200 GET "/v1/users/1"
+expect_more "  entrée expirée" "$MISSES" "$(cache_stat misses)"
+check "Aucune erreur Redis" 200 GET "/admin/cache" "" "$AUTH"
+expect "  errors à 0" '"errors":0'
+
+kill "$REDIS_PID" 2>/dev/null
+BASE_URL=$MAIN_URL
+
+echo -e "${BLUE}📧 17. Unicité des emails${NC}"
+check "Email enregistré en minuscules" 201 POST "/v1/users" '{"name":"Joël Abena","email":"Joel.Abena@Example.com","age":29}'
+expect "  normalisé" '"email":"joel.abena@example.com"'
+
+# Inscriptions simultanées : l'index unique tranche, une seule passe
+: > "$WORKDIR/signups"
+for name in Alice Boris Carine Didier Estelle Fabrice Gisèle Hervé Ines Jules; do
+    curl -s -o /dev/null -w "%{http_code}\n" -X POST "$BASE_URL/v1/users" -H "Content-Type: application/json" \
+        --data-binary "{\"name\":\"$name Course\",\"email\":\"Course@Example.com\",\"age\":30}" >> "$WORKDIR/signups" &
+done
+wait $(jobs -p | grep -vx "$SERVER_PID")
+body="$(sort "$WORKDIR/signups" | uniq -c | tr -s ' ')"
+expect "Inscriptions simultanées : une seule créée" " 1 201"
+expect "  les autres en conflit (409)" " 9 409"
+expect "  aucune erreur serveur" ! " 500"
+
+# Deux utilisateurs prennent le même email en même temps
+check "Créer un utilisateur" 201 POST "/v1/users" '{"name":"Rita Owona","email":"rita@example.com","age":27}'
+RITA=$(echo "$body" | grep -o '"id":[0-9]*' | head -1 | cut -d: -f2)
+check "Créer un utilisateur" 201 POST "/v1/users" '{"name":"Paul Owona","email":"paul@example.com","age":52}'
+PAUL=$(echo "$body" | grep -o '"id":[0-9]*' | head -1 | cut -d: -f2)
+: > "$WORKDIR/updates"
+for id in $RITA $PAUL; do
+    curl -s -o /dev/null -w "%{http_code}\n" -X PUT "$BASE_URL/v1/users/$id" -H "Content-Type: application/json" \
+        --data-binary '{"name":"Famille Owona","email":"Owona@example.com","age":40}' >> "$WORKDIR/updates" &
+done
+wait $(jobs -p | grep -vx "$SERVER_PID")
+body="$(sort "$WORKDIR/updates" | tr '\n' ' ')"
+expect "Mises à jour simultanées : une acceptée, une en conflit" "200 409"
+
+# Normalisation des emails sur une base existante : doublons de casse
+# insérés avant la migration (sqlite3 requis)
+if command -v sqlite3 > /dev/null; then
+    EMAILS_DB="$WORKDIR/emails.db"
+    DB_DSN="$EMAILS_DB" "$WORKDIR/api" migrate up -to 20260116090000 > /dev/null
+    sqlite3 "$EMAILS_DB" "INSERT INTO users (tenant_id, name, email, age) VALUES
+        ('default', 'Awa Ngono', 'Awa@Example.com', 31), ('default', 'Awa N.', ' awa@example.com', 31),
+        ('acme', 'Boris Ela', 'boris@example.com', 40), ('acme', 'Carine Ela', 'Carine@Example.com', 38)"
+    migration=$(DB_DSN="$EMAILS_DB" "$WORKDIR/api" migrate up 2>&1)
+    code=$?
+    body="exit $code $migration"
+    expect "Migration arrêtée sur des doublons de casse" "exit 1 "
+    expect "  doublon listé" "default : awa@example.com (2 comptes)"
+    expect "  emails distincts absents de la liste" ! "carine@example.com"
+    expect "  pas de violation de contrainte brute" ! "UNIQUE constraint"
+    sqlite3 "$EMAILS_DB" "DELETE FROM users WHERE email = ' awa@example.com'"
+    body=$(DB_DSN="$EMAILS_DB" "$WORKDIR/api" migrate up 2>&1; sqlite3 "$EMAILS_DB" "SELECT email FROM users ORDER BY id")
+    expect "Migration appliquée une fois les doublons corrigés" "normalize_emails"
+    expect "  emails normalisés" "carine@example.com"
+else
+    echo "  (sqlite3 absent : migration des emails non testée)"
+fi
+
+echo -e "${BLUE}🔎 18. Filtres (?filter=)${NC}"
+# urlencode <texte> : encode un paramètre de requête
+urlencode() {
+    local s=$1 out="" c i
+    for ((i = 0; i < ${#s}; i++)); do
+        c=${s:i:1}
+        case "$c" in
+            [a-zA-Z0-9.~_-]) out+="$c" ;;
+            *) out+=$(printf '%%%02X' "'$c") ;;
+        esac
+    done
+    echo "$out"
+}
+F="X-Tenant-ID: filtres"
+check "Créer un utilisateur" 201 POST "/v1/users" '{"name":"Alain Kamga","email":"alain@example.com","age":25}' "$F"
+ALAIN=$(echo "$body" | grep -o '"id":[0-9]*' | head -1 | cut -d: -f2)
+check "Créer un utilisateur" 201 POST "/v1/users" '{"name":"Odile Kamga","email":"odile@example.com","age":41}' "$F"
+ODILE=$(echo "$body" | grep -o '"id":[0-9]*' | head -1 | cut -d: -f2)
+check "Créer un utilisateur" 201 POST "/v1/users" '{"name":"Serge Atangana","email":"serge@example.com","age":52}' "$F"
+check "Créer un post" 201 POST "/v1/posts" '{"title":"Tontine du quartier","content":"Cotisations du mois de mars","user_id":'"$ALAIN"'}' "$F"
+check "Créer un post" 201 POST "/v1/posts" '{"title":"Paiement mobile","content":"Recharger son compte Orange Money","user_id":'"$ODILE"'}' "$F"
+
+check "age >= 30 and name ~ \"kamga\"" 200 GET "/v1/users?fields=name&filter=$(urlencode 'age >= 30 and name ~ "kamga"')" "" "$F"
+expect "  une seule personne" '"total":1'
+expect "  Odile" '"name":"Odile Kamga"'
+check "or, not et parenthèses" 200 GET "/v1/users?filter=$(urlencode 'age < 30 or not (name ~ "Kamga")')" "" "$F"
+expect "  deux personnes" '"total":2'
+check "Date" 200 GET "/v1/users?filter=$(urlencode 'created_at > 2026-01-01 and created_at < 2999-01-01T00:00:00Z')" "" "$F"
+expect "  toutes créées après" '"total":3'
+check "Jokers SQL pris littéralement" 200 GET "/v1/users?filter=$(urlencode 'name ~ "%"')" "" "$F"
+expect "  aucun résultat" '"total":0'
+check "Posts filtrés" 200 GET "/v1/posts?filter=$(urlencode "content ~ \"money\" and user_id != $ALAIN")" "" "$F"
+expect "  le post d'Odile" '"title":"Paiement mobile"'
+expect "  seulement lui" '"total":1'
+
+check "Champ non filtrable" 400 GET "/v1/users?filter=$(urlencode 'age > 20 and password = "x"')" "" "$F"
+expect "  position du champ" '"position":14'
+check "Opérateur non permis" 400 GET "/v1/users?filter=$(urlencode 'age ~ 3')" "" "$F"
+expect "  position de l'opérateur" '"position":5'
+check "Valeur du mauvais type" 400 GET "/v1/users?filter=$(urlencode 'age >= "trente"')" "" "$F"
+check "Expression incomplète" 400 GET "/v1/users?filter=$(urlencode 'age >= 30 and')" "" "$F"
+expect "  position de la fin" '"position":14'
+check "Parenthèse non fermée" 400 GET "/v1/users?filter=$(urlencode '(age > 1')" "" "$F"
+check "Injection SQL" 400 GET "/v1/users?filter=$(urlencode 'age > 1; DROP TABLE users')" "" "$F"
+check "Trop de comparaisons" 400 GET "/v1/users?filter=$(urlencode 'age>1 or age>2 or age>3 or age>4 or age>5 or age>6 or age>7 or age>8 or age>9 or age>10 or age>11')" "" "$F"
+expect "  limite de complexité" 'trop complexe'
+
+echo -e "${BLUE}💾 19. Sauvegarde et restauration${NC}"
+check "Sauvegarde sans token" 401 POST "/admin/backups"
+check "Sauvegarde SQLite en ligne" 201 POST "/admin/backups" "" "$AUTH"
+expect "  format sqlite" '"kind":"sqlite"'
+expect "  somme de contrôle" '"sha256":"'
+check "Export NDJSON" 201 POST "/admin/backups?kind=ndjson" "" "$AUTH"
+expect "  fichier compressé" '.ndjson.gz"'
+check "Format inconnu" 400 POST "/admin/backups?kind=zip" "" "$AUTH"
+check "Sauvegarde SQLite" 201 POST "/admin/backups" "" "$AUTH"
+check "Sauvegarde SQLite" 201 POST "/admin/backups" "" "$AUTH"
+check "Lister les sauvegardes" 200 GET "/admin/backups" "" "$AUTH"
+expect "  rétention (BACKUP_KEEP=2)" '"keep":2'
+if [ "$(echo "$body" | grep -o '"kind":"sqlite"' | wc -l)" -eq 2 ]; then
+    echo -e "${GREEN}✔${NC}   deux sauvegardes SQLite gardées"
+    PASSED=$((PASSED + 1))
+else
+    echo -e "${RED}✘   deux sauvegardes SQLite gardées${NC}"
+    echo "  $body"
+    FAILED=$((FAILED + 1))
+fi
+
+# cli <nom> <code attendu> <commande...> : sous-commande sur une base SQLite du répertoire de test
+cli() {
+    local name=$1
+    local expected=$2
+    shift 2
+    "$@" > "$WORKDIR/cli.log" 2>&1
+    local code=$?
+    if [ "$code" = "$expected" ]; then
+        echo -e "${GREEN}✔${NC} $name ($code)"
+        PASSED=$((PASSED + 1))
+    else
+        echo -e "${RED}✘ $name : attendu $expected, reçu $code${NC}"
+        tail -n 3 "$WORKDIR/cli.log"
+        FAILED=$((FAILED + 1))
+    fi
+}
+# Dernière ligne d'un export : nombre de lignes par table
+counts() { gzip -dc "$1" | tail -n 1; }
+
+cli "Sommes vérifiables avec sha256sum" 0 sh -c "cd '$WORKDIR/backups' && sha256sum -c --quiet *.sha256"
+cli "Export de la base seed" 0 env DB_DRIVER=sqlite DB_DSN="$WORKDIR/seed.db" \
+    "$WORKDIR/api" export "$WORKDIR/seed.ndjson.gz"
+cli "Import dans une base neuve" 0 env DB_DRIVER=sqlite DB_DSN="$WORKDIR/restored.db" \
+    "$WORKDIR/api" restore "$WORKDIR/seed.ndjson.gz"
+cli "Réexport de la base restaurée" 0 env DB_DRIVER=sqlite DB_DSN="$WORKDIR/restored.db" \
+    "$WORKDIR/api" export "$WORKDIR/restored.ndjson.gz"
+if [ -n "$(counts "$WORKDIR/seed.ndjson.gz")" ] && \
+    [ "$(counts "$WORKDIR/seed.ndjson.gz")" = "$(counts "$WORKDIR/restored.ndjson.gz")" ]; then
+    echo -e "${GREEN}✔${NC}   mêmes lignes après l'aller-retour"
+    PASSED=$((PASSED + 1))
+else
+    echo -e "${RED}✘   mêmes lignes après l'aller-retour${NC}"
+    FAILED=$((FAILED + 1))
+fi
+
+gzip -dc "$WORKDIR/seed.ndjson.gz" | head -n -2 | gzip > "$WORKDIR/tronque.ndjson.gz"
+cli "Export tronqué refusé" 1 env DB_DRIVER=sqlite DB_DSN="$WORKDIR/restored.db" \
+    "$WORKDIR/api" restore "$WORKDIR/tronque.ndjson.gz"
+cp "$WORKDIR/seed.ndjson.gz" "$WORKDIR/altere.ndjson.gz"
+cp "$WORKDIR/seed.ndjson.gz.sha256" "$WORKDIR/altere.ndjson.gz.sha256"
+printf 'x' >> "$WORKDIR/altere.ndjson.gz"
+cli "Somme de contrôle fausse refusée" 1 env DB_DRIVER=sqlite DB_DSN="$WORKDIR/restored.db" \
+    "$WORKDIR/api" restore "$WORKDIR/altere.ndjson.gz"
+cli "Base intacte après les refus" 0 env DB_DRIVER=sqlite DB_DSN="$WORKDIR/restored.db" \
+    "$WORKDIR/api" export "$WORKDIR/restored.ndjson.gz"
+if [ "$(counts "$WORKDIR/seed.ndjson.gz")" = "$(counts "$WORKDIR/restored.ndjson.gz")" ]; then
+    echo -e "${GREEN}✔${NC}   aucune ligne perdue"
+    PASSED=$((PASSED + 1))
+else
+    echo -e "${RED}✘   aucune ligne perdue${NC}"
+    FAILED=$((FAILED + 1))
+fi
+
+BACKUP_DB=$(ls "$WORKDIR"/backups/*.db | tail -n 1)
+cli "Restauration du fichier SQLite" 0 env DB_DRIVER=sqlite DB_DSN="$WORKDIR/physique.db" \
+    "$WORKDIR/api" restore "$BACKUP_DB"
+cli "Base restaurée lisible" 0 env DB_DRIVER=sqlite DB_DSN="$WORKDIR/physique.db" \
+    "$WORKDIR/api" migrate status
+printf 'pas une base' > "$WORKDIR/abime.db"
+cli "Fichier SQLite abîmé refusé" 1 env DB_DRIVER=sqlite DB_DSN="$WORKDIR/physique.db" \
+    "$WORKDIR/api" restore "$WORKDIR/abime.db"
+
+echo -e "${BLUE}💰 20. Grand livre${NC}"
+L="X-Tenant-ID: grand-livre"
+check "Créer un utilisateur" 201 POST "/v1/users" '{"name":"Awa Ngono","email":"awa@example.com","age":31}' "$L"
+AWA=$(echo "$body" | grep -o '"id":[0-9]*' | head -1 | cut -d: -f2)
+check "Créer un utilisateur" 201 POST "/v1/users" '{"name":"Blaise Etoa","email":"blaise@example.com","age":44}' "$L"
+BLAISE=$(echo "$body" | grep -o '"id":[0-9]*' | head -1 | cut -d: -f2)
+check "Portefeuille créé au premier accès" 200 GET "/v1/users/$AWA/wallet" "" "$L"
+expect "  solde nul" '"balance":0'
+expect "  code du portefeuille" "\"code\":\"wallet:$AWA\""
+WALLET=$(echo "$body" | grep -o '"id":[0-9]*' | head -1 | cut -d: -f2)
+check "Même portefeuille ensuite" 200 GET "/v1/users/$AWA/wallet" "" "$L"
+expect "  même compte" "\"id\":$WALLET,"
+check "Portefeuille d'un utilisateur inexistant" 404 GET "/v1/users/999999/wallet" "" "$L"
+
+check "Écriture sans token" 401 POST "/admin/ledger/entries" '{}'
+check "Dépôt (attente → portefeuille)" 201 POST "/admin/ledger/entries" \
+    '{"description":"Dépôt Mobile Money","lines":[{"debit":"suspense","credit":"wallet:'"$AWA"'","amount":10000}]}' "$AUTH" "$L"
+DEPOSIT=$(echo "$body" | grep -o '"id":[0-9]*' | head -1 | cut -d: -f2)
+check "Paiement avec frais (deux lignes)" 201 POST "/admin/ledger/entries" \
+    '{"description":"Paiement","lines":[{"debit":"wallet:'"$AWA"'","credit":"wallet:'"$BLAISE"'","amount":3000},{"debit":"wallet:'"$AWA"'","credit":"fees","amount":50}]}' "$AUTH" "$L"
+PAYMENT=$(echo "$body" | grep -o '"id":[0-9]*' | head -1 | cut -d: -f2)
+check "Solde insuffisant" 422 POST "/admin/ledger/entries" \
+    '{"description":"Trop","lines":[{"debit":"wallet:'"$BLAISE"'","credit":"wallet:'"$AWA"'","amount":3001}]}' "$AUTH" "$L"
+expect "  code d'erreur" '"code":"insufficient_funds"'
+check "Débit et crédit sur le même compte" 400 POST "/admin/ledger/entries" \
+    '{"description":"Boucle","lines":[{"debit":"fees","credit":"fees","amount":10}]}' "$AUTH" "$L"
+check "Compte inconnu" 404 POST "/admin/ledger/entries" \
+    '{"description":"Banque","lines":[{"debit":"banque","credit":"fees","amount":10}]}' "$AUTH" "$L"
+check "Montant nul" 400 POST "/admin/ledger/entries" \
+    '{"description":"Rien","lines":[{"debit":"suspense","credit":"fees","amount":0}]}' "$AUTH" "$L"
+check "Écriture sans ligne" 400 POST "/admin/ledger/entries" '{"description":"Vide","lines":[]}' "$AUTH" "$L"
+
+check "Solde du portefeuille" 200 GET "/v1/accounts/$WALLET/balance" "" "$L"
+expect "  10000 - 3000 - 50" '"balance":6950'
+expect "  devise" '"currency":"XAF"'
+check "Dernière écriture du compte" 200 GET "/v1/accounts/$WALLET/entries?limit=1" "" "$L"
+expect "  variation du compte" '"amount":-3050'
+expect "  curseur de la page suivante" "\"next_before\":$PAYMENT"
+check "Page suivante" 200 GET "/v1/accounts/$WALLET/entries?limit=1&before=$PAYMENT" "" "$L"
+expect "  le dépôt" "\"id\":$DEPOSIT,"
+expect "  dernière page" ! '"next_before"'
+check "Curseur invalide" 400 GET "/v1/accounts/$WALLET/entries?before=abc" "" "$L"
+check "Compte inexistant" 404 GET "/v1/accounts/999999/balance" "" "$L"
+check "Compte d'un autre tenant" 404 GET "/v1/accounts/$WALLET/balance" "" "X-Tenant-ID: autre-livre"
+
+# Paiements simultanés de 1000 sur 6950 : verrous, six passent
+: > "$WORKDIR/payments"
+for i in $(seq 1 10); do
+    curl -s -o /dev/null -w "%{http_code}\n" -X POST "$BASE_URL/admin/ledger/entries" \
+        -H "Content-Type: application/json" -H "$AUTH" -H "$L" \
+        --data-binary '{"description":"Achat","lines":[{"debit":"wallet:'"$AWA"'","credit":"fees","amount":1000}]}' \
+        >> "$WORKDIR/payments" &
+done
+wait $(jobs -p | grep -vx "$SERVER_PID")
+body="$(sort "$WORKDIR/payments" | uniq -c | tr -s ' ')"
+expect "Paiements simultanés : six acceptés" " 6 201"
+expect "  les autres refusés (solde insuffisant)" " 4 422"
+check "Solde jamais négatif" 200 GET "/v1/accounts/$WALLET/balance" "" "$L"
+expect "  reste 950" '"balance":950'
+check "Soldes conformes aux lignes" 200 GET "/admin/ledger/check" "" "$AUTH"
+expect "  aucun écart" '"ok":true'
+
+# Écritures immuables jusque dans la base : UPDATE et DELETE refusés par les
+# triggers, sauf pendant l'import NDJSON (sqlite3 requis)
+if command -v sqlite3 > /dev/null; then
+    LEDGER_DB="$WORKDIR/ledger.db"
+    DB_DSN="$LEDGER_DB" "$WORKDIR/api" migrate up > /dev/null
+    sqlite3 "$LEDGER_DB" "INSERT INTO accounts (tenant_id, code, kind) VALUES ('default', 'suspense', 'suspense'), ('default', 'fees', 'fees');
+        INSERT INTO journal_entries (tenant_id, description) VALUES ('default', 'Frais');
+        INSERT INTO journal_lines (tenant_id, entry_id, debit_account_id, credit_account_id, amount) VALUES ('default', 1, 1, 2, 500)"
+    body=$(sqlite3 "$LEDGER_DB" "DELETE FROM journal_lines" 2>&1; sqlite3 "$LEDGER_DB" "DELETE FROM journal_entries" 2>&1)
+    expect "Lignes non supprimables" "journal_lines : écritures comptables immuables"
+    expect "Écritures non supprimables" "journal_entries : écritures comptables immuables"
+    body=$(sqlite3 "$LEDGER_DB" "UPDATE journal_lines SET amount = 1" 2>&1)
+    expect "Lignes non modifiables" "journal_lines : écritures comptables immuables"
+    cli "Export du grand livre" 0 env DB_DRIVER=sqlite DB_DSN="$LEDGER_DB" "$WORKDIR/api" export "$WORKDIR/ledger.ndjson.gz"
+    cli "Import par-dessus (lignes remplacées)" 0 env DB_DRIVER=sqlite DB_DSN="$LEDGER_DB" "$WORKDIR/api" restore "$WORKDIR/ledger.ndjson.gz"
+    body=$(sqlite3 "$LEDGER_DB" "SELECT 'lignes=' || COUNT(*) FROM journal_lines; SELECT 'maintenance=' || COUNT(*) FROM ledger_maintenance; DELETE FROM journal_lines" 2>&1)
+    expect "  ligne réimportée" "lignes=1"
+    expect "  déverrouillage limité à l'import" "maintenance=0"
+    expect "  suppression refusée ensuite" "écritures comptables immuables"
+else
+    echo "  (sqlite3 absent : triggers du grand livre non testés)"
+fi
+
+echo -e "${BLUE}🔁 21. Virements${NC}"
+V="X-Tenant-ID: virements"
+check "Créer un utilisateur" 201 POST "/v1/users" '{"name":"Cyrille Mbarga","email":"cyrille@example.com","age":38}' "$V"
+CYRILLE=$(echo "$body" | grep -o '"id":[0-9]*' | head -1 | cut -d: -f2)
+check "Créer un utilisateur" 201 POST "/v1/users" '{"name":"Diane Ewane","email":"diane@example.com","age":27}' "$V"
+DIANE=$(echo "$body" | grep -o '"id":[0-9]*' | head -1 | cut -d: -f2)
+check "Créer un utilisateur" 201 POST "/v1/users" '{"name":"Emile Tchana","email":"emile@example.com","age":52}' "$V"
+EMILE=$(echo "$body" | grep -o '"id":[0-9]*' | head -1 | cut -d: -f2)
+check "Dépôt de 20000" 201 POST "/admin/ledger/entries" \
+    '{"description":"Dépôt","lines":[{"debit":"suspense","credit":"wallet:'"$CYRILLE"'","amount":20000}]}' "$AUTH" "$V"
+check "Portefeuille de Diane" 200 GET "/v1/users/$DIANE/wallet" "" "$V"
+DIANE_WALLET=$(echo "$body" | grep -o '"id":[0-9]*' | head -1 | cut -d: -f2)
+check "Portefeuille d'Emile" 200 GET "/v1/users/$EMILE/wallet" "" "$V"
+EMILE_WALLET=$(echo "$body" | grep -o '"id":[0-9]*' | head -1 | cut -d: -f2)
+
+transfer() { # transfer name code from to amount key
+    check "$1" "$2" POST "/v1/transfers" '{"to_user_id":'"$4"',"amount":'"$5"',"description":"Test"}' \
+        "$V" "X-User-ID: $3" "Idempotency-Key: $6"
+}
+check "Virement sans émetteur" 401 POST "/v1/transfers" '{"to_user_id":1,"amount":100}' "$V" "Idempotency-Key: v-0"
+check "Virement sans clé d'idempotence" 400 POST "/v1/transfers" '{"to_user_id":1,"amount":100}' "$V" "X-User-ID: $CYRILLE"
+transfer "Virement de 3000" 201 "$CYRILLE" "$DIANE" 3000 v-1
+expect "  exécuté" '"status":"completed"'
+expect "  écriture du grand livre" '"entry_id":'
+T1=$(echo "$body" | grep -o '"id":[0-9]*' | head -1 | cut -d: -f2)
+transfer "Même clé rejouée" 201 "$CYRILLE" "$DIANE" 3000 v-1
+expect "  même virement" "\"id\":$T1,"
+check "Débité une seule fois" 200 GET "/v1/users/$CYRILLE/wallet" "" "$V"
+expect "  reste 17000" '"balance":17000'
+transfer "Même clé, autre montant" 409 "$CYRILLE" "$DIANE" 3500 v-1
+expect "  code d'erreur" '"code":"idempotency_key_reused"'
+transfer "Virement vers soi-même" 400 "$CYRILLE" "$CYRILLE" 100 v-2
+transfer "Destinataire inexistant" 404 "$CYRILLE" 999999 100 v-3
+transfer "Au-delà du plafond par virement" 422 "$CYRILLE" "$DIANE" 6000 v-4
+expect "  code d'erreur" '"code":"limit_exceeded"'
+expect "  virement en échec" '"status":"failed"'
+transfer "Virement de 4000" 201 "$CYRILLE" "$DIANE" 4000 v-5
+transfer "Au-delà du plafond sur 24 h" 422 "$CYRILLE" "$DIANE" 2000 v-6
+expect "  code d'erreur" '"code":"limit_exceeded"'
+
+check "Consulter (destinataire)" 200 GET "/v1/transfers/$T1" "" "$V" "X-User-ID: $DIANE"
+check "Consulter (tiers)" 404 GET "/v1/transfers/$T1" "" "$V" "X-User-ID: $EMILE"
+check "Annulation sans token" 401 POST "/admin/transfers/$T1/reverse" ""
+check "Annuler le virement de 3000" 200 POST "/admin/transfers/$T1/reverse" "" "$AUTH" "$V"
+expect "  annulé" '"status":"reversed"'
+expect "  écriture inverse" '"reversal_entry_id":'
+check "Annuler deux fois" 409 POST "/admin/transfers/$T1/reverse" "" "$AUTH" "$V"
+check "Annuler un virement inexistant" 404 POST "/admin/transfers/999999/reverse" "" "$AUTH" "$V"
+check "Argent rendu" 200 GET "/v1/users/$CYRILLE/wallet" "" "$V"
+expect "  20000 - 4000" '"balance":16000'
+transfer "Plafond libéré par l'annulation" 201 "$CYRILLE" "$DIANE" 2000 v-7
+
+transfer "Diane vire 5000 à Emile" 201 "$DIANE" "$EMILE" 5000 v-8
+T8=$(echo "$body" | grep -o '"id":[0-9]*' | head -1 | cut -d: -f2)
+transfer "Solde insuffisant" 422 "$DIANE" "$EMILE" 3000 v-9
+expect "  code d'erreur" '"code":"insufficient_funds"'
+F9=$(echo "$body" | grep -o '"id":[0-9]*' | head -1 | cut -d: -f2)
+transfer "Échec rejoué" 422 "$DIANE" "$EMILE" 3000 v-9
+expect "  même virement" "\"id\":$F9,"
+check "Annuler un virement en échec" 409 POST "/admin/transfers/$F9/reverse" "" "$AUTH" "$V"
+transfer "Emile dépense 4500" 201 "$EMILE" "$CYRILLE" 4500 v-10
+check "Annulation sans les fonds" 422 POST "/admin/transfers/$T8/reverse" "" "$AUTH" "$V"
+expect "  code d'erreur" '"code":"insufficient_funds"'
+
+check "Geler le portefeuille d'Emile" 200 POST "/admin/accounts/$EMILE_WALLET/freeze" "" "$AUTH" "$V"
+expect "  gelé" '"frozen":true'
+transfer "Virement vers un compte gelé" 422 "$CYRILLE" "$EMILE" 100 v-11
+expect "  code d'erreur" '"code":"account_frozen"'
+check "Dégeler" 200 POST "/admin/accounts/$EMILE_WALLET/unfreeze" "" "$AUTH" "$V"
+transfer "Virement après dégel" 201 "$CYRILLE" "$EMILE" 100 v-12
+check "Geler un compte inexistant" 404 POST "/admin/accounts/999999/freeze" "" "$AUTH" "$V"
+
+# Même clé envoyée cinq fois en parallèle : un seul débit
+: > "$WORKDIR/transfers"
+for i in $(seq 1 5); do
+    curl -s -o /dev/null -w "%{http_code}\n" -X POST "$BASE_URL/v1/transfers" \
+        -H "Content-Type: application/json" -H "$V" -H "X-User-ID: $DIANE" -H "Idempotency-Key: v-13" \
+        --data-binary '{"to_user_id":'"$CYRILLE"',"amount":500}' >> "$WORKDIR/transfers" &
+done
+wait $(jobs -p | grep -vx "$SERVER_PID")
+body="$(sort "$WORKDIR/transfers" | uniq -c | tr -s ' ')"
+expect "Clé rejouée en parallèle : acceptée" " 201"
+expect "  sans erreur serveur" ! " 500"
+check "Un seul débit" 200 GET "/v1/accounts/$DIANE_WALLET/balance" "" "$V"
+expect "  6000 - 5000 - 500" '"balance":500'
+check "Soldes conformes aux lignes" 200 GET "/admin/ledger/check" "" "$AUTH"
+expect "  aucun écart" '"ok":true'
+
+echo -e "${BLUE}📱 22. Mobile money (simulateur)${NC}"
+SIM_URL="http://localhost:$((PORT + 3))"
+SIM_PORT=$((PORT + 3)) SIM_CALLBACK_DELAY=300ms GIN_MODE=release "$WORKDIR/api" simulate > "$WORKDIR/simulator.log" 2>&1 &
+SIM_PID=$!
+for i in $(seq 1 50); do
+    curl -s "$SIM_URL/_sim/operations" > /dev/null && break
+    sleep 0.2
+done
+P="X-Tenant-ID: paiements"
+check "Créer un utilisateur" 201 POST "/v1/users" '{"name":"Fanny Ngono","email":"fanny@example.com","age":31}' "$P"
+FANNY=$(echo "$body" | grep -o '"id":[0-9]*' | head -1 | cut -d: -f2)
+check "Créer un utilisateur" 201 POST "/v1/users" '{"name":"Gaston Fotso","email":"gaston@example.com","age":45}' "$P"
+GASTON=$(echo "$body" | grep -o '"id":[0-9]*' | head -1 | cut -d: -f2)
+check "Portefeuille de Fanny" 200 GET "/v1/users/$FANNY/wallet" "" "$P"
+FANNY_WALLET=$(echo "$body" | grep -o '"id":[0-9]*' | head -1 | cut -d: -f2)
+
+payment() { # payment name code deposits|withdrawals provider phone amount key
+    check "$1" "$2" POST "/v1/payments/$3" '{"provider":"'"$4"'","phone":"'"$5"'","amount":'"$6"'}' \
+        "$P" "X-User-ID: $FANNY" "Idempotency-Key: $7"
+}
+# wait_payment <id> <statut> : attend le callback (3 s au plus)
+wait_payment() {
+    for i in $(seq 1 15); do
+        curl -s "$BASE_URL/v1/payments/$1" -H "$P" -H "X-User-ID: $FANNY" | grep -q "\"status\":\"$2\"" && break
+        sleep 0.2
+    done
+    check "  paiement $1 : $2" 200 GET "/v1/payments/$1" "" "$P" "X-User-ID: $FANNY"
+    expect "    statut" "\"status\":\"$2\""
+}
+payment_id() { echo "$body" | grep -o '"id":[0-9]*' | head -1 | cut -d: -f2; }
+payment_ref() { echo "$body" | grep -o '"reference":"[^"]*"' | cut -d'"' -f4; }
+
+check "Dépôt sans utilisateur" 401 POST "/v1/payments/deposits" '{"provider":"mtn","phone":"+237670000010","amount":100}' \
+    "$P" "Idempotency-Key: p-0"
+check "Dépôt sans clé d'idempotence" 400 POST "/v1/payments/deposits" '{"provider":"mtn","phone":"+237670000010","amount":100}' \
+    "$P" "X-User-ID: $FANNY"
+payment "Opérateur inconnu" 400 deposits airtel +237670000010 100 p-0
+payment "Numéro invalide" 400 deposits mtn 670000010 100 p-0
+
+payment "Dépôt MTN de 10000" 202 deposits mtn +237670000010 10000 p-1
+expect "  en attente" '"status":"pending"'
+P1=$(payment_id)
+payment "Même clé rejouée" 200 deposits mtn +237670000010 10000 p-1
+expect "  même paiement" "\"id\":$P1,"
+payment "Même clé, autre montant" 409 deposits mtn +237670000010 9000 p-1
+expect "  code d'erreur" '"code":"idempotency_key_reused"'
+wait_payment "$P1" completed
+expect "    écriture de crédit" '"entry_id":'
+payment "Dépôt Orange de 5000" 202 deposits orange +237690000011 5000 p-2
+wait_payment "$(payment_id)" completed
+expect "    payToken enregistré" '"provider_ref":"MP'
+check "Portefeuille crédité" 200 GET "/v1/accounts/$FANNY_WALLET/balance" "" "$P"
+expect "  10000 + 5000" '"balance":15000'
+
+payment "Dépôt refusé par le client" 202 deposits mtn +237670000000 2000 p-3
+wait_payment "$(payment_id)" failed
+expect "    raison" '"failure_reason":"NOT_ENOUGH_FUNDS"'
+
+payment "Retrait MTN de 4000" 202 withdrawals mtn +237670000012 4000 p-4
+P4=$(payment_id)
+check "Fonds réservés dès la demande" 200 GET "/v1/accounts/$FANNY_WALLET/balance" "" "$P"
+expect "  15000 - 4000" '"balance":11000'
+wait_payment "$P4" completed
+payment "Retrait Orange en échec" 202 withdrawals orange +237690000000 3000 p-5
+wait_payment "$(payment_id)" failed
+expect "    fonds rendus" '"refund_entry_id":'
+check "Solde après remboursement" 200 GET "/v1/accounts/$FANNY_WALLET/balance" "" "$P"
+expect "  toujours 11000" '"balance":11000'
+payment "Retrait au-delà du solde" 422 withdrawals mtn +237670000012 50000 p-6
+expect "  code d'erreur" '"code":"insufficient_funds"'
+check "Geler le portefeuille" 200 POST "/admin/accounts/$FANNY_WALLET/freeze" "" "$AUTH" "$P"
+payment "Retrait depuis un compte gelé" 422 withdrawals mtn +237670000012 1000 p-7
+expect "  code d'erreur" '"code":"account_frozen"'
+check "Dégeler" 200 POST "/admin/accounts/$FANNY_WALLET/unfreeze" "" "$AUTH" "$P"
+
+payment "Opérateur en panne" 202 deposits mtn +237670000002 1000 p-8
+expect "  reste en attente" '"status":"pending"'
+P8=$(payment_id)
+payment "Succès sans callback" 202 deposits orange +237690000003 1500 p-9
+P9=$(payment_id)
+payment "Client qui ne valide pas" 202 deposits mtn +237670000001 2500 p-10
+P10=$(payment_id)
+P10_REF=$(payment_ref)
+sleep 1.2
+check "Relecture des paiements en attente" 200 POST "/admin/payments/reconcile" "" "$AUTH"
+expect "  deux réglés" '"settled":2'
+wait_payment "$P8" failed
+wait_payment "$P9" completed
+
+check "Callback forgé" 200 PUT "/callbacks/mtn" '{"externalId":"'"$P10_REF"'","status":"SUCCESSFUL","amount":"2500"}'
+expect "  état relu chez l'opérateur" '"status":"pending"'
+check "Callback d'une référence inconnue" 404 PUT "/callbacks/mtn" '{"externalId":"inconnue","status":"SUCCESSFUL"}'
+check "Callback d'un opérateur inconnu" 404 POST "/callbacks/airtel" '{"orderId":"x"}'
+check "Callback illisible" 400 POST "/callbacks/orange" 'pas du json'
+curl -s -X POST "$SIM_URL/_sim/operations/$P10_REF/resolve" -H "Content-Type: application/json" \
+    --data-binary '{"status":"SUCCESSFUL"}' > /dev/null
+wait_payment "$P10" completed
+
+check "Consulter (tiers)" 404 GET "/v1/payments/$P1" "" "$P" "X-User-ID: $GASTON"
+check "Consulter (inexistant)" 404 GET "/v1/payments/999999" "" "$P" "X-User-ID: $FANNY"
+check "Solde final" 200 GET "/v1/accounts/$FANNY_WALLET/balance" "" "$P"
+expect "  11000 + 1500 + 2500" '"balance":15000'
+check "Soldes conformes aux lignes" 200 GET "/admin/ledger/check" "" "$AUTH"
+expect "  aucun écart" '"ok":true'
+
+echo -e "${BLUE}🪝 23. Webhooks sortants${NC}"
+W="X-Tenant-ID: marchand"
+HOOKS="$SIM_URL/_sim/webhooks"
+check "Créer le marchand" 201 POST "/v1/users" '{"name":"Hawa Bello","email":"hawa@example.com","age":35}' "$W"
+WC="X-User-ID: $(echo "$body" | grep -o '"id":[0-9]*' | head -1 | cut -d: -f2)"
+check "Endpoint sans appelant" 401 POST "/v1/webhooks" '{"url":"'"$HOOKS/a"'","events":["*"]}' "$W"
+check "Liste sans appelant" 401 GET "/v1/webhooks" "" "$W"
+check "Rotation sans appelant" 401 POST "/v1/webhooks/1/rotate-secret" "" "$W"
+check "Sans événement" 400 POST "/v1/webhooks" '{"url":"'"$HOOKS/a"'","events":[]}' "$W" "$WC"
+check "Événement inconnu" 400 POST "/v1/webhooks" '{"url":"'"$HOOKS/a"'","events":["user.created","user.deleted"]}' "$W" "$WC"
+expect "  événement nommé" '"unknown":["user.deleted"]'
+check "URL non HTTP" 400 POST "/v1/webhooks" '{"url":"ftp://example.com/hooks","events":["*"]}' "$W" "$WC"
+check "Créer un endpoint" 201 POST "/v1/webhooks" \
+    '{"url":"'"$HOOKS/a"'","description":"CRM","events":["user.created","payment.succeeded"]}' "$W" "$WC"
+expect "  secret montré à la création" '"secret":"whsec_'
+HOOK_A=$(echo "$body" | grep -o '"id":[0-9]*' | head -1 | cut -d: -f2)
+SECRET_A=$(echo "$body" | grep -o '"secret":"[^"]*"' | cut -d'"' -f4)
+check "Lire l'endpoint" 200 GET "/v1/webhooks/$HOOK_A" "" "$W" "$WC"
+expect "  secret caché ensuite" ! '"secret"'
+check "Endpoint d'un autre tenant" 404 GET "/v1/webhooks/$HOOK_A" "" "$P" "$WC"
+check "Créer un endpoint en panne" 201 POST "/v1/webhooks" '{"url":"'"$HOOKS/b?status=500"'","events":["*"]}' "$W" "$WC"
+HOOK_B=$(echo "$body" | grep -o '"id":[0-9]*' | head -1 | cut -d: -f2)
+check "Lister les endpoints" 200 GET "/v1/webhooks" "" "$W" "$WC"
+expect "  deux endpoints" '"total":2'
+expect "  propriétaire : l'appelant" "\"owner_id\":${WC#X-User-ID: },"
+WO="X-User-ID: 999999"
+check "Liste d'un autre utilisateur du compte" 200 GET "/v1/webhooks" "" "$W" "$WO"
+expect "  aucun endpoint" '"total":0'
+check "Lire l'endpoint d'un autre" 404 GET "/v1/webhooks/$HOOK_A" "" "$W" "$WO"
+check "Modifier l'endpoint d'un autre" 404 PUT "/v1/webhooks/$HOOK_A" '{"url":"'"$HOOKS/x"'"}' "$W" "$WO"
+check "Rotation du secret d'un autre" 404 POST "/v1/webhooks/$HOOK_A/rotate-secret" "" "$W" "$WO"
+check "Supprimer l'endpoint d'un autre" 404 DELETE "/v1/webhooks/$HOOK_A" "" "$W" "$WO"
+
+# wait_hooks <endpoint> <nombre> : attend nombre requêtes reçues (5 s au plus)
+wait_hooks() {
+    for i in $(seq 1 25); do
+        curl -s "$HOOKS/$1" | grep -q "\"count\":$2," && break
+        sleep 0.2
+    done
+    body=$(curl -s "$HOOKS/$1")
+}
+# last_hook <endpoint> : dernière requête reçue (corps dans $WORKDIR/hook.json)
+last_hook() {
+    curl -s -D "$WORKDIR/hook.h" -o "$WORKDIR/hook.json" "$HOOKS/$1/last"
+    HOOK_TS=$(grep -i '^X-Webhook-Timestamp:' "$WORKDIR/hook.h" | cut -d' ' -f2 | tr -d '\r')
+    HOOK_SIG=$(grep -i '^X-Webhook-Signature:' "$WORKDIR/hook.h" | cut -d' ' -f2 | tr -d '\r')
+    body=$(cat "$WORKDIR/hook.json")
+}
+# sign <secret> : signature attendue de la dernière requête
+sign() {
+    printf '%s.%s' "$HOOK_TS" "$(cat "$WORKDIR/hook.json")" | openssl dgst -sha256 -hmac "$1" | sed 's/^.*= //'
+}
+
+check "Créer un utilisateur" 201 POST "/v1/users" '{"name":"Hélène Mbarga","email":"helene@example.com","age":38}' "$W"
+HELENE=$(echo "$body" | grep -o '"id":[0-9]*' | head -1 | cut -d: -f2)
+wait_hooks a 1
+expect "user.created reçu" '"event":"user.created"'
+last_hook a
+expect "  données de l'utilisateur" '"email":"helene@example.com"'
+expect "  identifiant d'événement" '"id":"'
+body=$HOOK_SIG
+expect "  signature HMAC-SHA256 vérifiée" "v1=$(sign "$SECRET_A")"
+expect "  une seule signature" ! ","
+
+for i in $(seq 1 25); do
+    curl -s "$BASE_URL/admin/webhooks/deliveries?status=dead" -H "$AUTH" -H "$W" | grep -q '"total":1' && break
+    sleep 0.2
+done
+check "File des lettres mortes" 200 GET "/admin/webhooks/deliveries?status=dead" "" "$AUTH" "$W"
+expect "  livraison abandonnée" "\"endpoint_id\":$HOOK_B,"
+expect "  après trois essais" '"attempts":3'
+expect "  dernier code" '"last_status_code":500'
+DEAD=$(echo "$body" | grep -o '"id":[0-9]*' | head -1 | cut -d: -f2)
+check "Journal d'une livraison" 200 GET "/admin/webhooks/deliveries/$DEAD" "" "$AUTH" "$W"
+expect "  troisième essai" '"number":3'
+body=$(curl -s "$HOOKS/b")
+expect "  trois requêtes reçues" '"count":3,'
+check "Journal sans admin" 401 GET "/admin/webhooks/deliveries" "" "$W"
+check "Statut inconnu" 400 GET "/admin/webhooks/deliveries?status=lost" "" "$AUTH" "$W"
+check "Journal paginé" 200 GET "/admin/webhooks/deliveries?limit=1" "" "$AUTH" "$W"
+expect "  page suivante" '"next_before":'
+check "Réparer l'endpoint" 200 PUT "/v1/webhooks/$HOOK_B" '{"url":"'"$HOOKS/b"'"}' "$W" "$WC"
+check "Relancer la livraison" 200 POST "/admin/webhooks/deliveries/$DEAD/redeliver" "" "$AUTH" "$W"
+expect "  livrée" '"status":"succeeded"'
+expect "  essai manuel journalisé" '"manual":true'
+check "Relancer (inexistante)" 404 POST "/admin/webhooks/deliveries/999999/redeliver" "" "$AUTH" "$W"
+
+check "Créer un post" 201 POST "/v1/posts" '{"title":"Nouveautés","content":"Les webhooks arrivent","user_id":'"$HELENE"'}' "$W"
+wait_hooks b 5
+body=$(curl -s "$HOOKS/b?event=post.created")
+expect "post.created reçu par l'abonné à *" '"count":1,'
+body=$(curl -s "$HOOKS/a?event=post.created")
+expect "  pas par l'endpoint non abonné" '"count":0,'
+
+check "Désactiver l'endpoint" 200 PUT "/v1/webhooks/$HOOK_B" '{"active":false}' "$W" "$WC"
+expect "  inactif" '"active":false'
+check "Rotation du secret" 200 POST "/v1/webhooks/$HOOK_A/rotate-secret" "" "$W" "$WC"
+NEW_SECRET_A=$(echo "$body" | grep -o '"secret":"[^"]*"' | cut -d'"' -f4)
+expect "  ancien secret en période de grâce" '"previous_secret_expires_at":'
+check "Créer un utilisateur" 201 POST "/v1/users" '{"name":"Ibrahim Sali","email":"ibrahim@example.com","age":29}' "$W"
+wait_hooks a 2
+last_hook a
+body=$HOOK_SIG
+expect "  signé avec les deux secrets" "v1=$(sign "$NEW_SECRET_A"),v1=$(sign "$SECRET_A")"
+body=$(curl -s "$HOOKS/b")
+expect "  rien pour l'endpoint désactivé" '"count":5,'
+check "Rotation sans grâce" 200 POST "/v1/webhooks/$HOOK_A/rotate-secret?grace=0" "" "$W" "$WC"
+LAST_SECRET_A=$(echo "$body" | grep -o '"secret":"[^"]*"' | cut -d'"' -f4)
+check "Grâce invalide" 400 POST "/v1/webhooks/$HOOK_A/rotate-secret?grace=demain" "" "$W" "$WC"
+
+check "Dépôt MTN" 202 POST "/v1/payments/deposits" '{"provider":"mtn","phone":"+237670000020","amount":3000}' \
+    "$W" "X-User-ID: $HELENE" "Idempotency-Key: w-1"
+wait_hooks a 3
+expect "payment.succeeded reçu" '"event":"payment.succeeded"'
+last_hook a
+expect "  montant du paiement" '"amount":3000'
+body=$HOOK_SIG
+expect "  nouveau secret seul" "v1=$(sign "$LAST_SECRET_A")"
+expect "  ancien révoqué" ! ","
+check "Envoi immédiat des livraisons dues" 200 POST "/admin/webhooks/dispatch" "" "$AUTH" "$W"
+
+check "Supprimer l'endpoint" 204 DELETE "/v1/webhooks/$HOOK_B" "" "$W" "$WC"
+check "Endpoint supprimé" 404 GET "/v1/webhooks/$HOOK_B" "" "$W" "$WC"
+check "Journal conservé" 200 GET "/admin/webhooks/deliveries?endpoint_id=$HOOK_B" "" "$AUTH" "$W"
+expect "  deux livraisons" '"total":2'
+kill "$SIM_PID" 2>/dev/null
+wait "$SIM_PID" 2>/dev/null
+SIM_PID=
+
+echo ""
+if [ "$FAILED" -eq 0 ]; then
+    echo -e "${GREEN}✅ $PASSED tests réussis${NC}"
+else
+    echo -e "${RED}❌ $FAILED échec(s), $PASSED réussi(s)${NC}"
+    echo "Logs du serveur : voir ci-dessous"
+    tail -n 20 "$WORKDIR/server.log"
+    exit 1
+fi
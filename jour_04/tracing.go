@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+const tracerName = "afaapay/jour04"
+
+var tracer = otel.Tracer(tracerName)
+
+// === TRACING (OpenTelemetry) ===
+
+// initTracing configure le TracerProvider global.
+// L'exporteur est choisi via OTEL_TRACES_EXPORTER :
+//   - "console" : spans affichés sur la sortie standard
+//   - "otlp"    : envoi OTLP/HTTP (OTEL_EXPORTER_OTLP_ENDPOINT, défaut localhost:4318)
+//   - "none" ou vide : tracing désactivé
+//
+// La fonction retournée vide les spans en attente à l'arrêt du serveur.
+func initTracing(ctx context.Context) (func(context.Context) error, error) {
+	// Propagation W3C (traceparent / tracestate) + baggage
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	var exporter sdktrace.SpanExporter
+	var err error
+
+	switch strings.ToLower(os.Getenv("OTEL_TRACES_EXPORTER")) {
+	case "", "none":
+		return func(context.Context) error { return nil }, nil
+	case "console", "stdout":
+		exporter, err = stdouttrace.New(stdouttrace.WithPrettyPrint())
+	case "otlp":
+		exporter, err = otlptracehttp.New(ctx)
+	default:
+		return nil, fmt.Errorf("exporteur de traces inconnu: %q", os.Getenv("OTEL_TRACES_EXPORTER"))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	serviceName := os.Getenv("OTEL_SERVICE_NAME")
+	if serviceName == "" {
+		serviceName = "afaapay-api"
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(
+			attribute.String("service.name", serviceName),
+		)),
+	)
+	otel.SetTracerProvider(tp)
+
+	return tp.Shutdown, nil
+}
+
+// TracingMiddleware crée un span serveur par requête.
+// Le nom du span utilise le template de la route (/v1/users/:id)
+// et non le chemin réel, pour garder une cardinalité faible.
+func TracingMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Récupérer le contexte amont (header traceparent)
+		ctx := otel.GetTextMapPropagator().Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+
+		ctx, span := tracer.Start(ctx, c.Request.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", c.Request.Method),
+				attribute.String("http.route", route),
+				attribute.String("url.path", c.Request.URL.Path),
+			),
+		)
+		defer span.End()
+
+		// Les repositories propagent ce contexte à GORM via db.WithContext
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttributes(attribute.Int("http.response.status_code", status))
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+		if len(c.Errors) > 0 {
+			span.RecordError(c.Errors.Last())
+		}
+	}
+}
+
+// === TRACING GORM ===
+
+const gormSpanKey = "otel:span"
+
+// registerGormTracing ajoute des callbacks GORM qui créent un span enfant
+// pour chaque requête SQL. Seul le SQL avec ses placeholders est enregistré :
+// les valeurs liées (db.Statement.Vars) ne sont jamais exportées.
+func registerGormTracing(db *gorm.DB) error {
+	cb := db.Callback()
+
+	return errors.Join(
+		cb.Create().Before("gorm:create").Register("otel:before_create", startGormSpan("create")),
+		cb.Create().After("gorm:create").Register("otel:after_create", endGormSpan),
+		cb.Query().Before("gorm:query").Register("otel:before_query", startGormSpan("query")),
+		cb.Query().After("gorm:query").Register("otel:after_query", endGormSpan),
+		cb.Update().Before("gorm:update").Register("otel:before_update", startGormSpan("update")),
+		cb.Update().After("gorm:update").Register("otel:after_update", endGormSpan),
+		cb.Delete().Before("gorm:delete").Register("otel:before_delete", startGormSpan("delete")),
+		cb.Delete().After("gorm:delete").Register("otel:after_delete", endGormSpan),
+		cb.Row().Before("gorm:row").Register("otel:before_row", startGormSpan("row")),
+		cb.Row().After("gorm:row").Register("otel:after_row", endGormSpan),
+		cb.Raw().Before("gorm:raw").Register("otel:before_raw", startGormSpan("raw")),
+		cb.Raw().After("gorm:raw").Register("otel:after_raw", endGormSpan),
+	)
+}
+
+func startGormSpan(operation string) func(*gorm.DB) {
+	return func(tx *gorm.DB) {
+		ctx := tx.Statement.Context
+		if ctx == nil {
+			ctx = context.Background()
+		}
+
+		_, span := tracer.Start(ctx, "gorm."+operation,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(
+				attribute.String("db.system", tx.Dialector.Name()),
+				attribute.String("db.operation.name", operation),
+			),
+		)
+		tx.InstanceSet(gormSpanKey, span)
+	}
+}
+
+func endGormSpan(tx *gorm.DB) {
+	v, ok := tx.InstanceGet(gormSpanKey)
+	if !ok {
+		return
+	}
+	span, ok := v.(trace.Span)
+	if !ok {
+		return
+	}
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("db.query.text", tx.Statement.SQL.String()),
+		attribute.Int64("db.rows_affected", tx.Statement.RowsAffected),
+	)
+	if tx.Statement.Table != "" {
+		span.SetAttributes(attribute.String("db.collection.name", tx.Statement.Table))
+	}
+
+	if tx.Error != nil && tx.Error != gorm.ErrRecordNotFound {
+		span.RecordError(tx.Error)
+		span.SetStatus(codes.Error, tx.Error.Error())
+	}
+}
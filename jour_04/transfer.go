@@ -0,0 +1,451 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// === VIREMENTS ===
+//
+// Un virement fait passer de l'argent du portefeuille d'un utilisateur à
+// celui d'un autre, par une écriture du grand livre (ledger.go). Une seule
+// transaction SERIALIZABLE insère le virement (ce qui réserve la clé),
+// verrouille les deux portefeuilles, vérifie gel, plafonds et solde, passe
+// l'écriture et le marque "completed" : l'argent bouge et le statut change
+// ensemble, ou pas du tout. "pending" n'existe que dans cette transaction.
+// Un refus l'annule ; le virement est alors enregistré "failed" avec son
+// code, dans une transaction à part.
+// L'annulation (reversal) passe l'écriture inverse et le marque "reversed".
+//
+// La clé d'idempotence (header Idempotency-Key, obligatoire) identifie le
+// virement dans le tenant : la même requête rejouée retourne le virement
+// déjà traité, avec la même réponse, sans débiter une seconde fois.
+
+// Statuts d'un virement
+const (
+	TransferPending   = "pending"
+	TransferCompleted = "completed"
+	TransferFailed    = "failed"
+	TransferReversed  = "reversed"
+)
+
+// Transfer : virement entre deux portefeuilles. FailureCode explique un
+// échec (insufficient_funds, account_frozen, limit_exceeded).
+type Transfer struct {
+	ID              uint       `gorm:"primaryKey" json:"id"`
+	TenantID        string     `gorm:"size:64;not null;uniqueIndex:idx_transfers_tenant_idempotency_key,priority:1" json:"-"`
+	IdempotencyKey  string     `gorm:"size:255;not null;uniqueIndex:idx_transfers_tenant_idempotency_key,priority:2" json:"idempotency_key"`
+	FromUserID      uint       `gorm:"not null;index:idx_transfers_from_user_created,priority:1" json:"from_user_id"`
+	ToUserID        uint       `gorm:"not null;index" json:"to_user_id"`
+	FromAccountID   uint       `gorm:"not null" json:"from_account_id"`
+	ToAccountID     uint       `gorm:"not null" json:"to_account_id"`
+	Amount          int64      `gorm:"not null" json:"amount"`
+	Currency        string     `gorm:"size:3;not null;default:XAF" json:"currency"`
+	Description     string     `gorm:"size:255;not null;default:''" json:"description"`
+	Status          string     `gorm:"size:16;not null" json:"status"`
+	FailureCode     string     `gorm:"size:32" json:"failure_code,omitempty"`
+	EntryID         *uint      `json:"entry_id,omitempty"`
+	ReversalEntryID *uint      `json:"reversal_entry_id,omitempty"`
+	CreatedAt       time.Time  `gorm:"index:idx_transfers_from_user_created,priority:2" json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+	ReversedAt      *time.Time `json:"reversed_at,omitempty"`
+}
+
+type TransferRepository interface {
+	// Get retourne un virement, ou ErrNotFound
+	Get(ctx context.Context, id uint) (*Transfer, error)
+	// GetByKey retourne le virement de cette clé d'idempotence, ou ErrNotFound
+	GetByKey(ctx context.Context, key string) (*Transfer, error)
+	// Lock relit le virement, verrouillé jusqu'à la fin de la transaction
+	Lock(ctx context.Context, id uint) (*Transfer, error)
+	// Create insère le virement ; *ConflictError si la clé existe déjà
+	Create(ctx context.Context, transfer *Transfer) error
+	// Update enregistre le statut, le code d'échec, les écritures et la
+	// date d'annulation
+	Update(ctx context.Context, transfer *Transfer) error
+	// SentSince : total des virements exécutés (completed) de l'utilisateur
+	// depuis since
+	SentSince(ctx context.Context, userID uint, since time.Time) (int64, error)
+}
+
+// === SERVICE ===
+
+var (
+	ErrTransferNotFound    = errors.New("virement non trouvé")
+	ErrSelfTransfer        = errors.New("virement vers son propre portefeuille")
+	ErrAccountFrozen       = errors.New("compte gelé")
+	ErrLimitExceeded       = errors.New("plafond de virement dépassé")
+	ErrIdempotencyMismatch = errors.New("clé d'idempotence déjà utilisée pour un autre virement")
+	ErrNotReversible       = errors.New("seul un virement exécuté peut être annulé")
+)
+
+// Codes d'échec enregistrés sur le virement (et renvoyés au client)
+var transferFailures = map[string]error{
+	"insufficient_funds": ErrInsufficientFunds,
+	"account_frozen":     ErrAccountFrozen,
+	"limit_exceeded":     ErrLimitExceeded,
+}
+
+var transferFailureMessages = map[string]string{
+	"insufficient_funds": "Solde insuffisant",
+	"account_frozen":     "Compte gelé",
+	"limit_exceeded":     "Plafond de virement dépassé",
+}
+
+// failureCode retourne le code d'un refus métier, "" pour une autre erreur
+func failureCode(err error) string {
+	for code, target := range transferFailures {
+		if errors.Is(err, target) {
+			return code
+		}
+	}
+	return ""
+}
+
+// TransferLimits : plafonds d'envoi par utilisateur (0 = sans plafond)
+type TransferLimits struct {
+	// MaxAmount : montant maximal d'un virement
+	MaxAmount int64
+	// Daily : total maximal des virements exécutés sur 24 heures glissantes
+	Daily int64
+}
+
+// loadTransferLimits lit TRANSFER_MAX_AMOUNT (500 000 XAF par défaut) et
+// TRANSFER_DAILY_LIMIT (2 000 000 XAF par défaut)
+func loadTransferLimits() TransferLimits {
+	limits := TransferLimits{MaxAmount: 500_000, Daily: 2_000_000}
+	if n, err := strconv.ParseInt(os.Getenv("TRANSFER_MAX_AMOUNT"), 10, 64); err == nil && n >= 0 {
+		limits.MaxAmount = n
+	}
+	if n, err := strconv.ParseInt(os.Getenv("TRANSFER_DAILY_LIMIT"), 10, 64); err == nil && n >= 0 {
+		limits.Daily = n
+	}
+	return limits
+}
+
+// TransferRequest : virement demandé par FromUserID
+type TransferRequest struct {
+	IdempotencyKey string
+	FromUserID     uint
+	ToUserID       uint
+	Amount         int64
+	Description    string
+}
+
+type TransferService struct {
+	transfers TransferRepository
+	ledger    *LedgerService
+	uow       UnitOfWork
+	limits    TransferLimits
+}
+
+func NewTransferService(transfers TransferRepository, ledger *LedgerService, uow UnitOfWork, limits TransferLimits) *TransferService {
+	return &TransferService{transfers: transfers, ledger: ledger, uow: uow, limits: limits}
+}
+
+// Get retourne un virement
+func (s *TransferService) Get(ctx context.Context, id uint) (*Transfer, error) {
+	transfer, err := s.transfers.Get(ctx, id)
+	if errors.Is(err, ErrNotFound) {
+		return nil, ErrTransferNotFound
+	}
+	return transfer, err
+}
+
+// Create exécute le virement, ou retourne celui déjà enregistré sous la même
+// clé (replayed). Un refus métier retourne le virement "failed" avec
+// l'erreur correspondante.
+func (s *TransferService) Create(ctx context.Context, req TransferRequest) (transfer *Transfer, replayed bool, err error) {
+	if req.FromUserID == req.ToUserID {
+		return nil, false, ErrSelfTransfer
+	}
+	if existing, err := s.transfers.GetByKey(usePrimary(ctx), req.IdempotencyKey); err == nil {
+		return s.replay(existing, req)
+	} else if !errors.Is(err, ErrNotFound) {
+		return nil, false, err
+	}
+
+	from, err := s.ledger.Wallet(ctx, req.FromUserID)
+	if err != nil {
+		return nil, false, err
+	}
+	to, err := s.ledger.Wallet(ctx, req.ToUserID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	draft := Transfer{
+		IdempotencyKey: req.IdempotencyKey,
+		FromUserID:     req.FromUserID,
+		ToUserID:       req.ToUserID,
+		FromAccountID:  from.ID,
+		ToAccountID:    to.ID,
+		Amount:         req.Amount,
+		Currency:       from.Currency,
+		Description:    req.Description,
+		Status:         TransferPending,
+	}
+	// Clé réservée, contrôles, écriture et statut dans la même transaction :
+	// un virement n'est jamais enregistré "pending". Une requête concurrente
+	// de même clé bute sur l'index unique et relit le virement validé.
+	err = s.uow.Do(serializable(ctx), func(ctx context.Context) error {
+		t := draft // repart du brouillon si la transaction est rejouée
+		transfer = &t
+		if err := s.transfers.Create(ctx, transfer); err != nil {
+			return err
+		}
+		return s.execute(ctx, transfer)
+	})
+	if err == nil {
+		return transfer, false, nil
+	}
+	if errors.Is(err, ErrConflict) {
+		return s.replayKey(ctx, req)
+	}
+	code := failureCode(err)
+	if code == "" {
+		// Rien n'est enregistré : la clé reste libre pour un nouvel essai
+		return nil, false, err
+	}
+
+	// Refus métier : tout a été annulé, le virement est enregistré "failed"
+	// à part, même si le client a déjà abandonné la requête
+	failed := draft
+	failed.Status, failed.FailureCode = TransferFailed, code
+	createErr := s.uow.Do(context.WithoutCancel(ctx), func(ctx context.Context) error {
+		return s.transfers.Create(ctx, &failed)
+	})
+	if errors.Is(createErr, ErrConflict) {
+		return s.replayKey(ctx, req)
+	}
+	if createErr != nil {
+		return nil, false, errors.Join(err, createErr)
+	}
+	return &failed, false, err
+}
+
+// replayKey relit le virement validé sous la clé de req (après un conflit
+// sur l'index unique) et le rejoue
+func (s *TransferService) replayKey(ctx context.Context, req TransferRequest) (*Transfer, bool, error) {
+	existing, err := s.transfers.GetByKey(usePrimary(ctx), req.IdempotencyKey)
+	if err != nil {
+		return nil, false, err
+	}
+	return s.replay(existing, req)
+}
+
+// execute : portefeuilles verrouillés, contrôles, écriture, statut
+// (dans l'unité de travail de Create)
+func (s *TransferService) execute(ctx context.Context, transfer *Transfer) error {
+	accounts, err := s.ledger.Lock(ctx, transfer.FromAccountID, transfer.ToAccountID)
+	if err != nil {
+		return err
+	}
+	for _, a := range accounts {
+		if a.Frozen {
+			return fmt.Errorf("%w : %s", ErrAccountFrozen, a.Code)
+		}
+	}
+
+	if s.limits.MaxAmount > 0 && transfer.Amount > s.limits.MaxAmount {
+		return fmt.Errorf("%w : %d XAF maximum par virement", ErrLimitExceeded, s.limits.MaxAmount)
+	}
+	if s.limits.Daily > 0 {
+		// Portefeuille de l'émetteur verrouillé : ses autres virements
+		// attendent, le total ne peut pas bouger entre lecture et écriture
+		sent, err := s.transfers.SentSince(ctx, transfer.FromUserID, time.Now().Add(-24*time.Hour))
+		if err != nil {
+			return err
+		}
+		if sent+transfer.Amount > s.limits.Daily {
+			return fmt.Errorf("%w : %d XAF maximum sur 24 heures", ErrLimitExceeded, s.limits.Daily)
+		}
+	}
+
+	entry := JournalEntry{
+		Description: fmt.Sprintf("Virement #%d", transfer.ID),
+		Lines: []JournalLine{{
+			DebitAccountID: transfer.FromAccountID, CreditAccountID: transfer.ToAccountID, Amount: transfer.Amount,
+		}},
+	}
+	if err := s.ledger.Post(ctx, &entry); err != nil {
+		return err
+	}
+	transfer.Status, transfer.EntryID = TransferCompleted, &entry.ID
+	return s.transfers.Update(ctx, transfer)
+}
+
+// replay retourne le virement déjà enregistré sous cette clé, avec la même
+// issue que la première fois ; la clé ne sert qu'à une seule demande
+func (s *TransferService) replay(transfer *Transfer, req TransferRequest) (*Transfer, bool, error) {
+	if transfer.FromUserID != req.FromUserID || transfer.ToUserID != req.ToUserID || transfer.Amount != req.Amount {
+		return nil, true, ErrIdempotencyMismatch
+	}
+	if transfer.Status == TransferFailed {
+		if err, ok := transferFailures[transfer.FailureCode]; ok {
+			return transfer, true, err
+		}
+		return transfer, true, errors.New("virement en échec : " + transfer.FailureCode)
+	}
+	return transfer, true, nil
+}
+
+// Reverse annule un virement exécuté : l'écriture inverse rend l'argent à
+// l'émetteur. Le destinataire doit encore avoir les fonds ; le gel des
+// comptes n'empêche pas l'annulation (décision d'un opérateur).
+func (s *TransferService) Reverse(ctx context.Context, id uint) (*Transfer, error) {
+	var transfer *Transfer
+	err := s.uow.Do(serializable(ctx), func(ctx context.Context) error {
+		var err error
+		transfer, err = s.transfers.Lock(ctx, id)
+		if errors.Is(err, ErrNotFound) {
+			return ErrTransferNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if transfer.Status != TransferCompleted {
+			return ErrNotReversible
+		}
+
+		entry := JournalEntry{
+			Description: fmt.Sprintf("Annulation du virement #%d", transfer.ID),
+			Lines: []JournalLine{{
+				DebitAccountID: transfer.ToAccountID, CreditAccountID: transfer.FromAccountID, Amount: transfer.Amount,
+			}},
+		}
+		if err := s.ledger.Post(ctx, &entry); err != nil {
+			return err
+		}
+		now := time.Now()
+		transfer.Status, transfer.ReversalEntryID, transfer.ReversedAt = TransferReversed, &entry.ID, &now
+		return s.transfers.Update(ctx, transfer)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return transfer, nil
+}
+
+// === HANDLERS ===
+
+type TransferHandler struct {
+	transfers *TransferService
+}
+
+func NewTransferHandler(transfers *TransferService) *TransferHandler {
+	return &TransferHandler{transfers: transfers}
+}
+
+// respondTransferError : refus métier en 422 avec le virement en échec
+// quand il existe ; le reste comme le grand livre
+func respondTransferError(c *gin.Context, transfer *Transfer, err error, fallback string) {
+	if code := failureCode(err); code != "" {
+		resp := gin.H{"error": transferFailureMessages[code], "code": code}
+		if transfer != nil {
+			resp["transfer"] = transfer
+		}
+		c.JSON(http.StatusUnprocessableEntity, resp)
+		return
+	}
+
+	switch {
+	case errors.Is(err, ErrTransferNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Virement non trouvé"})
+	case errors.Is(err, ErrSelfTransfer):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Impossible de virer vers son propre portefeuille"})
+	case errors.Is(err, ErrIdempotencyMismatch):
+		c.JSON(http.StatusConflict, gin.H{"error": "Clé d'idempotence déjà utilisée pour un autre virement", "code": "idempotency_key_reused"})
+	case errors.Is(err, ErrNotReversible):
+		c.JSON(http.StatusConflict, gin.H{"error": "Seul un virement exécuté peut être annulé", "code": "not_reversible"})
+	default:
+		respondLedgerError(c, err, fallback)
+	}
+}
+
+// transferRequest : corps de POST /v1/transfers (émetteur : l'appelant)
+type transferRequest struct {
+	ToUserID    uint   `json:"to_user_id" binding:"required"`
+	Amount      int64  `json:"amount" binding:"required,xaf"`
+	Description string `json:"description" binding:"max=255"`
+}
+
+// POST /v1/transfers (émetteur : l'appelant authentifié, header
+// Idempotency-Key requis)
+func (h *TransferHandler) Create(c *gin.Context) {
+	fromID, ok := requireCaller(c)
+	if !ok {
+		return
+	}
+	key := c.GetHeader("Idempotency-Key")
+	if key == "" || len(key) > 255 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Header Idempotency-Key requis (255 caractères maximum)"})
+		return
+	}
+
+	var req transferRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondValidationError(c, err)
+		return
+	}
+
+	transfer, replayed, err := h.transfers.Create(c.Request.Context(), TransferRequest{
+		IdempotencyKey: key,
+		FromUserID:     fromID,
+		ToUserID:       req.ToUserID,
+		Amount:         req.Amount,
+		Description:    req.Description,
+	})
+	if replayed {
+		c.Header("Idempotent-Replayed", "true")
+	}
+	if err != nil {
+		respondTransferError(c, transfer, err, "Erreur de virement")
+		return
+	}
+	c.JSON(http.StatusCreated, transfer)
+}
+
+// GET /v1/transfers/:id (émetteur ou destinataire : l'appelant)
+func (h *TransferHandler) Get(c *gin.Context) {
+	id, ok := parseID(c)
+	if !ok {
+		return
+	}
+	callerID, ok := requireCaller(c)
+	if !ok {
+		return
+	}
+
+	transfer, err := h.transfers.Get(c.Request.Context(), id)
+	if err == nil && transfer.FromUserID != callerID && transfer.ToUserID != callerID {
+		err = ErrTransferNotFound
+	}
+	if err != nil {
+		respondTransferError(c, nil, err, "Erreur BD")
+		return
+	}
+	c.JSON(http.StatusOK, transfer)
+}
+
+// POST /admin/transfers/:id/reverse
+func (h *TransferHandler) Reverse(c *gin.Context) {
+	id, ok := parseID(c)
+	if !ok {
+		return
+	}
+
+	transfer, err := h.transfers.Reverse(c.Request.Context(), id)
+	if err != nil {
+		respondTransferError(c, nil, err, "Erreur d'annulation")
+		return
+	}
+	c.JSON(http.StatusOK, transfer)
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// === VIREMENTS : REPOSITORIES ===
+
+type gormTransferRepository struct {
+	db *gorm.DB
+}
+
+func NewGormTransferRepository(db *gorm.DB) TransferRepository {
+	return &gormTransferRepository{db: db}
+}
+
+func (r *gormTransferRepository) Get(ctx context.Context, id uint) (*Transfer, error) {
+	var transfer Transfer
+	if err := dbFromContext(ctx, r.db).First(&transfer, id).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &transfer, nil
+}
+
+func (r *gormTransferRepository) GetByKey(ctx context.Context, key string) (*Transfer, error) {
+	var transfer Transfer
+	if err := dbFromContext(ctx, r.db).Where("idempotency_key = ?", key).First(&transfer).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &transfer, nil
+}
+
+func (r *gormTransferRepository) Lock(ctx context.Context, id uint) (*Transfer, error) {
+	var transfer Transfer
+	err := dbFromContext(ctx, r.db).Clauses(clause.Locking{Strength: "UPDATE"}).First(&transfer, id).Error
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return &transfer, nil
+}
+
+func (r *gormTransferRepository) Create(ctx context.Context, transfer *Transfer) error {
+	return translateError(dbFromContext(ctx, r.db).Create(transfer).Error)
+}
+
+func (r *gormTransferRepository) Update(ctx context.Context, transfer *Transfer) error {
+	return dbFromContext(ctx, r.db).Model(transfer).
+		Select("Status", "FailureCode", "EntryID", "ReversalEntryID", "ReversedAt", "UpdatedAt").
+		Updates(transfer).Error
+}
+
+func (r *gormTransferRepository) SentSince(ctx context.Context, userID uint, since time.Time) (int64, error) {
+	var total int64
+	err := dbFromContext(ctx, r.db).Model(&Transfer{}).Select("COALESCE(SUM(amount), 0)").
+		Where("from_user_id = ? AND created_at >= ? AND status = ?", userID, since, TransferCompleted).
+		Scan(&total).Error
+	return total, err
+}
+
+// --- En mémoire ---
+
+type memoryTransferRepository struct {
+	s *MemoryStore
+}
+
+func (s *MemoryStore) Transfers() TransferRepository { return &memoryTransferRepository{s} }
+
+func (r *memoryTransferRepository) Get(_ context.Context, id uint) (*Transfer, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	t, ok := r.s.transfers[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &t, nil
+}
+
+func (r *memoryTransferRepository) GetByKey(_ context.Context, key string) (*Transfer, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	for _, t := range r.s.transfers {
+		if t.IdempotencyKey == key {
+			return &t, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// Lock : les unités de travail en mémoire sont déjà sérialisées
+func (r *memoryTransferRepository) Lock(ctx context.Context, id uint) (*Transfer, error) {
+	return r.Get(ctx, id)
+}
+
+func (r *memoryTransferRepository) Create(_ context.Context, transfer *Transfer) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, t := range r.s.transfers {
+		if t.IdempotencyKey == transfer.IdempotencyKey {
+			return &ConflictError{Field: "idempotency_key"}
+		}
+	}
+	transfer.ID = r.s.nextTransferID
+	r.s.nextTransferID++
+	transfer.CreatedAt = time.Now()
+	transfer.UpdatedAt = transfer.CreatedAt
+	r.s.transfers[transfer.ID] = *transfer
+	return nil
+}
+
+func (r *memoryTransferRepository) Update(_ context.Context, transfer *Transfer) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	t, ok := r.s.transfers[transfer.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	t.Status, t.FailureCode = transfer.Status, transfer.FailureCode
+	t.EntryID, t.ReversalEntryID, t.ReversedAt = transfer.EntryID, transfer.ReversalEntryID, transfer.ReversedAt
+	t.UpdatedAt = time.Now()
+	r.s.transfers[t.ID] = t
+	transfer.UpdatedAt = t.UpdatedAt
+	return nil
+}
+
+func (r *memoryTransferRepository) SentSince(_ context.Context, userID uint, since time.Time) (int64, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	var total int64
+	for _, t := range r.s.transfers {
+		if t.FromUserID == userID && t.Status == TransferCompleted && !t.CreatedAt.Before(since) {
+			total += t.Amount
+		}
+	}
+	return total, nil
+}
+
+// --- En mémoire, par tenant ---
+
+type tenantTransferRepository struct {
+	t *MemoryTenants
+}
+
+func (t *MemoryTenants) Transfers() TransferRepository { return &tenantTransferRepository{t} }
+
+func (r *tenantTransferRepository) Get(ctx context.Context, id uint) (*Transfer, error) {
+	s, _, err := r.t.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.Transfers().Get(ctx, id)
+}
+
+func (r *tenantTransferRepository) GetByKey(ctx context.Context, key string) (*Transfer, error) {
+	s, _, err := r.t.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.Transfers().GetByKey(ctx, key)
+}
+
+func (r *tenantTransferRepository) Lock(ctx context.Context, id uint) (*Transfer, error) {
+	s, _, err := r.t.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.Transfers().Lock(ctx, id)
+}
+
+func (r *tenantTransferRepository) Create(ctx context.Context, transfer *Transfer) error {
+	s, tenant, err := r.t.store(ctx)
+	if err != nil {
+		return err
+	}
+	transfer.TenantID = tenant
+	return s.Transfers().Create(ctx, transfer)
+}
+
+func (r *tenantTransferRepository) Update(ctx context.Context, transfer *Transfer) error {
+	s, _, err := r.t.store(ctx)
+	if err != nil {
+		return err
+	}
+	return s.Transfers().Update(ctx, transfer)
+}
+
+func (r *tenantTransferRepository) SentSince(ctx context.Context, userID uint, since time.Time) (int64, error) {
+	s, _, err := r.t.store(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return s.Transfers().SentSince(ctx, userID, since)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// Virements sur les repositories en mémoire : la clé n'est enregistrée
+// qu'avec l'issue du virement (jamais "pending"), et la même clé rejouée
+// retourne la même issue sans second débit.
+
+// newTestTransfers : service de virements sur un store vide, l'émetteur
+// crédité de 5000 XAF
+func newTestTransfers(t *testing.T) (*TransferService, *LedgerService, []User) {
+	t.Helper()
+	store := NewMemoryStore()
+	users := NewUserService(store.Users(), store.UnitOfWork(), discardEvents{})
+	ledger := NewLedgerService(store.Ledger(), store.Users(), store.UnitOfWork())
+	transfers := NewTransferService(store.Transfers(), ledger, store.UnitOfWork(), TransferLimits{MaxAmount: 6000})
+
+	ctx := context.Background()
+	people := []User{
+		{Name: "Awa Ngono", Email: "awa@example.com", Age: 31},
+		{Name: "Blaise Etoa", Email: "blaise@example.com", Age: 44},
+	}
+	for i := range people {
+		if err := users.Create(ctx, &people[i]); err != nil {
+			t.Fatalf("création de %s : %v", people[i].Name, err)
+		}
+	}
+	suspense, err := ledger.SystemAccount(ctx, AccountSuspense)
+	if err != nil {
+		t.Fatalf("compte d'attente : %v", err)
+	}
+	wallet, err := ledger.Wallet(ctx, people[0].ID)
+	if err != nil {
+		t.Fatalf("portefeuille : %v", err)
+	}
+	deposit := JournalEntry{Description: "Dépôt", Lines: []JournalLine{{
+		DebitAccountID: suspense.ID, CreditAccountID: wallet.ID, Amount: 5000,
+	}}}
+	if err := ledger.Post(ctx, &deposit); err != nil {
+		t.Fatalf("dépôt : %v", err)
+	}
+	return transfers, ledger, people
+}
+
+func TestTransferServiceCreate(t *testing.T) {
+	tests := []struct {
+		name        string
+		amount      int64
+		cancel      bool // requête déjà abandonnée par le client
+		wantErr     error
+		wantStatus  string
+		wantBalance int64
+	}{
+		{name: "exécuté", amount: 3000, wantStatus: TransferCompleted, wantBalance: 2000},
+		{name: "solde insuffisant", amount: 5500, wantErr: ErrInsufficientFunds, wantStatus: TransferFailed, wantBalance: 5000},
+		{name: "plafond dépassé", amount: 7000, wantErr: ErrLimitExceeded, wantStatus: TransferFailed, wantBalance: 5000},
+		{name: "refus enregistré malgré l'abandon", amount: 5500, cancel: true, wantErr: ErrInsufficientFunds, wantStatus: TransferFailed, wantBalance: 5000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transfers, ledger, people := newTestTransfers(t)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.cancel {
+				cancel()
+			}
+			req := TransferRequest{IdempotencyKey: "cle-1", FromUserID: people[0].ID, ToUserID: people[1].ID, Amount: tt.amount}
+
+			transfer, replayed, err := transfers.Create(ctx, req)
+			if !errors.Is(err, tt.wantErr) || replayed {
+				t.Fatalf("Create() = %v (replayed %v), attendu %v", err, replayed, tt.wantErr)
+			}
+			if transfer == nil || transfer.Status != tt.wantStatus {
+				t.Fatalf("virement renvoyé = %+v, statut attendu %s", transfer, tt.wantStatus)
+			}
+
+			stored, err := transfers.transfers.GetByKey(context.Background(), req.IdempotencyKey)
+			if err != nil || stored.Status != tt.wantStatus {
+				t.Fatalf("virement enregistré = %+v (%v), statut attendu %s", stored, err, tt.wantStatus)
+			}
+
+			again, replayed, err := transfers.Create(context.Background(), req)
+			if !errors.Is(err, tt.wantErr) || !replayed || again.ID != stored.ID {
+				t.Errorf("clé rejouée = %+v, %v (replayed %v), attendu le virement %d", again, err, replayed, stored.ID)
+			}
+
+			wallet, err := ledger.Wallet(context.Background(), people[0].ID)
+			if err != nil {
+				t.Fatalf("portefeuille : %v", err)
+			}
+			if wallet.Balance != tt.wantBalance {
+				t.Errorf("solde de l'émetteur = %d, attendu %d", wallet.Balance, tt.wantBalance)
+			}
+		})
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+
+	"gorm.io/gorm"
+)
+
+// === UNIT OF WORK ===
+
+// UnitOfWork exécute plusieurs opérations de repository dans une même
+// transaction. La transaction voyage dans le contexte : tout repository
+// appelé avec ce contexte y participe. Un Do imbriqué utilise un savepoint,
+// annulé seul si la fonction imbriquée échoue.
+type UnitOfWork interface {
+	Do(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+type txKey struct{}
+
+type serializableKey struct{}
+
+// serializableAttempts : tentatives d'une unité de travail SERIALIZABLE
+// annulée par la base pour conflit
+const serializableAttempts = 3
+
+// serializable demande l'isolation SERIALIZABLE pour l'unité de travail
+// ouverte avec ce contexte ; si la base l'annule pour conflit de
+// sérialisation, Do la rejoue (jusqu'à serializableAttempts fois). Sans
+// effet sur un Do imbriqué, qui hérite de la transaction englobante.
+func serializable(ctx context.Context) context.Context {
+	return context.WithValue(ctx, serializableKey{}, true)
+}
+
+type commitHooksKey struct{}
+
+// commitHooks : fonctions à appeler après la validation de l'unité de
+// travail la plus externe (invalidation de cache, par exemple)
+type commitHooks struct {
+	mu  sync.Mutex
+	fns []func()
+}
+
+// withCommitHooks prépare la liste des hooks si ctx n'est pas déjà dans une
+// unité de travail ; hooks est nil pour une unité de travail imbriquée
+func withCommitHooks(ctx context.Context) (context.Context, *commitHooks) {
+	if ctx.Value(commitHooksKey{}) != nil {
+		return ctx, nil
+	}
+	hooks := &commitHooks{}
+	return context.WithValue(ctx, commitHooksKey{}, hooks), hooks
+}
+
+// run appelle les hooks dans l'ordre d'enregistrement
+func (h *commitHooks) run() {
+	h.mu.Lock()
+	fns := h.fns
+	h.fns = nil
+	h.mu.Unlock()
+	for _, fn := range fns {
+		fn()
+	}
+}
+
+// afterCommit appelle fn après la validation de l'unité de travail en cours,
+// ou tout de suite hors unité de travail. Rien n'est appelé si elle échoue ;
+// les hooks d'un Do imbriqué annulé seul sont tout de même appelés.
+func afterCommit(ctx context.Context, fn func()) {
+	hooks, ok := ctx.Value(commitHooksKey{}).(*commitHooks)
+	if !ok {
+		fn()
+		return
+	}
+	hooks.mu.Lock()
+	hooks.fns = append(hooks.fns, fn)
+	hooks.mu.Unlock()
+}
+
+// inUnitOfWork indique si ctx est dans une unité de travail
+func inUnitOfWork(ctx context.Context) bool {
+	return ctx.Value(commitHooksKey{}) != nil
+}
+
+// dbFromContext retourne la transaction en cours s'il y en a une,
+// sinon la connexion liée au contexte.
+func dbFromContext(ctx context.Context, db *gorm.DB) *gorm.DB {
+	if tx, ok := ctx.Value(txKey{}).(*gorm.DB); ok {
+		return tx
+	}
+	return db.WithContext(ctx)
+}
+
+type gormUnitOfWork struct {
+	db *gorm.DB
+}
+
+func NewGormUnitOfWork(db *gorm.DB) UnitOfWork {
+	return &gormUnitOfWork{db: db}
+}
+
+// Do ouvre une transaction, ou un savepoint si une transaction est déjà
+// en cours (comportement de Transaction de GORM sur une transaction).
+func (u *gormUnitOfWork) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	_, inTx := ctx.Value(txKey{}).(*gorm.DB)
+	if wanted, _ := ctx.Value(serializableKey{}).(bool); !wanted || inTx {
+		return u.do(ctx, fn)
+	}
+
+	opts := &sql.TxOptions{Isolation: sql.LevelSerializable}
+	var err error
+	for attempt := 1; attempt <= serializableAttempts; attempt++ {
+		if err = u.do(ctx, fn, opts); !isSerializationFailure(err) {
+			break
+		}
+	}
+	return err
+}
+
+func (u *gormUnitOfWork) do(ctx context.Context, fn func(ctx context.Context) error, opts ...*sql.TxOptions) error {
+	ctx, hooks := withCommitHooks(ctx)
+	err := dbFromContext(ctx, u.db).Transaction(func(tx *gorm.DB) error {
+		return fn(context.WithValue(ctx, txKey{}, tx))
+	}, opts...)
+	if err == nil && hooks != nil {
+		hooks.run()
+	}
+	return err
+}
+
+// memoryUnitOfWork prend un instantané du store et le restaure en cas
+// d'erreur ou de panic. Les unités de travail sont sérialisées entre elles
+// (serializable n'y change rien) ;
+// les écritures faites hors unité de travail ne sont pas isolées.
+type memoryUnitOfWork struct {
+	s *MemoryStore
+}
+
+type memoryTxKey struct{}
+
+func (u *memoryUnitOfWork) Do(ctx context.Context, fn func(ctx context.Context) error) (err error) {
+	ctx, hooks := withCommitHooks(ctx)
+	returned := false // faux si fn panique
+	if hooks != nil {
+		// Hooks appelés une fois txMu relâché (defer exécutés en ordre inverse)
+		defer func() {
+			if returned && err == nil {
+				hooks.run()
+			}
+		}()
+	}
+	if ctx.Value(memoryTxKey{}) == nil {
+		u.s.txMu.Lock()
+		defer u.s.txMu.Unlock()
+		ctx = context.WithValue(ctx, memoryTxKey{}, true)
+	}
+
+	snap := u.s.snapshot()
+	defer func() {
+		if p := recover(); p != nil {
+			u.s.restore(snap)
+			panic(p)
+		}
+		if err != nil {
+			u.s.restore(snap)
+		}
+	}()
+
+	err = fn(ctx)
+	returned = true
+	return err
+}
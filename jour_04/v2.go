@@ -0,0 +1,32 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// === V2 HANDLERS (derrière feature flags) ===
+
+// GET /v2/profile - profil de l'appelant authentifié
+func (h *UserHandler) Profile(c *gin.Context) {
+	id, ok := requireCaller(c)
+	if !ok {
+		return
+	}
+
+	user, err := h.users.Get(c.Request.Context(), id, ReadOptions{Include: []string{"posts"}})
+	if err != nil {
+		respondUserError(c, err, "Erreur BD")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"id":          user.ID,
+		"name":        user.Name,
+		"email":       user.Email,
+		"phone":       user.Phone,
+		"age":         user.Age,
+		"posts_count": len(user.Posts),
+	})
+}
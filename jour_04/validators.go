@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// === VALIDATEURS MÉTIER ===
+
+var (
+	// Numéro camerounais au format E.164 : +237 suivi de 9 chiffres
+	// (6XXXXXXXX pour le mobile, 2XXXXXXXX pour le fixe)
+	phoneCMRegex = regexp.MustCompile(`^\+237[26]\d{8}$`)
+
+	// Nom affichable : lettres (accents compris), espaces simples,
+	// apostrophes, points et tirets ; doit commencer par une lettre
+	displayNameRegex = regexp.MustCompile(`^\p{L}[\p{L}\p{M}'.\-]*( [\p{L}\p{M}'.\-]+)*$`)
+
+	// Slug : minuscules et chiffres séparés par des tirets simples
+	slugRegex = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+	// Clé de feature flag : snake_case (v2_profile)
+	flagKeyRegex = regexp.MustCompile(`^[a-z][a-z0-9]*(_[a-z0-9]+)*$`)
+)
+
+// registerValidators enregistre les règles métier auprès du moteur de
+// validation de Gin et fait remonter le nom JSON des champs dans les erreurs.
+func registerValidators() error {
+	v, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return errors.New("moteur de validation Gin inattendu")
+	}
+
+	// Utiliser le nom JSON ("email") plutôt que le nom Go ("Email")
+	v.RegisterTagNameFunc(func(fld reflect.StructField) string {
+		name := strings.SplitN(fld.Tag.Get("json"), ",", 2)[0]
+		if name == "-" {
+			return ""
+		}
+		if name == "" {
+			return fld.Name
+		}
+		return name
+	})
+
+	return errors.Join(
+		v.RegisterValidation("phone_cm", validatePhoneCM),
+		v.RegisterValidation("xaf", validateXAF),
+		v.RegisterValidation("display_name", validateDisplayName),
+		v.RegisterValidation("slug", validateSlug),
+		v.RegisterValidation("flag_key", validateFlagKey),
+	)
+}
+
+func validatePhoneCM(fl validator.FieldLevel) bool {
+	return phoneCMRegex.MatchString(fl.Field().String())
+}
+
+// validateXAF accepte un montant en francs CFA : le XAF n'a pas de
+// sous-unité, le montant doit donc être un entier strictement positif.
+func validateXAF(fl validator.FieldLevel) bool {
+	f := fl.Field()
+	switch f.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return f.Int() > 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return f.Uint() > 0
+	case reflect.Float32, reflect.Float64:
+		return f.Float() > 0 && f.Float() == math.Trunc(f.Float()) && f.Float() <= math.MaxInt64
+	case reflect.String:
+		n, err := strconv.ParseInt(f.String(), 10, 64)
+		return err == nil && n > 0
+	}
+	return false
+}
+
+func validateDisplayName(fl validator.FieldLevel) bool {
+	return displayNameRegex.MatchString(fl.Field().String())
+}
+
+func validateSlug(fl validator.FieldLevel) bool {
+	return slugRegex.MatchString(fl.Field().String())
+}
+
+func validateFlagKey(fl validator.FieldLevel) bool {
+	return flagKeyRegex.MatchString(fl.Field().String())
+}
+
+// === ERREURS DE VALIDATION STRUCTURÉES ===
+
+// validationErrors traduit une erreur de binding en map
+// {champ_json: [messages]} exploitable par les clients.
+func validationErrors(err error) map[string][]string {
+	fields := map[string][]string{}
+
+	var verrs validator.ValidationErrors
+	var typeErr *json.UnmarshalTypeError
+	var syntaxErr *json.SyntaxError
+
+	switch {
+	case errors.As(err, &verrs):
+		for _, fe := range verrs {
+			key := fieldKey(fe)
+			fields[key] = append(fields[key], validationMessage(fe))
+		}
+	case errors.As(err, &typeErr):
+		key := typeErr.Field
+		if key == "" {
+			key = "_body"
+		}
+		fields[key] = append(fields[key], fmt.Sprintf("doit être de type %s", typeErr.Type.String()))
+	case errors.As(err, &syntaxErr), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		fields["_body"] = []string{"JSON invalide"}
+	default:
+		fields["_body"] = []string{err.Error()}
+	}
+
+	return fields
+}
+
+// fieldKey retire le nom de la struct racine du namespace :
+// "User.email" devient "email", "Post.user.email" devient "user.email".
+func fieldKey(fe validator.FieldError) string {
+	ns := fe.Namespace()
+	if i := strings.Index(ns, "."); i >= 0 {
+		return ns[i+1:]
+	}
+	return fe.Field()
+}
+
+func validationMessage(fe validator.FieldError) string {
+	isString := fe.Kind() == reflect.String
+
+	switch fe.Tag() {
+	case "required":
+		return "ce champ est requis"
+	case "email":
+		return "doit être une adresse email valide"
+	case "min":
+		if isString {
+			return fmt.Sprintf("doit contenir au moins %s caractères", fe.Param())
+		}
+		return fmt.Sprintf("doit être supérieur ou égal à %s", fe.Param())
+	case "max":
+		if isString {
+			return fmt.Sprintf("doit contenir au plus %s caractères", fe.Param())
+		}
+		return fmt.Sprintf("doit être inférieur ou égal à %s", fe.Param())
+	case "oneof":
+		return fmt.Sprintf("doit être l'une des valeurs : %s", fe.Param())
+	case "phone_cm":
+		return "doit être un numéro camerounais au format +237XXXXXXXXX"
+	case "xaf":
+		return "doit être un montant XAF entier et positif"
+	case "display_name":
+		return "doit commencer par une lettre et ne contenir que lettres, espaces, apostrophes, points ou tirets"
+	case "slug":
+		return "ne doit contenir que des minuscules, des chiffres et des tirets"
+	case "flag_key":
+		return "doit être en snake_case (ex: v2_profile)"
+	}
+	return fmt.Sprintf("ne respecte pas la règle '%s'", fe.Tag())
+}
+
+// respondValidationError renvoie une 400 avec le détail par champ.
+func respondValidationError(c *gin.Context, err error) {
+	c.JSON(http.StatusBadRequest, gin.H{
+		"error":  "Erreur de validation",
+		"fields": validationErrors(err),
+	})
+}
@@ -0,0 +1,1101 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	mrand "math/rand/v2"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// === WEBHOOKS SORTANTS ===
+//
+// Un compte (tenant) enregistre des endpoints HTTP abonnés à des types
+// d'événements. Publish est appelé dans l'unité de travail qui produit
+// l'événement (création d'un utilisateur, d'un post, issue d'un paiement) :
+// une livraison par endpoint abonné est enregistrée avec la donnée, ou rien
+// du tout (outbox). Le dispatcher (Watch) envoie ensuite les livraisons
+// dues : POST JSON signé, nouvel essai avec backoff exponentiel et jitter
+// en cas d'échec, puis file des lettres mortes (status "dead") après
+// WEBHOOK_MAX_ATTEMPTS essais. Les admins consultent le journal des
+// livraisons et peuvent relancer une livraison à la main.
+//
+// Signature : X-Webhook-Signature = "v1=" + hex(HMAC-SHA256(secret,
+// "<X-Webhook-Timestamp>.<corps>")). Pendant la période de grâce d'une
+// rotation, l'ancien secret signe aussi : "v1=<nouveau>,v1=<ancien>".
+
+// Types d'événements
+const (
+	EventUserCreated      = "user.created"
+	EventPostCreated      = "post.created"
+	EventPaymentSucceeded = "payment.succeeded"
+	EventPaymentFailed    = "payment.failed"
+)
+
+// webhookEventTypes : événements auxquels un endpoint peut s'abonner ("*" : tous)
+var webhookEventTypes = []string{EventUserCreated, EventPostCreated, EventPaymentSucceeded, EventPaymentFailed}
+
+// Statuts d'une livraison
+const (
+	DeliveryPending   = "pending"   // en attente du prochain essai (next_attempt_at)
+	DeliverySucceeded = "succeeded" // réponse 2xx
+	DeliveryDead      = "dead"      // abandonnée : file des lettres mortes
+)
+
+// EventPublisher enregistre un événement ; appelé dans l'unité de travail
+// qui le produit, il est annulé avec elle
+type EventPublisher interface {
+	Publish(ctx context.Context, eventType string, data interface{}) error
+}
+
+// discardEvents : aucun webhook (données de test : seed, fixtures)
+type discardEvents struct{}
+
+func (discardEvents) Publish(context.Context, string, interface{}) error { return nil }
+
+// EventTypes : abonnements d'un endpoint, stockés "a,b,c"
+type EventTypes []string
+
+func (e EventTypes) Value() (driver.Value, error) {
+	return strings.Join(e, ","), nil
+}
+
+func (e *EventTypes) Scan(value interface{}) error {
+	var s string
+	switch v := value.(type) {
+	case nil:
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	default:
+		return fmt.Errorf("EventTypes : type %T inattendu", value)
+	}
+	*e = nil
+	if s != "" {
+		*e = strings.Split(s, ",")
+	}
+	return nil
+}
+
+func (EventTypes) GormDataType() string { return "string" }
+
+// Has : l'endpoint est abonné à eventType
+func (e EventTypes) Has(eventType string) bool {
+	return slices.Contains(e, eventType) || slices.Contains(e, "*")
+}
+
+// rawJSON : document JSON stocké tel quel et renvoyé sans être ré-encodé
+type rawJSON string
+
+func (r rawJSON) MarshalJSON() ([]byte, error) {
+	if r == "" {
+		return []byte("null"), nil
+	}
+	return []byte(r), nil
+}
+
+// WebhookEndpoint : URL d'un compte abonnée à des événements. Seul son
+// propriétaire (l'utilisateur qui l'a enregistré) le voit et le modifie.
+// Secret n'est montré qu'à la création et à la rotation.
+type WebhookEndpoint struct {
+	ID                      uint       `gorm:"primaryKey" json:"id"`
+	TenantID                string     `gorm:"size:64;not null;index" json:"-"`
+	OwnerID                 uint       `gorm:"not null;default:0;index" json:"owner_id"`
+	URL                     string     `gorm:"size:2048;not null" json:"url"`
+	Description             string     `gorm:"size:255" json:"description,omitempty"`
+	Events                  EventTypes `gorm:"size:1024;not null" json:"events"`
+	Active                  bool       `gorm:"not null;default:true" json:"active"`
+	Secret                  string     `gorm:"size:64;not null" json:"-"`
+	PreviousSecret          string     `gorm:"size:64" json:"-"`
+	PreviousSecretExpiresAt *time.Time `json:"previous_secret_expires_at,omitempty"`
+	CreatedAt               time.Time  `json:"created_at"`
+	UpdatedAt               time.Time  `json:"updated_at"`
+}
+
+// WebhookDelivery : envoi d'un événement à un endpoint. EventID (UUID) est
+// le même pour tous les endpoints et tous les essais : le destinataire
+// dédoublonne avec.
+type WebhookDelivery struct {
+	ID             uint       `gorm:"primaryKey" json:"id"`
+	TenantID       string     `gorm:"size:64;not null;index" json:"-"`
+	EndpointID     uint       `gorm:"not null;index" json:"endpoint_id"`
+	EventID        string     `gorm:"size:36;not null;index" json:"event_id"`
+	EventType      string     `gorm:"size:64;not null" json:"event_type"`
+	Payload        rawJSON    `gorm:"type:text;not null" json:"payload"`
+	Status         string     `gorm:"size:16;not null;index:idx_webhook_deliveries_status_next,priority:1" json:"status"`
+	NextAttemptAt  *time.Time `gorm:"index:idx_webhook_deliveries_status_next,priority:2" json:"next_attempt_at,omitempty"`
+	Attempts       int        `gorm:"not null;default:0" json:"attempts"`
+	LastStatusCode int        `json:"last_status_code,omitempty"`
+	LastError      string     `gorm:"size:255" json:"last_error,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty"`
+}
+
+// WebhookAttempt : un essai d'une livraison (journal)
+type WebhookAttempt struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	TenantID   string    `gorm:"size:64;not null;index" json:"-"`
+	DeliveryID uint      `gorm:"not null;index" json:"delivery_id"`
+	Number     int       `gorm:"not null" json:"number"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `gorm:"size:255" json:"error,omitempty"`
+	DurationMS int64     `gorm:"not null;default:0" json:"duration_ms"`
+	Manual     bool      `gorm:"not null;default:false" json:"manual"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// DeliveryFilter : critères du journal des livraisons (les plus récentes
+// d'abord, IDs < Before si Before > 0)
+type DeliveryFilter struct {
+	EndpointID uint
+	Status     string
+	Before     uint
+	Limit      int
+}
+
+type WebhookRepository interface {
+	CreateEndpoint(ctx context.Context, endpoint *WebhookEndpoint) error
+	// GetEndpoint retourne un endpoint du tenant, ou ErrNotFound
+	GetEndpoint(ctx context.Context, id uint) (*WebhookEndpoint, error)
+	ListEndpoints(ctx context.Context) ([]WebhookEndpoint, error)
+	// UpdateEndpoint enregistre URL, description, abonnements, état et secrets
+	UpdateEndpoint(ctx context.Context, endpoint *WebhookEndpoint) error
+	// DeleteEndpoint supprime l'endpoint (ErrNotFound s'il n'existe pas) ;
+	// ses livraisons restent dans le journal
+	DeleteEndpoint(ctx context.Context, id uint) error
+
+	CreateDeliveries(ctx context.Context, deliveries []WebhookDelivery) error
+	// GetDelivery retourne une livraison du tenant, ou ErrNotFound
+	GetDelivery(ctx context.Context, id uint) (*WebhookDelivery, error)
+	// LockDelivery relit la livraison, verrouillée jusqu'à la fin de la transaction
+	LockDelivery(ctx context.Context, id uint) (*WebhookDelivery, error)
+	// UpdateDelivery enregistre statut, prochain essai, compteur, dernier
+	// résultat et date de livraison
+	UpdateDelivery(ctx context.Context, delivery *WebhookDelivery) error
+	ListDeliveries(ctx context.Context, filter DeliveryFilter) ([]WebhookDelivery, error)
+	// DueDeliveries retourne, tous tenants confondus, au plus limit
+	// livraisons en attente dont le prochain essai est passé
+	DueDeliveries(ctx context.Context, now time.Time, limit int) ([]WebhookDelivery, error)
+
+	AddAttempt(ctx context.Context, attempt *WebhookAttempt) error
+	// ListAttempts retourne les essais de la livraison, dans l'ordre
+	ListAttempts(ctx context.Context, deliveryID uint) ([]WebhookAttempt, error)
+}
+
+// === CONFIGURATION ===
+
+// WebhookConfig : WEBHOOK_MAX_ATTEMPTS (8), WEBHOOK_RETRY_BASE (30s, délai
+// après le premier échec, doublé à chaque essai), WEBHOOK_RETRY_MAX (6h),
+// WEBHOOK_TIMEOUT (10s), WEBHOOK_SECRET_GRACE (24h, validité de l'ancien
+// secret après une rotation), WEBHOOK_ALLOW_PRIVATE (false, true : adresses
+// locales et privées acceptées, pour le simulateur et les tests)
+type WebhookConfig struct {
+	MaxAttempts  int
+	RetryBase    time.Duration
+	RetryMax     time.Duration
+	Timeout      time.Duration
+	SecretGrace  time.Duration
+	AllowPrivate bool
+}
+
+func loadWebhookConfig() WebhookConfig {
+	cfg := WebhookConfig{
+		MaxAttempts: 8,
+		RetryBase:   30 * time.Second,
+		RetryMax:    6 * time.Hour,
+		Timeout:     10 * time.Second,
+		SecretGrace: 24 * time.Hour,
+	}
+	if n, err := strconv.Atoi(os.Getenv("WEBHOOK_MAX_ATTEMPTS")); err == nil && n > 0 {
+		cfg.MaxAttempts = n
+	}
+	durations := map[string]*time.Duration{
+		"WEBHOOK_RETRY_BASE":   &cfg.RetryBase,
+		"WEBHOOK_RETRY_MAX":    &cfg.RetryMax,
+		"WEBHOOK_TIMEOUT":      &cfg.Timeout,
+		"WEBHOOK_SECRET_GRACE": &cfg.SecretGrace,
+	}
+	for name, d := range durations {
+		if v, err := time.ParseDuration(os.Getenv(name)); err == nil && v > 0 {
+			*d = v
+		}
+	}
+	if b, err := strconv.ParseBool(os.Getenv("WEBHOOK_ALLOW_PRIVATE")); err == nil {
+		cfg.AllowPrivate = b
+	}
+	return cfg
+}
+
+// webhookPollInterval lit WEBHOOK_POLL_INTERVAL (2s par défaut, 0 = pas
+// d'envoi automatique)
+func webhookPollInterval() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("WEBHOOK_POLL_INTERVAL")); err == nil && d >= 0 {
+		return d
+	}
+	return 2 * time.Second
+}
+
+// === SERVICE ===
+
+var (
+	ErrWebhookNotFound  = errors.New("endpoint non trouvé")
+	ErrDeliveryNotFound = errors.New("livraison non trouvée")
+	ErrInvalidEndpoint  = errors.New("URL d'endpoint invalide")
+	ErrPrivateEndpoint  = errors.New("adresse locale ou privée refusée")
+)
+
+// UnknownEventsError liste les types d'événements inconnus demandés
+type UnknownEventsError struct {
+	Names []string
+}
+
+func (e *UnknownEventsError) Error() string {
+	return "événements inconnus : " + strings.Join(e.Names, ", ")
+}
+
+const (
+	webhookDispatchBatch = 100 // livraisons par passage
+	webhookWorkers       = 8   // envois simultanés
+)
+
+type WebhookService struct {
+	webhooks WebhookRepository
+	uow      UnitOfWork
+	cfg      WebhookConfig
+	client   *http.Client
+}
+
+func NewWebhookService(webhooks WebhookRepository, uow UnitOfWork, cfg WebhookConfig) *WebhookService {
+	// Sans proxy : l'adresse contrôlée à la connexion est celle de l'endpoint
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	if !cfg.AllowPrivate {
+		dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second, Control: publicAddressOnly}
+		transport.DialContext = dialer.DialContext
+	}
+	return &WebhookService{
+		webhooks: webhooks,
+		uow:      uow,
+		cfg:      cfg,
+		client: &http.Client{
+			Timeout:   cfg.Timeout,
+			Transport: transport,
+			// Une redirection n'est pas une livraison
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+	}
+}
+
+// deniedPrefixes : destinations refusées, d'après les registres IANA des
+// adresses à usage spécial : non spécifiée, bouclage, réseaux privés et
+// partagés (CGNAT), lien local (169.254.169.254 : métadonnées des clouds),
+// documentation, bancs de test, multicast et plages réservées
+var deniedPrefixes = mustParsePrefixes(
+	"0.0.0.0/8", "10.0.0.0/8", "100.64.0.0/10", "127.0.0.0/8", "169.254.0.0/16",
+	"172.16.0.0/12", "192.0.0.0/24", "192.0.2.0/24", "192.88.99.0/24", "192.168.0.0/16",
+	"198.18.0.0/15", "198.51.100.0/24", "203.0.113.0/24", "224.0.0.0/4", "240.0.0.0/4",
+	"::/96", // non spécifiée, bouclage et IPv4 compatibles (obsolètes)
+	"64:ff9b:1::/48", "100::/64", "2001::/23", "2001:db8::/32",
+	"fc00::/7", "fe80::/10", "fec0::/10", "ff00::/8",
+)
+
+// Préfixes IPv6 qui embarquent une IPv4, jugés sur celle-ci
+var (
+	nat64Prefix = netip.MustParsePrefix("64:ff9b::/96") // IPv4 dans les 4 derniers octets
+	sixToFour   = netip.MustParsePrefix("2002::/16")    // IPv4 dans les octets 2 à 5
+)
+
+func mustParsePrefixes(prefixes ...string) []netip.Prefix {
+	parsed := make([]netip.Prefix, len(prefixes))
+	for i, p := range prefixes {
+		parsed[i] = netip.MustParsePrefix(p)
+	}
+	return parsed
+}
+
+// privateIP : adresse invalide ou dans une plage refusée. Les formes IPv6
+// d'une IPv4 (::ffff:a.b.c.d, NAT64, 6to4) sont ramenées à l'IPv4.
+func privateIP(addr netip.Addr) bool {
+	addr = addr.WithZone("").Unmap()
+	if addr.Is6() {
+		b := addr.As16()
+		switch {
+		case nat64Prefix.Contains(addr):
+			addr = netip.AddrFrom4([4]byte(b[12:16]))
+		case sixToFour.Contains(addr):
+			addr = netip.AddrFrom4([4]byte(b[2:6]))
+		}
+	}
+	if !addr.IsValid() {
+		return true
+	}
+	for _, p := range deniedPrefixes {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// publicAddressOnly (Control du dialer) refuse la connexion vers une adresse
+// privée : contrôle fait sur l'adresse résolue, juste avant la connexion,
+// qu'un changement DNS après l'enregistrement ne contourne pas
+func publicAddressOnly(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if addr, err := netip.ParseAddr(host); err != nil || privateIP(addr) {
+		return fmt.Errorf("%w : %s", ErrPrivateEndpoint, host)
+	}
+	return nil
+}
+
+// newWebhookSecret : "whsec_" + 24 octets aléatoires en hexadécimal
+func newWebhookSecret() string {
+	b := make([]byte, 24)
+	_, _ = rand.Read(b)
+	return "whsec_" + hex.EncodeToString(b)
+}
+
+// checkEndpoint vérifie l'URL (http ou https), son hôte (ni local ni privé,
+// sauf allowPrivate) et les abonnements. Un nom qui ne se résout pas encore
+// est accepté : le dialer refuse de toute façon les adresses privées.
+func checkEndpoint(ctx context.Context, rawURL string, events []string, allowPrivate bool) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return ErrInvalidEndpoint
+	}
+	if !allowPrivate {
+		if err := checkPublicHost(ctx, u.Hostname()); err != nil {
+			return err
+		}
+	}
+	var unknown []string
+	for _, e := range events {
+		if e != "*" && !slices.Contains(webhookEventTypes, e) {
+			unknown = append(unknown, e)
+		}
+	}
+	if len(unknown) > 0 {
+		return &UnknownEventsError{Names: unknown}
+	}
+	return nil
+}
+
+// checkPublicHost refuse localhost et tout hôte dont une adresse est privée
+func checkPublicHost(ctx context.Context, host string) error {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return ErrPrivateEndpoint
+	}
+	if addr, err := netip.ParseAddr(host); err == nil {
+		if privateIP(addr) {
+			return ErrPrivateEndpoint
+		}
+		return nil
+	}
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return nil
+	}
+	for _, a := range addrs {
+		if privateIP(a) {
+			return ErrPrivateEndpoint
+		}
+	}
+	return nil
+}
+
+// CreateEndpoint enregistre un endpoint actif avec un secret neuf
+func (s *WebhookService) CreateEndpoint(ctx context.Context, endpoint *WebhookEndpoint) error {
+	endpoint.Events = slices.Compact(slices.Sorted(slices.Values(endpoint.Events)))
+	if err := checkEndpoint(ctx, endpoint.URL, endpoint.Events, s.cfg.AllowPrivate); err != nil {
+		return err
+	}
+	endpoint.Active = true
+	endpoint.Secret, endpoint.PreviousSecret, endpoint.PreviousSecretExpiresAt = newWebhookSecret(), "", nil
+	return s.webhooks.CreateEndpoint(ctx, endpoint)
+}
+
+// ListEndpoints retourne les endpoints du propriétaire
+func (s *WebhookService) ListEndpoints(ctx context.Context, ownerID uint) ([]WebhookEndpoint, error) {
+	endpoints, err := s.webhooks.ListEndpoints(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return slices.DeleteFunc(endpoints, func(e WebhookEndpoint) bool { return e.OwnerID != ownerID }), nil
+}
+
+// GetEndpoint retourne un endpoint du propriétaire ; celui d'un autre
+// utilisateur est introuvable (ErrWebhookNotFound), comme un ID inconnu
+func (s *WebhookService) GetEndpoint(ctx context.Context, ownerID, id uint) (*WebhookEndpoint, error) {
+	endpoint, err := s.webhooks.GetEndpoint(ctx, id)
+	if errors.Is(err, ErrNotFound) || (err == nil && endpoint.OwnerID != ownerID) {
+		return nil, ErrWebhookNotFound
+	}
+	return endpoint, err
+}
+
+// EndpointPatch : champs modifiés par PUT (nil : inchangé)
+type EndpointPatch struct {
+	URL         *string
+	Description *string
+	Events      []string
+	Active      *bool
+}
+
+func (s *WebhookService) UpdateEndpoint(ctx context.Context, ownerID, id uint, patch EndpointPatch) (*WebhookEndpoint, error) {
+	var endpoint *WebhookEndpoint
+	err := s.uow.Do(ctx, func(ctx context.Context) error {
+		var err error
+		if endpoint, err = s.GetEndpoint(ctx, ownerID, id); err != nil {
+			return err
+		}
+		if patch.URL != nil {
+			endpoint.URL = *patch.URL
+		}
+		if patch.Description != nil {
+			endpoint.Description = *patch.Description
+		}
+		if patch.Events != nil {
+			endpoint.Events = slices.Compact(slices.Sorted(slices.Values(patch.Events)))
+		}
+		if patch.Active != nil {
+			endpoint.Active = *patch.Active
+		}
+		if err := checkEndpoint(ctx, endpoint.URL, endpoint.Events, s.cfg.AllowPrivate); err != nil {
+			return err
+		}
+		return s.webhooks.UpdateEndpoint(ctx, endpoint)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return endpoint, nil
+}
+
+func (s *WebhookService) DeleteEndpoint(ctx context.Context, ownerID, id uint) error {
+	return s.uow.Do(ctx, func(ctx context.Context) error {
+		if _, err := s.GetEndpoint(ctx, ownerID, id); err != nil {
+			return err
+		}
+		err := s.webhooks.DeleteEndpoint(ctx, id)
+		if errors.Is(err, ErrNotFound) {
+			return ErrWebhookNotFound
+		}
+		return err
+	})
+}
+
+// RotateSecret remplace le secret ; l'ancien signe encore pendant grace
+// (0 : révoqué tout de suite)
+func (s *WebhookService) RotateSecret(ctx context.Context, ownerID, id uint, grace time.Duration) (*WebhookEndpoint, error) {
+	var endpoint *WebhookEndpoint
+	err := s.uow.Do(ctx, func(ctx context.Context) error {
+		var err error
+		if endpoint, err = s.GetEndpoint(ctx, ownerID, id); err != nil {
+			return err
+		}
+		endpoint.PreviousSecret, endpoint.PreviousSecretExpiresAt = "", nil
+		if grace > 0 {
+			expires := time.Now().Add(grace)
+			endpoint.PreviousSecret, endpoint.PreviousSecretExpiresAt = endpoint.Secret, &expires
+		}
+		endpoint.Secret = newWebhookSecret()
+		return s.webhooks.UpdateEndpoint(ctx, endpoint)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return endpoint, nil
+}
+
+// webhookEvent : corps envoyé aux endpoints
+type webhookEvent struct {
+	ID        string      `json:"id"`
+	Type      string      `json:"type"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+// Publish enregistre une livraison de l'événement pour chaque endpoint
+// actif du tenant abonné à eventType
+func (s *WebhookService) Publish(ctx context.Context, eventType string, data interface{}) error {
+	endpoints, err := s.webhooks.ListEndpoints(ctx)
+	if err != nil {
+		return err
+	}
+	endpoints = slices.DeleteFunc(endpoints, func(e WebhookEndpoint) bool {
+		return !e.Active || !e.Events.Has(eventType)
+	})
+	if len(endpoints) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	event := webhookEvent{ID: uuid.NewString(), Type: eventType, CreatedAt: now.UTC(), Data: data}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	deliveries := make([]WebhookDelivery, len(endpoints))
+	for i, e := range endpoints {
+		deliveries[i] = WebhookDelivery{
+			EndpointID:    e.ID,
+			EventID:       event.ID,
+			EventType:     eventType,
+			Payload:       rawJSON(payload),
+			Status:        DeliveryPending,
+			NextAttemptAt: &now,
+		}
+	}
+	return s.webhooks.CreateDeliveries(ctx, deliveries)
+}
+
+// === LIVRAISON ===
+
+// Dispatch envoie les livraisons dues, webhookWorkers à la fois ; retourne
+// le nombre de réussites et d'échecs
+func (s *WebhookService) Dispatch(ctx context.Context) (delivered, failed int, err error) {
+	due, err := s.webhooks.DueDeliveries(ctx, time.Now(), webhookDispatchBatch)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var (
+		mu   sync.Mutex
+		wg   sync.WaitGroup
+		errs []error
+		sem  = make(chan struct{}, webhookWorkers)
+	)
+	for _, d := range due {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			delivery, err := s.attempt(withTenant(ctx, d.TenantID), d.ID, false)
+
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err != nil:
+				errs = append(errs, fmt.Errorf("livraison %d : %w", d.ID, err))
+			case delivery == nil:
+				// prise par un autre dispatcher
+			case delivery.Status == DeliverySucceeded:
+				delivered++
+			default:
+				failed++
+			}
+		}()
+	}
+	wg.Wait()
+	return delivered, failed, errors.Join(errs...)
+}
+
+// Redeliver fait un essai immédiat, quel que soit le statut de la
+// livraison (lettre morte comprise). Un échec ne change pas le statut d'une
+// livraison réussie ou morte.
+func (s *WebhookService) Redeliver(ctx context.Context, id uint) (*WebhookDelivery, error) {
+	delivery, err := s.attempt(ctx, id, true)
+	if errors.Is(err, ErrNotFound) {
+		return nil, ErrDeliveryNotFound
+	}
+	return delivery, err
+}
+
+// Delivery retourne une livraison et ses essais
+func (s *WebhookService) Delivery(ctx context.Context, id uint) (*WebhookDelivery, []WebhookAttempt, error) {
+	delivery, err := s.webhooks.GetDelivery(ctx, id)
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil, ErrDeliveryNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	attempts, err := s.webhooks.ListAttempts(ctx, id)
+	return delivery, attempts, err
+}
+
+// Deliveries retourne une page du journal et le curseur de la suivante
+func (s *WebhookService) Deliveries(ctx context.Context, filter DeliveryFilter) ([]WebhookDelivery, uint, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = defaultEntriesLimit
+	}
+	filter.Limit = min(filter.Limit, maxEntriesLimit)
+	limit := filter.Limit
+	filter.Limit++ // une de plus pour savoir s'il reste une page
+
+	deliveries, err := s.webhooks.ListDeliveries(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+	var next uint
+	if len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+		next = deliveries[limit-1].ID
+	}
+	return deliveries, next, nil
+}
+
+// attempt réserve la livraison (prochain essai repoussé du temps d'un
+// envoi, pour qu'un autre dispatcher ne la prenne pas), l'envoie et
+// enregistre le résultat. nil, nil : livraison plus due (automatique).
+func (s *WebhookService) attempt(ctx context.Context, id uint, manual bool) (*WebhookDelivery, error) {
+	var delivery *WebhookDelivery
+	err := s.uow.Do(ctx, func(ctx context.Context) error {
+		d, err := s.webhooks.LockDelivery(ctx, id)
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		if !manual && (d.Status != DeliveryPending || d.NextAttemptAt == nil || d.NextAttemptAt.After(now)) {
+			return nil
+		}
+		if d.Status == DeliveryPending {
+			lease := now.Add(2 * s.cfg.Timeout)
+			d.NextAttemptAt = &lease
+			if err := s.webhooks.UpdateDelivery(ctx, d); err != nil {
+				return err
+			}
+		}
+		delivery = d
+		return nil
+	})
+	if err != nil || delivery == nil {
+		return nil, err
+	}
+
+	// Endpoint supprimé ou désactivé : plus d'essai automatique
+	var result deliveryResult
+	endpoint, err := s.webhooks.GetEndpoint(ctx, delivery.EndpointID)
+	switch {
+	case errors.Is(err, ErrNotFound):
+		result = deliveryResult{err: "endpoint supprimé", final: true}
+	case err != nil:
+		result = deliveryResult{err: err.Error()}
+	case !endpoint.Active && !manual:
+		result = deliveryResult{err: "endpoint désactivé", final: true}
+	default:
+		result = s.send(ctx, delivery, endpoint)
+	}
+	return s.record(ctx, delivery.ID, result, manual)
+}
+
+type deliveryResult struct {
+	statusCode int
+	err        string
+	duration   time.Duration
+	final      bool // inutile de réessayer
+}
+
+func (r deliveryResult) ok() bool { return r.err == "" }
+
+// send : POST signé du corps de l'événement
+func (s *WebhookService) send(ctx context.Context, delivery *WebhookDelivery, endpoint *WebhookEndpoint) deliveryResult {
+	now := time.Now()
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.URL, bytes.NewReader(body))
+	if err != nil {
+		return deliveryResult{err: err.Error(), final: true}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "jour04-webhooks/1.0")
+	req.Header.Set("X-Webhook-ID", delivery.EventID)
+	req.Header.Set("X-Webhook-Event", delivery.EventType)
+	req.Header.Set("X-Webhook-Delivery", strconv.FormatUint(uint64(delivery.ID), 10))
+	req.Header.Set("X-Webhook-Timestamp", strconv.FormatInt(now.Unix(), 10))
+	req.Header.Set("X-Webhook-Signature", webhookSignature(endpoint, now, body))
+
+	resp, err := s.client.Do(req)
+	result := deliveryResult{duration: time.Since(now)}
+	if err != nil {
+		result.err = err.Error()
+		return result
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	result.statusCode = resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		result.err = "HTTP " + resp.Status
+	}
+	return result
+}
+
+// webhookSignature : "v1=<hex>" avec le secret, puis avec l'ancien tant
+// que la rotation est en période de grâce
+func webhookSignature(endpoint *WebhookEndpoint, now time.Time, body []byte) string {
+	sig := "v1=" + signWebhook(endpoint.Secret, now.Unix(), body)
+	if endpoint.PreviousSecret != "" && endpoint.PreviousSecretExpiresAt != nil &&
+		now.Before(*endpoint.PreviousSecretExpiresAt) {
+		sig += ",v1=" + signWebhook(endpoint.PreviousSecret, now.Unix(), body)
+	}
+	return sig
+}
+
+// signWebhook : hex(HMAC-SHA256(secret, "<timestamp>.<corps>"))
+func signWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// record enregistre l'essai et fait avancer la livraison : réussie, nouvel
+// essai après backoff, ou lettre morte
+func (s *WebhookService) record(ctx context.Context, id uint, result deliveryResult, manual bool) (*WebhookDelivery, error) {
+	var delivery *WebhookDelivery
+	err := s.uow.Do(ctx, func(ctx context.Context) error {
+		d, err := s.webhooks.LockDelivery(ctx, id)
+		if err != nil {
+			return err
+		}
+		d.Attempts++
+		d.LastStatusCode, d.LastError = result.statusCode, truncate(result.err, 255)
+		now := time.Now()
+		switch {
+		case result.ok():
+			d.Status, d.NextAttemptAt, d.DeliveredAt = DeliverySucceeded, nil, &now
+		case d.Status != DeliveryPending:
+			// Relance manuelle d'une livraison réussie ou morte : statut inchangé
+		case result.final || d.Attempts >= s.cfg.MaxAttempts:
+			d.Status, d.NextAttemptAt = DeliveryDead, nil
+		default:
+			next := now.Add(s.backoff(d.Attempts))
+			d.NextAttemptAt = &next
+		}
+		if err := s.webhooks.UpdateDelivery(ctx, d); err != nil {
+			return err
+		}
+		delivery = d
+		return s.webhooks.AddAttempt(ctx, &WebhookAttempt{
+			DeliveryID: d.ID,
+			Number:     d.Attempts,
+			StatusCode: result.statusCode,
+			Error:      d.LastError,
+			DurationMS: result.duration.Milliseconds(),
+			Manual:     manual,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return delivery, nil
+}
+
+// backoff : RetryBase doublé à chaque échec, plafonné à RetryMax, puis tiré
+// au hasard dans [d/2, d] pour étaler les essais des livraisons tombées
+// ensemble
+func (s *WebhookService) backoff(attempts int) time.Duration {
+	d := s.cfg.RetryBase
+	for i := 1; i < attempts && d < s.cfg.RetryMax; i++ {
+		d *= 2
+	}
+	d = min(d, s.cfg.RetryMax)
+	return d/2 + mrand.N(d/2+1)
+}
+
+// Watch envoie les livraisons dues à intervalle régulier
+func (s *WebhookService) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			delivered, failed, err := s.Dispatch(ctx)
+			if err != nil {
+				fmt.Printf("[WEBHOOK] Erreur: %v\n", err)
+			}
+			if delivered+failed > 0 {
+				fmt.Printf("[WEBHOOK] %d livrée(s), %d en échec\n", delivered, failed)
+			}
+		}
+	}
+}
+
+// === HANDLERS ===
+
+type WebhookHandler struct {
+	webhooks *WebhookService
+}
+
+func NewWebhookHandler(webhooks *WebhookService) *WebhookHandler {
+	return &WebhookHandler{webhooks: webhooks}
+}
+
+func respondWebhookError(c *gin.Context, err error, fallback string) {
+	var unknown *UnknownEventsError
+	switch {
+	case errors.As(err, &unknown):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Événements inconnus", "unknown": unknown.Names, "available": webhookEventTypes})
+	case errors.Is(err, ErrInvalidEndpoint):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "URL invalide (http ou https)"})
+	case errors.Is(err, ErrPrivateEndpoint):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "URL refusée : adresse locale ou privée", "code": "private_endpoint"})
+	case errors.Is(err, ErrWebhookNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Endpoint non trouvé"})
+	case errors.Is(err, ErrDeliveryNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Livraison non trouvée"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
+
+// endpointWithSecret : réponse de la création et de la rotation, seules à
+// montrer le secret
+type endpointWithSecret struct {
+	*WebhookEndpoint
+	Secret string `json:"secret"`
+}
+
+// webhookRequest : corps de POST /v1/webhooks
+type webhookRequest struct {
+	URL         string   `json:"url" binding:"required,url,max=2048"`
+	Description string   `json:"description" binding:"max=255"`
+	Events      []string `json:"events" binding:"required,min=1,max=20,dive,required"`
+}
+
+// POST /v1/webhooks (propriétaire : l'appelant)
+func (h *WebhookHandler) Create(c *gin.Context) {
+	ownerID, ok := requireCaller(c)
+	if !ok {
+		return
+	}
+	var req webhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondValidationError(c, err)
+		return
+	}
+
+	endpoint := WebhookEndpoint{OwnerID: ownerID, URL: req.URL, Description: req.Description, Events: req.Events}
+	if err := h.webhooks.CreateEndpoint(c.Request.Context(), &endpoint); err != nil {
+		respondWebhookError(c, err, "Erreur création")
+		return
+	}
+	c.JSON(http.StatusCreated, endpointWithSecret{&endpoint, endpoint.Secret})
+}
+
+// GET /v1/webhooks - endpoints de l'appelant
+func (h *WebhookHandler) List(c *gin.Context) {
+	ownerID, ok := requireCaller(c)
+	if !ok {
+		return
+	}
+	endpoints, err := h.webhooks.ListEndpoints(c.Request.Context(), ownerID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur BD"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"webhooks": endpoints, "total": len(endpoints)})
+}
+
+// GET /v1/webhooks/:id (propriétaire : l'appelant)
+func (h *WebhookHandler) Get(c *gin.Context) {
+	id, ok := parseID(c)
+	if !ok {
+		return
+	}
+	ownerID, ok := requireCaller(c)
+	if !ok {
+		return
+	}
+	endpoint, err := h.webhooks.GetEndpoint(c.Request.Context(), ownerID, id)
+	if err != nil {
+		respondWebhookError(c, err, "Erreur BD")
+		return
+	}
+	c.JSON(http.StatusOK, endpoint)
+}
+
+// webhookPatchRequest : corps de PUT /v1/webhooks/:id (champs absents conservés)
+type webhookPatchRequest struct {
+	URL         *string  `json:"url" binding:"omitempty,url,max=2048"`
+	Description *string  `json:"description" binding:"omitempty,max=255"`
+	Events      []string `json:"events" binding:"omitempty,min=1,max=20,dive,required"`
+	Active      *bool    `json:"active"`
+}
+
+// PUT /v1/webhooks/:id (propriétaire : l'appelant)
+func (h *WebhookHandler) Update(c *gin.Context) {
+	id, ok := parseID(c)
+	if !ok {
+		return
+	}
+	ownerID, ok := requireCaller(c)
+	if !ok {
+		return
+	}
+	var req webhookPatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondValidationError(c, err)
+		return
+	}
+
+	endpoint, err := h.webhooks.UpdateEndpoint(c.Request.Context(), ownerID, id, EndpointPatch{
+		URL: req.URL, Description: req.Description, Events: req.Events, Active: req.Active,
+	})
+	if err != nil {
+		respondWebhookError(c, err, "Erreur mise à jour")
+		return
+	}
+	c.JSON(http.StatusOK, endpoint)
+}
+
+// DELETE /v1/webhooks/:id (propriétaire : l'appelant)
+func (h *WebhookHandler) Delete(c *gin.Context) {
+	id, ok := parseID(c)
+	if !ok {
+		return
+	}
+	ownerID, ok := requireCaller(c)
+	if !ok {
+		return
+	}
+	if err := h.webhooks.DeleteEndpoint(c.Request.Context(), ownerID, id); err != nil {
+		respondWebhookError(c, err, "Erreur suppression")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// POST /v1/webhooks/:id/rotate-secret (propriétaire : l'appelant ; ?grace=,
+// WEBHOOK_SECRET_GRACE par défaut, 0 : ancien secret révoqué tout de suite)
+func (h *WebhookHandler) RotateSecret(c *gin.Context) {
+	id, ok := parseID(c)
+	if !ok {
+		return
+	}
+	ownerID, ok := requireCaller(c)
+	if !ok {
+		return
+	}
+	grace := h.webhooks.cfg.SecretGrace
+	if raw := c.Query("grace"); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d < 0 || d > 7*24*time.Hour {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "grace doit être une durée entre 0 et 168h"})
+			return
+		}
+		grace = d
+	}
+
+	endpoint, err := h.webhooks.RotateSecret(c.Request.Context(), ownerID, id, grace)
+	if err != nil {
+		respondWebhookError(c, err, "Erreur rotation")
+		return
+	}
+	c.JSON(http.StatusOK, endpointWithSecret{endpoint, endpoint.Secret})
+}
+
+// GET /admin/webhooks/deliveries (?status=pending|succeeded|dead,
+// ?endpoint_id=, ?limit=, ?before=) : journal des livraisons ; status=dead
+// donne la file des lettres mortes
+func (h *WebhookHandler) Deliveries(c *gin.Context) {
+	var filter DeliveryFilter
+	filter.Status = c.Query("status")
+	if filter.Status != "" && !slices.Contains([]string{DeliveryPending, DeliverySucceeded, DeliveryDead}, filter.Status) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status : pending, succeeded ou dead"})
+		return
+	}
+	for name, target := range map[string]*uint{"endpoint_id": &filter.EndpointID, "before": &filter.Before} {
+		if raw := c.Query(name); raw != "" {
+			n, err := strconv.ParseUint(raw, 10, 32)
+			if err != nil || n == 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": name + " doit être un ID"})
+				return
+			}
+			*target = uint(n)
+		}
+	}
+	filter.Limit, _ = strconv.Atoi(c.Query("limit"))
+
+	deliveries, next, err := h.webhooks.Deliveries(c.Request.Context(), filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur BD"})
+		return
+	}
+	resp := gin.H{"deliveries": deliveries, "total": len(deliveries)}
+	if next != 0 {
+		resp["next_before"] = next
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// deliveryDetail : livraison et ses essais
+type deliveryDetail struct {
+	*WebhookDelivery
+	AttemptLog []WebhookAttempt `json:"attempt_log"`
+}
+
+// GET /admin/webhooks/deliveries/:id
+func (h *WebhookHandler) Delivery(c *gin.Context) {
+	id, ok := parseID(c)
+	if !ok {
+		return
+	}
+	delivery, attempts, err := h.webhooks.Delivery(c.Request.Context(), id)
+	if err != nil {
+		respondWebhookError(c, err, "Erreur BD")
+		return
+	}
+	c.JSON(http.StatusOK, deliveryDetail{delivery, attempts})
+}
+
+// POST /admin/webhooks/deliveries/:id/redeliver - essai immédiat ; la
+// réponse contient son résultat
+func (h *WebhookHandler) Redeliver(c *gin.Context) {
+	id, ok := parseID(c)
+	if !ok {
+		return
+	}
+	ctx := c.Request.Context()
+	if _, err := h.webhooks.Redeliver(ctx, id); err != nil {
+		respondWebhookError(c, err, "Erreur de livraison")
+		return
+	}
+	delivery, attempts, err := h.webhooks.Delivery(ctx, id)
+	if err != nil {
+		respondWebhookError(c, err, "Erreur BD")
+		return
+	}
+	c.JSON(http.StatusOK, deliveryDetail{delivery, attempts})
+}
+
+// POST /admin/webhooks/dispatch - envoie tout de suite les livraisons dues
+func (h *WebhookHandler) Dispatch(c *gin.Context) {
+	delivered, failed, err := h.webhooks.Dispatch(c.Request.Context())
+	resp := gin.H{"delivered": delivered, "failed": failed}
+	if err != nil {
+		resp["error"] = err.Error()
+		c.JSON(http.StatusInternalServerError, resp)
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
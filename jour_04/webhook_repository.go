@@ -0,0 +1,435 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// === WEBHOOKS : REPOSITORIES ===
+
+type gormWebhookRepository struct {
+	db *gorm.DB
+}
+
+func NewGormWebhookRepository(db *gorm.DB) WebhookRepository {
+	return &gormWebhookRepository{db: db}
+}
+
+func (r *gormWebhookRepository) CreateEndpoint(ctx context.Context, endpoint *WebhookEndpoint) error {
+	return translateError(dbFromContext(ctx, r.db).Create(endpoint).Error)
+}
+
+func (r *gormWebhookRepository) GetEndpoint(ctx context.Context, id uint) (*WebhookEndpoint, error) {
+	var endpoint WebhookEndpoint
+	if err := dbFromContext(ctx, r.db).First(&endpoint, id).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &endpoint, nil
+}
+
+func (r *gormWebhookRepository) ListEndpoints(ctx context.Context) ([]WebhookEndpoint, error) {
+	var endpoints []WebhookEndpoint
+	err := dbFromContext(ctx, r.db).Order("id").Find(&endpoints).Error
+	return endpoints, err
+}
+
+func (r *gormWebhookRepository) UpdateEndpoint(ctx context.Context, endpoint *WebhookEndpoint) error {
+	return dbFromContext(ctx, r.db).Model(endpoint).
+		Select("URL", "Description", "Events", "Active", "Secret", "PreviousSecret", "PreviousSecretExpiresAt", "UpdatedAt").
+		Updates(endpoint).Error
+}
+
+func (r *gormWebhookRepository) DeleteEndpoint(ctx context.Context, id uint) error {
+	result := dbFromContext(ctx, r.db).Delete(&WebhookEndpoint{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *gormWebhookRepository) CreateDeliveries(ctx context.Context, deliveries []WebhookDelivery) error {
+	return dbFromContext(ctx, r.db).Create(&deliveries).Error
+}
+
+func (r *gormWebhookRepository) GetDelivery(ctx context.Context, id uint) (*WebhookDelivery, error) {
+	var delivery WebhookDelivery
+	if err := dbFromContext(ctx, r.db).First(&delivery, id).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &delivery, nil
+}
+
+func (r *gormWebhookRepository) LockDelivery(ctx context.Context, id uint) (*WebhookDelivery, error) {
+	var delivery WebhookDelivery
+	err := dbFromContext(ctx, r.db).Clauses(clause.Locking{Strength: "UPDATE"}).First(&delivery, id).Error
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return &delivery, nil
+}
+
+func (r *gormWebhookRepository) UpdateDelivery(ctx context.Context, delivery *WebhookDelivery) error {
+	return dbFromContext(ctx, r.db).Model(delivery).
+		Select("Status", "NextAttemptAt", "Attempts", "LastStatusCode", "LastError", "DeliveredAt", "UpdatedAt").
+		Updates(delivery).Error
+}
+
+func (r *gormWebhookRepository) ListDeliveries(ctx context.Context, filter DeliveryFilter) ([]WebhookDelivery, error) {
+	query := dbFromContext(ctx, r.db).Order("id DESC").Limit(filter.Limit)
+	if filter.EndpointID > 0 {
+		query = query.Where("endpoint_id = ?", filter.EndpointID)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.Before > 0 {
+		query = query.Where("id < ?", filter.Before)
+	}
+
+	var deliveries []WebhookDelivery
+	err := query.Find(&deliveries).Error
+	return deliveries, err
+}
+
+// DueDeliveries : le dispatcher tourne hors de tout tenant
+func (r *gormWebhookRepository) DueDeliveries(ctx context.Context, now time.Time, limit int) ([]WebhookDelivery, error) {
+	var deliveries []WebhookDelivery
+	err := dbFromContext(allTenants(ctx), r.db).
+		Where("status = ? AND next_attempt_at <= ?", DeliveryPending, now).
+		Order("next_attempt_at, id").Limit(limit).Find(&deliveries).Error
+	return deliveries, err
+}
+
+func (r *gormWebhookRepository) AddAttempt(ctx context.Context, attempt *WebhookAttempt) error {
+	return dbFromContext(ctx, r.db).Create(attempt).Error
+}
+
+func (r *gormWebhookRepository) ListAttempts(ctx context.Context, deliveryID uint) ([]WebhookAttempt, error) {
+	var attempts []WebhookAttempt
+	err := dbFromContext(ctx, r.db).Where("delivery_id = ?", deliveryID).Order("id").Find(&attempts).Error
+	return attempts, err
+}
+
+// --- En mémoire ---
+
+type memoryWebhookRepository struct {
+	s *MemoryStore
+}
+
+func (s *MemoryStore) Webhooks() WebhookRepository { return &memoryWebhookRepository{s} }
+
+func (r *memoryWebhookRepository) CreateEndpoint(_ context.Context, endpoint *WebhookEndpoint) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	endpoint.ID = r.s.nextEndpointID
+	r.s.nextEndpointID++
+	endpoint.CreatedAt = time.Now()
+	endpoint.UpdatedAt = endpoint.CreatedAt
+	e := *endpoint
+	e.Events = slices.Clone(endpoint.Events)
+	r.s.webhookEndpoints[e.ID] = e
+	return nil
+}
+
+func (r *memoryWebhookRepository) GetEndpoint(_ context.Context, id uint) (*WebhookEndpoint, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	e, ok := r.s.webhookEndpoints[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	e.Events = slices.Clone(e.Events)
+	return &e, nil
+}
+
+func (r *memoryWebhookRepository) ListEndpoints(_ context.Context) ([]WebhookEndpoint, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	var endpoints []WebhookEndpoint
+	for _, e := range r.s.webhookEndpoints {
+		e.Events = slices.Clone(e.Events)
+		endpoints = append(endpoints, e)
+	}
+	slices.SortFunc(endpoints, func(a, b WebhookEndpoint) int { return int(a.ID) - int(b.ID) })
+	return endpoints, nil
+}
+
+func (r *memoryWebhookRepository) UpdateEndpoint(_ context.Context, endpoint *WebhookEndpoint) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	e, ok := r.s.webhookEndpoints[endpoint.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	e.URL, e.Description, e.Events, e.Active = endpoint.URL, endpoint.Description, slices.Clone(endpoint.Events), endpoint.Active
+	e.Secret, e.PreviousSecret, e.PreviousSecretExpiresAt = endpoint.Secret, endpoint.PreviousSecret, endpoint.PreviousSecretExpiresAt
+	e.UpdatedAt = time.Now()
+	r.s.webhookEndpoints[e.ID] = e
+	endpoint.UpdatedAt = e.UpdatedAt
+	return nil
+}
+
+func (r *memoryWebhookRepository) DeleteEndpoint(_ context.Context, id uint) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.webhookEndpoints[id]; !ok {
+		return ErrNotFound
+	}
+	delete(r.s.webhookEndpoints, id)
+	return nil
+}
+
+func (r *memoryWebhookRepository) CreateDeliveries(_ context.Context, deliveries []WebhookDelivery) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	now := time.Now()
+	for i := range deliveries {
+		deliveries[i].ID = r.s.nextDeliveryID
+		r.s.nextDeliveryID++
+		deliveries[i].CreatedAt, deliveries[i].UpdatedAt = now, now
+		r.s.webhookDeliveries[deliveries[i].ID] = deliveries[i]
+	}
+	return nil
+}
+
+func (r *memoryWebhookRepository) GetDelivery(_ context.Context, id uint) (*WebhookDelivery, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	d, ok := r.s.webhookDeliveries[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &d, nil
+}
+
+// LockDelivery : les unités de travail en mémoire sont déjà sérialisées
+func (r *memoryWebhookRepository) LockDelivery(ctx context.Context, id uint) (*WebhookDelivery, error) {
+	return r.GetDelivery(ctx, id)
+}
+
+func (r *memoryWebhookRepository) UpdateDelivery(_ context.Context, delivery *WebhookDelivery) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	d, ok := r.s.webhookDeliveries[delivery.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	d.Status, d.NextAttemptAt, d.Attempts = delivery.Status, delivery.NextAttemptAt, delivery.Attempts
+	d.LastStatusCode, d.LastError, d.DeliveredAt = delivery.LastStatusCode, delivery.LastError, delivery.DeliveredAt
+	d.UpdatedAt = time.Now()
+	r.s.webhookDeliveries[d.ID] = d
+	delivery.UpdatedAt = d.UpdatedAt
+	return nil
+}
+
+func (r *memoryWebhookRepository) ListDeliveries(_ context.Context, filter DeliveryFilter) ([]WebhookDelivery, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	var deliveries []WebhookDelivery
+	for _, d := range r.s.webhookDeliveries {
+		if (filter.EndpointID > 0 && d.EndpointID != filter.EndpointID) ||
+			(filter.Status != "" && d.Status != filter.Status) ||
+			(filter.Before > 0 && d.ID >= filter.Before) {
+			continue
+		}
+		deliveries = append(deliveries, d)
+	}
+	slices.SortFunc(deliveries, func(a, b WebhookDelivery) int { return int(b.ID) - int(a.ID) })
+	if len(deliveries) > filter.Limit {
+		deliveries = deliveries[:filter.Limit]
+	}
+	return deliveries, nil
+}
+
+func (r *memoryWebhookRepository) DueDeliveries(_ context.Context, now time.Time, limit int) ([]WebhookDelivery, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	var deliveries []WebhookDelivery
+	for _, d := range r.s.webhookDeliveries {
+		if d.Status == DeliveryPending && d.NextAttemptAt != nil && !d.NextAttemptAt.After(now) {
+			deliveries = append(deliveries, d)
+		}
+	}
+	sortDueDeliveries(deliveries)
+	if len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+	return deliveries, nil
+}
+
+// sortDueDeliveries : les plus en retard d'abord
+func sortDueDeliveries(deliveries []WebhookDelivery) {
+	slices.SortFunc(deliveries, func(a, b WebhookDelivery) int {
+		if c := a.NextAttemptAt.Compare(*b.NextAttemptAt); c != 0 {
+			return c
+		}
+		return int(a.ID) - int(b.ID)
+	})
+}
+
+func (r *memoryWebhookRepository) AddAttempt(_ context.Context, attempt *WebhookAttempt) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	attempt.ID = r.s.nextAttemptID
+	r.s.nextAttemptID++
+	attempt.CreatedAt = time.Now()
+	r.s.webhookAttempts[attempt.ID] = *attempt
+	return nil
+}
+
+func (r *memoryWebhookRepository) ListAttempts(_ context.Context, deliveryID uint) ([]WebhookAttempt, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	var attempts []WebhookAttempt
+	for _, a := range r.s.webhookAttempts {
+		if a.DeliveryID == deliveryID {
+			attempts = append(attempts, a)
+		}
+	}
+	slices.SortFunc(attempts, func(a, b WebhookAttempt) int { return int(a.ID) - int(b.ID) })
+	return attempts, nil
+}
+
+// --- En mémoire, par tenant ---
+
+type tenantWebhookRepository struct {
+	t *MemoryTenants
+}
+
+func (t *MemoryTenants) Webhooks() WebhookRepository { return &tenantWebhookRepository{t} }
+
+func (r *tenantWebhookRepository) CreateEndpoint(ctx context.Context, endpoint *WebhookEndpoint) error {
+	s, tenant, err := r.t.store(ctx)
+	if err != nil {
+		return err
+	}
+	endpoint.TenantID = tenant
+	return s.Webhooks().CreateEndpoint(ctx, endpoint)
+}
+
+func (r *tenantWebhookRepository) GetEndpoint(ctx context.Context, id uint) (*WebhookEndpoint, error) {
+	s, _, err := r.t.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.Webhooks().GetEndpoint(ctx, id)
+}
+
+func (r *tenantWebhookRepository) ListEndpoints(ctx context.Context) ([]WebhookEndpoint, error) {
+	s, _, err := r.t.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.Webhooks().ListEndpoints(ctx)
+}
+
+func (r *tenantWebhookRepository) UpdateEndpoint(ctx context.Context, endpoint *WebhookEndpoint) error {
+	s, _, err := r.t.store(ctx)
+	if err != nil {
+		return err
+	}
+	return s.Webhooks().UpdateEndpoint(ctx, endpoint)
+}
+
+func (r *tenantWebhookRepository) DeleteEndpoint(ctx context.Context, id uint) error {
+	s, _, err := r.t.store(ctx)
+	if err != nil {
+		return err
+	}
+	return s.Webhooks().DeleteEndpoint(ctx, id)
+}
+
+func (r *tenantWebhookRepository) CreateDeliveries(ctx context.Context, deliveries []WebhookDelivery) error {
+	s, tenant, err := r.t.store(ctx)
+	if err != nil {
+		return err
+	}
+	for i := range deliveries {
+		deliveries[i].TenantID = tenant
+	}
+	return s.Webhooks().CreateDeliveries(ctx, deliveries)
+}
+
+func (r *tenantWebhookRepository) GetDelivery(ctx context.Context, id uint) (*WebhookDelivery, error) {
+	s, _, err := r.t.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.Webhooks().GetDelivery(ctx, id)
+}
+
+func (r *tenantWebhookRepository) LockDelivery(ctx context.Context, id uint) (*WebhookDelivery, error) {
+	s, _, err := r.t.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.Webhooks().LockDelivery(ctx, id)
+}
+
+func (r *tenantWebhookRepository) UpdateDelivery(ctx context.Context, delivery *WebhookDelivery) error {
+	s, _, err := r.t.store(ctx)
+	if err != nil {
+		return err
+	}
+	return s.Webhooks().UpdateDelivery(ctx, delivery)
+}
+
+func (r *tenantWebhookRepository) ListDeliveries(ctx context.Context, filter DeliveryFilter) ([]WebhookDelivery, error) {
+	s, _, err := r.t.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.Webhooks().ListDeliveries(ctx, filter)
+}
+
+func (r *tenantWebhookRepository) DueDeliveries(ctx context.Context, now time.Time, limit int) ([]WebhookDelivery, error) {
+	var deliveries []WebhookDelivery
+	for _, s := range r.t.allStores() {
+		due, err := s.Webhooks().DueDeliveries(ctx, now, limit)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, due...)
+	}
+	sortDueDeliveries(deliveries)
+	if len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+	return deliveries, nil
+}
+
+func (r *tenantWebhookRepository) AddAttempt(ctx context.Context, attempt *WebhookAttempt) error {
+	s, tenant, err := r.t.store(ctx)
+	if err != nil {
+		return err
+	}
+	attempt.TenantID = tenant
+	return s.Webhooks().AddAttempt(ctx, attempt)
+}
+
+func (r *tenantWebhookRepository) ListAttempts(ctx context.Context, deliveryID uint) ([]WebhookAttempt, error) {
+	s, _, err := r.t.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.Webhooks().ListAttempts(ctx, deliveryID)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// Endpoints de webhooks : adresses locales et privées refusées à
+// l'enregistrement et à la connexion, sauf WEBHOOK_ALLOW_PRIVATE.
+
+func TestCheckEndpoint(t *testing.T) {
+	tests := []struct {
+		name         string
+		url          string
+		allowPrivate bool
+		wantErr      error
+	}{
+		{name: "IP publique", url: "https://93.184.215.14/hooks"},
+		{name: "schéma non HTTP", url: "ftp://93.184.215.14/hooks", wantErr: ErrInvalidEndpoint},
+		{name: "localhost", url: "http://localhost:8080/hooks", wantErr: ErrPrivateEndpoint},
+		{name: "sous-domaine de localhost", url: "http://api.localhost/hooks", wantErr: ErrPrivateEndpoint},
+		{name: "bouclage", url: "http://127.0.0.1/hooks", wantErr: ErrPrivateEndpoint},
+		{name: "bouclage IPv6", url: "http://[::1]/hooks", wantErr: ErrPrivateEndpoint},
+		{name: "réseau privé", url: "http://192.168.1.10/hooks", wantErr: ErrPrivateEndpoint},
+		{name: "métadonnées du cloud", url: "http://169.254.169.254/latest/meta-data", wantErr: ErrPrivateEndpoint},
+		{name: "adresse non spécifiée", url: "http://0.0.0.0:8080/hooks", wantErr: ErrPrivateEndpoint},
+		{name: "réseau 0.0.0.0/8", url: "http://0.1.2.3/hooks", wantErr: ErrPrivateEndpoint},
+		{name: "CGNAT", url: "http://100.64.0.1/hooks", wantErr: ErrPrivateEndpoint},
+		{name: "banc de test", url: "http://198.18.0.1/hooks", wantErr: ErrPrivateEndpoint},
+		{name: "documentation", url: "http://192.0.2.10/hooks", wantErr: ErrPrivateEndpoint},
+		{name: "multicast", url: "http://224.0.0.1/hooks", wantErr: ErrPrivateEndpoint},
+		{name: "diffusion", url: "http://255.255.255.255/hooks", wantErr: ErrPrivateEndpoint},
+		{name: "IPv4 mappée (bouclage)", url: "http://[::ffff:127.0.0.1]/hooks", wantErr: ErrPrivateEndpoint},
+		{name: "IPv4 mappée (métadonnées)", url: "http://[::ffff:a9fe:a9fe]/hooks", wantErr: ErrPrivateEndpoint},
+		{name: "NAT64 vers le réseau privé", url: "http://[64:ff9b::a00:1]/hooks", wantErr: ErrPrivateEndpoint},
+		{name: "NAT64 vers une IP publique", url: "http://[64:ff9b::5db8:d70e]/hooks"},
+		{name: "6to4 vers le bouclage", url: "http://[2002:7f00:1::]/hooks", wantErr: ErrPrivateEndpoint},
+		{name: "IPv6 locale unique", url: "http://[fd00::1]/hooks", wantErr: ErrPrivateEndpoint},
+		{name: "IPv6 multicast", url: "http://[ff02::1]/hooks", wantErr: ErrPrivateEndpoint},
+		{name: "IPv6 publique", url: "http://[2606:4700::1111]/hooks"},
+		{name: "simulateur local autorisé", url: "http://localhost:8083/_sim/webhooks/a", allowPrivate: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkEndpoint(context.Background(), tt.url, []string{"*"}, tt.allowPrivate)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("checkEndpoint(%q) = %v, attendu %v", tt.url, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWebhookClientPrivateAddress(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name         string
+		allowPrivate bool
+		wantErr      error
+	}{
+		{name: "connexion refusée", wantErr: ErrPrivateEndpoint},
+		{name: "autorisée (WEBHOOK_ALLOW_PRIVATE)", allowPrivate: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewWebhookService(nil, nil, WebhookConfig{Timeout: 5 * time.Second, AllowPrivate: tt.allowPrivate})
+			resp, err := s.client.Post(server.URL, "application/json", nil)
+			if err == nil {
+				resp.Body.Close()
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("POST %s = %v, attendu %v", server.URL, err, tt.wantErr)
+			}
+		})
+	}
+}